@@ -3,6 +3,7 @@ package version_one
 import (
 	"errors"
 	"github.com/gin-gonic/gin"
+	"github.com/soxft/openid-go/app/service"
 	"github.com/soxft/openid-go/library/apiutil"
 	"github.com/soxft/openid-go/library/apputil"
 	"strings"
@@ -16,12 +17,12 @@ func AppInfo(c *gin.Context) {
 	api := apiutil.New(c)
 
 	// get app info
-	if appInfo, err := apputil.GetAppInfo(appId); err != nil {
+	if appInfo, err := service.From(c).Apps.Info(appId); err != nil {
 		if errors.Is(err, apputil.ErrAppNotExist) {
-			api.Fail("app not exist")
+			api.Fail(apiutil.CodeAppNotFound, "app not exist")
 			return
 		}
-		api.Fail("system error")
+		api.Fail(apiutil.CodeInternal, "system error")
 		return
 	} else {
 		api.SuccessWithData("success", gin.H{
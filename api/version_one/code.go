@@ -6,7 +6,7 @@ import (
 	"net/url"
 
 	"github.com/gin-gonic/gin"
-	"github.com/soxft/openid-go/api/version_one/helper"
+	"github.com/soxft/openid-go/app/service"
 	"github.com/soxft/openid-go/library/apiutil"
 	"github.com/soxft/openid-go/library/apputil"
 )
@@ -29,7 +29,7 @@ func Code(c *gin.Context) {
 
 	var req CodeRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		api.Fail("Invalid params")
+		api.Fail(apiutil.CodeInvalidParams, "Invalid params")
 		return
 	}
 
@@ -37,43 +37,49 @@ func Code(c *gin.Context) {
 	var err error
 	var redirectUriDomain *url.URL
 	if redirectUriDomain, err = url.Parse(req.RedirectUri); err != nil {
-		api.Fail("Invalid redirect_uri")
+		api.Fail(apiutil.CodeRedirectUriInvalid, "Invalid redirect_uri")
 		return
 	} else if redirectUriDomain.Host == "" {
-		api.Fail("Invalid redirect_uri")
+		api.Fail(apiutil.CodeRedirectUriInvalid, "Invalid redirect_uri")
 		return
 	}
 
 	// get app Info
-	var appInfo apputil.AppFullInfoStruct
-	if appInfo, err = apputil.GetAppInfo(req.AppId); err != nil {
+	var appInfo apputil.AppInfoStruct
+	if appInfo, err = service.From(c).Apps.Info(req.AppId); err != nil {
 		if errors.Is(err, apputil.ErrAppNotExist) {
-			api.Fail("app not exist")
+			api.Fail(apiutil.CodeAppNotFound, "app not exist")
 			return
 		}
-		api.Fail("system error")
+		api.Fail(apiutil.CodeInternal, "system error")
 		return
 	}
 
 	// 获取 app gateway
 	appGateWay := appInfo.AppGateway
 	if appGateWay == "" {
-		api.Fail("Invalid appGateWay, setting it first")
+		api.Fail(apiutil.CodeAppGatewayNotSet, "Invalid appGateWay, setting it first")
 		return
 	}
 
 	// 判断是否一致
 	if !apputil.CheckRedirectUriIsMatchUserGateway(redirectUriDomain.Host, appGateWay) {
-		api.FailWithData("redirect_uri is not match with appGateWay", gin.H{
+		api.FailWithData(apiutil.CodeRedirectUriMismatch, "redirect_uri is not match with appGateWay", gin.H{
 			"legal": appGateWay,
 			"given": redirectUriDomain.Host,
 		})
 		return
 	}
-	token, err := helper.GenerateToken(c, req.AppId, c.GetInt("userId"))
+	// 封禁的账号不允许授权
+	if err := service.From(c).Users.CheckSuspended(c, c.GetInt("userId")); err != nil {
+		api.Fail(suspendedCode(err), err.Error())
+		return
+	}
+
+	token, err := service.From(c).Grants.CreateToken(c, req.AppId, c.GetInt("userId"))
 	if err != nil {
 		log.Printf("[ERROR] get app info error: %s", err.Error())
-		api.Fail("system error")
+		api.Fail(apiutil.CodeInternal, "system error")
 		return
 	}
 
@@ -8,16 +8,15 @@ import (
 	"github.com/soxft/openid-go/config"
 	"github.com/soxft/openid-go/library/apputil"
 	"github.com/soxft/openid-go/library/toolutil"
-	"github.com/soxft/openid-go/process/dbutil"
-	"github.com/soxft/openid-go/process/redisutil"
 	"gorm.io/gorm"
 	"log"
+	"strconv"
 )
 
 // GetUserIdByToken
 // 通过Token和appid 获取用户ID
-func GetUserIdByToken(ctx context.Context, appId string, token string) (int, error) {
-	_redis := redisutil.RDB
+func GetUserIdByToken(ctx context.Context, rdb redis.Cmdable, appId string, token string) (int, error) {
+	_redis := rdb
 
 	userId, err := _redis.Get(ctx, getTokenRedisKey(appId, token)).Int()
 	if err != nil {
@@ -34,16 +33,16 @@ func GetUserIdByToken(ctx context.Context, appId string, token string) (int, err
 
 // GetUserIds
 // @description 获取用户ID
-func GetUserIds(appId string, userId int) (UserIdsStruct, error) {
-	openId, err := getUserOpenId(appId, userId)
+func GetUserIds(db *gorm.DB, rdb redis.Cmdable, appId string, userId int) (UserIdsStruct, error) {
+	openId, err := getUserOpenId(db, rdb, appId, userId)
 	if err != nil {
 		return UserIdsStruct{}, err
 	}
-	appInfo, err := apputil.GetAppInfo(appId)
+	appInfo, err := apputil.GetAppInfo(db, rdb, appId)
 	if err != nil {
 		return UserIdsStruct{}, err
 	}
-	uniqueId, err := getUserUniqueId(userId, appInfo.AppUserId)
+	uniqueId, err := getUserUniqueId(db, rdb, userId, appInfo.AppUserId)
 	if err != nil {
 		return UserIdsStruct{}, err
 	}
@@ -54,8 +53,8 @@ func GetUserIds(appId string, userId int) (UserIdsStruct, error) {
 	}, nil
 }
 
-func DeleteToken(ctx context.Context, appId string, token string) error {
-	_redis := redisutil.RDB
+func DeleteToken(ctx context.Context, rdb redis.Cmdable, appId string, token string) error {
+	_redis := rdb
 
 	if err := _redis.Del(ctx, getTokenRedisKey(appId, token)).Err(); err != nil {
 		log.Printf("[ERROR] DeleteToken error: %s", err)
@@ -66,32 +65,53 @@ func DeleteToken(ctx context.Context, appId string, token string) error {
 
 // GetUserOpenId
 // 获取 用户openID
-func getUserOpenId(appId string, userId int) (string, error) {
-	var openId string
-	err := dbutil.D.Model(&model.OpenId{}).Where(model.OpenId{AppId: appId, UserId: userId}).Select("open_id").First(&openId).Error
-
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return generateOpenId(appId, userId)
-	} else if err != nil {
-		log.Printf("[ERROR] GetUserOpenId error: %s", err)
-		return "", errors.New("server error")
+func getUserOpenId(db *gorm.DB, rdb redis.Cmdable, appId string, userId int) (string, error) {
+	if isPairwise() && !config.OpenId.Legacy {
+		return pairwiseOpenId(appId, userId), nil
 	}
-	return openId, nil
+
+	key := appId + ":" + strconv.Itoa(userId)
+	return apputil.OpenIdCache.Get(context.Background(), rdb, key, func() (string, error) {
+		var openId string
+		err := db.Model(&model.OpenId{}).Where(model.OpenId{AppId: appId, UserId: userId}).Select("open_id").First(&openId).Error
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if isPairwise() {
+				// 无历史记录, 使用计算值 (结果同样被缓存, 之后不再查表)
+				return pairwiseOpenId(appId, userId), nil
+			}
+			return generateOpenId(db, appId, userId)
+		} else if err != nil {
+			log.Printf("[ERROR] GetUserOpenId error: %s", err)
+			return "", errors.New("server error")
+		}
+		return openId, nil
+	})
 }
 
 // getUserUniqueId
 // 获取用户UniqueId
-func getUserUniqueId(userId, DevUserId int) (string, error) {
-	var uniqueId string
-	err := dbutil.D.Model(&model.UniqueId{}).Where(model.UniqueId{UserId: userId, DevUserId: DevUserId}).Select("unique_id").First(&uniqueId).Error
-
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return generateUniqueId(userId, DevUserId)
-	} else if err != nil {
-		log.Printf("[ERROR] GetUserUniqueId error: %s", err)
-		return "", errors.New("server error")
+func getUserUniqueId(db *gorm.DB, rdb redis.Cmdable, userId, DevUserId int) (string, error) {
+	if isPairwise() && !config.OpenId.Legacy {
+		return pairwiseUniqueId(userId, DevUserId), nil
 	}
-	return uniqueId, nil
+
+	key := strconv.Itoa(userId) + ":" + strconv.Itoa(DevUserId)
+	return apputil.UniqueIdCache.Get(context.Background(), rdb, key, func() (string, error) {
+		var uniqueId string
+		err := db.Model(&model.UniqueId{}).Where(model.UniqueId{UserId: userId, DevUserId: DevUserId}).Select("unique_id").First(&uniqueId).Error
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if isPairwise() {
+				return pairwiseUniqueId(userId, DevUserId), nil
+			}
+			return generateUniqueId(db, userId, DevUserId)
+		} else if err != nil {
+			log.Printf("[ERROR] GetUserUniqueId error: %s", err)
+			return "", errors.New("server error")
+		}
+		return uniqueId, nil
+	})
 }
 
 func getTokenRedisKey(appId string, token string) string {
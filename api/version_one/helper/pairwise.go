@@ -0,0 +1,36 @@
+package helper
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"strconv"
+
+	"github.com/soxft/openid-go/config"
+	"github.com/soxft/openid-go/library/randutil"
+)
+
+// isPairwise 是否以 HMAC 计算 openId / uniqueId
+func isPairwise() bool {
+	return config.OpenId.Mode == "pairwise"
+}
+
+// pairwiseOpenId openId 的扇区为应用
+func pairwiseOpenId(appId string, userId int) string {
+	return pairwiseId("app:"+appId, userId)
+}
+
+// pairwiseUniqueId uniqueId 的扇区为开发者, 同一开发者的所有应用得到相同的值
+func pairwiseUniqueId(userId, devUserId int) string {
+	return pairwiseId("dev:"+strconv.Itoa(devUserId), userId)
+}
+
+// pairwiseId
+// 参考 OIDC Core 8.1 Pairwise Identifier Algorithm, 对 扇区标识 + 用户 ID 计算 HMAC-SHA256,
+// 截取前 160 位编码, 结果对同一扇区稳定且无法在扇区之间关联
+func pairwiseId(sector string, userId int) string {
+	mac := hmac.New(sha256.New, []byte(config.OpenId.PairwiseKey))
+	mac.Write([]byte(sector))
+	mac.Write([]byte{0})
+	mac.Write([]byte(strconv.Itoa(userId)))
+	return randutil.EncodeBase32(mac.Sum(nil)[:20])
+}
@@ -0,0 +1,144 @@
+package helper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/soxft/openid-go/app/model"
+	"github.com/soxft/openid-go/config"
+	"github.com/soxft/openid-go/process/dbutil"
+	"github.com/soxft/openid-go/process/dbutil/migration"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const testPairwiseKey = "0123456789abcdef0123456789abcdef"
+
+// setup 使用内存 SQLite 与 miniredis, 并创建开发者 devUserId 名下的应用
+func setup(t *testing.T, openId config.OpenIdConfig, devUserId int, appIds ...string) (*gorm.DB, redis.Cmdable) {
+	t.Helper()
+
+	if err := config.Apply(&config.Config{
+		RedisConfig:  config.RedisConfig{Prefix: "openid"},
+		OpenIdConfig: openId,
+	}); err != nil {
+		t.Fatalf("apply config: %v", err)
+	}
+
+	db, err := dbutil.Open(dbutil.DriverSqlite, "file:"+t.Name()+"?mode=memory&cache=shared", &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	sqlDb, _ := db.DB()
+	sqlDb.SetMaxOpenConns(1)
+	if _, err := migration.New(db).Up(0); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	for _, appId := range appIds {
+		if err := db.Create(&model.App{UserId: devUserId, AppId: appId, AppName: appId, AppSecret: "secret-" + appId}).Error; err != nil {
+			t.Fatalf("create app: %v", err)
+		}
+	}
+
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() {
+		_ = rdb.Close()
+		_ = sqlDb.Close()
+	})
+	return db, rdb
+}
+
+func mustUserIds(t *testing.T, db *gorm.DB, rdb redis.Cmdable, appId string, userId int) UserIdsStruct {
+	t.Helper()
+
+	ids, err := GetUserIds(db, rdb, appId, userId)
+	if err != nil {
+		t.Fatalf("GetUserIds(%s, %d): %v", appId, userId, err)
+	}
+	return ids
+}
+
+func TestPairwiseStable(t *testing.T) {
+	db, rdb := setup(t, config.OpenIdConfig{Mode: "pairwise", PairwiseKey: testPairwiseKey}, 1, "202401010000000101")
+
+	first := mustUserIds(t, db, rdb, "202401010000000101", 101)
+	second := mustUserIds(t, db, rdb, "202401010000000101", 101)
+	if first != second {
+		t.Fatalf("ids changed between calls: %+v, %+v", first, second)
+	}
+	// 不依赖缓存, 直接计算也得到相同的值
+	if first.OpenId != pairwiseOpenId("202401010000000101", 101) || first.UniqueId != pairwiseUniqueId(101, 1) {
+		t.Fatalf("ids = %+v, not the computed values", first)
+	}
+
+	var count int64
+	db.Model(&model.OpenId{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("%d open ids stored in pairwise mode", count)
+	}
+
+	other := mustUserIds(t, db, rdb, "202401010000000101", 102)
+	if other.OpenId == first.OpenId || other.UniqueId == first.UniqueId {
+		t.Fatalf("different users share ids: %+v, %+v", first, other)
+	}
+}
+
+func TestPairwiseSectors(t *testing.T) {
+	db, rdb := setup(t, config.OpenIdConfig{Mode: "pairwise", PairwiseKey: testPairwiseKey}, 2, "202401010000000201", "202401010000000202")
+
+	a := mustUserIds(t, db, rdb, "202401010000000201", 201)
+	b := mustUserIds(t, db, rdb, "202401010000000202", 201)
+	if a.OpenId == b.OpenId {
+		t.Fatalf("different apps share openId %s", a.OpenId)
+	}
+	// 同一开发者的应用 uniqueId 相同
+	if a.UniqueId != b.UniqueId {
+		t.Fatalf("uniqueId differs across apps of one developer: %s, %s", a.UniqueId, b.UniqueId)
+	}
+
+	// 更换密钥后计算值全部变化
+	config.OpenId.PairwiseKey = strings.Repeat("k", 32)
+	if pairwiseOpenId("202401010000000201", 201) == a.OpenId {
+		t.Fatal("openId does not depend on PairwiseKey")
+	}
+}
+
+func TestRandomMode(t *testing.T) {
+	db, rdb := setup(t, config.OpenIdConfig{Mode: "random"}, 3, "202401010000000301")
+
+	ids := mustUserIds(t, db, rdb, "202401010000000301", 301)
+	if ids.OpenId == pairwiseOpenId("202401010000000301", 301) {
+		t.Fatal("random mode returned the pairwise openId")
+	}
+
+	var stored model.OpenId
+	if err := db.Where(model.OpenId{AppId: "202401010000000301", UserId: 301}).Take(&stored).Error; err != nil {
+		t.Fatalf("open id not stored: %v", err)
+	}
+	if stored.OpenId != ids.OpenId {
+		t.Fatalf("stored openId = %s, returned %s", stored.OpenId, ids.OpenId)
+	}
+	var unique model.UniqueId
+	if err := db.Where(model.UniqueId{UserId: 301, DevUserId: 3}).Take(&unique).Error; err != nil || unique.UniqueId != ids.UniqueId {
+		t.Fatalf("stored uniqueId = %q (%v), returned %s", unique.UniqueId, err, ids.UniqueId)
+	}
+}
+
+func TestPairwiseLegacy(t *testing.T) {
+	db, rdb := setup(t, config.OpenIdConfig{Mode: "pairwise", PairwiseKey: testPairwiseKey, Legacy: true}, 4, "202401010000000401")
+	if err := db.Create(&model.OpenId{AppId: "202401010000000401", UserId: 401, OpenId: "legacy-open-id"}).Error; err != nil {
+		t.Fatalf("create open id: %v", err)
+	}
+
+	// 已入库的组合返回原值, 没有记录的使用计算值
+	if ids := mustUserIds(t, db, rdb, "202401010000000401", 401); ids.OpenId != "legacy-open-id" {
+		t.Fatalf("legacy openId = %s", ids.OpenId)
+	}
+	if ids := mustUserIds(t, db, rdb, "202401010000000401", 402); ids.OpenId != pairwiseOpenId("202401010000000401", 402) {
+		t.Fatalf("new openId = %s, want computed", ids.OpenId)
+	}
+}
@@ -5,8 +5,10 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/soxft/openid-go/api/version_one/helper"
+	"github.com/soxft/openid-go/app/service"
 	"github.com/soxft/openid-go/library/apiutil"
 	"github.com/soxft/openid-go/library/apputil"
+	"github.com/soxft/openid-go/library/userutil"
 )
 
 type InfoRequest struct {
@@ -28,35 +30,58 @@ func Info(c *gin.Context) {
 
 	var req InfoRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		api.Fail("Invalid params")
+		api.Fail(apiutil.CodeInvalidParams, "Invalid params")
 		return
 	}
 
+	svc := service.From(c)
+
 	// 判断appId与appSecret是否正确
-	if err := apputil.CheckAppSecret(req.AppId, req.AppSecret); err != nil {
-		api.Fail(err.Error())
+	if err := svc.Apps.CheckSecret(req.AppId, req.AppSecret); errors.Is(err, apputil.ErrAppNotExist) {
+		api.Fail(apiutil.CodeAppNotFound, err.Error())
+		return
+	} else if errors.Is(err, apputil.ErrAppSecretNotMatch) {
+		api.Fail(apiutil.CodeAppSecretInvalid, err.Error())
+		return
+	} else if err != nil {
+		api.Fail(apiutil.CodeInternal, err.Error())
 		return
 	}
 
 	// 检测token是否正确 并获取userId
-	userId, err := helper.GetUserIdByToken(c, req.AppId, req.Token)
+	userId, err := svc.Grants.UserIdByToken(c, req.AppId, req.Token)
 	if err != nil {
 		if errors.Is(err, helper.ErrTokenNotExists) {
-			api.Fail("Token not exists")
+			api.Fail(apiutil.CodeTokenInvalid, "Token not exists")
 			return
 		}
-		api.Fail(err.Error())
+		api.Fail(apiutil.CodeInternal, err.Error())
+		return
+	}
+	// token 签发后账号被封禁
+	if err := svc.Users.CheckSuspended(c, userId); err != nil {
+		_ = svc.Grants.DeleteToken(c, req.AppId, req.Token)
+		api.Fail(suspendedCode(err), err.Error())
 		return
 	}
-	userIds, err := helper.GetUserIds(req.AppId, userId)
+
+	userIds, err := svc.Grants.UserIds(req.AppId, userId)
 	if err != nil {
-		api.Fail(err.Error())
+		api.Fail(apiutil.CodeInternal, err.Error())
 		return
 	}
 	// delete token
-	_ = helper.DeleteToken(c, req.AppId, req.Token)
+	_ = svc.Grants.DeleteToken(c, req.AppId, req.Token)
 	api.SuccessWithData("success", InfoResponse{
 		OpenId:   userIds.OpenId,
 		UniqueId: userIds.UniqueId,
 	})
 }
+
+// suspendedCode CheckSuspended 失败时的错误码
+func suspendedCode(err error) apiutil.Code {
+	if errors.Is(err, userutil.ErrAccountSuspended) {
+		return apiutil.CodeAccountSuspended
+	}
+	return apiutil.CodeInternal
+}
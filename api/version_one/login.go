@@ -16,7 +16,7 @@ func Login(c *gin.Context) {
 	appid := c.DefaultQuery("appid", "")
 	redirectUri := c.DefaultQuery("redirect_uri", "")
 	if appid == "" || redirectUri == "" {
-		api.Fail("Invalid params")
+		api.Fail(apiutil.CodeInvalidParams, "Invalid params")
 		return
 	}
 
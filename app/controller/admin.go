@@ -0,0 +1,389 @@
+package controller
+
+import (
+	"encoding/csv"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/soxft/openid-go/app/dto"
+	"github.com/soxft/openid-go/app/service"
+	"github.com/soxft/openid-go/library/apiutil"
+	"github.com/soxft/openid-go/library/apputil"
+	"github.com/soxft/openid-go/library/auditutil"
+	"github.com/soxft/openid-go/library/userutil"
+)
+
+// AdminUserList
+// @description 搜索用户
+// @route GET /admin/users
+func AdminUserList(c *gin.Context) {
+	api := apiutil.New(c)
+	limit, offset := getPagination(c)
+
+	users, total, err := service.From(c).Users.Search(c.Query("keyword"), limit, offset)
+	if err != nil {
+		api.Fail(apiutil.CodeInternal, "system error")
+		return
+	}
+
+	api.SuccessWithData("success", gin.H{
+		"total": total,
+		"list":  users,
+	})
+}
+
+// AdminUserInfo
+// @description 获取用户详情
+// @route GET /admin/users/:id
+func AdminUserInfo(c *gin.Context) {
+	api := apiutil.New(c)
+
+	userId, ok := getAdminTargetUserId(api)
+	if !ok {
+		return
+	}
+
+	user, err := service.From(c).Users.AdminInfo(userId)
+	if errors.Is(err, userutil.ErrUserNotFound) {
+		api.Fail(apiutil.CodeUserNotFound, "用户不存在")
+		return
+	} else if err != nil {
+		api.Fail(apiutil.CodeInternal, "system error")
+		return
+	}
+
+	api.SuccessWithData("success", user)
+}
+
+// AdminUserSessions
+// @description 获取用户的登录会话
+// @route GET /admin/users/:id/sessions
+func AdminUserSessions(c *gin.Context) {
+	api := apiutil.New(c)
+
+	userId, ok := getAdminTargetUserId(api)
+	if !ok {
+		return
+	}
+
+	sessions, err := service.From(c).Tokens.Sessions(c, userId)
+	if err != nil {
+		api.Fail(apiutil.CodeInternal, "system error")
+		return
+	}
+
+	api.SuccessWithData("success", sessions)
+}
+
+// AdminUserSessionsRevoke
+// @description 吊销用户的全部会话
+// @route DELETE /admin/users/:id/sessions
+func AdminUserSessionsRevoke(c *gin.Context) {
+	api := apiutil.New(c)
+
+	userId, ok := getAdminTargetUserId(api)
+	if !ok {
+		return
+	}
+
+	if err := service.From(c).Tokens.RevokeAll(c, userId); err != nil {
+		api.Fail(apiutil.CodeInternal, "system error")
+		return
+	}
+	recordAdminEvent(c, auditutil.ActionSessionsRevoke, userId, "")
+
+	api.Success("success")
+}
+
+// AdminUserPasskeys
+// @description 获取用户绑定的 Passkey
+// @route GET /admin/users/:id/passkeys
+func AdminUserPasskeys(c *gin.Context) {
+	api := apiutil.New(c)
+
+	userId, ok := getAdminTargetUserId(api)
+	if !ok {
+		return
+	}
+
+	passkeys, err := service.From(c).Passkeys.List(userId)
+	if err != nil {
+		log.Printf("[ERROR] passkey list failed: %v", err)
+		api.Fail(apiutil.CodeInternal, "system error")
+		return
+	}
+
+	api.SuccessWithData("success", passkeySummaries(passkeys))
+}
+
+// AdminUserApps
+// @description 获取用户创建的应用
+// @route GET /admin/users/:id/apps
+func AdminUserApps(c *gin.Context) {
+	api := apiutil.New(c)
+
+	userId, ok := getAdminTargetUserId(api)
+	if !ok {
+		return
+	}
+	limit, offset := getPagination(c)
+
+	apps := service.From(c).Apps
+	total, err := apps.Count(userId)
+	if err != nil {
+		api.Fail(apiutil.CodeInternal, "system error")
+		return
+	}
+	list, err := apps.List(userId, limit, offset)
+	if err != nil {
+		api.Fail(apiutil.CodeInternal, "system error")
+		return
+	}
+	if list == nil {
+		list = []apputil.AppBaseStruct{}
+	}
+
+	api.SuccessWithData("success", gin.H{
+		"total": total,
+		"list":  list,
+	})
+}
+
+// AdminUserSuspend
+// @description 封禁账号
+// @route PUT /admin/users/:id/suspend
+func AdminUserSuspend(c *gin.Context) {
+	var req dto.AdminUserSuspendRequest
+	api := apiutil.New(c)
+
+	if err := dto.BindJSON(c, &req); err != nil {
+		api.Fail(apiutil.CodeInvalidParams, "请求参数错误")
+		return
+	}
+
+	userId, ok := getAdminTargetUserId(api)
+	if !ok {
+		return
+	}
+	if userId == c.GetInt("userId") {
+		api.Fail(apiutil.CodeSuspendSelf, "不能封禁自己")
+		return
+	}
+	if req.Until != 0 && req.Until <= time.Now().Unix() {
+		api.Fail(apiutil.CodeSuspendUntilInvalid, "解封时间应晚于当前时间")
+		return
+	}
+
+	if err := service.From(c).Users.Suspend(c, userId, req.Reason, req.Until); errors.Is(err, userutil.ErrUserNotFound) {
+		api.Fail(apiutil.CodeUserNotFound, "用户不存在")
+		return
+	} else if err != nil {
+		api.Fail(apiutil.CodeInternal, "system error")
+		return
+	}
+	recordAdminEvent(c, auditutil.ActionAccountSuspend, userId, req.Reason)
+
+	api.Success("success")
+}
+
+// AdminUserUnsuspend
+// @description 解除封禁
+// @route DELETE /admin/users/:id/suspend
+func AdminUserUnsuspend(c *gin.Context) {
+	api := apiutil.New(c)
+
+	userId, ok := getAdminTargetUserId(api)
+	if !ok {
+		return
+	}
+
+	if err := service.From(c).Users.Unsuspend(c, userId); errors.Is(err, userutil.ErrUserNotFound) {
+		api.Fail(apiutil.CodeUserNotFound, "用户不存在")
+		return
+	} else if err != nil {
+		api.Fail(apiutil.CodeInternal, "system error")
+		return
+	}
+	recordAdminEvent(c, auditutil.ActionAccountUnsuspend, userId, "")
+
+	api.Success("success")
+}
+
+// AdminUserPasswordReset
+// @description 强制用户重置密码
+// @route POST /admin/users/:id/password/reset
+func AdminUserPasswordReset(c *gin.Context) {
+	api := apiutil.New(c)
+
+	userId, ok := getAdminTargetUserId(api)
+	if !ok {
+		return
+	}
+
+	if err := service.From(c).Users.ForcePasswordReset(c, userId); errors.Is(err, userutil.ErrUserNotFound) {
+		api.Fail(apiutil.CodeUserNotFound, "用户不存在")
+		return
+	} else if err != nil {
+		api.Fail(apiutil.CodeInternal, "system error")
+		return
+	}
+	recordAdminEvent(c, auditutil.ActionPasswordForceReset, userId, "")
+
+	api.Success("success")
+}
+
+// AdminAppList
+// @description 搜索应用
+// @route GET /admin/apps
+func AdminAppList(c *gin.Context) {
+	api := apiutil.New(c)
+	limit, offset := getPagination(c)
+
+	apps, total, err := service.From(c).Apps.Search(c.Query("keyword"), limit, offset)
+	if err != nil {
+		api.Fail(apiutil.CodeInternal, "system error")
+		return
+	}
+
+	api.SuccessWithData("success", gin.H{
+		"total": total,
+		"list":  apps,
+	})
+}
+
+// AdminAppDel
+// @description 删除应用
+// @route DELETE /admin/apps/:appid
+func AdminAppDel(c *gin.Context) {
+	api := apiutil.New(c)
+	appId := c.Param("appid")
+
+	apps := service.From(c).Apps
+
+	if _, err := apps.Info(appId); errors.Is(err, apputil.ErrAppNotExist) {
+		api.Fail(apiutil.CodeAppNotFound, "应用不存在")
+		return
+	} else if err != nil {
+		api.Fail(apiutil.CodeInternal, "system error")
+		return
+	}
+
+	if err := apps.Delete(appId, auditutil.FromContext(c)); err != nil {
+		api.Fail(apiutil.CodeInternal, "system error")
+		return
+	}
+
+	api.Success("删除成功")
+}
+
+// AdminAuditList
+// @description 查询审计日志
+// @route GET /admin/audit
+func AdminAuditList(c *gin.Context) {
+	api := apiutil.New(c)
+	limit, offset := getPagination(c)
+
+	logs, total, err := service.From(c).Audit.List(getAuditFilter(c), limit, offset)
+	if err != nil {
+		api.Fail(apiutil.CodeInternal, "system error")
+		return
+	}
+
+	api.SuccessWithData("success", gin.H{
+		"total": total,
+		"list":  logs,
+	})
+}
+
+// AdminAuditExport
+// @description 按查询条件导出审计日志 (CSV)
+// @route GET /admin/audit/export
+func AdminAuditExport(c *gin.Context) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", "attachment; filename=audit-"+time.Now().Format("20060102150405")+".csv")
+	c.Status(200)
+
+	w := csv.NewWriter(c.Writer)
+	_ = w.Write([]string{"id", "time", "action", "result", "actor_id", "user_id", "target_type", "target_id", "ip", "user_agent", "detail"})
+
+	err := service.From(c).Audit.Each(getAuditFilter(c), 500, func(logs []auditutil.Log) error {
+		for _, l := range logs {
+			_ = w.Write([]string{
+				strconv.FormatInt(l.ID, 10),
+				time.Unix(l.CreatedAt, 0).Format(time.RFC3339),
+				l.Action,
+				l.Result,
+				strconv.Itoa(l.ActorId),
+				strconv.Itoa(l.UserId),
+				l.TargetType,
+				l.TargetId,
+				l.Ip,
+				l.UserAgent,
+				l.Detail,
+			})
+		}
+		w.Flush()
+		return w.Error()
+	})
+	if err != nil {
+		// 响应头已发送, 只能中断输出
+		log.Printf("[ERROR] AdminAuditExport: %v", err)
+	}
+	w.Flush()
+}
+
+// getAuditFilter 从 query 中获取审计日志查询条件
+func getAuditFilter(c *gin.Context) auditutil.Filter {
+	actorId, _ := strconv.Atoi(c.Query("actor_id"))
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	from, _ := strconv.ParseInt(c.Query("from"), 10, 64)
+	to, _ := strconv.ParseInt(c.Query("to"), 10, 64)
+
+	return auditutil.Filter{
+		Action:     c.Query("action"),
+		ActorId:    actorId,
+		UserId:     userId,
+		TargetType: c.Query("target_type"),
+		TargetId:   c.Query("target_id"),
+		Ip:         c.Query("ip"),
+		Result:     c.Query("result"),
+		From:       from,
+		To:         to,
+	}
+}
+
+// recordAdminEvent 记录管理员对用户的操作
+func recordAdminEvent(c *gin.Context, action string, userId int, detail string) {
+	service.From(c).Audit.Record(auditutil.FromContext(c), auditutil.Entry{
+		Action:     action,
+		UserId:     userId,
+		TargetType: auditutil.TargetUser,
+		TargetId:   strconv.Itoa(userId),
+		Detail:     detail,
+	})
+}
+
+func getAdminTargetUserId(api *apiutil.Api) (int, bool) {
+	userId, err := strconv.Atoi(api.Ctx.Param("id"))
+	if err != nil || userId <= 0 {
+		api.Fail(apiutil.CodeInvalidParams, "invalid id")
+		return 0, false
+	}
+	return userId, true
+}
+
+// getPagination 从 query 中获取分页参数
+func getPagination(c *gin.Context) (limit, offset int) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err = strconv.Atoi(c.DefaultQuery("per_page", "10"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 10
+	}
+	return limit, (page - 1) * limit
+}
@@ -9,10 +9,10 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/soxft/openid-go/app/dto"
-	"github.com/soxft/openid-go/app/model"
+	"github.com/soxft/openid-go/app/service"
 	"github.com/soxft/openid-go/library/apiutil"
 	"github.com/soxft/openid-go/library/apputil"
-	"github.com/soxft/openid-go/process/dbutil"
+	"github.com/soxft/openid-go/library/auditutil"
 )
 
 // AppCreate
@@ -23,17 +23,20 @@ func AppCreate(c *gin.Context) {
 	api := apiutil.New(c)
 	
 	if err := dto.BindJSON(c, &req); err != nil {
-		api.Fail("请求参数错误")
+		api.Fail(apiutil.CodeInvalidParams, "请求参数错误")
 		return
 	}
 	
 	if !apputil.CheckName(req.AppName) {
-		api.Fail("应用名称不合法")
+		api.Fail(apiutil.CodeAppNameInvalid, "应用名称不合法")
 		return
 	}
 	// 创建应用
-	if success, err := apputil.CreateApp(c.GetInt("userId"), req.AppName); !success {
-		api.Fail(err.Error())
+	if err := service.From(c).Apps.Create(c.GetInt("userId"), req.AppName); errors.Is(err, apputil.ErrAppLimitExceeded) {
+		api.Fail(apiutil.CodeAppLimitExceeded, err.Error())
+		return
+	} else if err != nil {
+		api.Fail(apiutil.CodeInternal, err.Error())
 		return
 	}
 
@@ -49,21 +52,21 @@ func AppEdit(c *gin.Context) {
 	api := apiutil.New(c)
 	
 	if err := dto.BindJSON(c, &req); err != nil {
-		api.Fail("请求参数错误")
+		api.Fail(apiutil.CodeInvalidParams, "请求参数错误")
 		return
 	}
 	
 	// 参数合法性检测
 	if !apputil.CheckName(req.AppName) {
-		api.Fail("应用名称不合法")
+		api.Fail(apiutil.CodeAppNameInvalid, "应用名称不合法")
 		return
 	}
 
 	if len(req.AppGateway) == 0 {
-		api.Fail("网关不能为空")
+		api.Fail(apiutil.CodeAppGatewayInvalid, "网关不能为空")
 		return
 	} else if len(req.AppGateway) > 200 {
-		api.Fail("网关长度不能超过 200字符")
+		api.Fail(apiutil.CodeAppGatewayInvalid, "网关长度不能超过 200字符")
 		return
 	}
 
@@ -77,29 +80,20 @@ func AppEdit(c *gin.Context) {
 			continue
 		}
 		if !apputil.CheckGateway(gateway) {
-			apiutil.New(c).Fail(fmt.Sprintf("网关 %s 不合法", gateway))
+			api.Fail(apiutil.CodeAppGatewayInvalid, fmt.Sprintf("网关 %s 不合法", gateway))
 			return
 		}
 		gateways = append(gateways, gateway)
 
 		if gateWayCount++; gateWayCount > 10 {
-			api.Fail("网关数量不能超过 10 个")
+			api.Fail(apiutil.CodeAppGatewayInvalid, "网关数量不能超过 10 个")
 			return
 		}
 	}
 
 	// Do Update
-	err := dbutil.D.Model(model.App{}).
-		Where(model.App{
-			AppId: appId,
-		}).
-		Updates(model.App{
-			AppName:    req.AppName,
-			AppGateway: strings.Join(gateways, ","),
-		}).Error
-	if err != nil {
-		log.Printf("[ERROR] db.Exec err: %v", err)
-		api.Fail("system error")
+	if err := service.From(c).Apps.Update(appId, req.AppName, gateways); err != nil {
+		api.Fail(apiutil.CodeInternal, "system error")
 		return
 	}
 	api.Success("修改成功")
@@ -113,10 +107,10 @@ func AppDel(c *gin.Context) {
 	api := apiutil.New(c)
 
 	// delete
-	if success, err := apputil.DeleteUserApp(appId); !success {
-		api.Fail(err.Error())
+	if err := service.From(c).Apps.Delete(appId, auditutil.FromContext(c)); errors.Is(err, apputil.ErrAppNotExist) {
+		api.Fail(apiutil.CodeAppNotFound, err.Error())
 	} else if err != nil {
-		api.Fail("system error")
+		api.Fail(apiutil.CodeInternal, err.Error())
 	} else {
 		api.Success("删除成功")
 	}
@@ -130,9 +124,9 @@ func AppReGenerateSecret(c *gin.Context) {
 	api := apiutil.New(c)
 
 	// re generate secret
-	if newToken, err := apputil.ReGenerateSecret(appId); err != nil {
+	if newToken, err := service.From(c).Apps.RegenerateSecret(appId, auditutil.FromContext(c)); err != nil {
 		log.Printf("[ERROR] ReGenerateSecret error: %s", err)
-		api.Fail("re generate secret failed, try again later")
+		api.Fail(apiutil.CodeInternal, "re generate secret failed, try again later")
 	} else {
 		api.SuccessWithData("重置 AppSecret 成功!", gin.H{
 			"secret": newToken,
@@ -148,12 +142,12 @@ func AppInfo(c *gin.Context) {
 	api := apiutil.New(c)
 
 	// get app info
-	if appInfo, err := apputil.GetAppInfo(appId); err != nil {
+	if appInfo, err := service.From(c).Apps.FullInfo(appId); err != nil {
 		if errors.Is(err, apputil.ErrAppNotExist) {
-			api.Fail("应用不存在")
+			api.Fail(apiutil.CodeAppNotFound, "应用不存在")
 			return
 		}
-		api.Fail("system error")
+		api.Fail(apiutil.CodeInternal, "system error")
 		return
 	} else {
 		appInfo.AppGateway = strings.ReplaceAll(appInfo.AppGateway, ",", "\n")
@@ -195,11 +189,12 @@ func AppGetList(c *gin.Context) {
 	offset := (page - 1) * limit
 	// 获取用户Id
 	userId := c.GetInt("userId")
+	apps := service.From(c).Apps
 
 	// 获取用户app数量
 	var appCounts int
-	if appCounts, err = apputil.GetUserAppCount(userId); err != nil {
-		api.Fail("server error")
+	if appCounts, err = apps.Count(userId); err != nil {
+		api.Fail(apiutil.CodeInternal, "server error")
 		return
 	}
 	if appCounts == 0 {
@@ -212,14 +207,14 @@ func AppGetList(c *gin.Context) {
 
 	// 获取用户app列表
 	var appList []apputil.AppBaseStruct
-	if appList, err = apputil.GetUserAppList(userId, limit, offset); err != nil {
-		api.FailWithData("获取失败", gin.H{
+	if appList, err = apps.List(userId, limit, offset); err != nil {
+		api.FailWithData(apiutil.CodeInternal, "获取失败", gin.H{
 			"err": err.Error(),
 		})
 		return
 	}
 	if len(appList) == 0 {
-		api.Fail("当页无数据")
+		api.Fail(apiutil.CodeNoData, "当页无数据")
 		return
 	}
 
@@ -1,22 +1,18 @@
 package controller
 
 import (
-	"encoding/json"
 	"errors"
-	"log"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/soxft/openid-go/app/dto"
-	"github.com/soxft/openid-go/app/model"
+	"github.com/soxft/openid-go/app/service"
 	"github.com/soxft/openid-go/library/apiutil"
-	"github.com/soxft/openid-go/library/codeutil"
+	"github.com/soxft/openid-go/library/auditutil"
 	"github.com/soxft/openid-go/library/mailutil"
 	"github.com/soxft/openid-go/library/toolutil"
 	"github.com/soxft/openid-go/library/userutil"
-	"github.com/soxft/openid-go/process/dbutil"
-	"github.com/soxft/openid-go/process/queueutil"
-	"gorm.io/gorm"
 )
 
 // ForgetPasswordCode
@@ -27,50 +23,50 @@ func ForgetPasswordCode(c *gin.Context) {
 	api := apiutil.New(c)
 	
 	if err := dto.BindJSON(c, &req); err != nil {
-		api.Fail("请求参数错误")
+		api.Fail(apiutil.CodeInvalidParams, "请求参数错误")
 		return
 	}
 	
 	email := req.Email
 	
 	if !toolutil.IsEmail(email) {
-		api.Fail("非法的邮箱格式")
+		api.Fail(apiutil.CodeEmailInvalid, "非法的邮箱格式")
 		return
 	}
-	if exists, err := userutil.CheckEmailExists(email); err != nil {
-		api.Fail("server error")
+	if exists, err := service.From(c).Users.EmailExists(email); err != nil {
+		api.Fail(apiutil.CodeInternal, "server error")
 		return
 	} else if !exists {
-		api.Fail("邮箱不存在")
+		api.Fail(apiutil.CodeEmailNotFound, "邮箱不存在")
 		return
 	}
 
 	// 防止频繁发送验证码
-	if beacon, err := mailutil.CheckBeacon(c, email); beacon || err != nil {
-		api.Fail("code send too frequently")
+	if beacon, err := service.From(c).Mail.CheckBeacon(c, email); beacon || err != nil {
+		api.Fail(apiutil.CodeCodeTooFrequent, "code send too frequently")
 		return
 	}
 
 	// send mail
-	coder := codeutil.New(c)
+	coder := service.From(c).Mail.Coder(c)
 	verifyCode := coder.Create(6)
-	_msg, _ := json.Marshal(mailutil.Mail{
+	mail := mailutil.Mail{
 		ToAddress: email,
 		Subject:   verifyCode + " 为您的验证码",
 		Content:   "您正在申请找回密码, 您的验证码为: " + verifyCode + ", 有效期10分钟",
 		Typ:       "forgetPwd",
-	})
+	}
 
 	if err := coder.Save("forgetPwd", email, verifyCode, 60*time.Minute); err != nil {
-		api.Fail("send code failed")
+		api.Fail(apiutil.CodeInternal, "send code failed")
 		return
 	}
-	if err := queueutil.Q.Publish("mail", string(_msg), 0); err != nil {
+	if err := service.From(c).Mail.Send(mail); err != nil {
 		coder.Consume("forgetPwd", email) // 删除code
-		api.Fail("send code failed")
+		api.Fail(apiutil.CodeInternal, "send code failed")
 		return
 	}
-	_ = mailutil.CreateBeacon(c, email, 120)
+	_ = service.From(c).Mail.CreateBeacon(c, email, 2*time.Minute)
 
 	api.Success("success")
 }
@@ -83,7 +79,7 @@ func ForgetPasswordUpdate(c *gin.Context) {
 	api := apiutil.New(c)
 	
 	if err := dto.BindJSON(c, &req); err != nil {
-		api.Fail("请求参数错误")
+		api.Fail(apiutil.CodeInvalidParams, "请求参数错误")
 		return
 	}
 	
@@ -92,55 +88,51 @@ func ForgetPasswordUpdate(c *gin.Context) {
 	newPassword := req.Password
 
 	if !toolutil.IsEmail(email) {
-		api.Fail("非法的邮箱格式")
-		return
-	}
-
-	if !toolutil.IsPassword(newPassword) {
-		api.Fail("密码应在8-64位之间")
+		api.Fail(apiutil.CodeEmailInvalid, "非法的邮箱格式")
 		return
 	}
 
 	// verify code
-	coder := codeutil.New(c)
+	coder := service.From(c).Mail.Coder(c)
 	if pass, err := coder.Check("forgetPwd", email, code); !pass || err != nil {
-		api.Fail("验证码错误或已过期")
+		api.Fail(apiutil.CodeCodeInvalid, "验证码错误或已过期")
 		return
 	}
 
-	// update password
-	var err error
-	var pwdDb string
-	if pwdDb, err = userutil.GeneratePwd(newPassword); err != nil {
-		log.Println(err)
-		api.Fail("pwd generate error")
-		return
-	}
+	users := service.From(c).Users
 
 	// get Username by email
-	var username string
-	err = dbutil.D.Model(model.Account{}).Where(model.Account{Email: email}).Select("username").Take(&username).Error
-	if errors.Is(err, gorm.ErrRecordNotFound) {
+	account, err := users.GetByEmail(email)
+	if errors.Is(err, userutil.ErrUserNotFound) {
 		// 系统中不存在该邮箱
-		api.Fail("验证码错误或已过期")
+		api.Fail(apiutil.CodeCodeInvalid, "验证码错误或已过期")
 		return
 	} else if err != nil {
-		log.Printf("[ERROR] GetUsername SQL: %s", err)
-		api.Fail("system error")
+		api.Fail(apiutil.CodeInternal, "system error")
 		return
 	}
 
-	err = dbutil.D.Model(model.Account{}).Where(model.Account{Email: email}).Updates(&model.Account{Password: pwdDb}).Error
-	if err != nil {
-		log.Printf("[ERROR] UserPasswordUpdate %v", err)
-		api.Fail("system error")
+	if err := users.ValidatePassword(account.ID, account.Username, email, newPassword); err != nil {
+		failPasswordPolicy(api, err)
+		return
+	}
+
+	// update password
+	if err := users.SetPassword(account.ID, newPassword); err != nil {
+		api.Fail(apiutil.CodeInternal, "system error")
 		return
 	}
 	coder.Consume("forgetPwd", email)
 
 	// 修改密码后续安全操作
-	_ = userutil.SetJwtExpire(c, c.GetString("token"))
-	userutil.PasswordChangeNotify(email, time.Now())
-
+	_ = service.From(c).Tokens.Revoke(c, c.GetString("token"))
+	users.NotifyPasswordChanged(email, time.Now())
+
+	service.From(c).Audit.Record(auditutil.FromContext(c), auditutil.Entry{
+		Action:     auditutil.ActionPasswordForget,
+		UserId:     account.ID,
+		TargetType: auditutil.TargetUser,
+		TargetId:   strconv.Itoa(account.ID),
+	})
 	api.Success("修改成功!")
 }
@@ -1,9 +1,14 @@
 package controller
 
 import (
+	"errors"
+	"strconv"
+
 	"github.com/gin-gonic/gin"
 	"github.com/soxft/openid-go/app/dto"
+	"github.com/soxft/openid-go/app/service"
 	"github.com/soxft/openid-go/library/apiutil"
+	"github.com/soxft/openid-go/library/auditutil"
 	"github.com/soxft/openid-go/library/userutil"
 )
 
@@ -12,22 +17,92 @@ func Login(c *gin.Context) {
 	api := apiutil.New(c)
 	
 	if err := dto.BindJSON(c, &req); err != nil {
-		api.Fail("请求参数错误")
+		api.Fail(apiutil.CodeInvalidParams, "请求参数错误")
 		return
 	}
 
+	// 登录前没有 userId, 登录成功后操作者即为被登录的账号; 失败时操作者保持匿名
+	actor := auditutil.FromContext(c)
+	svc := service.From(c)
+
 	// check username and password
-	if userId, err := userutil.CheckPassword(req.Username, req.Password); err != nil {
-		api.Fail(err.Error())
+	if userId, err := svc.Users.Authenticate(req.Username, req.Password); err != nil {
+		targetId, _ := svc.Users.FindLoginId(req.Username)
+		svc.Audit.Record(actor, auditutil.Entry{
+			Action:     auditutil.ActionLogin,
+			UserId:     targetId,
+			TargetType: auditutil.TargetUser,
+			TargetId:   req.Username,
+			Result:     auditutil.ResultFailure,
+			Detail:     err.Error(),
+		})
+		if errors.Is(err, userutil.ErrPasswd) {
+			api.Fail(apiutil.CodePasswordIncorrect, err.Error())
+		} else {
+			api.Fail(suspendedCode(err), err.Error())
+		}
 		return
 	} else {
 		// get token
-		if token, err := userutil.GenerateJwt(userId, c.ClientIP()); err != nil {
-			api.Fail("system error")
+		if token, err := svc.Tokens.Issue(userId, loginMeta(c, userutil.LoginMethodPassword)); err != nil {
+			api.Fail(apiutil.CodeInternal, "system error")
 		} else {
+			actor.UserId = userId
+			svc.Audit.Record(actor, auditutil.Entry{
+				Action:     auditutil.ActionLogin,
+				UserId:     userId,
+				TargetType: auditutil.TargetUser,
+				TargetId:   req.Username,
+			})
 			api.SuccessWithData("登录成功", gin.H{
 				"token": token,
 			})
 		}
 	}
 }
+
+// LoginDeny
+// @description 登录提醒邮件中的 "不是我本人" 链接: 退出全部设备并重置密码
+// @route POST /login/deny
+func LoginDeny(c *gin.Context) {
+	var req dto.LoginDenyRequest
+	api := apiutil.New(c)
+
+	if err := dto.BindJSON(c, &req); err != nil {
+		api.Fail(apiutil.CodeInvalidParams, "请求参数错误")
+		return
+	}
+
+	userId, err := service.From(c).Users.DenyLogin(c, req.Token)
+	if errors.Is(err, userutil.ErrLoginDenyTokenInvalid) {
+		api.Fail(apiutil.CodeLinkInvalid, "链接无效或已过期")
+		return
+	} else if err != nil {
+		api.Fail(apiutil.CodeInternal, "system error")
+		return
+	}
+
+	service.From(c).Audit.Record(auditutil.FromContext(c), auditutil.Entry{
+		Action:     auditutil.ActionLoginDeny,
+		UserId:     userId,
+		TargetType: auditutil.TargetUser,
+		TargetId:   strconv.Itoa(userId),
+	})
+	api.Success("已退出所有设备, 请通过忘记密码设置新密码")
+}
+
+func loginMeta(c *gin.Context, method string) userutil.LoginMeta {
+	return userutil.LoginMeta{
+		Ip:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Method:    method,
+	}
+}
+
+// suspendedCode CheckSuspended 等账号校验失败时的错误码
+func suspendedCode(err error) apiutil.Code {
+	if errors.Is(err, userutil.ErrAccountSuspended) {
+		return apiutil.CodeAccountSuspended
+	}
+	return apiutil.CodeInternal
+}
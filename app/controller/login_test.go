@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/soxft/openid-go/app/model"
+	"github.com/soxft/openid-go/app/service"
+	"github.com/soxft/openid-go/library/auditutil"
+	"github.com/soxft/openid-go/library/userutil"
+)
+
+// fakeUsers 内存中的账号, 未实现的方法调用时 panic
+type fakeUsers struct {
+	service.UserService
+	passwords map[string]string
+	ids       map[string]int
+}
+
+func (f *fakeUsers) Authenticate(username, password string) (int, error) {
+	id, ok := f.ids[username]
+	if !ok {
+		return 0, userutil.ErrPasswd
+	}
+	if f.passwords[username] != password {
+		return 0, userutil.ErrPasswd
+	}
+	return id, nil
+}
+
+func (f *fakeUsers) FindLoginId(username string) (int, error) {
+	if id, ok := f.ids[username]; ok {
+		return id, nil
+	}
+	return 0, userutil.ErrUserNotFound
+}
+
+type fakeTokens struct {
+	service.TokenService
+	issued []int
+}
+
+func (f *fakeTokens) Issue(userId int, meta userutil.LoginMeta) (string, error) {
+	f.issued = append(f.issued, userId)
+	return "token-" + meta.Method, nil
+}
+
+// fakeAudit 记录写入的审计日志
+type fakeAudit struct {
+	service.AuditService
+	logs []model.AuditLog
+}
+
+func (f *fakeAudit) Record(actor auditutil.Actor, e auditutil.Entry) {
+	if e.Result == "" {
+		e.Result = auditutil.ResultSuccess
+	}
+	f.logs = append(f.logs, model.AuditLog{
+		Action:   e.Action,
+		ActorId:  actor.UserId,
+		UserId:   e.UserId,
+		TargetId: e.TargetId,
+		Result:   e.Result,
+		Detail:   e.Detail,
+	})
+}
+
+func doLogin(t *testing.T, s *service.Services, body string) map[string]any {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(service.Inject(s))
+	r.POST("/login", Login)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	var resp map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response %q: %v", w.Body.String(), err)
+	}
+	return resp
+}
+
+func TestLogin(t *testing.T) {
+	tokens := &fakeTokens{}
+	audit := &fakeAudit{}
+	s := &service.Services{
+		Users: &fakeUsers{
+			passwords: map[string]string{"alice": "correct horse"},
+			ids:       map[string]int{"alice": 7},
+		},
+		Tokens: tokens,
+		Audit:  audit,
+	}
+
+	resp := doLogin(t, s, `{"username":"alice","password":"correct horse"}`)
+	if resp["success"] != true {
+		t.Fatalf("login failed: %v", resp)
+	}
+	if token := resp["data"].(map[string]any)["token"]; token != "token-"+userutil.LoginMethodPassword {
+		t.Fatalf("token = %v", token)
+	}
+	if len(tokens.issued) != 1 || tokens.issued[0] != 7 {
+		t.Fatalf("issued = %v", tokens.issued)
+	}
+
+	resp = doLogin(t, s, `{"username":"alice","password":"wrong"}`)
+	if resp["success"] != false || resp["code"] != "password_incorrect" || resp["message"] != userutil.ErrPasswd.Error() {
+		t.Fatalf("wrong password response = %v", resp)
+	}
+	if len(tokens.issued) != 1 {
+		t.Fatalf("token issued for wrong password")
+	}
+
+	logs := audit.logs
+	if len(logs) != 2 || logs[0].Result != auditutil.ResultSuccess || logs[0].ActorId != 7 || logs[1].Result != auditutil.ResultFailure || logs[1].UserId != 7 {
+		t.Fatalf("audit logs = %+v", logs)
+	}
+	// 登录失败时操作者保持匿名, 目标账号记录在 UserId
+	if logs[1].ActorId != 0 {
+		t.Fatalf("failed login actor = %d, want anonymous", logs[1].ActorId)
+	}
+}
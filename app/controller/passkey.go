@@ -1,10 +1,12 @@
 package controller
 
 import (
-	"encoding/base64"
+	"bytes"
+	"encoding/json"
 	"errors"
 	"log"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-webauthn/webauthn/protocol"
@@ -12,10 +14,11 @@ import (
 
 	"github.com/soxft/openid-go/app/dto"
 	"github.com/soxft/openid-go/app/model"
+	"github.com/soxft/openid-go/app/service"
 	"github.com/soxft/openid-go/library/apiutil"
+	"github.com/soxft/openid-go/library/auditutil"
 	"github.com/soxft/openid-go/library/passkey"
 	"github.com/soxft/openid-go/library/userutil"
-	"github.com/soxft/openid-go/process/dbutil"
 )
 
 // PasskeyRegistrationOptions 获取 Passkey 注册选项
@@ -26,14 +29,14 @@ func PasskeyRegistrationOptions(c *gin.Context) {
 
 	account, err := getAccount(c)
 	if err != nil {
-		api.Fail("user not found")
+		api.Fail(apiutil.CodeUserNotFound, "user not found")
 		return
 	}
 
-	options, err := passkey.BeginRegistration(c.Request.Context(), *account)
+	options, err := service.From(c).Passkeys.BeginRegistration(c.Request.Context(), *account)
 	if err != nil {
 		log.Printf("[ERROR] passkey begin registration failed: %v", err)
-		api.Fail("生成 Passkey 参数失败")
+		api.Fail(apiutil.CodeInternal, "生成 Passkey 参数失败")
 		return
 	}
 
@@ -47,32 +50,28 @@ func PasskeyRegistrationFinish(c *gin.Context) {
 	api := apiutil.New(c)
 	account, err := getAccount(c)
 	if err != nil {
-		api.Fail("user not found")
+		api.Fail(apiutil.CodeUserNotFound, "user not found")
 		return
 	}
 
-	// 解析 JSON 格式的 WebAuthn 响应
-	parsed, err := protocol.ParseCredentialCreationResponse(c.Request)
+	// 请求体需解析两次: WebAuthn 响应与 sessionId, 备注（可选）
+	var reqBody dto.PasskeyRegistrationFinishRequest
+	parsed, err := parseRegistrationBody(c, &reqBody)
 	if err != nil {
 		log.Printf("[ERROR] parse credential creation failed: %v", err)
-		api.Fail("invalid payload")
+		api.Fail(apiutil.CodePasskeyCredentialInvalid, "invalid payload")
+		return
+	}
+	remark := strings.TrimSpace(reqBody.Remark)
+	if !passkey.CheckRemark(remark) {
+		api.Fail(apiutil.CodePasskeyRemarkInvalid, "备注不能超过 32 个字符, 且不能包含特殊字符")
 		return
 	}
-
-	// 获取备注（可选）
-	var reqBody dto.PasskeyRegistrationFinishRequest
-	_ = c.ShouldBindJSON(&reqBody)
-	remark := reqBody.Remark
 
 	// 完成注册，并传递备注
-	credential, err := passkey.CompleteRegistrationWithRemark(c.Request.Context(), *account, parsed, remark)
+	credential, err := service.From(c).Passkeys.FinishRegistration(c.Request.Context(), auditutil.FromContext(c), *account, reqBody.SessionID, parsed, remark)
 	if err != nil {
-		if errors.Is(err, passkey.ErrSessionNotFound) {
-			api.Fail("挑战已过期，请重试")
-			return
-		}
-		log.Printf("[ERROR] passkey finish registration failed: %v", err)
-		api.Fail("注册失败")
+		failPasskeyRegistration(api, err)
 		return
 	}
 
@@ -89,10 +88,10 @@ func PasskeyLoginOptions(c *gin.Context) {
 
 	// 模式2：无用户名登录（无条件 UI）
 	// 生成通用的登录挑战，不指定 allowCredentials
-	options, err := passkey.BeginDiscoverableLogin(c.Request.Context())
+	options, err := service.From(c).Passkeys.BeginLogin(c.Request.Context())
 	if err != nil {
 		log.Printf("[ERROR] passkey begin discoverable login failed: %v", err)
-		api.Fail("生成登录参数失败")
+		api.Fail(apiutil.CodeInternal, "生成登录参数失败")
 		return
 	}
 
@@ -106,75 +105,74 @@ func PasskeyLoginOptions(c *gin.Context) {
 func PasskeyLoginFinish(c *gin.Context) {
 	api := apiutil.New(c)
 
-	// 解析 JSON 格式的 WebAuthn 响应
-	parsed, err := protocol.ParseCredentialRequestResponse(c.Request)
+	// 解析 JSON 格式的 WebAuthn 响应与 sessionId
+	var req dto.PasskeyLoginFinishRequest
+	parsed, err := parseAssertionBody(c, &req)
 	if err != nil {
 		log.Printf("[ERROR] parse credential request failed: %v", err)
-		api.Fail("invalid credential")
+		api.Fail(apiutil.CodePasskeyCredentialInvalid, "invalid credential")
 		return
 	}
 
 	if parsed == nil {
 		log.Printf("[ERROR] parsed credential is nil")
-		api.Fail("invalid credential")
+		api.Fail(apiutil.CodePasskeyCredentialInvalid, "invalid credential")
 		return
 	}
 
-	// 方式1：通过 userHandle（如果客户端提供了）
-	var account model.Account
-	var found bool
-
-	if len(parsed.Response.UserHandle) > 0 {
-		// userHandle 是用户 ID 的 base64 编码
-		userIDStr := string(parsed.Response.UserHandle)
-		if userID, err := strconv.Atoi(userIDStr); err == nil {
-			if err := dbutil.D.Where("id = ?", userID).Take(&account).Error; err == nil {
-				found = true
-				log.Printf("[DEBUG] Found user by userHandle: %d", userID)
-			}
-		}
-	}
+	svc := service.From(c)
 
-	// 方式2：通过 credential ID 查找
-	if !found {
-		credentialID := passkey.EncodeKey(parsed.RawID)
-		var passkeyRecord model.PassKey
-		if err := dbutil.D.Where("credential_id = ?", credentialID).Take(&passkeyRecord).Error; err == nil {
-			if err := dbutil.D.Where("id = ?", passkeyRecord.UserID).Take(&account).Error; err == nil {
-				found = true
-				log.Printf("[DEBUG] Found user by credential ID: %d", passkeyRecord.UserID)
-			}
-		}
-	}
+	// 用户由 userHandle 确定, 签名 / challenge / 签名计数均在 FinishLogin 中校验
+	account, passkeyCredential, err := svc.Passkeys.FinishLogin(c.Request.Context(), req.SessionID, parsed)
 
-	if !found {
-		log.Printf("[ERROR] User not found for credential ID: %s", base64.StdEncoding.EncodeToString(parsed.RawID))
-		api.Fail("invalid credential")
-		return
+	// 与密码登录一致, 失败时操作者保持匿名, 目标账号记录在 UserId
+	actor := auditutil.FromContext(c)
+	loginEntry := auditutil.Entry{
+		Action:     auditutil.ActionLoginPasskey,
+		UserId:     account.ID,
+		TargetType: auditutil.TargetPasskey,
+		TargetId:   passkey.EncodeKey(parsed.RawID),
 	}
 
-	// 验证登录
-	passkeyCredential, err := passkey.CompleteDiscoverableLogin(c.Request.Context(), account, parsed)
 	if err != nil {
+		if account.ID != 0 {
+			loginEntry.Result, loginEntry.Detail = auditutil.ResultFailure, err.Error()
+			svc.Audit.Record(actor, loginEntry)
+		}
+
 		if errors.Is(err, passkey.ErrSessionNotFound) {
-			api.Fail("挑战已过期，请重试")
+			api.Fail(apiutil.CodePasskeyChallengeExpired, "挑战已过期，请重试")
 			return
 		}
 		if errors.Is(err, passkey.ErrNoPasskeyRegistered) {
-			api.Fail("未绑定 Passkey")
+			api.Fail(apiutil.CodePasskeyNotRegistered, "未绑定 Passkey")
+			return
+		}
+		if errors.Is(err, passkey.ErrSignCountRegression) {
+			api.Fail(apiutil.CodePasskeyCloned, "该 Passkey 签名计数异常, 可能已被复制, 请使用其他方式登录并检查")
 			return
 		}
 		log.Printf("[ERROR] passkey finish login failed: %v", err)
-		api.Fail("登录失败")
+		api.Fail(apiutil.CodePasskeyVerifyFailed, "登录失败")
+		return
+	}
+
+	if err := svc.Users.CheckSuspended(c, account.ID); err != nil {
+		loginEntry.Result, loginEntry.Detail = auditutil.ResultFailure, err.Error()
+		svc.Audit.Record(actor, loginEntry)
+		api.Fail(suspendedCode(err), err.Error())
 		return
 	}
 
 	// 登录成功，生成 JWT Token
 	token, err := generateLoginToken(c, account.ID)
 	if err != nil {
-		api.Fail("system error")
+		api.Fail(apiutil.CodeInternal, "system error")
 		return
 	}
+	loginEntry.TargetId = strconv.Itoa(passkeyCredential.ID)
+	actor.UserId = account.ID
+	svc.Audit.Record(actor, loginEntry)
 
 	api.SuccessWithData("success", gin.H{
 		"token":     token,
@@ -191,31 +189,54 @@ func PasskeyList(c *gin.Context) {
 	api := apiutil.New(c)
 	account, err := getAccount(c)
 	if err != nil {
-		api.Fail("user not found")
+		api.Fail(apiutil.CodeUserNotFound, "user not found")
 		return
 	}
 
-	passkeys, err := passkey.ListUserPasskeys(account.ID)
+	passkeys, err := service.From(c).Passkeys.List(account.ID)
 	if err != nil {
 		log.Printf("[ERROR] passkey list failed: %v", err)
-		api.Fail("获取失败")
+		api.Fail(apiutil.CodeInternal, "获取失败")
 		return
 	}
 
-	summaries := make([]passkey.Summary, 0, len(passkeys))
-	for _, item := range passkeys {
-		summaries = append(summaries, passkey.Summary{
-			ID:           item.ID,
-			Remark:       item.Remark, // 包含备注信息
-			CreatedAt:    item.CreatedAt,
-			LastUsedAt:   item.LastUsedAt,
-			CloneWarning: item.CloneWarning,
-			SignCount:    item.SignCount,
-			Transports:   passkey.SplitTransports(item.Transport),
-		})
+	api.SuccessWithData("success", passkeySummaries(passkeys))
+}
+
+// PasskeyRename 修改 Passkey 备注
+//
+//	PATCH /passkey/:id
+func PasskeyRename(c *gin.Context) {
+	var req dto.PasskeyRenameRequest
+	api := apiutil.New(c)
+
+	if err := dto.BindJSON(c, &req); err != nil {
+		api.Fail(apiutil.CodeInvalidParams, "请求参数错误")
+		return
+	}
+	remark := strings.TrimSpace(req.Remark)
+	if !passkey.CheckRemark(remark) {
+		api.Fail(apiutil.CodePasskeyRemarkInvalid, "备注不能超过 32 个字符, 且不能包含特殊字符")
+		return
 	}
 
-	api.SuccessWithData("success", summaries)
+	passkeyID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || passkeyID <= 0 {
+		api.Fail(apiutil.CodeInvalidParams, "invalid id")
+		return
+	}
+
+	record, err := service.From(c).Passkeys.Rename(auditutil.FromContext(c), c.GetInt("userId"), passkeyID, remark)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		api.Fail(apiutil.CodePasskeyNotFound, "Passkey 不存在")
+		return
+	} else if err != nil {
+		log.Printf("[ERROR] passkey rename failed: %v", err)
+		api.Fail(apiutil.CodeInternal, "修改失败")
+		return
+	}
+
+	api.SuccessWithData("success", passkeySummaries([]model.PassKey{*record})[0])
 }
 
 // PasskeyDelete 删除指定 Passkey
@@ -225,37 +246,95 @@ func PasskeyDelete(c *gin.Context) {
 	api := apiutil.New(c)
 	account, err := getAccount(c)
 	if err != nil {
-		api.Fail("user not found")
+		api.Fail(apiutil.CodeUserNotFound, "user not found")
 		return
 	}
 
 	passkeyID, err := strconv.Atoi(c.Param("id"))
 	if err != nil || passkeyID <= 0 {
-		api.Fail("invalid id")
+		api.Fail(apiutil.CodeInvalidParams, "invalid id")
 		return
 	}
 
-	if err := passkey.DeleteUserPasskey(account.ID, passkeyID); err != nil {
+	if err := service.From(c).Passkeys.Delete(auditutil.FromContext(c), account.ID, passkeyID); err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			api.Fail("Passkey 不存在")
+			api.Fail(apiutil.CodePasskeyNotFound, "Passkey 不存在")
+			return
+		}
+		if errors.Is(err, passkey.ErrLastPasskey) {
+			api.Fail(apiutil.CodePasskeyLast, "账号未设置密码, 不能删除唯一的 Passkey")
 			return
 		}
 		log.Printf("[ERROR] passkey delete failed: %v", err)
-		api.Fail("删除失败")
+		api.Fail(apiutil.CodeInternal, "删除失败")
 		return
 	}
 
 	api.Success("success")
 }
 
+// parseRegistrationBody 解析 WebAuthn 注册响应, 同一请求体中的附加字段解析到 extra
+func parseRegistrationBody(c *gin.Context, extra interface{}) (*protocol.ParsedCredentialCreationData, error) {
+	body, err := c.GetRawData()
+	if err != nil {
+		return nil, err
+	}
+	_ = json.Unmarshal(body, extra)
+
+	return protocol.ParseCredentialCreationResponseBody(bytes.NewReader(body))
+}
+
+// parseAssertionBody 解析 WebAuthn 登录断言, 同一请求体中的附加字段解析到 extra
+func parseAssertionBody(c *gin.Context, extra interface{}) (*protocol.ParsedCredentialAssertionData, error) {
+	body, err := c.GetRawData()
+	if err != nil {
+		return nil, err
+	}
+	_ = json.Unmarshal(body, extra)
+
+	return protocol.ParseCredentialRequestResponseBody(bytes.NewReader(body))
+}
+
+func failPasskeyRegistration(api *apiutil.Api, err error) {
+	if errors.Is(err, passkey.ErrSessionNotFound) {
+		api.Fail(apiutil.CodePasskeyChallengeExpired, "挑战已过期，请重试")
+		return
+	}
+	if errors.Is(err, passkey.ErrAuthenticatorNotAllowed) {
+		api.Fail(apiutil.CodePasskeyAuthenticatorDenied, "不支持该型号的认证器")
+		return
+	}
+	log.Printf("[ERROR] passkey finish registration failed: %v", err)
+	api.Fail(apiutil.CodePasskeyRegisterFailed, "注册失败")
+}
+
+func passkeySummaries(passkeys []model.PassKey) []passkey.Summary {
+	summaries := make([]passkey.Summary, 0, len(passkeys))
+	for _, item := range passkeys {
+		aaguid := passkey.FormatAAGUID(item.AAGUID)
+		summaries = append(summaries, passkey.Summary{
+			ID:           item.ID,
+			Remark:       item.Remark, // 包含备注信息
+			AAGUID:       aaguid,
+			Name:         passkey.AuthenticatorName(aaguid),
+			CreatedAt:    item.CreatedAt,
+			LastUsedAt:   item.LastUsedAt,
+			CloneWarning: item.CloneWarning,
+			SignCount:    item.SignCount,
+			Transports:   passkey.SplitTransports(item.Transport),
+		})
+	}
+	return summaries
+}
+
 func getAccount(c *gin.Context) (*model.Account, error) {
 	userID := c.GetInt("userId")
 	if userID == 0 {
 		return nil, errors.New("empty user id")
 	}
 
-	var account model.Account
-	if err := dbutil.D.Where("id = ?", userID).Take(&account).Error; err != nil {
+	account, err := service.From(c).Users.Get(userID)
+	if err != nil {
 		return nil, err
 	}
 
@@ -263,5 +342,5 @@ func getAccount(c *gin.Context) (*model.Account, error) {
 }
 
 func generateLoginToken(c *gin.Context, userID int) (string, error) {
-	return userutil.GenerateJwt(userID, c.ClientIP())
+	return service.From(c).Tokens.Issue(userID, loginMeta(c, userutil.LoginMethodPasskey))
 }
@@ -3,6 +3,7 @@ package controller
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/soxft/openid-go/library/apiutil"
+	"github.com/soxft/openid-go/library/cacheutil"
 	"time"
 )
 
@@ -13,3 +14,13 @@ func Ping(c *gin.Context) {
 		"timestamp": time.Now().Unix(),
 	})
 }
+
+// CacheStats
+// @description 缓存命中统计 (Debug 模式下, 以及管理后台)
+// @route GET /debug/cache
+// @route GET /admin/cache
+func CacheStats(c *gin.Context) {
+	api := apiutil.New(c)
+
+	api.SuccessWithData("success", cacheutil.Stats())
+}
@@ -1,20 +1,20 @@
 package controller
 
 import (
-	"encoding/json"
 	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/soxft/openid-go/app/dto"
 	"github.com/soxft/openid-go/app/model"
+	"github.com/soxft/openid-go/app/service"
 	"github.com/soxft/openid-go/config"
 	"github.com/soxft/openid-go/library/apiutil"
-	"github.com/soxft/openid-go/library/codeutil"
+	"github.com/soxft/openid-go/library/auditutil"
 	"github.com/soxft/openid-go/library/mailutil"
+	"github.com/soxft/openid-go/library/passkey"
 	"github.com/soxft/openid-go/library/toolutil"
 	"github.com/soxft/openid-go/library/userutil"
-	"github.com/soxft/openid-go/process/dbutil"
-	"github.com/soxft/openid-go/process/queueutil"
 	"log"
+	"strings"
 	"time"
 )
 
@@ -24,64 +24,64 @@ import (
 func RegisterCode(c *gin.Context) {
 	var req dto.RegisterCodeRequest
 	api := apiutil.New(c)
-	
+
 	if err := dto.BindJSON(c, &req); err != nil {
-		api.Fail("请求参数错误")
+		api.Fail(apiutil.CodeInvalidParams, "请求参数错误")
 		return
 	}
-	
+
 	email := req.Email
 	// verify email by re
 	if !toolutil.IsEmail(email) {
-		api.Fail("invalid email")
+		api.Fail(apiutil.CodeEmailInvalid, "invalid email")
 		return
 	}
 
 	// 防止频繁发送验证码
-	if beacon, err := mailutil.CheckBeacon(c, email); beacon || err != nil {
-		api.Fail("code send too frequently")
+	if beacon, err := service.From(c).Mail.CheckBeacon(c, email); beacon || err != nil {
+		api.Fail(apiutil.CodeCodeTooFrequent, "code send too frequently")
 		return
 	}
 
 	// 先创建 beacon 再说
-	_ = mailutil.CreateBeacon(c, email, 120)
+	_ = service.From(c).Mail.CreateBeacon(c, email, 2*time.Minute)
 
 	// check mail exists
-	if exists, err := userutil.CheckEmailExists(email); err != nil {
-		go mailutil.DeleteBeacon(c, email) // 删除信标
+	if exists, err := service.From(c).Users.EmailExists(email); err != nil {
+		go service.From(c).Mail.DeleteBeacon(c, email) // 删除信标
 
-		api.Fail("server error")
+		api.Fail(apiutil.CodeInternal, "server error")
 		return
 	} else if exists {
-		go mailutil.DeleteBeacon(c, email) // 删除信标
+		go service.From(c).Mail.DeleteBeacon(c, email) // 删除信标
 
-		api.Fail("email already exists")
+		api.Fail(apiutil.CodeEmailTaken, "email already exists")
 		return
 	}
 
 	// send Code
-	coder := codeutil.New(c)
+	coder := service.From(c).Mail.Coder(c)
 	verifyCode := coder.Create(4)
 
-	_msg, _ := json.Marshal(mailutil.Mail{
+	mail := mailutil.Mail{
 		ToAddress: email,
 		Subject:   verifyCode + " 为您的验证码",
 		Content:   "您正在注册 " + config.Server.Title + ". 您的验证码为: " + verifyCode + ", 有效期10分钟.",
 		Typ:       "register",
-	})
+	}
 
 	if err := coder.Save("register", email, verifyCode, 60*time.Minute); err != nil {
-		go mailutil.DeleteBeacon(c, email) // 删除信标
+		go service.From(c).Mail.DeleteBeacon(c, email) // 删除信标
 
-		api.Fail("send code failed")
+		api.Fail(apiutil.CodeInternal, "send code failed")
 		return
 	}
 
-	if err := queueutil.Q.Publish("mail", string(_msg), 0); err != nil {
-		go coder.Consume("register", email) // 删除code
-		go mailutil.DeleteBeacon(c, email)  // 删除信标
+	if err := service.From(c).Mail.Send(mail); err != nil {
+		go coder.Consume("register", email)            // 删除code
+		go service.From(c).Mail.DeleteBeacon(c, email) // 删除信标
 
-		api.Fail("send code failed")
+		api.Fail(apiutil.CodeInternal, "send code failed")
 		return
 	}
 
@@ -94,47 +94,48 @@ func RegisterCode(c *gin.Context) {
 func RegisterSubmit(c *gin.Context) {
 	var req dto.RegisterSubmitRequest
 	api := apiutil.New(c)
-	
+
 	if err := dto.BindJSON(c, &req); err != nil {
-		api.Fail("请求参数错误")
+		api.Fail(apiutil.CodeInvalidParams, "请求参数错误")
 		return
 	}
-	
+
 	email := req.Email
 	verifyCode := req.Code
 	username := req.Username
 	password := req.Password
 	// 合法检测
 	if !toolutil.IsEmail(email) {
-		api.Fail("非法的邮箱")
+		api.Fail(apiutil.CodeEmailInvalid, "非法的邮箱")
 		return
 	}
 	if !toolutil.IsUserName(username) {
-		api.Fail("非法的用户名")
+		api.Fail(apiutil.CodeUsernameInvalid, "非法的用户名")
 		return
 	}
-	if !toolutil.IsPassword(password) {
-		api.Fail("密码应在8～64位")
+	users := service.From(c).Users
+	if err := users.ValidatePassword(0, username, email, password); err != nil {
+		failPasswordPolicy(api, err)
 		return
 	}
 
 	// 验证码检测
-	coder := codeutil.New(c)
+	coder := service.From(c).Mail.Coder(c)
 	if pass, err := coder.Check("register", email, verifyCode); !pass || err != nil {
-		api.Fail("invalid code")
+		api.Fail(apiutil.CodeCodeInvalid, "invalid code")
 		return
 	}
 
 	// 重复检测
-	if err := userutil.RegisterCheck(username, email); err != nil {
+	if err := users.RegisterCheck(username, email); err != nil {
 		if errors.Is(err, userutil.ErrUsernameExists) {
-			api.Fail("用户名已存在")
+			api.Fail(apiutil.CodeUsernameTaken, "用户名已存在")
 			return
 		} else if errors.Is(err, userutil.ErrEmailExists) {
-			api.Fail("邮箱已存在")
+			api.Fail(apiutil.CodeEmailTaken, "邮箱已存在")
 			return
 		}
-		api.Fail("server error")
+		api.Fail(apiutil.CodeInternal, "server error")
 		return
 	}
 
@@ -142,28 +143,17 @@ func RegisterSubmit(c *gin.Context) {
 	userIp := c.ClientIP()
 	timestamp := time.Now().Unix()
 
-	var err error
-	var pwd string
-	if pwd, err = userutil.GeneratePwd(password); err != nil {
-		log.Println(err)
-		api.Fail("pwd generate error")
-		return
-	}
-
 	// insert to Database
 	newUser := model.Account{
 		Username: username,
-		Password: pwd,
 		Email:    email,
 		RegTime:  timestamp,
 		RegIp:    userIp,
 		LastTime: timestamp,
 		LastIp:   userIp,
 	}
-	result := dbutil.D.Create(&newUser)
-	if result.Error != nil || result.RowsAffected == 0 {
-		log.Printf("[ERROR] RegisterSubmit %s", result.Error.Error())
-		api.Fail("register failed")
+	if _, err := users.Register(newUser, password); err != nil {
+		api.Fail(apiutil.CodeInternal, "register failed")
 		return
 	}
 
@@ -171,3 +161,136 @@ func RegisterSubmit(c *gin.Context) {
 	coder.Consume("register", email)
 	api.Success("success")
 }
+
+// RegisterPasskeyOptions
+// @description 无密码注册: 校验邮箱验证码并创建账号, 返回首个 passkey 的注册参数
+// @route POST /register/passkey/options
+func RegisterPasskeyOptions(c *gin.Context) {
+	var req dto.RegisterPasskeyOptionsRequest
+	api := apiutil.New(c)
+
+	if err := dto.BindJSON(c, &req); err != nil {
+		api.Fail(apiutil.CodeInvalidParams, "请求参数错误")
+		return
+	}
+
+	email := req.Email
+	username := req.Username
+	if !toolutil.IsEmail(email) {
+		api.Fail(apiutil.CodeEmailInvalid, "非法的邮箱")
+		return
+	}
+	if !toolutil.IsUserName(username) {
+		api.Fail(apiutil.CodeUsernameInvalid, "非法的用户名")
+		return
+	}
+
+	// 验证码检测
+	coder := service.From(c).Mail.Coder(c)
+	if pass, err := coder.Check("register", email, req.Code); !pass || err != nil {
+		api.Fail(apiutil.CodeCodeInvalid, "invalid code")
+		return
+	}
+
+	// 创建未设置密码的账号, 中断后使用同一验证码重试时复用; 验证码在绑定 passkey 后消费
+	userIp := c.ClientIP()
+	timestamp := time.Now().Unix()
+	users := service.From(c).Users
+	userId, err := users.RegisterPasswordless(model.Account{
+		Username: username,
+		Email:    email,
+		RegTime:  timestamp,
+		RegIp:    userIp,
+		LastTime: timestamp,
+		LastIp:   userIp,
+	})
+	if errors.Is(err, userutil.ErrUsernameExists) {
+		api.Fail(apiutil.CodeUsernameTaken, "用户名已存在")
+		return
+	} else if errors.Is(err, userutil.ErrEmailExists) {
+		api.Fail(apiutil.CodeEmailTaken, "邮箱已存在")
+		return
+	} else if err != nil {
+		api.Fail(apiutil.CodeInternal, "register failed")
+		return
+	}
+
+	account, err := users.Get(userId)
+	if err != nil {
+		api.Fail(apiutil.CodeInternal, "register failed")
+		return
+	}
+	options, err := service.From(c).Passkeys.BeginRegistration(c.Request.Context(), account)
+	if err != nil {
+		log.Printf("[ERROR] passkey begin registration failed: %v", err)
+		api.Fail(apiutil.CodeInternal, "生成 Passkey 参数失败")
+		return
+	}
+	signupToken, err := users.CreateSignupToken(c, userId)
+	if err != nil {
+		api.Fail(apiutil.CodeInternal, "register failed")
+		return
+	}
+
+	api.SuccessWithData("success", gin.H{
+		"signupToken": signupToken,
+		"options":     options,
+	})
+}
+
+// RegisterPasskey
+// @description 无密码注册: 绑定首个 passkey 完成注册并登录
+// @route POST /register/passkey
+func RegisterPasskey(c *gin.Context) {
+	api := apiutil.New(c)
+
+	var req dto.RegisterPasskeyRequest
+	parsed, err := parseRegistrationBody(c, &req)
+	if err != nil {
+		api.Fail(apiutil.CodePasskeyCredentialInvalid, "invalid payload")
+		return
+	}
+	remark := strings.TrimSpace(req.Remark)
+	if !passkey.CheckRemark(remark) {
+		api.Fail(apiutil.CodePasskeyRemarkInvalid, "备注不能超过 32 个字符, 且不能包含特殊字符")
+		return
+	}
+
+	svc := service.From(c)
+	userId, err := svc.Users.GetSignupToken(c, req.SignupToken)
+	if errors.Is(err, userutil.ErrSignupTokenInvalid) {
+		api.Fail(apiutil.CodeSignupExpired, "注册已过期, 请重新注册")
+		return
+	} else if err != nil {
+		api.Fail(apiutil.CodeInternal, "system error")
+		return
+	}
+	account, err := svc.Users.Get(userId)
+	if err != nil {
+		api.Fail(apiutil.CodeSignupExpired, "注册已过期, 请重新注册")
+		return
+	}
+
+	actor := auditutil.FromContext(c)
+	actor.UserId = userId
+	credential, err := svc.Passkeys.FinishRegistration(c.Request.Context(), actor, account, req.SessionID, parsed, remark)
+	if err != nil {
+		failPasskeyRegistration(api, err)
+		return
+	}
+	svc.Users.CompleteSignup(c, userId, req.SignupToken)
+	svc.Mail.Coder(c).Consume("register", account.Email)
+
+	token, err := generateLoginToken(c, userId)
+	if err != nil {
+		api.Fail(apiutil.CodeInternal, "system error")
+		return
+	}
+
+	api.SuccessWithData("success", gin.H{
+		"token":     token,
+		"passkeyId": credential.ID,
+		"username":  account.Username,
+		"email":     account.Email,
+	})
+}
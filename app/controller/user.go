@@ -1,19 +1,21 @@
 package controller
 
 import (
-	"encoding/json"
+	"bytes"
 	"errors"
 	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
 	"github.com/soxft/openid-go/app/dto"
-	"github.com/soxft/openid-go/app/model"
+	"github.com/soxft/openid-go/app/service"
 	"github.com/soxft/openid-go/library/apiutil"
-	"github.com/soxft/openid-go/library/codeutil"
+	"github.com/soxft/openid-go/library/auditutil"
 	"github.com/soxft/openid-go/library/mailutil"
+	"github.com/soxft/openid-go/library/passkey"
+	"github.com/soxft/openid-go/library/passwordutil"
 	"github.com/soxft/openid-go/library/toolutil"
 	"github.com/soxft/openid-go/library/userutil"
-	"github.com/soxft/openid-go/process/dbutil"
-	"github.com/soxft/openid-go/process/queueutil"
 	"log"
+	"strconv"
 	"time"
 )
 
@@ -32,12 +34,17 @@ func UserStatus(c *gin.Context) {
 func UserInfo(c *gin.Context) {
 	api := apiutil.New(c)
 
-	userId := c.GetInt("userId")
+	account, err := getAccount(c)
+	if err != nil {
+		api.Fail(apiutil.CodeUserNotFound, "user not found")
+		return
+	}
 	api.SuccessWithData("success", gin.H{
-		"userId":   userId,
-		"username": c.GetString("username"),
-		"email":    c.GetString("email"),
-		"lastTime": c.GetInt64("lastTime"),
+		"userId":      account.ID,
+		"username":    c.GetString("username"),
+		"email":       c.GetString("email"),
+		"lastTime":    c.GetInt64("lastTime"),
+		"hasPassword": account.Password != "", // 无密码账号只能通过 passkey 登录与验证身份
 	})
 }
 
@@ -45,7 +52,8 @@ func UserInfo(c *gin.Context) {
 // @description 用户退出
 func UserLogout(c *gin.Context) {
 	api := apiutil.New(c)
-	_ = userutil.SetJwtExpire(c, c.GetString("token"))
+	_ = service.From(c).Tokens.Revoke(c, c.GetString("token"))
+	recordUserEvent(c, auditutil.ActionLogout, auditutil.ResultSuccess, "")
 	api.Success("success")
 }
 
@@ -57,54 +65,139 @@ func UserPasswordUpdate(c *gin.Context) {
 	api := apiutil.New(c)
 	
 	if err := dto.BindJSON(c, &req); err != nil {
-		api.Fail("请求参数错误")
+		api.Fail(apiutil.CodeInvalidParams, "请求参数错误")
 		return
 	}
 	
+	// 身份已由 RequireReauth 中间件验证
 	userId := c.GetInt("userId")
 	username := c.GetString("username")
+	svc := service.From(c)
 
-	if !toolutil.IsPassword(req.NewPassword) {
-		api.Fail("密码应在8～64位")
+	if err := svc.Users.ValidatePassword(userId, username, c.GetString("email"), req.NewPassword); err != nil {
+		failPasswordPolicy(api, err)
 		return
 	}
-	// verify old password
-	if _, err := userutil.CheckPassword(username, req.OldPassword); errors.Is(err, userutil.ErrPasswd) {
-		api.Fail("旧密码错误")
+
+	// change password
+	if err := svc.Users.SetPassword(userId, req.NewPassword); errors.Is(err, userutil.ErrUserNotFound) {
+		api.Fail(apiutil.CodeUserNotFound, "用户不存在")
 		return
 	} else if err != nil {
-		api.Fail("system err")
+		api.Fail(apiutil.CodeInternal, "system error")
 		return
 	}
 
-	// change password
-	var err error
-	var newPwd string
-	if newPwd, err = userutil.GeneratePwd(req.NewPassword); err != nil {
-		log.Printf("generate password failed: %v", err)
-		api.Fail("system error")
+	// make jwt token expire
+	_ = svc.Tokens.Revoke(c, c.GetString("token"))
+
+	// send safe notify email
+	svc.Users.NotifyPasswordChanged(c.GetString("email"), time.Now())
+	recordUserEvent(c, auditutil.ActionPasswordUpdate, auditutil.ResultSuccess, "")
+
+	api.Success("修改成功, 请重新登录")
+}
+
+// UserReauthOptions
+// @description 获取重新验证身份所需的 passkey 参数
+// @router GET /user/reauth/options
+func UserReauthOptions(c *gin.Context) {
+	api := apiutil.New(c)
+
+	account, err := getAccount(c)
+	if err != nil {
+		api.Fail(apiutil.CodeUserNotFound, "user not found")
 		return
 	}
 
-	result := dbutil.D.Model(model.Account{}).Where(&model.Account{ID: userId}).
-		Updates(&model.Account{Password: newPwd})
-
-	if result.Error != nil {
-		log.Printf("[ERROR] UserPasswordUpdate %v", result.Error)
-		api.Fail("system error")
+	options, err := service.From(c).Passkeys.BeginReauth(c.Request.Context(), *account)
+	if errors.Is(err, passkey.ErrNoPasskeyRegistered) {
+		api.Fail(apiutil.CodePasskeyNotRegistered, "未绑定 Passkey")
 		return
-	} else if result.RowsAffected == 0 {
-		api.Fail("用户不存在")
+	} else if err != nil {
+		log.Printf("[ERROR] passkey begin reauth failed: %v", err)
+		api.Fail(apiutil.CodeInternal, "生成 Passkey 参数失败")
 		return
 	}
 
-	// make jwt token expire
-	_ = userutil.SetJwtExpire(c, c.GetString("token"))
+	api.SuccessWithData("success", options)
+}
 
-	// send safe notify email
-	userutil.PasswordChangeNotify(c.GetString("email"), time.Now())
+// UserReauth
+// @description 使用密码或 passkey 重新验证身份, 验证通过后当前会话可在短时间内执行敏感操作
+// @router POST /user/reauth
+func UserReauth(c *gin.Context) {
+	var req dto.UserReauthRequest
+	api := apiutil.New(c)
 
-	api.Success("修改成功, 请重新登录")
+	if err := dto.BindJSON(c, &req); err != nil {
+		api.Fail(apiutil.CodeInvalidParams, "请求参数错误")
+		return
+	}
+
+	svc := service.From(c)
+
+	var method string
+	switch {
+	case req.Password != "":
+		method = userutil.ReauthMethodPassword
+		if account, err := getAccount(c); err != nil {
+			api.Fail(apiutil.CodeUserNotFound, "user not found")
+			return
+		} else if account.Password == "" {
+			api.Fail(apiutil.CodePasswordNotSet, "未设置密码, 请使用 Passkey 验证")
+			return
+		}
+		if _, err := svc.Users.Authenticate(c.GetString("username"), req.Password); errors.Is(err, userutil.ErrPasswd) {
+			recordUserEvent(c, auditutil.ActionReauth, auditutil.ResultFailure, method+": 密码错误")
+			api.Fail(apiutil.CodePasswordIncorrect, "密码错误")
+			return
+		} else if err != nil {
+			api.Fail(apiutil.CodeInternal, "system err")
+			return
+		}
+	case len(req.Credential) > 0:
+		method = userutil.ReauthMethodPasskey
+		parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(req.Credential))
+		if err != nil {
+			api.Fail(apiutil.CodePasskeyCredentialInvalid, "invalid credential")
+			return
+		}
+		account, err := getAccount(c)
+		if err != nil {
+			api.Fail(apiutil.CodeUserNotFound, "user not found")
+			return
+		}
+
+		if _, err := svc.Passkeys.FinishReauth(c.Request.Context(), *account, req.SessionID, parsed); err != nil {
+			recordUserEvent(c, auditutil.ActionReauth, auditutil.ResultFailure, method+": "+err.Error())
+			if errors.Is(err, passkey.ErrSessionNotFound) {
+				api.Fail(apiutil.CodePasskeyChallengeExpired, "挑战已过期，请重试")
+				return
+			}
+			if errors.Is(err, passkey.ErrSignCountRegression) {
+				api.Fail(apiutil.CodePasskeyCloned, "该 Passkey 签名计数异常, 可能已被复制, 请使用其他方式验证并检查")
+				return
+			}
+			api.Fail(apiutil.CodePasskeyVerifyFailed, "验证失败")
+			return
+		}
+	default:
+		api.Fail(apiutil.CodeInvalidParams, "请求参数错误")
+		return
+	}
+
+	expireAt, err := svc.Tokens.Elevate(c, c.GetString("jti"), method)
+	if err != nil {
+		api.Fail(apiutil.CodeInternal, "system error")
+		return
+	}
+	recordUserEvent(c, auditutil.ActionReauth, auditutil.ResultSuccess, method)
+
+	api.SuccessWithData("验证成功", gin.H{
+		"method":   method,
+		"expireAt": expireAt.Unix(),
+	})
 }
 
 // UserEmailUpdateCode
@@ -112,67 +205,59 @@ func UserPasswordUpdate(c *gin.Context) {
 // @router POST /user/email/update/code
 func UserEmailUpdateCode(c *gin.Context) {
 	var req struct {
-		Password string `json:"password" binding:"required"`
 		NewEmail string `json:"new_email" binding:"required,email"`
+		// Deprecated: 旧版客户端随请求提交的当前密码, 弃用期内由 RequireReauthOrPassword 校验
+		Password string `json:"password"`
 	}
 	api := apiutil.New(c)
 	
 	if err := dto.BindJSON(c, &req); err != nil {
-		api.Fail("请求参数错误")
+		api.Fail(apiutil.CodeInvalidParams, "请求参数错误")
 		return
 	}
 	
-	username := c.GetString("username")
 	newEmail := req.NewEmail
+	users := service.From(c).Users
 
 	if !toolutil.IsEmail(newEmail) {
-		api.Fail("非法的邮箱格式")
+		api.Fail(apiutil.CodeEmailInvalid, "非法的邮箱格式")
 		return
 	}
 
-	// verify old password
-	if _, err := userutil.CheckPassword(username, req.Password); errors.Is(err, userutil.ErrPasswd) {
-		api.Fail("旧密码错误")
-		return
-	} else if err != nil {
-		api.Fail("system err")
-		return
-	}
-
-	if exist, err := userutil.CheckEmailExists(newEmail); err != nil {
-		api.Fail("system err")
+	if exist, err := users.EmailExists(newEmail); err != nil {
+		api.Fail(apiutil.CodeInternal, "system err")
 		return
 	} else if exist {
-		api.Fail("邮箱已存在")
+		api.Fail(apiutil.CodeEmailTaken, "邮箱已存在")
 		return
 	}
 
 	// 防止频繁发送验证码
-	if beacon, err := mailutil.CheckBeacon(c, newEmail); beacon || err != nil {
-		api.Fail("code send too frequently")
+	if beacon, err := service.From(c).Mail.CheckBeacon(c, newEmail); beacon || err != nil {
+		api.Fail(apiutil.CodeCodeTooFrequent, "code send too frequently")
 		return
 	}
 
 	// send mail
-	coder := codeutil.New(c)
+	coder := service.From(c).Mail.Coder(c)
 	verifyCode := coder.Create(4)
-	_msg, _ := json.Marshal(mailutil.Mail{
+	mail := mailutil.Mail{
 		ToAddress: newEmail,
 		Subject:   verifyCode + " 为您的验证码",
 		Content:   "您正在申请修改邮箱, 您的验证码为: " + verifyCode + ", 有效期10分钟",
 		Typ:       "emailChange",
-	})
+	}
 
 	if err := coder.Save("emailChange", newEmail, verifyCode, 60*time.Minute); err != nil {
-		api.Fail("send code failed")
+		api.Fail(apiutil.CodeInternal, "send code failed")
 		return
 	}
-	if err := queueutil.Q.Publish("mail", string(_msg), 0); err != nil {
+	if err := service.From(c).Mail.Send(mail); err != nil {
 		coder.Consume("emailChange", newEmail) // 删除code
-		api.Fail("send code failed")
+		api.Fail(apiutil.CodeInternal, "send code failed")
 		return
 	}
-	_ = mailutil.CreateBeacon(c, newEmail, 120)
+	_ = service.From(c).Mail.CreateBeacon(c, newEmail, 2*time.Minute)
 
 	api.Success("发送成功")
 }
@@ -185,7 +270,7 @@ func UserEmailUpdate(c *gin.Context) {
 	api := apiutil.New(c)
 	
 	if err := dto.BindJSON(c, &req); err != nil {
-		api.Fail("请求参数错误")
+		api.Fail(apiutil.CodeInvalidParams, "请求参数错误")
 		return
 	}
 	
@@ -193,31 +278,168 @@ func UserEmailUpdate(c *gin.Context) {
 	code := req.Code
 	
 	if !toolutil.IsEmail(newEmail) {
-		api.Fail("非法的邮箱格式")
+		api.Fail(apiutil.CodeEmailInvalid, "非法的邮箱格式")
 		return
 	}
 
 	// verify code
-	coder := codeutil.New(c)
+	coder := service.From(c).Mail.Coder(c)
 	if pass, err := coder.Check("emailChange", newEmail, code); !pass || err != nil {
-		api.Fail("验证码错误或已过期")
+		api.Fail(apiutil.CodeCodeInvalid, "验证码错误或已过期")
 		return
 	}
 
 	// update email
+	svc := service.From(c)
 	userId := c.GetInt("userId") // get userid from middleware
-	result := dbutil.D.Model(&model.Account{}).Where(&model.Account{ID: userId}).Update("email", newEmail)
-	if result.Error != nil {
-		log.Printf("[ERROR] UserEmailUpdate %v", result.Error)
-		api.Fail("system error")
+	if err := svc.Users.UpdateEmail(userId, newEmail); errors.Is(err, userutil.ErrUserNotFound) {
+		api.Fail(apiutil.CodeUserNotFound, "用户不存在")
 		return
-	} else if result.RowsAffected == 0 {
-		api.Fail("用户不存在")
+	} else if err != nil {
+		api.Fail(apiutil.CodeInternal, "system error")
 		return
 	}
 
 	coder.Consume("emailChange", newEmail)
-	userutil.EmailChangeNotify(c.GetString("email"), time.Now())
-	_ = userutil.SetJwtExpire(c, c.GetString("token"))
+	svc.Users.NotifyEmailChanged(c.GetString("email"), time.Now())
+	recordUserEvent(c, auditutil.ActionEmailUpdate, auditutil.ResultSuccess, c.GetString("email")+" -> "+newEmail)
+	_ = svc.Tokens.Revoke(c, c.GetString("token"))
 	api.Success("修改成功, 请重新登录")
 }
+
+// UserDelete
+// @description 申请注销账号, 冷静期后删除
+// @router POST /user/delete
+func UserDelete(c *gin.Context) {
+	api := apiutil.New(c)
+	svc := service.From(c)
+
+	// 身份已由 RequireReauth 中间件验证
+	deleteAt, err := svc.Users.ScheduleDeletion(c, c.GetInt("userId"))
+	if errors.Is(err, userutil.ErrDeletionScheduled) {
+		api.FailWithData(apiutil.CodeDeletionScheduled, "已申请注销", gin.H{
+			"deleteAt": deleteAt.Unix(),
+		})
+		return
+	} else if err != nil {
+		api.Fail(apiutil.CodeInternal, "system error")
+		return
+	}
+
+	_ = svc.Tokens.Revoke(c, c.GetString("token"))
+	recordUserEvent(c, auditutil.ActionAccountDeleteApply, auditutil.ResultSuccess, "deleteAt "+deleteAt.Format("2006-01-02 15:04:05"))
+	api.SuccessWithData("已申请注销, 撤销链接已发送至您的邮箱", gin.H{
+		"deleteAt": deleteAt.Unix(),
+	})
+}
+
+// UserDeleteCancel
+// @description 通过邮件链接撤销注销
+// @router POST /user/delete/cancel
+func UserDeleteCancel(c *gin.Context) {
+	var req dto.UserDeleteCancelRequest
+	api := apiutil.New(c)
+
+	if err := dto.BindJSON(c, &req); err != nil {
+		api.Fail(apiutil.CodeInvalidParams, "请求参数错误")
+		return
+	}
+
+	userId, err := service.From(c).Users.CancelDeletion(c, req.Token)
+	if errors.Is(err, userutil.ErrDeletionTokenInvalid) {
+		api.Fail(apiutil.CodeLinkInvalid, "链接无效或已过期")
+		return
+	} else if err != nil {
+		api.Fail(apiutil.CodeInternal, "system error")
+		return
+	}
+
+	service.From(c).Audit.Record(auditutil.FromContext(c), auditutil.Entry{
+		Action:     auditutil.ActionAccountDeleteCancel,
+		UserId:     userId,
+		TargetType: auditutil.TargetUser,
+		TargetId:   strconv.Itoa(userId),
+	})
+
+	api.Success("已撤销注销")
+}
+
+// UserExport
+// @description 导出用户数据
+// @router GET /user/export
+func UserExport(c *gin.Context) {
+	api := apiutil.New(c)
+
+	export, err := service.From(c).Users.Export(c.GetInt("userId"))
+	if err != nil {
+		log.Printf("[ERROR] UserExport %v", err)
+		api.Fail(apiutil.CodeInternal, "system error")
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="openid-export-`+export.Account.Username+`.json"`)
+	api.SuccessWithData("success", export)
+}
+
+// UserSecurityLog
+// @description 查看自己账号的安全日志
+// @router GET /user/security-log
+func UserSecurityLog(c *gin.Context) {
+	api := apiutil.New(c)
+	limit, offset := getPagination(c)
+
+	logs, total, err := service.From(c).Audit.List(auditutil.Filter{UserId: c.GetInt("userId")}, limit, offset)
+	if err != nil {
+		api.Fail(apiutil.CodeInternal, "system error")
+		return
+	}
+
+	api.SuccessWithData("success", gin.H{
+		"total": total,
+		"list":  logs,
+	})
+}
+
+// UserLoginHistory
+// @description 查看登录历史
+// @router GET /user/login-history
+func UserLoginHistory(c *gin.Context) {
+	api := apiutil.New(c)
+	limit, offset := getPagination(c)
+
+	records, total, err := service.From(c).Users.LoginHistory(c.GetInt("userId"), limit, offset)
+	if err != nil {
+		api.Fail(apiutil.CodeInternal, "system error")
+		return
+	}
+
+	api.SuccessWithData("success", gin.H{
+		"total": total,
+		"list":  records,
+	})
+}
+
+// failPasswordPolicy 返回密码不符合策略的具体原因
+func failPasswordPolicy(api *apiutil.Api, err error) {
+	var policyErr *passwordutil.PolicyError
+	if errors.As(err, &policyErr) {
+		api.FailWithData(apiutil.CodePasswordWeak, "密码不符合安全要求", gin.H{
+			"reasons": policyErr.Violations,
+		})
+		return
+	}
+	api.Fail(apiutil.CodeInternal, "system error")
+}
+
+// recordUserEvent 记录当前登录用户对自己账号的操作
+func recordUserEvent(c *gin.Context, action, result, detail string) {
+	userId := c.GetInt("userId")
+	service.From(c).Audit.Record(auditutil.FromContext(c), auditutil.Entry{
+		Action:     action,
+		UserId:     userId,
+		TargetType: auditutil.TargetUser,
+		TargetId:   strconv.Itoa(userId),
+		Result:     result,
+		Detail:     detail,
+	})
+}
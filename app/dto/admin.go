@@ -0,0 +1,7 @@
+package dto
+
+// AdminUserSuspendRequest 封禁账号请求
+type AdminUserSuspendRequest struct {
+	Reason string `json:"reason" binding:"required,max=255"`
+	Until  int64  `json:"until"` // 解封时间 (unix 秒), 0 为永久
+}
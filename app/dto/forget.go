@@ -9,5 +9,5 @@ type ForgetPasswordCodeRequest struct {
 type ForgetPasswordUpdateRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Code     string `json:"code" binding:"required"`
-	Password string `json:"password" binding:"required,min=8,max=64"`
+	Password string `json:"password" binding:"required"`
 }
\ No newline at end of file
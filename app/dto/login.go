@@ -9,4 +9,9 @@ type LoginRequest struct {
 // LoginResponse 登录响应
 type LoginResponse struct {
 	Token string `json:"token"`
-}
\ No newline at end of file
+}
+
+// LoginDenyRequest 登录提醒中 "不是我本人" 请求
+type LoginDenyRequest struct {
+	Token string `json:"token" binding:"required"`
+}
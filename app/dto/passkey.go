@@ -2,11 +2,12 @@ package dto
 
 // PasskeyRegistrationFinishRequest Passkey注册完成请求
 type PasskeyRegistrationFinishRequest struct {
-	ID     string `json:"id" binding:"required"`
-	RawID  string `json:"rawId" binding:"required"`
-	Type   string `json:"type" binding:"required"`
-	Remark string `json:"remark,omitempty"`
-	Response struct {
+	ID        string `json:"id" binding:"required"`
+	RawID     string `json:"rawId" binding:"required"`
+	Type      string `json:"type" binding:"required"`
+	Remark    string `json:"remark,omitempty"`
+	SessionID string `json:"sessionId"` // 注册参数中的 sessionId
+	Response  struct {
 		AttestationObject string   `json:"attestationObject" binding:"required"`
 		ClientDataJSON    string   `json:"clientDataJSON" binding:"required"`
 		Transports        []string `json:"transports,omitempty"`
@@ -14,12 +15,18 @@ type PasskeyRegistrationFinishRequest struct {
 	AuthenticatorAttachment string `json:"authenticatorAttachment,omitempty"`
 }
 
+// PasskeyRenameRequest 修改 Passkey 备注请求
+type PasskeyRenameRequest struct {
+	Remark string `json:"remark"`
+}
+
 // PasskeyLoginFinishRequest Passkey登录完成请求
 type PasskeyLoginFinishRequest struct {
-	ID    string `json:"id" binding:"required"`
-	RawID string `json:"rawId" binding:"required"`
-	Type  string `json:"type" binding:"required"`
-	Response struct {
+	ID        string `json:"id" binding:"required"`
+	RawID     string `json:"rawId" binding:"required"`
+	Type      string `json:"type" binding:"required"`
+	SessionID string `json:"sessionId"` // 登录参数中的 sessionId
+	Response  struct {
 		ClientDataJSON    string `json:"clientDataJSON" binding:"required"`
 		AuthenticatorData string `json:"authenticatorData" binding:"required"`
 		Signature         string `json:"signature" binding:"required"`
@@ -49,4 +56,4 @@ type PasskeySummaryResponse struct {
 	CloneWarning bool     `json:"clone_warning"`
 	SignCount    uint32   `json:"sign_count"`
 	Transports   []string `json:"transports,omitempty"`
-}
\ No newline at end of file
+}
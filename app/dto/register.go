@@ -11,4 +11,18 @@ type RegisterSubmitRequest struct {
 	Code       string `json:"code" binding:"required"`
 	Username   string `json:"username" binding:"required"`
 	Password   string `json:"password" binding:"required"`
-}
\ No newline at end of file
+}
+
+// RegisterPasskeyOptionsRequest 无密码注册: 验证邮箱并获取 passkey 注册参数
+type RegisterPasskeyOptionsRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Code     string `json:"code" binding:"required"`
+	Username string `json:"username" binding:"required"`
+}
+
+// RegisterPasskeyRequest 无密码注册: 与 WebAuthn 注册响应位于同一请求体
+type RegisterPasskeyRequest struct {
+	SignupToken string `json:"signupToken"`
+	SessionID   string `json:"sessionId"` // options 中的 sessionId
+	Remark      string `json:"remark,omitempty"`
+}
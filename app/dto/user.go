@@ -1,9 +1,19 @@
 package dto
 
-// UserPasswordUpdateRequest 用户更新密码请求
+import "encoding/json"
+
+// UserPasswordUpdateRequest 用户更新密码请求, 需先通过 /user/reauth 验证身份
 type UserPasswordUpdateRequest struct {
-	OldPassword string `json:"old_password" binding:"required"`
-	NewPassword string `json:"new_password" binding:"required,min=8,max=64"`
+	NewPassword string `json:"new_password" binding:"required"`
+	// Deprecated: 旧版客户端随请求提交的当前密码, 弃用期内由 RequireReauthOrPassword 校验; 新客户端应先调用 /user/reauth
+	OldPassword string `json:"old_password"`
+}
+
+// UserReauthRequest 重新验证身份请求, password 与 credential 二选一
+type UserReauthRequest struct {
+	Password   string          `json:"password"`
+	Credential json.RawMessage `json:"credential"` // navigator.credentials.get 的完整 JSON
+	SessionID  string          `json:"sessionId"`  // /user/reauth/options 返回的 sessionId, 使用 credential 时必填
 }
 
 // UserEmailUpdateCodeRequest 发送邮箱更新验证码请求
@@ -31,4 +41,9 @@ type UserStatusResponse struct {
 	Login    bool   `json:"login"`
 	Username string `json:"username,omitempty"`
 	Email    string `json:"email,omitempty"`
-}
\ No newline at end of file
+}
+
+// UserDeleteCancelRequest 撤销注销请求
+type UserDeleteCancelRequest struct {
+	Token string `json:"token" binding:"required"`
+}
@@ -1,7 +1,10 @@
 package middleware
 
 import (
+	"errors"
+
 	"github.com/gin-gonic/gin"
+	"github.com/soxft/openid-go/app/service"
 	"github.com/soxft/openid-go/library/apiutil"
 	"github.com/soxft/openid-go/library/userutil"
 )
@@ -9,15 +12,22 @@ import (
 func AuthPermission() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		api := apiutil.New(c)
+		svc := service.From(c)
 
 		// check jwt token
 		var token string
 		if token = userutil.GetJwtFromAuth(c.GetHeader("Authorization")); token == "" {
-			api.Abort401("Unauthorized", "middleware.permission.token_empty")
+			api.Abort(apiutil.CodeUnauthorized, "Unauthorized", "middleware.permission.token_empty")
 			return
 		}
-		if userInfo, err := userutil.CheckPermission(c, token); err != nil {
-			api.Abort401("Unauthorized", "middleware.permission.token_invalid")
+		if userInfo, err := svc.Tokens.Verify(c, token); err != nil {
+			api.Abort(apiutil.CodeUnauthorized, "Unauthorized", "middleware.permission.token_invalid")
+			return
+		} else if err := svc.Users.CheckSuspended(c, userInfo.UserId); errors.Is(err, userutil.ErrAccountSuspended) {
+			api.Abort(apiutil.CodeAccountSuspended, "Account suspended", "middleware.permission.account_suspended")
+			return
+		} else if err != nil {
+			api.Abort(apiutil.CodeUnauthorized, "Unauthorized", "middleware.permission.user_invalid")
 			return
 		} else {
 			c.Set("userId", userInfo.UserId)
@@ -25,6 +35,24 @@ func AuthPermission() gin.HandlerFunc {
 			c.Set("email", userInfo.Email)
 			c.Set("lastTime", userInfo.LastTime)
 			c.Set("token", token)
+			c.Set("jti", userInfo.Jti)
+		}
+		c.Next()
+	}
+}
+
+// AdminPermission 管理员权限, 需在 AuthPermission 之后使用
+func AdminPermission() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		api := apiutil.New(c)
+
+		isAdmin, err := service.From(c).Users.IsAdmin(c.GetInt("userId"))
+		if err != nil {
+			api.Abort(apiutil.CodeInternal, "system error", "middleware.permission.admin_check_failed")
+			return
+		} else if !isAdmin {
+			api.Abort(apiutil.CodeForbidden, "Forbidden", "middleware.permission.not_admin")
+			return
 		}
 		c.Next()
 	}
@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/soxft/openid-go/app/service"
+	"github.com/soxft/openid-go/library/userutil"
+)
+
+type fakeTokens struct {
+	service.TokenService
+	valid    map[string]userutil.UserInfo
+	elevated map[string]bool
+}
+
+func (f fakeTokens) Verify(_ context.Context, token string) (userutil.UserInfo, error) {
+	info, ok := f.valid[token]
+	if !ok {
+		return info, errors.New("invalid token")
+	}
+	return info, nil
+}
+
+func (f fakeTokens) Elevated(_ context.Context, jti string) (bool, error) {
+	return f.elevated[jti], nil
+}
+
+type fakeUsers struct {
+	service.UserService
+	suspended map[int]bool
+	admins    map[int]bool
+}
+
+func (f fakeUsers) CheckSuspended(_ context.Context, userId int) error {
+	if f.suspended[userId] {
+		return userutil.ErrAccountSuspended
+	}
+	return nil
+}
+
+func (f fakeUsers) IsAdmin(userId int) (bool, error) {
+	return f.admins[userId], nil
+}
+
+func TestAuthPermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	s := &service.Services{
+		Tokens: fakeTokens{valid: map[string]userutil.UserInfo{
+			"user":      {UserId: 1, Username: "user"},
+			"admin":     {UserId: 2, Username: "admin"},
+			"suspended": {UserId: 3, Username: "suspended"},
+		}},
+		Users: fakeUsers{
+			suspended: map[int]bool{3: true},
+			admins:    map[int]bool{2: true},
+		},
+	}
+
+	r := gin.New()
+	r.Use(service.Inject(s))
+	r.GET("/user", AuthPermission(), func(c *gin.Context) {
+		c.String(200, c.GetString("username"))
+	})
+	r.GET("/admin", AuthPermission(), AdminPermission(), func(c *gin.Context) {
+		c.String(200, "ok")
+	})
+
+	cases := []struct {
+		path, token string
+		code        int
+	}{
+		{"/user", "", 401},
+		{"/user", "bogus", 401},
+		{"/user", "user", 200},
+		{"/user", "suspended", 403},
+		{"/admin", "user", 403},
+		{"/admin", "admin", 200},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		r.ServeHTTP(w, req)
+
+		if w.Code != tc.code {
+			t.Errorf("GET %s with %q = %d, want %d", tc.path, tc.token, w.Code, tc.code)
+		}
+	}
+}
+
+func TestRequireReauth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	s := &service.Services{
+		Tokens: fakeTokens{
+			valid: map[string]userutil.UserInfo{
+				"fresh": {UserId: 1, Jti: "jti-fresh"},
+				"stale": {UserId: 1, Jti: "jti-stale"},
+			},
+			elevated: map[string]bool{"jti-fresh": true},
+		},
+		Users: fakeUsers{},
+	}
+
+	r := gin.New()
+	r.Use(service.Inject(s))
+	r.POST("/sensitive", AuthPermission(), RequireReauth(), func(c *gin.Context) {
+		c.String(200, "ok")
+	})
+
+	cases := []struct {
+		token string
+		code  int
+	}{
+		{"", 401},
+		{"stale", 403},
+		{"fresh", 200},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/sensitive", nil)
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		r.ServeHTTP(w, req)
+
+		if w.Code != tc.code {
+			t.Errorf("POST /sensitive with %q = %d, want %d", tc.token, w.Code, tc.code)
+		}
+	}
+}
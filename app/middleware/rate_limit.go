@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/soxft/openid-go/app/service"
+	"github.com/soxft/openid-go/config"
+	"github.com/soxft/openid-go/library/apiutil"
+	"github.com/soxft/openid-go/library/limitutil"
+)
+
+// maxAppIdLen appid 的最大长度, 生成的 appid 为 16 位数字
+const maxAppIdLen = 32
+
+// RateLimit v1 接口令牌桶限流
+// 每个请求先消耗客户端 IP 的总桶, 无论携带什么 appid; 携带 appid 时再消耗 appid + IP 的桶, 并使用该应用单独配置的规则.
+// 限流在查询应用之前完成, 不存在的 appid 同样计数; 伪造 appid 得到的新桶仍受 IP 总桶限制
+func RateLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !config.RateLimit.Enable {
+			c.Next()
+			return
+		}
+
+		ip := c.ClientIP()
+		res, ok := takeToken(c, "ip:"+ip, limitutil.IpRule())
+		if !ok {
+			return
+		}
+
+		if appId := getRequestAppId(c); appId != "" {
+			appRes, ok := takeToken(c, appLimitKey(appId, ip), limitutil.RuleFor(appId))
+			if !ok {
+				return
+			}
+			if res == nil || (appRes != nil && appRes.Remaining < res.Remaining) {
+				res = appRes
+			}
+		}
+
+		if res != nil {
+			setRateLimitHeaders(c, *res)
+		}
+		c.Next()
+	}
+}
+
+// AuthRateLimit 密码 / passkey 校验接口限流, 防止暴力破解
+// 已登录时按用户限制, 否则按客户端 IP 限制; 不受 RateLimit.Enable 影响
+func AuthRateLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := takeToken(c, authLimitKey(c), limitutil.AuthRule()); !ok {
+			return
+		}
+		c.Next()
+	}
+}
+
+func authLimitKey(c *gin.Context) string {
+	if userId := c.GetInt("userId"); userId > 0 {
+		return "auth:user:" + strconv.Itoa(userId)
+	}
+	return "auth:ip:" + c.ClientIP()
+}
+
+// appLimitKey appid + IP 的桶; 超长的 appid 必然不存在, 共用一个桶, 避免写入过长的 key
+func appLimitKey(appId, ip string) string {
+	if len(appId) > maxAppIdLen {
+		appId = "invalid"
+	}
+	return "app:" + appId + ":" + ip
+}
+
+// takeToken 从 key 对应的桶中取一个令牌, 被拒绝时中断请求并返回 false
+// 规则未启用时放行, 返回的结果为 nil;
+// redis 异常时默认放行 (fail-open), 避免限流组件拖垮整个接口, 配置 RateLimit.FailClosed 后改为拒绝请求
+func takeToken(c *gin.Context, key string, rule limitutil.Rule) (*limitutil.Result, bool) {
+	if rule.Rate <= 0 || rule.Burst <= 0 {
+		return nil, true
+	}
+
+	res, err := service.From(c).Limits.Allow(c, key, rule)
+	if err != nil {
+		log.Printf("[ERROR] rate limit: %v", err)
+		if config.RateLimit.FailClosed {
+			apiutil.New(c).Abort(apiutil.CodeInternal, "system error", "middleware.rate_limit.unavailable")
+			return nil, false
+		}
+		return nil, true
+	}
+
+	if !res.Allowed {
+		setRateLimitHeaders(c, res)
+		c.Header("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter.Seconds())))
+		apiutil.New(c).Abort(apiutil.CodeRateLimited, "too many requests", "middleware.rate_limit.exceeded")
+		return nil, false
+	}
+	return &res, true
+}
+
+func setRateLimitHeaders(c *gin.Context, res limitutil.Result) {
+	c.Header("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	c.Header("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset.Seconds())))
+}
+
+// getRequestAppId 依次从路由参数, query, JSON body 中获取 appid
+func getRequestAppId(c *gin.Context) string {
+	if appId := c.Param("appid"); appId != "" {
+		return appId
+	}
+	if appId := c.Query("appid"); appId != "" {
+		return appId
+	}
+
+	var req struct {
+		AppId string `json:"appid"`
+	}
+	_ = json.Unmarshal(peekJSONBody(c), &req)
+	return req.AppId
+}
+
+// peekJSONBody 读取 JSON 请求体并回填, 供后续 handler 读取; 非 JSON 请求返回 nil
+func peekJSONBody(c *gin.Context) []byte {
+	if c.Request.Body == nil || c.ContentType() != gin.MIMEJSON {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	if err != nil {
+		return nil
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	return body
+}
+
+func ceilSeconds(s float64) int {
+	return int(math.Ceil(s))
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/soxft/openid-go/app/service"
+	"github.com/soxft/openid-go/library/apiutil"
+	"github.com/soxft/openid-go/library/auditutil"
+	"github.com/soxft/openid-go/library/limitutil"
+	"github.com/soxft/openid-go/library/userutil"
+)
+
+// RequireReauth 敏感操作需当前会话近期通过 /user/reauth 重新验证身份, 需在 AuthPermission 之后使用
+func RequireReauth() gin.HandlerFunc {
+	return RequireReauthOrPassword("")
+}
+
+// RequireReauthOrPassword 同 RequireReauth, 弃用期内兼容旧版客户端:
+// 会话未验证时, 接受请求体 field 字段中的当前密码作为本次请求的验证, 与 /user/reauth 共用限流, 不提升会话
+func RequireReauthOrPassword(field string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		api := apiutil.New(c)
+
+		elevated, err := service.From(c).Tokens.Elevated(c, c.GetString("jti"))
+		if err != nil {
+			api.Abort(apiutil.CodeInternal, "system error", "middleware.reauth.check_failed")
+			return
+		} else if elevated {
+			c.Next()
+			return
+		}
+
+		password := legacyPassword(c, field)
+		if password == "" {
+			api.Abort(apiutil.CodeReauthRequired, "请先验证身份", "middleware.reauth.required")
+			return
+		}
+		if _, ok := takeToken(c, authLimitKey(c), limitutil.AuthRule()); !ok {
+			return
+		}
+
+		c.Header("Deprecation", "true")
+		if _, err := service.From(c).Users.Authenticate(c.GetString("username"), password); errors.Is(err, userutil.ErrPasswd) {
+			recordReauth(c, auditutil.ResultFailure, "legacy password: 密码错误")
+			api.Abort(apiutil.CodePasswordIncorrect, "密码错误", "middleware.reauth.password_incorrect")
+			return
+		} else if err != nil {
+			api.Abort(apiutil.CodeInternal, "system error", "middleware.reauth.check_failed")
+			return
+		}
+		recordReauth(c, auditutil.ResultSuccess, "legacy password")
+		c.Next()
+	}
+}
+
+// legacyPassword 旧版客户端随请求提交的当前密码
+func legacyPassword(c *gin.Context, field string) string {
+	if field == "" {
+		return ""
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(peekJSONBody(c), &body); err != nil {
+		return ""
+	}
+	var password string
+	_ = json.Unmarshal(body[field], &password)
+	return password
+}
+
+func recordReauth(c *gin.Context, result, detail string) {
+	userId := c.GetInt("userId")
+	service.From(c).Audit.Record(auditutil.FromContext(c), auditutil.Entry{
+		Action:     auditutil.ActionReauth,
+		UserId:     userId,
+		TargetType: auditutil.TargetUser,
+		TargetId:   strconv.Itoa(userId),
+		Result:     result,
+		Detail:     detail,
+	})
+}
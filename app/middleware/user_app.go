@@ -1,7 +1,10 @@
 package middleware
 
 import (
+	"errors"
+
 	"github.com/gin-gonic/gin"
+	"github.com/soxft/openid-go/app/service"
 	"github.com/soxft/openid-go/library/apiutil"
 	"github.com/soxft/openid-go/library/apputil"
 )
@@ -13,23 +16,27 @@ func UserApp() gin.HandlerFunc {
 
 		appID := c.Param("appid")
 		if appID == "" {
-			api.Abort200("app id is empty", "middleware.user_app.app_id_empty")
+			api.Abort200(apiutil.CodeInvalidParams, "app id is empty", "middleware.user_app.app_id_empty")
 			return
 		}
 
 		var userID int
 		if userID = c.GetInt("userId"); userID == 0 {
-			api.Abort401("Unauthorized", "middleware.user_app.user_id_empty")
+			api.Abort(apiutil.CodeUnauthorized, "Unauthorized", "middleware.user_app.user_id_empty")
 			return
 		}
 
-		if i, err := apputil.CheckIfUserApp(appID, userID); err != nil {
+		if i, err := service.From(c).Apps.IsOwner(appID, userID); err != nil {
 			//log.Printf("check if user app error: %v", err)
 
-			api.Abort401("Unauthorized", "middleware.user_app.error.not_user_app")
+			code := apiutil.CodeInternal
+			if errors.Is(err, apputil.ErrAppNotExist) {
+				code = apiutil.CodeAppNotFound
+			}
+			api.Abort401(code, "Unauthorized", "middleware.user_app.error.not_user_app")
 			return
 		} else if !i {
-			api.Abort200("Unauthorized", "middleware.user_app.not_user_app")
+			api.Abort200(apiutil.CodeForbidden, "Unauthorized", "middleware.user_app.not_user_app")
 			return
 		}
 
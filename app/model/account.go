@@ -1,12 +1,25 @@
 package model
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type Account struct {
 	ID       int    `gorm:"autoIncrement;primaryKey"`
 	Username string `gorm:"type:varchar(20);uniqueIndex;not null"`
 	Password string `gorm:"type:varchar(128);not null"`
 	Email    string `gorm:"type:varchar(128);uniqueIndex"`
-	RegTime  int64  `gorm:"bigint(20)"`
+	RegTime  int64  `gorm:"type:bigint"`
 	RegIp    string `gorm:"type:varchar(128)"`
-	LastTime int64  `gorm:"bigint(20)"`
+	LastTime int64  `gorm:"type:bigint"`
 	LastIp   string `gorm:"type:varchar(128)"`
+	DeleteAt int64  `gorm:"type:bigint;default:0;index"` // 计划删除时间, 0 为未申请注销
+	Role     string `gorm:"type:varchar(16);default:'user'"`
+
+	PendingSignup bool `gorm:"not null;default:false;index"` // 无密码注册尚未绑定 passkey, 超时后由 SignupSweeper 删除
+
+	SuspendedAt   int64  `gorm:"type:bigint;default:0"` // 封禁时间, 0 为未封禁
+	SuspendUntil  int64  `gorm:"type:bigint;default:0"` // 解封时间, 0 为永久
+	SuspendReason string `gorm:"type:varchar(255)"`
 }
@@ -0,0 +1,16 @@
+package model
+
+// AuditLog 安全审计日志, 只追加不修改
+type AuditLog struct {
+	ID         int64  `gorm:"autoIncrement;primaryKey"`
+	Action     string `gorm:"type:varchar(64);index;not null"`
+	ActorId    int    `gorm:"index"` // 操作者, 0 为匿名或系统
+	UserId     int    `gorm:"index"` // 事件所属用户
+	TargetType string `gorm:"type:varchar(32)"`
+	TargetId   string `gorm:"type:varchar(64);index"`
+	Ip         string `gorm:"type:varchar(128)"`
+	UserAgent  string `gorm:"type:varchar(255)"`
+	Result     string `gorm:"type:varchar(16)"`
+	Detail     string `gorm:"type:varchar(255)"`
+	CreatedAt  int64  `gorm:"type:bigint;index;not null"`
+}
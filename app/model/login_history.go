@@ -0,0 +1,13 @@
+package model
+
+// LoginHistory 登录历史
+type LoginHistory struct {
+	ID         int64  `gorm:"autoIncrement;primaryKey"`
+	UserId     int    `gorm:"index;not null"`
+	Ip         string `gorm:"type:varchar(128)"`
+	Network    string `gorm:"type:varchar(64)"` // IPv4 /24, IPv6 /48
+	UserAgent  string `gorm:"type:varchar(255)"`
+	DeviceHash string `gorm:"type:varchar(64)"`
+	Method     string `gorm:"type:varchar(16)"` // password / passkey
+	CreatedAt  int64  `gorm:"type:bigint;index;not null"`
+}
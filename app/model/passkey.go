@@ -7,9 +7,9 @@ type PassKey struct {
 	PublicKey    string `gorm:"type:text;not null"`
 	Attestation  string `gorm:"type:varchar(32)"`
 	AAGUID       string `gorm:"type:varchar(64)"`
-	SignCount    uint32 `gorm:"type:int unsigned"`
+	SignCount    uint32 `gorm:"default:0"`
 	Transport    string `gorm:"type:varchar(255)"`
-	CloneWarning bool   `gorm:"type:tinyint(1);default:0"`
+	CloneWarning bool   `gorm:"default:false"`
 	Remark       string `gorm:"type:varchar(255);default:''"`  // 备注字段
 	CreatedAt    int64  `gorm:"type:bigint;not null"`
 	UpdatedAt    int64  `gorm:"type:bigint;not null"`
@@ -0,0 +1,9 @@
+package model
+
+// PasswordHistory 历史密码 (hash), 用于禁止重复使用最近的密码
+type PasswordHistory struct {
+	ID        int64  `gorm:"autoIncrement;primaryKey"`
+	UserId    int    `gorm:"index;not null"`
+	Password  string `gorm:"type:varchar(128);not null"`
+	CreatedAt int64  `gorm:"type:bigint;not null"`
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"github.com/redis/go-redis/v9"
+	"github.com/soxft/openid-go/library/apputil"
+	"github.com/soxft/openid-go/library/auditutil"
+	"github.com/soxft/openid-go/library/mq"
+	"gorm.io/gorm"
+)
+
+// AppService 开发者应用
+type AppService interface {
+	Create(userId int, appName string) error
+	Update(appId, appName string, gateways []string) error
+	Delete(appId string, actor auditutil.Actor) error
+	RegenerateSecret(appId string, actor auditutil.Actor) (string, error)
+	// Info 应用信息, 不含密钥
+	Info(appId string) (apputil.AppInfoStruct, error)
+	// FullInfo 应用信息及密钥, 仅用于返回给应用所有者
+	FullInfo(appId string) (apputil.AppFullInfoStruct, error)
+	CheckSecret(appId, appSecret string) error
+	IsOwner(appId string, userId int) (bool, error)
+
+	Count(userId int) (int, error)
+	List(userId, limit, offset int) ([]apputil.AppBaseStruct, error)
+	Search(keyword string, limit, offset int) ([]apputil.AppAdminStruct, int64, error)
+}
+
+type appService struct {
+	db    *gorm.DB
+	rdb   redis.Cmdable
+	queue mq.MessageQueue
+}
+
+func NewAppService(db *gorm.DB, rdb redis.Cmdable, queue mq.MessageQueue) AppService {
+	return appService{db: db, rdb: rdb, queue: queue}
+}
+
+func (s appService) Create(userId int, appName string) error {
+	_, err := apputil.CreateApp(s.db, userId, appName)
+	return err
+}
+
+func (s appService) Update(appId, appName string, gateways []string) error {
+	return apputil.UpdateApp(s.db, s.rdb, appId, appName, gateways)
+}
+
+func (s appService) Delete(appId string, actor auditutil.Actor) error {
+	_, err := apputil.DeleteUserApp(s.db, s.rdb, appId, actor)
+	return err
+}
+
+func (s appService) RegenerateSecret(appId string, actor auditutil.Actor) (string, error) {
+	return apputil.ReGenerateSecret(s.db, s.rdb, appId, actor)
+}
+
+func (s appService) Info(appId string) (apputil.AppInfoStruct, error) {
+	return apputil.GetAppInfo(s.db, s.rdb, appId)
+}
+
+func (s appService) FullInfo(appId string) (apputil.AppFullInfoStruct, error) {
+	return apputil.GetAppFullInfo(s.db, s.rdb, appId)
+}
+
+func (s appService) CheckSecret(appId, appSecret string) error {
+	return apputil.CheckAppSecret(s.db, appId, appSecret)
+}
+
+func (s appService) IsOwner(appId string, userId int) (bool, error) {
+	return apputil.CheckIfUserApp(s.db, appId, userId)
+}
+
+func (s appService) Count(userId int) (int, error) {
+	return apputil.GetUserAppCount(s.db, userId)
+}
+
+func (s appService) List(userId, limit, offset int) ([]apputil.AppBaseStruct, error) {
+	return apputil.GetUserAppList(s.db, userId, limit, offset)
+}
+
+func (s appService) Search(keyword string, limit, offset int) ([]apputil.AppAdminStruct, int64, error) {
+	return apputil.SearchApps(s.db, keyword, limit, offset)
+}
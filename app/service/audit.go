@@ -0,0 +1,39 @@
+package service
+
+import (
+	"github.com/redis/go-redis/v9"
+	"github.com/soxft/openid-go/library/auditutil"
+	"github.com/soxft/openid-go/library/mq"
+	"gorm.io/gorm"
+)
+
+// AuditService 安全审计日志
+type AuditService interface {
+	// Record 写入一条审计日志, 失败只记录错误日志, 不影响业务
+	Record(actor auditutil.Actor, e auditutil.Entry)
+	List(f auditutil.Filter, limit, offset int) ([]auditutil.Log, int64, error)
+	// Each 按批遍历符合条件的日志, 用于导出
+	Each(f auditutil.Filter, batchSize int, fn func([]auditutil.Log) error) error
+}
+
+type auditService struct {
+	db    *gorm.DB
+	rdb   redis.Cmdable
+	queue mq.MessageQueue
+}
+
+func NewAuditService(db *gorm.DB, rdb redis.Cmdable, queue mq.MessageQueue) AuditService {
+	return auditService{db: db, rdb: rdb, queue: queue}
+}
+
+func (s auditService) Record(actor auditutil.Actor, e auditutil.Entry) {
+	auditutil.Record(s.db, actor, e)
+}
+
+func (s auditService) List(f auditutil.Filter, limit, offset int) ([]auditutil.Log, int64, error) {
+	return auditutil.List(s.db, f, limit, offset)
+}
+
+func (s auditService) Each(f auditutil.Filter, batchSize int, fn func([]auditutil.Log) error) error {
+	return auditutil.Each(s.db, f, batchSize, fn)
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/soxft/openid-go/api/version_one/helper"
+	"github.com/soxft/openid-go/library/mq"
+	"gorm.io/gorm"
+)
+
+// GrantService v1 授权: 一次性 token 与用户在应用下的 openId / uniqueId
+type GrantService interface {
+	// CreateToken 用户授权应用后生成一次性 token
+	CreateToken(ctx context.Context, appId string, userId int) (string, error)
+	// UserIdByToken 获取 token 对应的用户
+	UserIdByToken(ctx context.Context, appId, token string) (int, error)
+	DeleteToken(ctx context.Context, appId, token string) error
+	UserIds(appId string, userId int) (helper.UserIdsStruct, error)
+}
+
+type grantService struct {
+	db    *gorm.DB
+	rdb   redis.Cmdable
+	queue mq.MessageQueue
+}
+
+func NewGrantService(db *gorm.DB, rdb redis.Cmdable, queue mq.MessageQueue) GrantService {
+	return grantService{db: db, rdb: rdb, queue: queue}
+}
+
+func (s grantService) CreateToken(ctx context.Context, appId string, userId int) (string, error) {
+	return helper.GenerateToken(ctx, s.rdb, appId, userId)
+}
+
+func (s grantService) UserIdByToken(ctx context.Context, appId, token string) (int, error) {
+	return helper.GetUserIdByToken(ctx, s.rdb, appId, token)
+}
+
+func (s grantService) DeleteToken(ctx context.Context, appId, token string) error {
+	return helper.DeleteToken(ctx, s.rdb, appId, token)
+}
+
+func (s grantService) UserIds(appId string, userId int) (helper.UserIdsStruct, error) {
+	return helper.GetUserIds(s.db, s.rdb, appId, userId)
+}
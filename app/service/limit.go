@@ -0,0 +1,30 @@
+package service
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/soxft/openid-go/library/limitutil"
+	"github.com/soxft/openid-go/library/mq"
+	"gorm.io/gorm"
+)
+
+// LimitService 令牌桶限流
+type LimitService interface {
+	// Allow 从 key 对应的令牌桶中取一个令牌
+	Allow(ctx context.Context, key string, rule limitutil.Rule) (limitutil.Result, error)
+}
+
+type limitService struct {
+	db    *gorm.DB
+	rdb   redis.Cmdable
+	queue mq.MessageQueue
+}
+
+func NewLimitService(db *gorm.DB, rdb redis.Cmdable, queue mq.MessageQueue) LimitService {
+	return limitService{db: db, rdb: rdb, queue: queue}
+}
+
+func (s limitService) Allow(ctx context.Context, key string, rule limitutil.Rule) (limitutil.Result, error) {
+	return limitutil.Allow(ctx, s.rdb, key, rule)
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/soxft/openid-go/library/codeutil"
+	"github.com/soxft/openid-go/library/mailutil"
+	"github.com/soxft/openid-go/library/mq"
+	"gorm.io/gorm"
+)
+
+// MailService 邮箱验证码, 发信频率信标与邮件投递
+type MailService interface {
+	// Coder 邮箱验证码
+	Coder(ctx context.Context) codeutil.Coder
+	// CheckBeacon 当前客户端或邮箱是否在信标有效期内发过信
+	CheckBeacon(c *gin.Context, email string) (bool, error)
+	CreateBeacon(c *gin.Context, email string, timeout time.Duration) error
+	DeleteBeacon(c *gin.Context, email string)
+	// Send 投递到邮件队列, 由队列消费者发送
+	Send(mail mailutil.Mail) error
+}
+
+type mailService struct {
+	db    *gorm.DB
+	rdb   redis.Cmdable
+	queue mq.MessageQueue
+}
+
+func NewMailService(db *gorm.DB, rdb redis.Cmdable, queue mq.MessageQueue) MailService {
+	return mailService{db: db, rdb: rdb, queue: queue}
+}
+
+func (s mailService) Coder(ctx context.Context) codeutil.Coder {
+	return codeutil.New(ctx, s.rdb)
+}
+
+func (s mailService) CheckBeacon(c *gin.Context, email string) (bool, error) {
+	return mailutil.CheckBeacon(c, s.rdb, email)
+}
+
+func (s mailService) CreateBeacon(c *gin.Context, email string, timeout time.Duration) error {
+	return mailutil.CreateBeacon(c, s.rdb, email, timeout)
+}
+
+func (s mailService) DeleteBeacon(c *gin.Context, email string) {
+	mailutil.DeleteBeacon(c, s.rdb, email)
+}
+
+func (s mailService) Send(mail mailutil.Mail) error {
+	_msg, err := json.Marshal(mail)
+	if err != nil {
+		return err
+	}
+	return s.queue.Publish("mail", string(_msg), 0)
+}
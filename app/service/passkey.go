@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/redis/go-redis/v9"
+	"github.com/soxft/openid-go/app/model"
+	"github.com/soxft/openid-go/library/auditutil"
+	"github.com/soxft/openid-go/library/mq"
+	"github.com/soxft/openid-go/library/passkey"
+	"gorm.io/gorm"
+)
+
+// PasskeyService WebAuthn 凭证
+type PasskeyService interface {
+	BeginRegistration(ctx context.Context, account model.Account) (passkey.RegistrationOptions, error)
+	FinishRegistration(ctx context.Context, actor auditutil.Actor, account model.Account, sessionID string, parsed *protocol.ParsedCredentialCreationData, remark string) (*model.PassKey, error)
+	BeginLogin(ctx context.Context) (passkey.LoginOptions, error)
+	// FinishLogin 校验断言并返回 userHandle 对应的账号; 账号确定后即使校验失败也会返回
+	FinishLogin(ctx context.Context, sessionID string, parsed *protocol.ParsedCredentialAssertionData) (model.Account, *model.PassKey, error)
+	// BeginReauth / FinishReauth 已登录用户使用自己的 passkey 重新验证身份
+	BeginReauth(ctx context.Context, account model.Account) (passkey.LoginOptions, error)
+	FinishReauth(ctx context.Context, account model.Account, sessionID string, parsed *protocol.ParsedCredentialAssertionData) (*model.PassKey, error)
+	List(userId int) ([]model.PassKey, error)
+	Rename(actor auditutil.Actor, userId, passkeyId int, remark string) (*model.PassKey, error)
+	Delete(actor auditutil.Actor, userId, passkeyId int) error
+}
+
+type passkeyService struct {
+	db    *gorm.DB
+	rdb   redis.Cmdable
+	queue mq.MessageQueue
+}
+
+func NewPasskeyService(db *gorm.DB, rdb redis.Cmdable, queue mq.MessageQueue) PasskeyService {
+	return passkeyService{db: db, rdb: rdb, queue: queue}
+}
+
+func (s passkeyService) BeginRegistration(ctx context.Context, account model.Account) (passkey.RegistrationOptions, error) {
+	return passkey.BeginRegistration(ctx, s.db, s.rdb, account)
+}
+
+func (s passkeyService) FinishRegistration(ctx context.Context, actor auditutil.Actor, account model.Account, sessionID string, parsed *protocol.ParsedCredentialCreationData, remark string) (*model.PassKey, error) {
+	return passkey.CompleteRegistrationWithRemark(ctx, s.db, s.rdb, actor, account, sessionID, parsed, remark)
+}
+
+func (s passkeyService) BeginLogin(ctx context.Context) (passkey.LoginOptions, error) {
+	return passkey.BeginDiscoverableLogin(ctx, s.rdb)
+}
+
+func (s passkeyService) FinishLogin(ctx context.Context, sessionID string, parsed *protocol.ParsedCredentialAssertionData) (model.Account, *model.PassKey, error) {
+	return passkey.CompleteDiscoverableLogin(ctx, s.db, s.rdb, sessionID, parsed)
+}
+
+func (s passkeyService) BeginReauth(ctx context.Context, account model.Account) (passkey.LoginOptions, error) {
+	return passkey.BeginLoginForUser(ctx, s.db, s.rdb, account)
+}
+
+func (s passkeyService) FinishReauth(ctx context.Context, account model.Account, sessionID string, parsed *protocol.ParsedCredentialAssertionData) (*model.PassKey, error) {
+	return passkey.CompleteLoginWithAssertion(ctx, s.db, s.rdb, account, sessionID, parsed)
+}
+
+func (s passkeyService) List(userId int) ([]model.PassKey, error) {
+	return passkey.ListUserPasskeys(s.db, userId)
+}
+
+func (s passkeyService) Rename(actor auditutil.Actor, userId, passkeyId int, remark string) (*model.PassKey, error) {
+	return passkey.RenameUserPasskey(s.db, actor, userId, passkeyId, remark)
+}
+
+func (s passkeyService) Delete(actor auditutil.Actor, userId, passkeyId int) error {
+	return passkey.DeleteUserPasskey(s.db, actor, userId, passkeyId)
+}
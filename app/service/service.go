@@ -0,0 +1,57 @@
+// Package service 定义 handler 依赖的服务接口
+//
+// handler 通过 From 获取服务, 不直接持有数据库, redis 与队列, 也不直接调用 userutil / apputil / passkey,
+// 测试时可以注入内存实现. 默认实现委托给对应的 library 包.
+package service
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/soxft/openid-go/library/mq"
+	"gorm.io/gorm"
+)
+
+const contextKey = "services"
+
+// Services 处理请求所需的全部服务, 在 core.Init 中构造
+// 测试中可替换为内存实现
+type Services struct {
+	Users    UserService
+	Apps     AppService
+	Passkeys PasskeyService
+	Tokens   TokenService
+	Audit    AuditService
+	Mail     MailService
+	Limits   LimitService
+	Grants   GrantService
+}
+
+// New
+// @description 使用默认实现构造服务
+func New(db *gorm.DB, rdb redis.Cmdable, queue mq.MessageQueue) *Services {
+	return &Services{
+		Users:    NewUserService(db, rdb, queue),
+		Apps:     NewAppService(db, rdb, queue),
+		Passkeys: NewPasskeyService(db, rdb, queue),
+		Tokens:   NewTokenService(db, rdb, queue),
+		Audit:    NewAuditService(db, rdb, queue),
+		Mail:     NewMailService(db, rdb, queue),
+		Limits:   NewLimitService(db, rdb, queue),
+		Grants:   NewGrantService(db, rdb, queue),
+	}
+}
+
+// Inject
+// @description 将服务注入到请求上下文中
+func Inject(s *Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(contextKey, s)
+		c.Next()
+	}
+}
+
+// From
+// @description 获取注入的服务
+func From(c *gin.Context) *Services {
+	return c.MustGet(contextKey).(*Services)
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/soxft/openid-go/library/mq"
+	"github.com/soxft/openid-go/library/userutil"
+	"gorm.io/gorm"
+)
+
+// TokenService 登录凭证 (JWT) 与会话
+type TokenService interface {
+	// Issue 签发 JWT, 同时记录登录历史与会话
+	Issue(userId int, meta userutil.LoginMeta) (string, error)
+	// Verify 校验 JWT 及其是否已被吊销
+	Verify(ctx context.Context, token string) (userutil.UserInfo, error)
+	// Revoke 吊销单个 JWT
+	Revoke(ctx context.Context, token string) error
+	Sessions(ctx context.Context, userId int) ([]userutil.Session, error)
+	RevokeAll(ctx context.Context, userId int) error
+	// Elevate 标记会话 (jti) 已完成二次验证
+	Elevate(ctx context.Context, jti, method string) (time.Time, error)
+	// Elevated 会话是否在有效期内完成过二次验证
+	Elevated(ctx context.Context, jti string) (bool, error)
+}
+
+type tokenService struct {
+	db    *gorm.DB
+	rdb   redis.Cmdable
+	queue mq.MessageQueue
+}
+
+func NewTokenService(db *gorm.DB, rdb redis.Cmdable, queue mq.MessageQueue) TokenService {
+	return tokenService{db: db, rdb: rdb, queue: queue}
+}
+
+func (s tokenService) Issue(userId int, meta userutil.LoginMeta) (string, error) {
+	return userutil.GenerateJwt(s.db, s.rdb, s.queue, userId, meta)
+}
+
+func (s tokenService) Verify(ctx context.Context, token string) (userutil.UserInfo, error) {
+	return userutil.CheckPermission(ctx, s.rdb, token)
+}
+
+func (s tokenService) Revoke(ctx context.Context, token string) error {
+	return userutil.SetJwtExpire(ctx, s.rdb, token)
+}
+
+func (s tokenService) Sessions(ctx context.Context, userId int) ([]userutil.Session, error) {
+	return userutil.ListSessions(ctx, s.rdb, userId)
+}
+
+func (s tokenService) RevokeAll(ctx context.Context, userId int) error {
+	return userutil.RevokeAllSessions(ctx, s.rdb, userId)
+}
+
+func (s tokenService) Elevate(ctx context.Context, jti, method string) (time.Time, error) {
+	return userutil.MarkReauthenticated(ctx, s.rdb, jti, method)
+}
+
+func (s tokenService) Elevated(ctx context.Context, jti string) (bool, error) {
+	return userutil.IsReauthenticated(ctx, s.rdb, jti)
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/soxft/openid-go/app/model"
+	"github.com/soxft/openid-go/library/mq"
+	"github.com/soxft/openid-go/library/userutil"
+	"gorm.io/gorm"
+)
+
+// UserService 账号
+type UserService interface {
+	// Authenticate 校验用户名 (或邮箱) 与密码, 失败时 user id 为 0
+	Authenticate(username, password string) (int, error)
+	// FindLoginId 按用户名 (或邮箱) 查找 user id, 用于记录登录失败的目标账号
+	FindLoginId(username string) (int, error)
+	Get(userId int) (model.Account, error)
+	GetByEmail(email string) (model.Account, error)
+	IsAdmin(userId int) (bool, error)
+	CheckSuspended(ctx context.Context, userId int) error
+
+	RegisterCheck(username, email string) error
+	EmailExists(email string) (bool, error)
+	Register(account model.Account, password string) (int, error)
+	// RegisterPasswordless 创建无密码账号, 通过 signup token 完成首个 passkey 的绑定
+	RegisterPasswordless(account model.Account) (int, error)
+	CreateSignupToken(ctx context.Context, userId int) (string, error)
+	GetSignupToken(ctx context.Context, token string) (int, error)
+	// CompleteSignup 首个 passkey 绑定成功后调用, 账号不再被视为待完成的注册
+	CompleteSignup(ctx context.Context, userId int, token string)
+
+	ValidatePassword(userId int, username, email, password string) error
+	SetPassword(userId int, password string) error
+	UpdateEmail(userId int, email string) error
+	NotifyPasswordChanged(email string, at time.Time)
+	NotifyEmailChanged(email string, at time.Time)
+
+	ScheduleDeletion(ctx context.Context, userId int) (time.Time, error)
+	CancelDeletion(ctx context.Context, token string) (int, error)
+	Export(userId int) (userutil.UserExport, error)
+	LoginHistory(userId, limit, offset int) ([]userutil.LoginRecord, int64, error)
+	DenyLogin(ctx context.Context, token string) (int, error)
+
+	Search(keyword string, limit, offset int) ([]userutil.AdminUser, int64, error)
+	AdminInfo(userId int) (userutil.AdminUser, error)
+	Suspend(ctx context.Context, userId int, reason string, until int64) error
+	Unsuspend(ctx context.Context, userId int) error
+	ForcePasswordReset(ctx context.Context, userId int) error
+}
+
+type userService struct {
+	db    *gorm.DB
+	rdb   redis.Cmdable
+	queue mq.MessageQueue
+}
+
+func NewUserService(db *gorm.DB, rdb redis.Cmdable, queue mq.MessageQueue) UserService {
+	return userService{db: db, rdb: rdb, queue: queue}
+}
+
+func (s userService) Authenticate(username, password string) (int, error) {
+	return userutil.CheckPassword(s.db, username, password)
+}
+
+func (s userService) FindLoginId(username string) (int, error) {
+	return userutil.FindLoginUserId(s.db, username)
+}
+
+func (s userService) Get(userId int) (model.Account, error) {
+	return userutil.GetAccount(s.db, userId)
+}
+
+func (s userService) GetByEmail(email string) (model.Account, error) {
+	return userutil.GetAccountByEmail(s.db, email)
+}
+
+func (s userService) IsAdmin(userId int) (bool, error) {
+	return userutil.IsAdmin(s.db, userId)
+}
+
+func (s userService) CheckSuspended(ctx context.Context, userId int) error {
+	return userutil.CheckSuspended(ctx, s.db, s.rdb, userId)
+}
+
+func (s userService) RegisterCheck(username, email string) error {
+	return userutil.RegisterCheck(s.db, username, email)
+}
+
+func (s userService) EmailExists(email string) (bool, error) {
+	return userutil.CheckEmailExists(s.db, email)
+}
+
+func (s userService) Register(account model.Account, password string) (int, error) {
+	return userutil.Register(s.db, account, password)
+}
+
+func (s userService) RegisterPasswordless(account model.Account) (int, error) {
+	return userutil.RegisterPasswordless(s.db, account)
+}
+
+func (s userService) CreateSignupToken(ctx context.Context, userId int) (string, error) {
+	return userutil.CreateSignupToken(ctx, s.rdb, userId)
+}
+
+func (s userService) GetSignupToken(ctx context.Context, token string) (int, error) {
+	return userutil.GetSignupToken(ctx, s.rdb, token)
+}
+
+func (s userService) CompleteSignup(ctx context.Context, userId int, token string) {
+	userutil.CompleteSignup(ctx, s.db, s.rdb, userId, token)
+}
+
+func (s userService) ValidatePassword(userId int, username, email, password string) error {
+	return userutil.ValidatePassword(s.db, userId, username, email, password)
+}
+
+func (s userService) SetPassword(userId int, password string) error {
+	return userutil.SetPassword(s.db, userId, password)
+}
+
+func (s userService) UpdateEmail(userId int, email string) error {
+	return userutil.UpdateEmail(s.db, userId, email)
+}
+
+func (s userService) NotifyPasswordChanged(email string, at time.Time) {
+	userutil.PasswordChangeNotify(s.queue, email, at)
+}
+
+func (s userService) NotifyEmailChanged(email string, at time.Time) {
+	userutil.EmailChangeNotify(s.queue, email, at)
+}
+
+func (s userService) ScheduleDeletion(ctx context.Context, userId int) (time.Time, error) {
+	return userutil.ScheduleDeletion(ctx, s.db, s.rdb, s.queue, userId)
+}
+
+func (s userService) CancelDeletion(ctx context.Context, token string) (int, error) {
+	return userutil.CancelDeletion(ctx, s.db, s.rdb, token)
+}
+
+func (s userService) Export(userId int) (userutil.UserExport, error) {
+	return userutil.ExportUserData(s.db, userId)
+}
+
+func (s userService) LoginHistory(userId, limit, offset int) ([]userutil.LoginRecord, int64, error) {
+	return userutil.ListLoginHistory(s.db, userId, limit, offset)
+}
+
+func (s userService) DenyLogin(ctx context.Context, token string) (int, error) {
+	return userutil.DenyLogin(ctx, s.db, s.rdb, s.queue, token)
+}
+
+func (s userService) Search(keyword string, limit, offset int) ([]userutil.AdminUser, int64, error) {
+	return userutil.SearchUsers(s.db, keyword, limit, offset)
+}
+
+func (s userService) AdminInfo(userId int) (userutil.AdminUser, error) {
+	return userutil.GetAdminUser(s.db, userId)
+}
+
+func (s userService) Suspend(ctx context.Context, userId int, reason string, until int64) error {
+	return userutil.Suspend(ctx, s.db, s.rdb, userId, reason, until)
+}
+
+func (s userService) Unsuspend(ctx context.Context, userId int) error {
+	return userutil.Unsuspend(ctx, s.db, s.rdb, userId)
+}
+
+func (s userService) ForcePasswordReset(ctx context.Context, userId int) error {
+	return userutil.ForcePasswordReset(ctx, s.db, s.rdb, s.queue, userId)
+}
@@ -5,6 +5,8 @@ Server:
   Title: "X openID"
   ServerName: "X openID"
   FrontUrl: http://127.0.0.1:8080
+  # 失败响应的 HTTP 状态码由错误码决定; 旧客户端依赖 HTTP 200 与原始 message 时设为 true
+  LegacyErrors: false
 Redis:
   Address: "127.0.0.1:6379"
   Password:
@@ -14,6 +16,15 @@ Redis:
   MaxIdle: 50
   MaxActive: 500
   MaxRetries: 3
+Database:
+  Driver: mysql # mysql / postgres / sqlite
+  # postgres: "host=127.0.0.1 user=openid password=openid dbname=openid port=5432 sslmode=disable"
+  # sqlite: 数据库文件路径, 如 openid.db
+  # mysql: 留空时使用下方 Mysql 配置
+  Dsn:
+  MaxOpen: 0 # 连接池参数, 为 0 时使用 Mysql 中的配置
+  MaxIdle: 0
+  MaxLifetime: 0
 Mysql:
   Address: 127.0.0.1:3306
   Username: openid
@@ -40,6 +51,71 @@ Jwt:
   Secret: "jwt_secret"
 Developer:
   AppLimit: 10
+RateLimit: # v1 接口限流 (令牌桶, 按客户端 IP, 以及 appid + 客户端 IP)
+  Enable: true
+  Rate: 5 # 每秒补充令牌数
+  Burst: 20 # 令牌桶容量
+  Ip: # 单个 IP 的总限制, 不区分 appid, 未配置时使用上面的 Rate / Burst; 为应用单独放宽限制时需同时调大
+    Rate: 20
+    Burst: 60
+  Apps: # 按 appid 单独配置, 未配置的 appid 使用上面的 Rate / Burst
+    # "20230101123401234":
+    #   Rate: 50
+    #   Burst: 100
+  Auth: # 登录 / 重新验证身份 (含旧版客户端随请求提交的密码), 已登录按用户, 否则按 IP; 不受 Enable 影响
+    Rate: 0.1 # 每分钟 6 次
+    Burst: 10
+  # redis 异常时的处理: false 放行 (fail-open, 限流失效但接口可用, 记录错误日志); true 返回 internal_error (fail-closed)
+  FailClosed: false
+Cache: # 应用信息 / openId 读穿缓存
+  LocalSize: 1024 # 进程内 LRU 容量, 0 为不启用
+  LocalTTL: 10 # 秒
+  RedisTTL: 600 # 秒
+OpenId:
+  # random: openId / uniqueId 随机生成并写入 open_id / unique_id 表
+  # pairwise: 以 HMAC(PairwiseKey, 扇区 + 用户 ID) 计算, 无需查表
+  Mode: random
+  PairwiseKey: "" # pairwise 模式必填, 至少 32 字节, 更换后所有计算得到的 ID 都会变化
+  # 由 random 迁移至 pairwise 时开启: 已入库的 ID 继续有效, 新的用户 / 应用组合使用计算值
+  Legacy: true
+Account:
+  DeleteGraceDays: 7 # 申请注销后的冷静期 (天), 期间可通过邮件链接撤销
+Password: # 密码策略, 注册 / 修改密码 / 找回密码时生效
+  MinLength: 8
+  MaxLength: 64
+  MinClasses: 2 # 至少包含几种字符 (小写字母 / 大写字母 / 数字 / 符号)
+  DisallowPersonal: true # 禁止包含用户名或邮箱前缀
+  History: 5 # 不得与最近 5 次使用过的密码相同, 0 为不限制
+  # 泄露密码库目录, 为空不检查. 目录下每个文件以 SHA-1 前 5 位 (大写十六进制) 命名,
+  # 每行为 "剩余 35 位:出现次数", 与 Have I Been Pwned range 接口格式相同
+  BreachedDir: ""
+  BreachedMinCount: 1
+  # 新密码使用的哈希算法: bcrypt / argon2id. 已有的哈希均可校验,
+  # 算法或参数 (低于当前配置) 过时的哈希会在用户下次登录成功时自动重新计算
+  Hasher: bcrypt
+  BcryptCost: 10
+  Argon2:
+    Memory: 65536 # KiB
+    Iterations: 3
+    Parallelism: 2
+    MaxMemory: 4194304 # KiB, 校验已有哈希 (如导入的哈希) 时允许的最大内存, 超出视为无效哈希
+Passkey:
+  RPID: "" # 为空时使用 Server.FrontUrl 的域名; 可设为上级域名以便多个子域共用 passkey
+  RPName: "" # 为空时使用 Server.Name
+  # 允许的 origin, 为空时使用 Server.FrontUrl. 原生应用按平台格式填写, 如
+  # android:apk-key-hash:<base64url 签名证书 SHA-256>
+  Origins: []
+  Attachment: platform # platform: 设备内置 / cross-platform: 安全密钥等外部设备 / any: 不限制
+  UserVerification: preferred # required / preferred / discouraged
+  Attestation: none # none / indirect / direct / enterprise
+  RegisterTimeout: 300 # 注册挑战有效期 (秒)
+  LoginTimeout: 300 # 登录挑战有效期 (秒)
+  SessionStore: redis # 挑战会话存储: redis / memory (进程内存, 仅适用于单实例部署)
+  # 只允许注册以下型号的认证器 (AAGUID), 为空不限制.
+  # 未要求 attestation 时 AAGUID 由客户端自行上报, 部分浏览器会返回全 0, 仅适合作为软性限制
+  AllowedAAGUIDs: []
+  # FIDO MDS3 payload (JWT 解码后的 JSON) 路径, 用于根据 AAGUID 显示认证器名称, 为空使用内置快照
+  MetadataPath: ""
 Github:
   ClientID: "github_client_id"
   ClientSecret: "github_client_secret"
\ No newline at end of file
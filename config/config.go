@@ -1,39 +1,123 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"gopkg.in/yaml.v2"
-	"log"
 	"os"
+	"regexp"
+	"strings"
 )
 
+var aaguidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// minPairwiseKeyLen PairwiseKey 的最小字节数, 与 HMAC-SHA256 的输出长度相同
+const minPairwiseKeyLen = 32
+
 var (
 	C           *Config
 	Server      ServerConfig
 	Redis       RedisConfig
+	Database    DatabaseConfig
 	Mysql       MysqlConfig
 	Smtp        SmtpConfig
 	Aliyun      AliyunConfig
 	Jwt         JwtConfig
 	Developer   DeveloperConfig
+	RateLimit   RateLimitConfig
+	Cache       CacheConfig
+	OpenId      OpenIdConfig
+	Account     AccountConfig
+	Password    PasswordConfig
+	Passkey     PasskeyConfig
 	RedisPrefix string
 )
 
-func init() {
-	data, err := os.ReadFile("config.yaml")
+// Load
+// @description 读取配置文件, 需在使用任何配置前调用
+func Load(path string) error {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		log.Panicf("error when reading yaml: %v", err)
+		return fmt.Errorf("error when reading yaml: %w", err)
+	}
+	c := &Config{}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("error when unmarshal yaml: %w", err)
+	}
+	return Apply(c)
+}
+
+// Apply
+// @description 校验并应用配置, 测试中可直接传入构造的配置
+func Apply(c *Config) error {
+	if c.OpenIdConfig.Mode == "pairwise" {
+		if c.OpenIdConfig.PairwiseKey == "" {
+			return errors.New("OpenId.PairwiseKey is required in pairwise mode")
+		} else if len(c.OpenIdConfig.PairwiseKey) < minPairwiseKeyLen {
+			return fmt.Errorf("OpenId.PairwiseKey must be at least %d bytes", minPairwiseKeyLen)
+		}
+	}
+	if err := checkPasskey(&c.PasskeyConfig); err != nil {
+		return err
 	}
-	C = &Config{}
-	if err := yaml.Unmarshal(data, C); err != nil {
-		log.Panicf("error when unmarshal yaml: %v", err)
+	for i, aaguid := range c.PasskeyConfig.AllowedAAGUIDs {
+		aaguid = strings.ToLower(strings.TrimSpace(aaguid))
+		if !aaguidPattern.MatchString(aaguid) {
+			return fmt.Errorf("Passkey.AllowedAAGUIDs: invalid aaguid %q", c.PasskeyConfig.AllowedAAGUIDs[i])
+		}
+		c.PasskeyConfig.AllowedAAGUIDs[i] = aaguid
 	}
 
+	C = c
 	Server = C.ServerConfig
 	Redis = C.RedisConfig
+	Database = C.DatabaseConfig
 	Mysql = C.MysqlConfig
 	Smtp = C.SmtpConfig
 	Aliyun = C.AliyunConfig
 	Jwt = C.JwtConfig
 	Developer = C.DeveloperConfig
+	RateLimit = C.RateLimitConfig
+	Cache = C.CacheConfig
+	OpenId = C.OpenIdConfig
+	Account = C.AccountConfig
+	Password = C.PasswordConfig
+	Passkey = C.PasskeyConfig
 	RedisPrefix = C.RedisConfig.Prefix
+	return nil
+}
+
+// checkPasskey 校验 Passkey 中的枚举值与有效期
+func checkPasskey(p *PasskeyConfig) error {
+	enums := []struct {
+		name, value string
+		allowed     []string
+	}{
+		{"Attachment", p.Attachment, []string{"platform", "cross-platform", "any"}},
+		{"UserVerification", p.UserVerification, []string{"required", "preferred", "discouraged"}},
+		{"Attestation", p.Attestation, []string{"none", "indirect", "direct", "enterprise"}},
+		{"SessionStore", p.SessionStore, []string{"redis", "memory"}},
+	}
+	for _, e := range enums {
+		if e.value == "" {
+			continue
+		}
+		valid := false
+		for _, v := range e.allowed {
+			valid = valid || e.value == v
+		}
+		if !valid {
+			return fmt.Errorf("Passkey.%s must be one of %s, got %q", e.name, strings.Join(e.allowed, " / "), e.value)
+		}
+	}
+
+	if p.RegisterTimeout < 0 || p.LoginTimeout < 0 {
+		return errors.New("Passkey timeouts must not be negative")
+	}
+	for _, origin := range p.Origins {
+		if strings.TrimSpace(origin) == "" {
+			return errors.New("Passkey.Origins must not contain empty values")
+		}
+	}
+	return nil
 }
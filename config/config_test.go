@@ -0,0 +1,32 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyPairwiseKey(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		openId  OpenIdConfig
+		wantErr string
+	}{
+		{name: "random without key", openId: OpenIdConfig{Mode: "random"}},
+		{name: "missing key", openId: OpenIdConfig{Mode: "pairwise"}, wantErr: "required"},
+		{name: "short key", openId: OpenIdConfig{Mode: "pairwise", PairwiseKey: strings.Repeat("k", 31)}, wantErr: "at least 32 bytes"},
+		{name: "ok", openId: OpenIdConfig{Mode: "pairwise", PairwiseKey: strings.Repeat("k", 32)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Apply(&Config{OpenIdConfig: tc.openId})
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Apply() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("Apply() = %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -3,11 +3,18 @@ package config
 type Config struct {
 	ServerConfig    `yaml:"Server"`
 	RedisConfig     `yaml:"Redis"`
+	DatabaseConfig  `yaml:"Database"`
 	MysqlConfig     `yaml:"Mysql"`
 	SmtpConfig      `yaml:"Smtp"`
 	AliyunConfig    `yaml:"Aliyun"`
 	JwtConfig       `yaml:"Jwt"`
 	DeveloperConfig `yaml:"Developer"`
+	RateLimitConfig `yaml:"RateLimit"`
+	CacheConfig     `yaml:"Cache"`
+	OpenIdConfig    `yaml:"OpenId"`
+	AccountConfig   `yaml:"Account"`
+	PasswordConfig  `yaml:"Password"`
+	PasskeyConfig   `yaml:"Passkey"`
 }
 type ServerConfig struct {
 	Addr     string `yaml:"Address"`
@@ -16,6 +23,8 @@ type ServerConfig struct {
 	Title    string `yaml:"Title"`
 	Name     string `yaml:"ServerName"`
 	FrontUrl string `yaml:"FrontUrl"`
+	// LegacyErrors 兼容旧客户端: 失败响应沿用 HTTP 200 与原始 message
+	LegacyErrors bool `yaml:"LegacyErrors"`
 }
 
 type RedisConfig struct {
@@ -29,6 +38,14 @@ type RedisConfig struct {
 	MaxRetries int    `yaml:"MaxRetries"`
 }
 
+type DatabaseConfig struct {
+	Driver      string `yaml:"Driver"` // mysql / postgres / sqlite, 为空时为 mysql
+	Dsn         string `yaml:"Dsn"`    // postgres 连接串或 sqlite 文件路径; mysql 为空时由 Mysql 配置生成
+	MaxOpen     int    `yaml:"MaxOpen"`
+	MaxIdle     int    `yaml:"MaxIdle"`
+	MaxLifetime int    `yaml:"MaxLifetime"` // 连接池参数为 0 时使用 Mysql 中的配置
+}
+
 type MysqlConfig struct {
 	Addr        string `yaml:"Address"`
 	User        string `yaml:"Username"`
@@ -64,3 +81,71 @@ type JwtConfig struct {
 type DeveloperConfig struct {
 	AppLimit int `yaml:"AppLimit"`
 }
+
+type RateLimitConfig struct {
+	Enable bool                     `yaml:"Enable"`
+	Rate   float64                  `yaml:"Rate"`  // 每秒补充令牌数
+	Burst  int                      `yaml:"Burst"` // 令牌桶容量
+	Ip     RateLimitRule            `yaml:"Ip"`    // 单个 IP 的总限制, 不区分 appid, 未配置时使用默认限制
+	Apps   map[string]RateLimitRule `yaml:"Apps"`  // 按 appid 覆盖默认限制, 仅对存在的应用生效
+	Auth   RateLimitRule            `yaml:"Auth"`  // 登录与重新验证身份, 按用户或 IP, 不受 Enable 影响
+
+	FailClosed bool `yaml:"FailClosed"` // redis 异常时拒绝请求, 默认放行
+}
+
+type RateLimitRule struct {
+	Rate  float64 `yaml:"Rate"`
+	Burst int     `yaml:"Burst"`
+}
+
+type CacheConfig struct {
+	LocalSize int `yaml:"LocalSize"` // 进程内 LRU 容量, 0 为不启用
+	LocalTTL  int `yaml:"LocalTTL"`  // 进程内缓存有效期 (秒)
+	RedisTTL  int `yaml:"RedisTTL"`  // Redis 缓存有效期 (秒)
+}
+
+type OpenIdConfig struct {
+	Mode        string `yaml:"Mode"`        // random: 随机生成并入库; pairwise: HMAC 计算, 无需查表
+	PairwiseKey string `yaml:"PairwiseKey"` // pairwise 模式的 HMAC 密钥, 设置后不可更改
+	Legacy      bool   `yaml:"Legacy"`      // pairwise 模式下优先返回已入库的 openId / uniqueId
+}
+
+type AccountConfig struct {
+	DeleteGraceDays int `yaml:"DeleteGraceDays"` // 注销冷静期 (天)
+}
+
+type PasswordConfig struct {
+	MinLength        int    `yaml:"MinLength"`        // 最短长度, 默认 8
+	MaxLength        int    `yaml:"MaxLength"`        // 最长长度, 默认 64
+	MinClasses       int    `yaml:"MinClasses"`       // 至少包含的字符种类数 (小写 / 大写 / 数字 / 符号)
+	DisallowPersonal bool   `yaml:"DisallowPersonal"` // 禁止包含用户名或邮箱前缀
+	History          int    `yaml:"History"`          // 不得与最近 N 次使用过的密码相同, 0 为不限制
+	BreachedDir      string `yaml:"BreachedDir"`      // 泄露密码库目录 (SHA-1 前缀分片), 为空不检查
+	BreachedMinCount int    `yaml:"BreachedMinCount"` // 泄露次数达到该值才拒绝, 默认 1
+
+	Hasher     string       `yaml:"Hasher"`     // 新密码使用的哈希算法: bcrypt (默认) / argon2id
+	BcryptCost int          `yaml:"BcryptCost"` // 默认 10
+	Argon2     Argon2Config `yaml:"Argon2"`
+}
+
+type Argon2Config struct {
+	Memory      int `yaml:"Memory"`      // KiB, 默认 65536
+	Iterations  int `yaml:"Iterations"`  // 默认 3
+	Parallelism int `yaml:"Parallelism"` // 默认 2
+	MaxMemory   int `yaml:"MaxMemory"`   // 校验已有哈希时允许的最大内存 (KiB), 默认 4194304 (4 GiB)
+}
+
+type PasskeyConfig struct {
+	RPID             string   `yaml:"RPID"`             // 为空时使用 Server.FrontUrl 的域名
+	RPName           string   `yaml:"RPName"`           // 为空时使用 Server.Name
+	Origins          []string `yaml:"Origins"`          // 允许的 origin (网页与原生应用), 为空时使用 Server.FrontUrl
+	Attachment       string   `yaml:"Attachment"`       // platform (默认) / cross-platform / any
+	UserVerification string   `yaml:"UserVerification"` // required / preferred (默认) / discouraged
+	Attestation      string   `yaml:"Attestation"`      // none (默认) / indirect / direct / enterprise
+	RegisterTimeout  int      `yaml:"RegisterTimeout"`  // 注册挑战有效期 (秒), 默认 300
+	LoginTimeout     int      `yaml:"LoginTimeout"`     // 登录挑战有效期 (秒), 默认 300
+	SessionStore     string   `yaml:"SessionStore"`     // 挑战会话存储: redis (默认) / memory (仅单实例)
+
+	AllowedAAGUIDs []string `yaml:"AllowedAAGUIDs"` // 只允许注册这些型号的认证器 (AAGUID, 如 cb69481e-8ff7-4039-93ec-0a2729a154a8), 为空不限制
+	MetadataPath   string   `yaml:"MetadataPath"`   // FIDO MDS3 payload (JSON) 路径, 用于显示认证器名称; 为空使用内置快照
+}
@@ -0,0 +1,459 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/soxft/openid-go/app/model"
+	"github.com/soxft/openid-go/config"
+	"github.com/soxft/openid-go/library/apputil"
+	"github.com/soxft/openid-go/library/auditutil"
+	"github.com/soxft/openid-go/library/passwordutil"
+	"github.com/soxft/openid-go/library/randutil"
+	"github.com/soxft/openid-go/library/userutil"
+	"github.com/soxft/openid-go/process/dbutil"
+	"github.com/soxft/openid-go/process/dbutil/migration"
+	"github.com/soxft/openid-go/process/redisutil"
+	"gorm.io/gorm"
+)
+
+// cliActor 命令行操作在审计日志中的操作者
+var cliActor = auditutil.Actor{UserAgent: "openid-go cli"}
+
+const cliUsage = `usage: openid-go [-config config.yaml] <command> [flags]
+
+commands:
+  serve                                  start the web server (default)
+  migrate [up] [-to <version>]           apply pending schema migrations
+  migrate down [-steps 1]                roll back the latest migrations
+  migrate status                         list migrations and whether they are applied
+  import -file <file>                    bulk import users, see docs/import.md
+  user create -username -email [-password] [-role user|admin]
+  user reset-password -user <id|username|email> [-password]
+  user disable -user <id|username|email> [-reason] [-until]
+  user enable -user <id|username|email>
+  user set-role -user <id|username|email> -role user|admin
+  app list [-user <id|username|email>] [-keyword] [-limit] [-offset]
+  app transfer -app <appid> -to <id|username|email>
+  sessions revoke -user <id|username|email> | -all
+`
+
+// Run
+// @description 按子命令分发, 无参数时启动服务
+// 除 serve 外, 结果以 JSON 输出到 stdout, 日志输出到 stderr
+func Run(args []string) {
+	fs := flag.NewFlagSet("openid-go", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, cliUsage) }
+	configFile := fs.String("config", "config.yaml", "config file")
+	_ = fs.Parse(args)
+	args = fs.Args()
+
+	if len(args) > 0 && (args[0] == "help" || args[0] == "-h" || args[0] == "--help") {
+		fmt.Print(cliUsage)
+		return
+	}
+	if err := config.Load(*configFile); err != nil {
+		log.Fatalf("[ERROR] %v", err)
+	}
+
+	if len(args) == 0 {
+		Init()
+		return
+	}
+
+	switch args[0] {
+	case "serve":
+		Init()
+	case "migrate":
+		cmdMigrate(args[1:])
+	case "import":
+		Import(args[1:])
+	case "user":
+		cmdUser(args[1:])
+	case "app":
+		cmdApp(args[1:])
+	case "sessions":
+		cmdSessions(args[1:])
+	default:
+		fmt.Fprint(os.Stderr, cliUsage)
+		os.Exit(2)
+	}
+}
+
+func cmdMigrate(args []string) {
+	sub := "up"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		sub, args = args[0], args[1:]
+	}
+	fs := flag.NewFlagSet("migrate "+sub, flag.ExitOnError)
+
+	switch sub {
+	case "up":
+		to := fs.Int("to", 0, "target version, latest when 0")
+		parseFlags(fs, args)
+
+		db := initDB()
+		done, err := dbutil.Migrator(db).Up(*to)
+		printResult(migrateResult(done, err))
+		if err != nil {
+			os.Exit(1)
+		}
+
+	case "down":
+		steps := fs.Int("steps", 1, "number of migrations to roll back")
+		parseFlags(fs, args)
+
+		db := initDB()
+		done, err := dbutil.Migrator(db).Down(*steps)
+		printResult(migrateResult(done, err))
+		if err != nil {
+			os.Exit(1)
+		}
+
+	case "status":
+		parseFlags(fs, args)
+
+		db := initDB()
+		status, err := dbutil.Migrator(db).Status()
+		if err != nil {
+			exitWithError(err)
+		}
+		printResult(status)
+
+	default:
+		usageError()
+	}
+}
+
+// migrateResult 部分迁移成功后失败时, 同时输出已执行的迁移与错误
+func migrateResult(done []migration.Migration, err error) map[string]any {
+	list := make([]map[string]any, 0, len(done))
+	for _, mg := range done {
+		list = append(list, map[string]any{"version": mg.Version, "name": mg.Name})
+	}
+
+	result := map[string]any{"migrations": list}
+	if err != nil {
+		result["error"] = err.Error()
+	}
+	return result
+}
+
+func cmdUser(args []string) {
+	if len(args) == 0 {
+		usageError()
+	}
+	fs := flag.NewFlagSet("user "+args[0], flag.ExitOnError)
+	var user *string
+	if args[0] != "create" {
+		user = fs.String("user", "", "user id, username or email")
+	}
+
+	switch args[0] {
+	case "create":
+		username := fs.String("username", "", "username")
+		email := fs.String("email", "", "email")
+		password := fs.String("password", "", "password, generated when empty")
+		role := fs.String("role", model.RoleUser, "user or admin")
+		parseFlags(fs, args[1:])
+
+		db := initDB()
+		generated := ""
+		if *password == "" {
+			generated = generatePassword()
+			*password = generated
+		}
+		userId, err := userutil.CreateUser(db, *username, *email, *password, *role)
+		if err != nil {
+			exitWithError(err)
+		}
+		auditutil.Record(db, cliActor, auditutil.Entry{
+			Action:     auditutil.ActionAccountCreate,
+			UserId:     userId,
+			TargetType: auditutil.TargetUser,
+			TargetId:   strconv.Itoa(userId),
+			Detail:     "role " + *role,
+		})
+		printResult(userResult(userId, map[string]any{"password": generated}))
+
+	case "reset-password":
+		password := fs.String("password", "", "new password, generated when empty")
+		parseFlags(fs, args[1:])
+
+		db, rdb := initStorage()
+		userId := findUser(db, *user)
+		account, err := userutil.GetAdminUser(db, userId)
+		if err != nil {
+			exitWithError(err)
+		}
+		generated := ""
+		if *password == "" {
+			generated = generatePassword()
+			*password = generated
+		} else if err := userutil.ValidatePassword(db, userId, account.Username, account.Email, *password); err != nil {
+			exitWithError(err)
+		}
+		if err := userutil.SetPassword(db, userId, *password); err != nil {
+			exitWithError(err)
+		}
+		if err := userutil.RevokeAllSessions(context.Background(), rdb, userId); err != nil {
+			exitWithError(err)
+		}
+		recordCliUserEvent(db, auditutil.ActionPasswordForceReset, userId, "")
+		printResult(userResult(userId, map[string]any{"password": generated}))
+
+	case "disable":
+		reason := fs.String("reason", "", "reason shown to the user")
+		until := fs.String("until", "", "unix seconds or RFC3339, permanent when empty")
+		parseFlags(fs, args[1:])
+
+		untilTs, err := parseUntil(*until)
+		if err != nil {
+			exitWithError(err)
+		}
+		db, rdb := initStorage()
+		userId := findUser(db, *user)
+		if err := userutil.Suspend(context.Background(), db, rdb, userId, *reason, untilTs); err != nil {
+			exitWithError(err)
+		}
+		recordCliUserEvent(db, auditutil.ActionAccountSuspend, userId, *reason)
+		printResult(userResult(userId, map[string]any{"suspend_until": untilTs}))
+
+	case "enable":
+		parseFlags(fs, args[1:])
+
+		db, rdb := initStorage()
+		userId := findUser(db, *user)
+		if err := userutil.Unsuspend(context.Background(), db, rdb, userId); err != nil {
+			exitWithError(err)
+		}
+		recordCliUserEvent(db, auditutil.ActionAccountUnsuspend, userId, "")
+		printResult(userResult(userId, nil))
+
+	case "set-role":
+		role := fs.String("role", "", "user or admin")
+		parseFlags(fs, args[1:])
+
+		db := initDB()
+		userId := findUser(db, *user)
+		if err := userutil.SetRole(db, userId, *role); err != nil {
+			exitWithError(err)
+		}
+		recordCliUserEvent(db, auditutil.ActionRoleUpdate, userId, *role)
+		printResult(userResult(userId, map[string]any{"role": *role}))
+
+	default:
+		usageError()
+	}
+}
+
+func cmdApp(args []string) {
+	if len(args) == 0 {
+		usageError()
+	}
+	fs := flag.NewFlagSet("app "+args[0], flag.ExitOnError)
+
+	switch args[0] {
+	case "list":
+		user := fs.String("user", "", "only apps of this developer")
+		keyword := fs.String("keyword", "", "appid or name")
+		limit := fs.Int("limit", 100, "max results")
+		offset := fs.Int("offset", 0, "offset")
+		parseFlags(fs, args[1:])
+
+		db := initDB()
+		if *user != "" {
+			userId := findUser(db, *user)
+			total, err := apputil.GetUserAppCount(db, userId)
+			if err != nil {
+				exitWithError(err)
+			}
+			apps, err := apputil.GetUserAppList(db, userId, *limit, *offset)
+			if err != nil {
+				exitWithError(err)
+			}
+			if apps == nil {
+				apps = []apputil.AppBaseStruct{}
+			}
+			printResult(map[string]any{"total": total, "list": apps})
+			return
+		}
+		apps, total, err := apputil.SearchApps(db, *keyword, *limit, *offset)
+		if err != nil {
+			exitWithError(err)
+		}
+		printResult(map[string]any{"total": total, "list": apps})
+
+	case "transfer":
+		appId := fs.String("app", "", "appid")
+		to := fs.String("to", "", "new owner: user id, username or email")
+		parseFlags(fs, args[1:])
+
+		db, rdb := initStorage()
+		toUserId := findUser(db, *to)
+		if err := apputil.TransferApp(db, rdb, *appId, toUserId, cliActor); err != nil {
+			exitWithError(err)
+		}
+		printResult(map[string]any{"app_id": *appId, "user_id": toUserId})
+
+	default:
+		usageError()
+	}
+}
+
+func cmdSessions(args []string) {
+	if len(args) == 0 || args[0] != "revoke" {
+		usageError()
+	}
+	fs := flag.NewFlagSet("sessions revoke", flag.ExitOnError)
+	user := fs.String("user", "", "user id, username or email")
+	all := fs.Bool("all", false, "revoke sessions of every user")
+	parseFlags(fs, args[1:])
+
+	if *all == (*user != "") {
+		exitWithError(errors.New("exactly one of -user and -all is required"))
+	}
+
+	db, rdb := initStorage()
+	ctx := context.Background()
+	if *all {
+		notBefore, err := userutil.RevokeEverySession(ctx, rdb)
+		if err != nil {
+			exitWithError(err)
+		}
+		auditutil.Record(db, cliActor, auditutil.Entry{
+			Action: auditutil.ActionSessionsRevoke,
+			Detail: "all users",
+		})
+		printResult(map[string]any{"not_before": notBefore})
+		return
+	}
+
+	userId := findUser(db, *user)
+	if err := userutil.RevokeAllSessions(ctx, rdb, userId); err != nil {
+		exitWithError(err)
+	}
+	recordCliUserEvent(db, auditutil.ActionSessionsRevoke, userId, "")
+	printResult(userResult(userId, nil))
+}
+
+// initDB 只操作数据库的命令
+func initDB() *gorm.DB {
+	dbutil.Init()
+	return dbutil.D
+}
+
+// initStorage 需要同时操作数据库与 redis (会话, 缓存) 的命令
+func initStorage() (*gorm.DB, *redis.Client) {
+	redisutil.Init()
+	return initDB(), redisutil.RDB
+}
+
+func findUser(db *gorm.DB, key string) int {
+	if key == "" {
+		exitWithError(errors.New("-user is required"))
+	}
+	userId, err := userutil.FindUserId(db, key)
+	if err != nil {
+		exitWithError(fmt.Errorf("%s: %w", key, err))
+	}
+	return userId
+}
+
+// generatePassword 生成符合密码策略的随机密码
+func generatePassword() string {
+	const alphabet = "ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz23456789!@#$%^&*-_"
+	n := max(20, config.Password.MinLength)
+	if config.Password.MaxLength > 0 {
+		n = min(n, config.Password.MaxLength)
+	}
+	for {
+		password := randutil.String(n, alphabet)
+		if passwordutil.Check(password, passwordutil.Subject{}).OrNil() == nil {
+			return password
+		}
+	}
+}
+
+func parseUntil(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	until, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid -until %q", value)
+		}
+		until = t.Unix()
+	}
+	if until <= time.Now().Unix() {
+		return 0, errors.New("-until must be in the future")
+	}
+	return until, nil
+}
+
+func recordCliUserEvent(db *gorm.DB, action string, userId int, detail string) {
+	auditutil.Record(db, cliActor, auditutil.Entry{
+		Action:     action,
+		UserId:     userId,
+		TargetType: auditutil.TargetUser,
+		TargetId:   strconv.Itoa(userId),
+		Detail:     detail,
+	})
+}
+
+// userResult 输出 user_id 及额外字段, 空字段省略
+func userResult(userId int, extra map[string]any) map[string]any {
+	result := map[string]any{"user_id": userId}
+	for k, v := range extra {
+		if v != "" {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+func parseFlags(fs *flag.FlagSet, args []string) {
+	_ = fs.Parse(args)
+	if fs.NArg() > 0 {
+		exitWithError(fmt.Errorf("unexpected argument %q", fs.Arg(0)))
+	}
+}
+
+func printResult(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Fatalf("[ERROR] encode result: %v", err)
+	}
+}
+
+// exitWithError 以 JSON 输出错误并退出, 密码策略错误附带具体原因
+func exitWithError(err error) {
+	result := map[string]any{"error": err.Error()}
+
+	var policyErr *passwordutil.PolicyError
+	if errors.As(err, &policyErr) {
+		result["reasons"] = policyErr.Violations
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(result)
+	os.Exit(1)
+}
+
+func usageError() {
+	fmt.Fprint(os.Stderr, cliUsage)
+	os.Exit(2)
+}
@@ -1,8 +1,13 @@
 package core
 
 import (
+	"context"
 	"log"
+	"time"
 
+	"github.com/soxft/openid-go/app/service"
+	"github.com/soxft/openid-go/library/cacheutil"
+	"github.com/soxft/openid-go/library/userutil"
 	"github.com/soxft/openid-go/process/dbutil"
 	"github.com/soxft/openid-go/process/queueutil"
 	"github.com/soxft/openid-go/process/redisutil"
@@ -15,12 +20,23 @@ func Init() {
 	// init redis
 	redisutil.Init()
 
+	// init cache invalidation
+	cacheutil.Subscribe(context.Background(), redisutil.RDB)
+
 	// init db
 	dbutil.Init()
+	if err := dbutil.CheckSchema(dbutil.D); err != nil {
+		log.Fatalf("[ERROR] %v", err)
+	}
 
 	// init queue
 	queueutil.Init()
 
+	// 注销冷静期结束的账号
+	userutil.DeletionSweeper(context.Background(), dbutil.D, redisutil.RDB, queueutil.Q, 10*time.Minute)
+	// 释放超时未完成的无密码注册
+	userutil.SignupSweeper(context.Background(), dbutil.D, 5*time.Minute)
+
 	// init web
-	webutil.Init()
+	webutil.Init(service.New(dbutil.D, redisutil.RDB, queueutil.Q))
 }
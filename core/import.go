@@ -0,0 +1,366 @@
+package core
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/soxft/openid-go/library/passwordutil"
+	"github.com/soxft/openid-go/library/userutil"
+	"github.com/soxft/openid-go/process/dbutil"
+	"gorm.io/gorm"
+)
+
+// importProgress 断点续传进度, 每个批次提交后写入
+type importProgress struct {
+	File      string `json:"file"`
+	Processed int    `json:"processed"` // 已处理 (导入或跳过) 的记录数
+	Imported  int    `json:"imported"`
+	Conflicts int    `json:"conflicts"`
+}
+
+// importRow 源文件中的一行, CSV 表头与 JSON 字段名相同
+type importRow struct {
+	Username     string `json:"username"`
+	Email        string `json:"email"`
+	Password     string `json:"password"`
+	PasswordHash string `json:"password_hash"`
+	PasswordAlgo string `json:"password_algo"` // md5 / sha1 / sha256 / sha512, password_hash 为摘要时填写
+	PasswordSalt string `json:"password_salt"` // 摘要的前缀盐
+	RegTime      string `json:"reg_time"`      // unix 秒 / RFC3339 / 2006-01-02 15:04:05
+	RegIp        string `json:"reg_ip"`
+}
+
+type importSource interface {
+	// Next 返回下一行及其在文件中的位置, 结束时返回 io.EOF
+	Next() (importRow, int, error)
+	Close() error
+}
+
+// Import
+// @description 从 CSV / JSON 导入账号
+//
+//	openid-go import -file users.csv [-format csv|json] [-batch 500] [-progress users.csv.progress] [-report users.csv.conflicts.csv]
+func Import(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	file := fs.String("file", "", "source file (.csv / .json)")
+	format := fs.String("format", "", "csv or json, detected from the file extension by default")
+	batch := fs.Int("batch", 500, "records per transaction")
+	progressFile := fs.String("progress", "", "progress file for resuming, default <file>.progress")
+	reportFile := fs.String("report", "", "conflict report, default <file>.conflicts.csv")
+	_ = fs.Parse(args)
+
+	if *file == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(*file)), ".")
+	}
+	if *progressFile == "" {
+		*progressFile = *file + ".progress"
+	}
+	if *reportFile == "" {
+		*reportFile = *file + ".conflicts.csv"
+	}
+	if *batch <= 0 {
+		*batch = 500
+	}
+
+	db := initDB()
+	if err := dbutil.CheckSchema(db); err != nil {
+		exitWithError(err)
+	}
+
+	progress, err := runImport(db, *file, *format, *batch, *progressFile, *reportFile)
+	if err != nil {
+		exitWithError(err)
+	}
+	printResult(map[string]any{
+		"processed": progress.Processed,
+		"imported":  progress.Imported,
+		"conflicts": progress.Conflicts,
+		"report":    *reportFile,
+	})
+}
+
+func runImport(db *gorm.DB, file, format string, batchSize int, progressFile, reportFile string) (importProgress, error) {
+	progress, err := loadImportProgress(progressFile, file)
+	if err != nil {
+		return progress, err
+	}
+	if progress.Processed > 0 {
+		log.Printf("[INFO] resuming import of %s from record %d", file, progress.Processed+1)
+	}
+
+	source, err := openImportSource(file, format)
+	if err != nil {
+		return progress, err
+	}
+	defer source.Close()
+
+	report, out, err := openConflictReport(reportFile)
+	if err != nil {
+		return progress, err
+	}
+	defer func() {
+		report.Flush()
+		_ = out.Close()
+	}()
+
+	// 跳过已处理的记录
+	for i := 0; i < progress.Processed; i++ {
+		if _, _, err := source.Next(); err != nil {
+			return progress, fmt.Errorf("skip processed records: %w", err)
+		}
+	}
+
+	for {
+		records, conflicts, done, err := readImportBatch(source, batchSize)
+		if err != nil {
+			return progress, err
+		}
+		processed := len(records) + len(conflicts)
+
+		imported, batchConflicts, err := userutil.ImportBatch(db, records)
+		if err != nil {
+			return progress, fmt.Errorf("batch starting at record %d: %w", progress.Processed+1, err)
+		}
+		conflicts = append(conflicts, batchConflicts...)
+
+		for _, c := range conflicts {
+			_ = report.Write([]string{strconv.Itoa(c.Record.Line), c.Record.Username, c.Record.Email, c.Reason})
+		}
+		report.Flush()
+		if err := report.Error(); err != nil {
+			return progress, err
+		}
+
+		progress.Processed += processed
+		progress.Imported += imported
+		progress.Conflicts += len(conflicts)
+		if err := saveImportProgress(progressFile, progress); err != nil {
+			return progress, err
+		}
+		if processed > 0 {
+			log.Printf("[INFO] processed %d, imported %d, conflicts %d", progress.Processed, progress.Imported, progress.Conflicts)
+		}
+
+		if done {
+			break
+		}
+	}
+
+	return progress, nil
+}
+
+// readImportBatch 读取一批记录, 无法解析的行直接作为冲突返回
+func readImportBatch(source importSource, size int) ([]userutil.ImportRecord, []userutil.ImportConflict, bool, error) {
+	var records []userutil.ImportRecord
+	var conflicts []userutil.ImportConflict
+
+	for len(records)+len(conflicts) < size {
+		row, line, err := source.Next()
+		if errors.Is(err, io.EOF) {
+			return records, conflicts, true, nil
+		} else if err != nil {
+			return nil, nil, false, err
+		}
+
+		record, reason := row.toRecord(line)
+		if reason != "" {
+			conflicts = append(conflicts, userutil.ImportConflict{Record: record, Reason: reason})
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, conflicts, false, nil
+}
+
+func (r importRow) toRecord(line int) (userutil.ImportRecord, string) {
+	record := userutil.ImportRecord{
+		Line:         line,
+		Username:     strings.TrimSpace(r.Username),
+		Email:        strings.TrimSpace(r.Email),
+		Password:     r.Password,
+		PasswordHash: strings.TrimSpace(r.PasswordHash),
+		RegIp:        strings.TrimSpace(r.RegIp),
+	}
+
+	if r.PasswordAlgo != "" {
+		encoded, err := passwordutil.EncodeLegacy(r.PasswordAlgo, r.PasswordSalt, record.PasswordHash)
+		if err != nil {
+			return record, userutil.ConflictInvalidPassword
+		}
+		record.PasswordHash = encoded
+	}
+
+	regTime, err := parseImportTime(strings.TrimSpace(r.RegTime))
+	if err != nil {
+		return record, userutil.ConflictInvalidRegTime
+	}
+	record.RegTime = regTime
+	return record, ""
+}
+
+func parseImportTime(value string) (int64, error) {
+	if value == "" {
+		return time.Now().Unix(), nil
+	}
+	if ts, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return ts, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.Unix(), nil
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", value, time.Local)
+	if err != nil {
+		return 0, err
+	}
+	return t.Unix(), nil
+}
+
+func openImportSource(file, format string) (importSource, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case "csv":
+		reader := csv.NewReader(f)
+		reader.FieldsPerRecord = -1
+		header, err := reader.Read()
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("read csv header: %w", err)
+		}
+		columns := make(map[string]int, len(header))
+		for i, name := range header {
+			columns[strings.ToLower(strings.TrimSpace(name))] = i
+		}
+		return &csvImportSource{file: f, reader: reader, columns: columns}, nil
+	case "json":
+		decoder := json.NewDecoder(f)
+		if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+			f.Close()
+			return nil, errors.New("json source must be an array of objects")
+		}
+		return &jsonImportSource{file: f, decoder: decoder}, nil
+	default:
+		f.Close()
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+type csvImportSource struct {
+	file    *os.File
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+func (s *csvImportSource) Next() (importRow, int, error) {
+	fields, err := s.reader.Read()
+	if err != nil {
+		return importRow{}, 0, err
+	}
+	line, _ := s.reader.FieldPos(0)
+
+	get := func(name string) string {
+		if i, ok := s.columns[name]; ok && i < len(fields) {
+			return fields[i]
+		}
+		return ""
+	}
+	return importRow{
+		Username:     get("username"),
+		Email:        get("email"),
+		Password:     get("password"),
+		PasswordHash: get("password_hash"),
+		PasswordAlgo: get("password_algo"),
+		PasswordSalt: get("password_salt"),
+		RegTime:      get("reg_time"),
+		RegIp:        get("reg_ip"),
+	}, line, nil
+}
+
+func (s *csvImportSource) Close() error {
+	return s.file.Close()
+}
+
+type jsonImportSource struct {
+	file    *os.File
+	decoder *json.Decoder
+	index   int
+}
+
+func (s *jsonImportSource) Next() (importRow, int, error) {
+	if !s.decoder.More() {
+		return importRow{}, 0, io.EOF
+	}
+
+	var row importRow
+	if err := s.decoder.Decode(&row); err != nil {
+		return row, 0, err
+	}
+	s.index++
+	return row, s.index, nil
+}
+
+func (s *jsonImportSource) Close() error {
+	return s.file.Close()
+}
+
+func loadImportProgress(progressFile, file string) (importProgress, error) {
+	progress := importProgress{File: file}
+
+	data, err := os.ReadFile(progressFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return progress, nil
+	} else if err != nil {
+		return progress, err
+	}
+
+	if err := json.Unmarshal(data, &progress); err != nil {
+		return progress, fmt.Errorf("parse progress file: %w", err)
+	}
+	if progress.File != file {
+		return progress, fmt.Errorf("progress file %s belongs to %s", progressFile, progress.File)
+	}
+	return progress, nil
+}
+
+// saveImportProgress 先写临时文件再重命名, 避免中断时进度文件损坏
+func saveImportProgress(progressFile string, progress importProgress) error {
+	data, _ := json.Marshal(progress)
+	tmp := progressFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, progressFile)
+}
+
+// openConflictReport 以追加方式打开冲突报告, 调用方在最后一次 Flush 后关闭文件
+func openConflictReport(reportFile string) (*csv.Writer, *os.File, error) {
+	_, statErr := os.Stat(reportFile)
+
+	f, err := os.OpenFile(reportFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	w := csv.NewWriter(f)
+	if errors.Is(statErr, os.ErrNotExist) {
+		_ = w.Write([]string{"line", "username", "email", "reason"})
+	}
+	return w, f, nil
+}
@@ -1,6 +1,12 @@
 package apiutil
 
-import "github.com/gin-gonic/gin"
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/soxft/openid-go/config"
+)
 
 func New(ctx *gin.Context) *Api {
 	return &Api{
@@ -24,36 +30,72 @@ func (c *Api) SuccessWithData(msg string, data interface{}) {
 	c.Out(200, true, msg, data)
 }
 
-func (c *Api) Fail(msg string) {
-	c.Out(200, false, msg, gin.H{})
+// Fail 失败响应, HTTP 状态码由错误码决定
+// msg 为具体提示, 客户端要求英文时替换为错误码对应的英文提示
+func (c *Api) Fail(code Code, msg string) {
+	c.FailWithData(code, msg, gin.H{})
 }
 
-func (c *Api) FailWithData(msg string, data interface{}) {
-	c.Out(200, false, msg, data)
+func (c *Api) FailWithData(code Code, msg string, data interface{}) {
+	c.Ctx.JSON(c.status(code, http.StatusOK), c.failBody(code, msg, data))
 }
 
-// httpCode
+// Abort 中断后续处理并返回失败响应, errors 为便于排查的内部标识
+// 与 Fail 不同, 兼容模式下同样使用错误码对应的状态码: 使用 Abort 的限流 (429), 重新验证身份 (403) 等响应
+// 在旧版中不存在, 客户端需要依据状态码处理 (如 Retry-After); 旧版已有的中断响应使用 Abort200 / Abort401
+func (c *Api) Abort(code Code, msg string, errors string) {
+	c.abort(code.Status(), code, msg, errors)
+}
 
-func (c *Api) FailWithHttpCode(httpCode int, msg string) {
-	c.Out(httpCode, false, msg, gin.H{})
+// Abort200 与 Abort 相同, 但兼容模式下沿用旧版的 HTTP 200
+func (c *Api) Abort200(code Code, msg string, errors string) {
+	c.abort(http.StatusOK, code, msg, errors)
 }
 
-// Abort
+// Abort401 与 Abort 相同, 但兼容模式下沿用旧版的 HTTP 401
+func (c *Api) Abort401(code Code, msg string, errors string) {
+	c.abort(http.StatusUnauthorized, code, msg, errors)
+}
 
-func (c *Api) Abort(httpCode int, msg string, errors string) {
-	c.Ctx.AbortWithStatusJSON(httpCode, gin.H{
-		"success": false,
-		"message": msg,
-		"data": gin.H{
-			"error": errors,
-		},
-	})
+func (c *Api) abort(legacyStatus int, code Code, msg string, errors string) {
+	c.Ctx.AbortWithStatusJSON(c.status(code, legacyStatus), c.failBody(code, msg, gin.H{
+		"error": errors,
+	}))
+}
+
+// status 兼容模式 (Server.LegacyErrors) 下使用旧版的状态码
+func (c *Api) status(code Code, legacyStatus int) int {
+	if config.Server.LegacyErrors {
+		return legacyStatus
+	}
+	return code.Status()
 }
 
-func (c *Api) Abort401(msg string, errors string) {
-	c.Abort(401, msg, errors)
+// failBody 兼容模式下 message 保持原文, code 字段两种模式均返回
+func (c *Api) failBody(code Code, msg string, data interface{}) gin.H {
+	if !config.Server.LegacyErrors {
+		if localized := code.Message(c.lang()); localized != "" {
+			msg = localized
+		}
+	}
+	if msg == "" {
+		msg = code.Message("zh")
+	}
+	return gin.H{
+		"success": false,
+		"code":    code,
+		"message": msg,
+		"data":    data,
+	}
 }
 
-func (c *Api) Abort200(msg string, errors string) {
-	c.Abort(200, msg, errors)
+// lang 仅在 Accept-Language 首选英文时返回 en
+// 中文提示由调用处给出, 比错误码对应的通用提示更具体, 因此不做替换
+func (c *Api) lang() string {
+	first, _, _ := strings.Cut(c.Ctx.GetHeader("Accept-Language"), ",")
+	first, _, _ = strings.Cut(first, ";")
+	if tag := strings.ToLower(strings.TrimSpace(first)); tag == "en" || strings.HasPrefix(tag, "en-") {
+		return "en"
+	}
+	return ""
 }
@@ -0,0 +1,96 @@
+package apiutil
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/soxft/openid-go/config"
+)
+
+func fail(t *testing.T, lang string, f func(api *Api)) (int, map[string]any) {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	if lang != "" {
+		c.Request.Header.Set("Accept-Language", lang)
+	}
+	f(New(c))
+
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+	return w.Code, body
+}
+
+func TestFail(t *testing.T) {
+	old := config.Server
+	t.Cleanup(func() { config.Server = old })
+	config.Server.LegacyErrors = false
+
+	emailTaken := func(api *Api) { api.Fail(CodeEmailTaken, "邮箱已存在") }
+
+	cases := []struct {
+		lang    string
+		message string
+	}{
+		{"", "邮箱已存在"},
+		{"zh-CN,zh;q=0.9,en;q=0.8", "邮箱已存在"},
+		{"en-US,en;q=0.9", "Email address is already in use"},
+		{"EN", "Email address is already in use"},
+		{"fr-FR", "邮箱已存在"},
+	}
+	for _, tc := range cases {
+		status, body := fail(t, tc.lang, emailTaken)
+		if status != http.StatusConflict || body["code"] != "email_taken" || body["message"] != tc.message || body["success"] != false {
+			t.Errorf("Accept-Language %q: %d %v", tc.lang, status, body)
+		}
+	}
+
+	if status, body := fail(t, "", func(api *Api) { api.Fail(CodeInternal, "") }); status != http.StatusInternalServerError || body["message"] != "系统错误, 请稍后再试" {
+		t.Errorf("empty message: %d %v", status, body)
+	}
+	if status, _ := fail(t, "", func(api *Api) { api.Fail("unknown", "x") }); status != http.StatusInternalServerError {
+		t.Errorf("unknown code status = %d", status)
+	}
+}
+
+func TestFailLegacy(t *testing.T) {
+	old := config.Server
+	t.Cleanup(func() { config.Server = old })
+	config.Server.LegacyErrors = true
+
+	status, body := fail(t, "en", func(api *Api) { api.Fail(CodeEmailTaken, "email already exists") })
+	if status != http.StatusOK || body["code"] != "email_taken" || body["message"] != "email already exists" {
+		t.Errorf("Fail: %d %v", status, body)
+	}
+
+	abort := []struct {
+		f      func(api *Api)
+		status int
+	}{
+		{func(api *Api) { api.Abort(CodeReauthRequired, "请先验证身份", "reauth") }, http.StatusForbidden},
+		{func(api *Api) { api.Abort200(CodeForbidden, "Unauthorized", "not_owner") }, http.StatusOK},
+		{func(api *Api) { api.Abort401(CodeAppNotFound, "Unauthorized", "owner_check") }, http.StatusUnauthorized},
+	}
+	for i, tc := range abort {
+		if status, body := fail(t, "", tc.f); status != tc.status || body["data"].(map[string]any)["error"] == "" {
+			t.Errorf("abort %d: %d %v", i, status, body)
+		}
+	}
+
+	// 非兼容模式下 Abort200 / Abort401 使用错误码对应的状态码
+	config.Server.LegacyErrors = false
+	if status, _ := fail(t, "", abort[1].f); status != http.StatusForbidden {
+		t.Errorf("Abort200 status = %d", status)
+	}
+	if status, _ := fail(t, "", abort[2].f); status != http.StatusNotFound {
+		t.Errorf("Abort401 status = %d", status)
+	}
+}
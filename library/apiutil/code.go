@@ -0,0 +1,144 @@
+package apiutil
+
+import "net/http"
+
+// Code 失败响应中稳定的错误码, 客户端应依据 code 而不是 message 判断失败原因
+// 已发布的错误码不可修改含义, 只能新增
+// 登录用户的 401 只表示登录态无效, 密码或 Passkey 校验失败使用 400, 避免前端误判为登录过期
+type Code string
+
+// 通用
+const (
+	CodeInvalidParams Code = "invalid_params"
+	CodeUnauthorized  Code = "unauthorized"
+	CodeForbidden     Code = "forbidden"
+	CodeRouteNotFound Code = "route_not_found"
+	CodeRateLimited   Code = "rate_limited"
+	CodeNoData        Code = "no_data"
+	CodeInternal      Code = "internal_error"
+)
+
+// 账号
+const (
+	CodeEmailInvalid        Code = "email_invalid"
+	CodeEmailTaken          Code = "email_taken"
+	CodeEmailNotFound       Code = "email_not_found"
+	CodeUsernameInvalid     Code = "username_invalid"
+	CodeUsernameTaken       Code = "username_taken"
+	CodeCodeInvalid         Code = "code_invalid"
+	CodeCodeTooFrequent     Code = "code_too_frequent"
+	CodePasswordIncorrect   Code = "password_incorrect"
+	CodePasswordWeak        Code = "password_weak"
+	CodePasswordNotSet      Code = "password_not_set"
+	CodeUserNotFound        Code = "user_not_found"
+	CodeAccountSuspended    Code = "account_suspended"
+	CodeReauthRequired      Code = "reauth_required"
+	CodeLinkInvalid         Code = "link_invalid"
+	CodeSignupExpired       Code = "signup_expired"
+	CodeDeletionScheduled   Code = "deletion_scheduled"
+	CodeSuspendSelf         Code = "suspend_self"
+	CodeSuspendUntilInvalid Code = "suspend_until_invalid"
+)
+
+// 应用与 OpenID 授权
+const (
+	CodeAppNotFound         Code = "app_not_found"
+	CodeAppNameInvalid      Code = "app_name_invalid"
+	CodeAppGatewayInvalid   Code = "app_gateway_invalid"
+	CodeAppGatewayNotSet    Code = "app_gateway_not_set"
+	CodeAppLimitExceeded    Code = "app_limit_exceeded"
+	CodeAppSecretInvalid    Code = "app_secret_invalid"
+	CodeRedirectUriInvalid  Code = "redirect_uri_invalid"
+	CodeRedirectUriMismatch Code = "redirect_uri_mismatch"
+	CodeTokenInvalid        Code = "token_invalid"
+)
+
+// Passkey
+const (
+	CodePasskeyNotFound            Code = "passkey_not_found"
+	CodePasskeyNotRegistered       Code = "passkey_not_registered"
+	CodePasskeyChallengeExpired    Code = "passkey_challenge_expired"
+	CodePasskeyCredentialInvalid   Code = "passkey_credential_invalid"
+	CodePasskeyVerifyFailed        Code = "passkey_verify_failed"
+	CodePasskeyRegisterFailed      Code = "passkey_register_failed"
+	CodePasskeyCloned              Code = "passkey_cloned"
+	CodePasskeyAuthenticatorDenied Code = "passkey_authenticator_denied"
+	CodePasskeyLast                Code = "passkey_last"
+	CodePasskeyRemarkInvalid       Code = "passkey_remark_invalid"
+)
+
+type codeInfo struct {
+	status int
+	zh     string
+	en     string
+}
+
+var codes = map[Code]codeInfo{
+	CodeInvalidParams: {http.StatusBadRequest, "请求参数错误", "Invalid request parameters"},
+	CodeUnauthorized:  {http.StatusUnauthorized, "未登录或登录已失效", "Unauthorized"},
+	CodeForbidden:     {http.StatusForbidden, "无权访问", "Forbidden"},
+	CodeRouteNotFound: {http.StatusNotFound, "接口不存在", "Route not found"},
+	CodeRateLimited:   {http.StatusTooManyRequests, "请求过于频繁", "Too many requests"},
+	CodeNoData:        {http.StatusNotFound, "当页无数据", "No data on this page"},
+	CodeInternal:      {http.StatusInternalServerError, "系统错误, 请稍后再试", "Internal server error, please try again later"},
+
+	CodeEmailInvalid:        {http.StatusBadRequest, "非法的邮箱", "Invalid email address"},
+	CodeEmailTaken:          {http.StatusConflict, "邮箱已存在", "Email address is already in use"},
+	CodeEmailNotFound:       {http.StatusNotFound, "邮箱不存在", "Email address is not registered"},
+	CodeUsernameInvalid:     {http.StatusBadRequest, "非法的用户名", "Invalid username"},
+	CodeUsernameTaken:       {http.StatusConflict, "用户名已存在", "Username is already taken"},
+	CodeCodeInvalid:         {http.StatusBadRequest, "验证码错误或已过期", "Verification code is incorrect or expired"},
+	CodeCodeTooFrequent:     {http.StatusTooManyRequests, "验证码发送过于频繁", "Verification code requested too frequently"},
+	CodePasswordIncorrect:   {http.StatusBadRequest, "用户名或密码错误", "Incorrect username or password"},
+	CodePasswordWeak:        {http.StatusBadRequest, "密码不符合安全要求", "Password does not meet the security requirements"},
+	CodePasswordNotSet:      {http.StatusBadRequest, "未设置密码, 请使用 Passkey 验证", "No password set, use a passkey instead"},
+	CodeUserNotFound:        {http.StatusNotFound, "用户不存在", "User not found"},
+	CodeAccountSuspended:    {http.StatusForbidden, "账号已被封禁", "Account suspended"},
+	CodeReauthRequired:      {http.StatusForbidden, "请先验证身份", "Re-authentication required"},
+	CodeLinkInvalid:         {http.StatusBadRequest, "链接无效或已过期", "Link is invalid or expired"},
+	CodeSignupExpired:       {http.StatusBadRequest, "注册已过期, 请重新注册", "Signup expired, please start over"},
+	CodeDeletionScheduled:   {http.StatusConflict, "已申请注销", "Account deletion already scheduled"},
+	CodeSuspendSelf:         {http.StatusBadRequest, "不能封禁自己", "You cannot suspend yourself"},
+	CodeSuspendUntilInvalid: {http.StatusBadRequest, "解封时间应晚于当前时间", "Suspension end must be in the future"},
+
+	CodeAppNotFound:         {http.StatusNotFound, "应用不存在", "App not found"},
+	CodeAppNameInvalid:      {http.StatusBadRequest, "应用名称不合法", "Invalid app name"},
+	CodeAppGatewayInvalid:   {http.StatusBadRequest, "网关不合法", "Invalid app gateway"},
+	CodeAppGatewayNotSet:    {http.StatusBadRequest, "应用未设置网关", "App gateway is not set"},
+	CodeAppLimitExceeded:    {http.StatusForbidden, "应用数量已达上限", "App limit reached"},
+	CodeAppSecretInvalid:    {http.StatusUnauthorized, "应用密钥错误", "Invalid app secret"},
+	CodeRedirectUriInvalid:  {http.StatusBadRequest, "redirect_uri 不合法", "Invalid redirect_uri"},
+	CodeRedirectUriMismatch: {http.StatusBadRequest, "redirect_uri 与应用网关不匹配", "redirect_uri does not match the app gateway"},
+	CodeTokenInvalid:        {http.StatusBadRequest, "token 无效或已过期", "Token is invalid or expired"},
+
+	CodePasskeyNotFound:            {http.StatusNotFound, "Passkey 不存在", "Passkey not found"},
+	CodePasskeyNotRegistered:       {http.StatusBadRequest, "未绑定 Passkey", "No passkey registered"},
+	CodePasskeyChallengeExpired:    {http.StatusBadRequest, "挑战已过期，请重试", "Challenge expired, please try again"},
+	CodePasskeyCredentialInvalid:   {http.StatusBadRequest, "Passkey 凭证格式错误", "Malformed passkey credential"},
+	CodePasskeyVerifyFailed:        {http.StatusBadRequest, "Passkey 验证失败", "Passkey verification failed"},
+	CodePasskeyRegisterFailed:      {http.StatusBadRequest, "Passkey 注册失败", "Passkey registration failed"},
+	CodePasskeyCloned:              {http.StatusForbidden, "该 Passkey 签名计数异常, 可能已被复制", "Passkey signature counter regressed, it may have been cloned"},
+	CodePasskeyAuthenticatorDenied: {http.StatusForbidden, "不支持该型号的认证器", "Authenticator model not allowed"},
+	CodePasskeyLast:                {http.StatusConflict, "账号未设置密码, 不能删除唯一的 Passkey", "Cannot remove the only passkey of an account without a password"},
+	CodePasskeyRemarkInvalid:       {http.StatusBadRequest, "备注不能超过 32 个字符, 且不能包含特殊字符", "Remark must be at most 32 characters without special characters"},
+}
+
+// Status 错误码对应的 HTTP 状态码, 未登记的错误码视为 500
+func (c Code) Status() int {
+	if info, ok := codes[c]; ok {
+		return info.status
+	}
+	return http.StatusInternalServerError
+}
+
+// Message 错误码在指定语言 (zh / en) 下的提示, 不支持的语言返回空
+func (c Code) Message(lang string) string {
+	info := codes[c]
+	switch lang {
+	case "zh":
+		return info.zh
+	case "en":
+		return info.en
+	}
+	return ""
+}
@@ -3,14 +3,18 @@ package apiutil
 import "github.com/gin-gonic/gin"
 
 type Apier interface {
-	Out(success bool, msg string, data interface{})
-	Success(msg string, data interface{})
-	Fail(msg string)
-	FailWithMsg(msg string, data interface{})
-	Abort(httpCode int, msg string, errorCode int)
-	Abort401(msg string, errCode int)
+	Out(httpCode int, success bool, msg string, data interface{})
+	Success(msg string)
+	SuccessWithData(msg string, data interface{})
+	Fail(code Code, msg string)
+	FailWithData(code Code, msg string, data interface{})
+	Abort(code Code, msg string, errors string)
+	Abort200(code Code, msg string, errors string)
+	Abort401(code Code, msg string, errors string)
 }
 
+var _ Apier = (*Api)(nil)
+
 type Api struct {
 	Ctx *gin.Context
 }
@@ -1,11 +1,14 @@
 package apputil
 
 import (
+	"context"
+	"crypto/subtle"
 	"errors"
+	"github.com/redis/go-redis/v9"
 	"github.com/soxft/openid-go/app/model"
 	"github.com/soxft/openid-go/config"
-	"github.com/soxft/openid-go/library/toolutil"
-	"github.com/soxft/openid-go/process/dbutil"
+	"github.com/soxft/openid-go/library/auditutil"
+	"github.com/soxft/openid-go/library/randutil"
 	"gorm.io/gorm"
 	"html"
 	"log"
@@ -59,7 +62,7 @@ func CheckGateway(gateway string) bool {
 	return true
 }
 
-func CreateApp(userId int, appName string) (bool, error) {
+func CreateApp(db *gorm.DB, userId int, appName string) (bool, error) {
 	if userId == 0 {
 		return false, errors.New("userId is invalid")
 	}
@@ -67,21 +70,21 @@ func CreateApp(userId int, appName string) (bool, error) {
 		return false, errors.New("app name is invalid")
 	}
 	// 判断用户app数量是否超过限制
-	counts, err := GetUserAppCount(userId)
+	counts, err := GetUserAppCount(db, userId)
 	if err != nil {
 		return false, err
 	}
 	if counts >= config.Developer.AppLimit {
-		return false, errors.New("the number of app exceeds the limit")
+		return false, ErrAppLimitExceeded
 	}
 
 	// 创建app
-	appId, err := generateAppId()
+	appId, err := generateAppId(db)
 	if err != nil {
 		return false, err
 	}
 
-	if result := dbutil.D.Create(&model.App{
+	if result := db.Create(&model.App{
 		UserId:     userId,
 		AppId:      appId,
 		AppName:    appName,
@@ -97,9 +100,14 @@ func CreateApp(userId int, appName string) (bool, error) {
 
 // DeleteUserApp
 // 删除用户App
-func DeleteUserApp(appId string) (bool, error) {
+func DeleteUserApp(db *gorm.DB, rdb redis.Cmdable, appId string, actor auditutil.Actor) (bool, error) {
+	appInfo, err := GetAppInfo(db, rdb, appId)
+	if err != nil {
+		return false, err
+	}
+
 	// 开启 事物
-	err := dbutil.D.Transaction(func(tx *gorm.DB) error {
+	err = db.Transaction(func(tx *gorm.DB) error {
 		var App model.App
 		var OpenId model.OpenId
 
@@ -121,16 +129,66 @@ func DeleteUserApp(appId string) (bool, error) {
 		log.Printf("[ERROR] DeleteUserApp error: %s", err)
 		return false, err
 	}
+	PurgeAppCache(rdb, appId)
+	PurgeOpenIdCache(rdb, appId)
+
+	auditutil.Record(db, actor, auditutil.Entry{
+		Action:     auditutil.ActionAppDelete,
+		UserId:     appInfo.AppUserId,
+		TargetType: auditutil.TargetApp,
+		TargetId:   appId,
+		Detail:     appInfo.AppName,
+	})
 	return true, nil
 }
 
+// UpdateApp
+// 修改应用名称与网关
+func UpdateApp(db *gorm.DB, rdb redis.Cmdable, appId, appName string, gateways []string) error {
+	err := db.Model(model.App{}).Where(model.App{AppId: appId}).Updates(model.App{
+		AppName:    appName,
+		AppGateway: strings.Join(gateways, ","),
+	}).Error
+	if err != nil {
+		log.Printf("[ERROR] UpdateApp error: %s", err)
+		return errors.New("system error")
+	}
+	PurgeAppCache(rdb, appId)
+	return nil
+}
+
+// TransferApp
+// 将应用转移给其他开发者, 已发放的 OpenID 不变
+func TransferApp(db *gorm.DB, rdb redis.Cmdable, appId string, toUserId int, actor auditutil.Actor) error {
+	appInfo, err := GetAppInfo(db, rdb, appId)
+	if err != nil {
+		return err
+	}
+
+	err = db.Model(&model.App{}).Where(model.App{AppId: appId}).Update("user_id", toUserId).Error
+	if err != nil {
+		log.Printf("[ERROR] TransferApp error: %s", err)
+		return errors.New("system error")
+	}
+	PurgeAppCache(rdb, appId)
+
+	auditutil.Record(db, actor, auditutil.Entry{
+		Action:     auditutil.ActionAppTransfer,
+		UserId:     appInfo.AppUserId,
+		TargetType: auditutil.TargetApp,
+		TargetId:   appId,
+		Detail:     "to " + strconv.Itoa(toUserId),
+	})
+	return nil
+}
+
 // GetUserAppList
 // @description: 获取用户app列表
-func GetUserAppList(userId, limit, offset int) ([]AppBaseStruct, error) {
+func GetUserAppList(db *gorm.DB, userId, limit, offset int) ([]AppBaseStruct, error) {
 	// 开始获取
 	var appList []AppBaseStruct
 	var appListRaw []model.App
-	err := dbutil.D.Model(model.App{}).Select("id, app_id, app_name, create_at").Where(model.App{UserId: userId}).Order("id desc").Limit(limit).Offset(offset).Find(&appListRaw).Error
+	err := db.Model(model.App{}).Select("id, app_id, app_name, create_at").Where(model.App{UserId: userId}).Order("id desc").Limit(limit).Offset(offset).Find(&appListRaw).Error
 	if err != nil {
 		log.Printf("[ERROR] GetUserAppList error: %s", err)
 		return nil, errors.New("GetUserAppList error")
@@ -146,11 +204,33 @@ func GetUserAppList(userId, limit, offset int) ([]AppBaseStruct, error) {
 	return appList, nil
 }
 
+// SearchApps
+// @description: 管理后台按 appid / 名称搜索应用
+func SearchApps(db *gorm.DB, keyword string, limit, offset int) ([]AppAdminStruct, int64, error) {
+	query := db.Model(&model.App{})
+	if keyword != "" {
+		query = query.Where("app_id = ? OR app_name LIKE ?", keyword, "%"+keyword+"%")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		log.Printf("[ERROR] SearchApps error: %s", err)
+		return nil, 0, errors.New("SearchApps error")
+	}
+
+	apps := []AppAdminStruct{}
+	if err := query.Select("id, user_id, app_id, app_name, app_gateway, create_at").Order("id desc").Limit(limit).Offset(offset).Scan(&apps).Error; err != nil {
+		log.Printf("[ERROR] SearchApps error: %s", err)
+		return nil, 0, errors.New("SearchApps error")
+	}
+	return apps, total, nil
+}
+
 // GetUserAppCount
 // 获取用户的app数量
-func GetUserAppCount(userId int) (int, error) {
+func GetUserAppCount(db *gorm.DB, userId int) (int, error) {
 	var count int64
-	err := dbutil.D.Model(&model.App{}).Where(model.App{UserId: userId}).Count(&count).Error
+	err := db.Model(&model.App{}).Where(model.App{UserId: userId}).Count(&count).Error
 	if err != nil {
 		log.Printf("[ERROR] GetUserAppCount error: %s", err)
 		return 0, errors.New("GetUserAppCount error")
@@ -160,37 +240,77 @@ func GetUserAppCount(userId int) (int, error) {
 	return countInt, nil
 }
 
-func GetAppInfo(appId string) (AppFullInfoStruct, error) {
-	var appInfo AppFullInfoStruct
+// GetAppInfo
+// @description: 获取应用信息 (读穿缓存), 不含密钥
+func GetAppInfo(db *gorm.DB, rdb redis.Cmdable, appId string) (AppInfoStruct, error) {
+	return appInfoCache.Get(context.Background(), rdb, appId, func() (AppInfoStruct, error) {
+		return loadAppInfo(db, appId)
+	})
+}
+
+// GetAppFullInfo
+// @description: 获取应用信息及密钥, 密钥始终从数据库读取
+func GetAppFullInfo(db *gorm.DB, rdb redis.Cmdable, appId string) (AppFullInfoStruct, error) {
+	appInfo, err := GetAppInfo(db, rdb, appId)
+	if err != nil {
+		return AppFullInfoStruct{}, err
+	}
+	appSecret, err := getAppSecret(db, appId)
+	if err != nil {
+		return AppFullInfoStruct{}, err
+	}
+	return AppFullInfoStruct{AppInfoStruct: appInfo, AppSecret: appSecret}, nil
+}
+
+// PurgeAppCache
+// @description: 应用信息变更后清除缓存
+func PurgeAppCache(rdb redis.Cmdable, appId string) {
+	appInfoCache.Delete(context.Background(), rdb, appId)
+}
+
+func loadAppInfo(db *gorm.DB, appId string) (AppInfoStruct, error) {
+	var appInfo AppInfoStruct
 	var appInfoRaw model.App
 
-	err := dbutil.D.Model(&model.App{}).Select("id, user_id, app_id, app_name, app_secret, app_gateway, create_at").Where(model.App{AppId: appId}).Take(&appInfoRaw).Error
+	err := db.Model(&model.App{}).Select("id, user_id, app_id, app_name, app_gateway, create_at").Where(model.App{AppId: appId}).Take(&appInfoRaw).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return appInfo, ErrAppNotExist
 	} else if err != nil {
 		log.Printf("[ERROR] GetAppInfo error: %s", err)
 		return appInfo, errors.New("server error")
 	}
-	appInfo = AppFullInfoStruct{
+	appInfo = AppInfoStruct{
 		Id:         appInfoRaw.ID,
 		AppUserId:  appInfoRaw.UserId,
 		AppId:      appInfoRaw.AppId,
 		AppName:    appInfoRaw.AppName,
-		AppSecret:  appInfoRaw.AppSecret,
 		AppGateway: appInfoRaw.AppGateway,
 		CreateAt:   appInfoRaw.CreateAt,
 	}
 	return appInfo, nil
 }
 
+// getAppSecret 从数据库读取应用密钥
+func getAppSecret(db *gorm.DB, appId string) (string, error) {
+	var appSecret string
+	err := db.Model(&model.App{}).Select("app_secret").Where(model.App{AppId: appId}).Take(&appSecret).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", ErrAppNotExist
+	} else if err != nil {
+		log.Printf("[ERROR] getAppSecret error: %s", err)
+		return "", errors.New("server error")
+	}
+	return appSecret, nil
+}
+
 // CheckAppSecret
-// @description: 检查appSecret
-func CheckAppSecret(appId string, appSecret string) error {
-	appInfo, err := GetAppInfo(appId)
+// @description: 检查appSecret, 密钥不经过缓存
+func CheckAppSecret(db *gorm.DB, appId string, appSecret string) error {
+	stored, err := getAppSecret(db, appId)
 	if err != nil {
 		return err
 	}
-	if appInfo.AppSecret != appSecret {
+	if subtle.ConstantTimeCompare([]byte(stored), []byte(appSecret)) != 1 {
 		return ErrAppSecretNotMatch
 	}
 	return nil
@@ -198,28 +318,25 @@ func CheckAppSecret(appId string, appSecret string) error {
 
 // GenerateAppId
 // 创建唯一的appid
-func generateAppId() (string, error) {
-	timeUnix := time.Now().Unix()
-	Tp := strconv.FormatInt(timeUnix, 10)
-
-	appId := time.Now().Format("20060102") + Tp[len(Tp)-4:] + strconv.Itoa(toolutil.RandInt(4))
-	if exists, err := checkAppIdExists(appId); err != nil {
+func generateAppId(db *gorm.DB) (string, error) {
+	appId := time.Now().Format("20060102") + randutil.Digits(8)
+	if exists, err := checkAppIdExists(db, appId); err != nil {
 		return "", err
 	} else if exists {
-		return generateAppId()
+		return generateAppId(db)
 	}
 	return appId, nil
 }
 
 // CheckIfUserApp
 // 判断是否为该用户的app
-func CheckIfUserApp(appId string, userId int) (bool, error) {
+func CheckIfUserApp(db *gorm.DB, appId string, userId int) (bool, error) {
 	var appUserId int
-	err := dbutil.D.Model(&model.App{}).Select("user_id").Where(model.App{AppId: appId}).Take(&appUserId).Error
+	err := db.Model(&model.App{}).Select("user_id").Where(model.App{AppId: appId}).Take(&appUserId).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		log.Printf("[ERROR] CheckIfUserApp error: %s", err)
 
-		return false, errors.New("app not exist")
+		return false, ErrAppNotExist
 	} else if err != nil {
 		log.Printf("[ERROR] CheckIfUserApp error: %s", err)
 
@@ -234,33 +351,37 @@ func CheckIfUserApp(appId string, userId int) (bool, error) {
 
 // ReGenerateSecret
 // 重新生成新的 appSecret
-func ReGenerateSecret(appId string) (string, error) {
+func ReGenerateSecret(db *gorm.DB, rdb redis.Cmdable, appId string, actor auditutil.Actor) (string, error) {
 	appSecret := generateAppSecret()
-	err := dbutil.D.Model(&model.App{}).
+	err := db.Model(&model.App{}).
 		Where(model.App{AppId: appId}).
 		Updates(model.App{AppSecret: appSecret}).Error
 	if err != nil {
 		log.Printf("[ERROR] ReGenerateAppSecret error: %s", err)
 		return "", errors.New("server error")
 	}
+	PurgeAppCache(rdb, appId)
+
+	auditutil.Record(db, actor, auditutil.Entry{
+		Action:     auditutil.ActionAppSecretReset,
+		UserId:     actor.UserId,
+		TargetType: auditutil.TargetApp,
+		TargetId:   appId,
+	})
 	return appSecret, nil
 }
 
 // generateAppSecret
 // 创建唯一的appSecret
 func generateAppSecret() string {
-	a := toolutil.Md5(time.Now().Format("20060102"))[:16]
-	b := toolutil.Md5(strconv.FormatInt(time.Now().UnixNano(), 10))[:16]
-	c := toolutil.RandStr(16)
-	d := toolutil.RandStr(16)
-	return strings.Join([]string{a, b, c, d}, ".")
+	return randutil.Base62(64)
 }
 
 // CheckAppIdExists
 // @description: check if appid exists
-func checkAppIdExists(appid string) (bool, error) {
+func checkAppIdExists(db *gorm.DB, appid string) (bool, error) {
 	var ID int64
-	err := dbutil.D.Model(model.App{}).Select("id").Where(model.App{AppId: appid}).Take(&ID).Error
+	err := db.Model(model.App{}).Select("id").Where(model.App{AppId: appid}).Take(&ID).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return false, nil
 	} else if err != nil {
@@ -0,0 +1,24 @@
+package apputil
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/soxft/openid-go/library/cacheutil"
+)
+
+var (
+	// appInfoCache appId => 应用信息, 不含密钥
+	appInfoCache = cacheutil.New[AppInfoStruct]("appinfo")
+
+	// OpenIdCache appId:userId => openId
+	OpenIdCache = cacheutil.New[string]("openid")
+	// UniqueIdCache userId:devUserId => uniqueId
+	UniqueIdCache = cacheutil.New[string]("uniqueid")
+)
+
+// PurgeOpenIdCache
+// @description: 清除应用下所有用户的 openId 缓存
+func PurgeOpenIdCache(rdb redis.Cmdable, appId string) {
+	OpenIdCache.DeletePrefix(context.Background(), rdb, appId+":")
+}
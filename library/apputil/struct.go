@@ -9,12 +9,27 @@ type AppBaseStruct struct {
 	CreateAt int64  `json:"create_time"`
 }
 
-type AppFullInfoStruct struct {
+// AppInfoStruct 应用信息, 不含密钥, 可以进入缓存
+type AppInfoStruct struct {
 	Id         int    `json:"id"`
 	AppUserId  int    `json:"user_id"`
 	AppId      string `json:"app_id"`
 	AppName    string `json:"app_name"`
-	AppSecret  string `json:"app_secret"`
+	AppGateway string `json:"app_gateway"`
+	CreateAt   int64  `json:"create_time"`
+}
+
+// AppFullInfoStruct 应用信息及密钥, 仅返回给应用所有者, 不缓存
+type AppFullInfoStruct struct {
+	AppInfoStruct
+	AppSecret string `json:"app_secret"`
+}
+
+type AppAdminStruct struct {
+	Id         int    `json:"id"`
+	UserId     int    `json:"user_id"`
+	AppId      string `json:"app_id"`
+	AppName    string `json:"app_name"`
 	AppGateway string `json:"app_gateway"`
 	CreateAt   int64  `json:"create_time"`
 }
@@ -24,4 +39,5 @@ type AppErr = error
 var (
 	ErrAppNotExist       = errors.New("app not exist")
 	ErrAppSecretNotMatch = errors.New("app secret not match")
+	ErrAppLimitExceeded  = errors.New("the number of app exceeds the limit")
 )
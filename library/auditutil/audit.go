@@ -0,0 +1,130 @@
+package auditutil
+
+import (
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/soxft/openid-go/app/model"
+	"gorm.io/gorm"
+)
+
+// FromContext
+// @description 从请求中获取操作者, 需在 AuthPermission 之后调用才能获得 userId
+func FromContext(c *gin.Context) Actor {
+	return Actor{
+		UserId:    c.GetInt("userId"),
+		Ip:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+}
+
+// Record
+// @description 写入一条审计日志; 写入失败只记录错误, 不影响业务
+func Record(db *gorm.DB, actor Actor, e Entry) {
+	if e.Result == "" {
+		e.Result = ResultSuccess
+	}
+
+	err := db.Create(&model.AuditLog{
+		Action:     e.Action,
+		ActorId:    actor.UserId,
+		UserId:     e.UserId,
+		TargetType: e.TargetType,
+		TargetId:   truncate(e.TargetId, 64),
+		Ip:         truncate(actor.Ip, 128),
+		UserAgent:  truncate(actor.UserAgent, 255),
+		Result:     e.Result,
+		Detail:     truncate(e.Detail, 255),
+		CreatedAt:  time.Now().Unix(),
+	}).Error
+	if err != nil {
+		log.Printf("[ERROR] audit record %s: %v", e.Action, err)
+	}
+}
+
+// List
+// @description 按条件分页查询, 按时间倒序
+func List(db *gorm.DB, f Filter, limit, offset int) ([]Log, int64, error) {
+	query := f.apply(db.Model(&model.AuditLog{}))
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		log.Printf("[ERROR] audit list: %v", err)
+		return nil, 0, err
+	}
+
+	logs := []Log{}
+	if err := query.Order("id desc").Limit(limit).Offset(offset).Scan(&logs).Error; err != nil {
+		log.Printf("[ERROR] audit list: %v", err)
+		return nil, 0, err
+	}
+	return logs, total, nil
+}
+
+// Each
+// @description 按时间倒序分批遍历符合条件的日志, 用于导出
+func Each(db *gorm.DB, f Filter, batchSize int, fn func([]Log) error) error {
+	var lastId int64
+	for {
+		query := f.apply(db.Model(&model.AuditLog{}))
+		if lastId > 0 {
+			query = query.Where("id < ?", lastId)
+		}
+
+		var logs []Log
+		if err := query.Order("id desc").Limit(batchSize).Scan(&logs).Error; err != nil {
+			log.Printf("[ERROR] audit each: %v", err)
+			return err
+		}
+		if len(logs) == 0 {
+			return nil
+		}
+		if err := fn(logs); err != nil {
+			return err
+		}
+		if len(logs) < batchSize {
+			return nil
+		}
+		lastId = logs[len(logs)-1].ID
+	}
+}
+
+func (f Filter) apply(query *gorm.DB) *gorm.DB {
+	if f.Action != "" {
+		query = query.Where("action = ?", f.Action)
+	}
+	if f.ActorId > 0 {
+		query = query.Where("actor_id = ?", f.ActorId)
+	}
+	if f.UserId > 0 {
+		query = query.Where("user_id = ?", f.UserId)
+	}
+	if f.TargetType != "" {
+		query = query.Where("target_type = ?", f.TargetType)
+	}
+	if f.TargetId != "" {
+		query = query.Where("target_id = ?", f.TargetId)
+	}
+	if f.Ip != "" {
+		query = query.Where("ip = ?", f.Ip)
+	}
+	if f.Result != "" {
+		query = query.Where("result = ?", f.Result)
+	}
+	if f.From > 0 {
+		query = query.Where("created_at >= ?", f.From)
+	}
+	if f.To > 0 {
+		query = query.Where("created_at < ?", f.To)
+	}
+	return query
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
@@ -0,0 +1,86 @@
+package auditutil
+
+// 事件类型
+const (
+	ActionLogin               = "login"
+	ActionLoginPasskey        = "login.passkey"
+	ActionLoginDeny           = "login.deny"
+	ActionLogout              = "logout"
+	ActionReauth              = "reauth"
+	ActionPasswordUpdate      = "password.update"
+	ActionPasswordForget      = "password.forget"
+	ActionPasswordForceReset  = "password.force_reset"
+	ActionEmailUpdate         = "email.update"
+	ActionPasskeyAdd          = "passkey.add"
+	ActionPasskeyDelete       = "passkey.delete"
+	ActionPasskeyRename       = "passkey.rename"
+	ActionAppSecretReset      = "app.secret.reset"
+	ActionAppDelete           = "app.delete"
+	ActionAppTransfer         = "app.transfer"
+	ActionAccountCreate       = "account.create"
+	ActionAccountDelete       = "account.delete"
+	ActionAccountDeleteApply  = "account.delete.apply"
+	ActionAccountDeleteCancel = "account.delete.cancel"
+	ActionAccountSuspend      = "account.suspend"
+	ActionAccountUnsuspend    = "account.unsuspend"
+	ActionRoleUpdate          = "role.update"
+	ActionSessionsRevoke      = "sessions.revoke"
+)
+
+// 事件结果
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// 事件对象类型
+const (
+	TargetUser    = "user"
+	TargetApp     = "app"
+	TargetPasskey = "passkey"
+)
+
+// Actor 操作者
+type Actor struct {
+	UserId    int // 0 为匿名或系统
+	Ip        string
+	UserAgent string
+}
+
+// Entry 一条待写入的审计事件
+type Entry struct {
+	Action     string
+	UserId     int // 事件所属用户, 用户可在安全日志中看到
+	TargetType string
+	TargetId   string
+	Result     string // 为空时视为 success
+	Detail     string
+}
+
+// Filter 审计日志查询条件, 零值字段不参与过滤
+type Filter struct {
+	Action     string
+	ActorId    int
+	UserId     int
+	TargetType string
+	TargetId   string
+	Ip         string
+	Result     string
+	From       int64 // unix 秒, 包含
+	To         int64 // unix 秒, 不包含
+}
+
+// Log 审计日志
+type Log struct {
+	ID         int64  `json:"id"`
+	Action     string `json:"action"`
+	ActorId    int    `json:"actor_id"`
+	UserId     int    `json:"user_id"`
+	TargetType string `json:"target_type"`
+	TargetId   string `json:"target_id"`
+	Ip         string `json:"ip"`
+	UserAgent  string `json:"user_agent"`
+	Result     string `json:"result"`
+	Detail     string `json:"detail"`
+	CreatedAt  int64  `json:"created_at"`
+}
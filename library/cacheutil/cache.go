@@ -0,0 +1,199 @@
+package cacheutil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/soxft/openid-go/config"
+)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]localEvicter{}
+)
+
+// Cache 进程内 LRU + Redis 的二级读穿缓存
+type Cache[T any] struct {
+	name      string
+	localOnce sync.Once
+	local     *lru[T]
+	counter   counter
+}
+
+// New
+// @description 创建一个二级缓存, name 需全局唯一
+func New[T any](name string) *Cache[T] {
+	c := &Cache[T]{name: name}
+
+	registryMu.Lock()
+	registry[name] = c
+	registryMu.Unlock()
+
+	return c
+}
+
+// Get
+// @description 依次查询本地缓存, Redis, 均未命中时调用 load 并回填
+// load 返回的错误不会被缓存
+func (c *Cache[T]) Get(ctx context.Context, rdb redis.Cmdable, key string, load func() (T, error)) (T, error) {
+	if local := c.getLocal(); local != nil {
+		if v, ok := local.get(key); ok {
+			c.counter.localHit.Add(1)
+			return v, nil
+		}
+	}
+
+	redisKey := c.redisKey(key)
+	if raw, err := rdb.Get(ctx, redisKey).Bytes(); err == nil {
+		var v T
+		if err := json.Unmarshal(raw, &v); err == nil {
+			c.counter.redisHit.Add(1)
+			c.setLocal(key, v)
+			return v, nil
+		}
+	} else if !errors.Is(err, redis.Nil) {
+		log.Printf("[ERROR] cache(%s) get: %v", c.name, err)
+	}
+
+	c.counter.miss.Add(1)
+	v, err := load()
+	if err != nil {
+		return v, err
+	}
+
+	if raw, err := json.Marshal(v); err == nil {
+		if err := rdb.Set(ctx, redisKey, raw, redisTTL()).Err(); err != nil {
+			log.Printf("[ERROR] cache(%s) set: %v", c.name, err)
+		}
+	}
+	c.setLocal(key, v)
+	return v, nil
+}
+
+// Delete
+// @description 删除指定 key, 并通知其他实例清除本地缓存
+func (c *Cache[T]) Delete(ctx context.Context, rdb redis.Cmdable, key string) {
+	if err := rdb.Del(ctx, c.redisKey(key)).Err(); err != nil {
+		log.Printf("[ERROR] cache(%s) delete: %v", c.name, err)
+	}
+	c.evictLocal(key, false)
+	c.broadcast(ctx, rdb, key, false)
+}
+
+// DeletePrefix
+// @description 删除所有以 prefix 开头的 key
+func (c *Cache[T]) DeletePrefix(ctx context.Context, rdb redis.Cmdable, prefix string) {
+	iter := rdb.Scan(ctx, 0, c.redisKey(prefix)+"*", 200).Iterator()
+	var keys []string
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		log.Printf("[ERROR] cache(%s) scan: %v", c.name, err)
+	}
+	if len(keys) > 0 {
+		if err := rdb.Del(ctx, keys...).Err(); err != nil {
+			log.Printf("[ERROR] cache(%s) delete prefix: %v", c.name, err)
+		}
+	}
+	c.evictLocal(prefix, true)
+	c.broadcast(ctx, rdb, prefix, true)
+}
+
+func (c *Cache[T]) getLocal() *lru[T] {
+	c.localOnce.Do(func() {
+		if size := config.Cache.LocalSize; size > 0 {
+			c.local = newLru[T](size)
+		}
+	})
+	return c.local
+}
+
+func (c *Cache[T]) setLocal(key string, v T) {
+	if local := c.getLocal(); local != nil {
+		local.set(key, v, time.Duration(config.Cache.LocalTTL)*time.Second)
+	}
+}
+
+func (c *Cache[T]) evictLocal(key string, prefix bool) {
+	local := c.getLocal()
+	if local == nil {
+		return
+	}
+	if prefix {
+		local.deletePrefix(key)
+	} else {
+		local.delete(key)
+	}
+}
+
+func (c *Cache[T]) stat() Stat {
+	return Stat{
+		LocalHit: c.counter.localHit.Load(),
+		RedisHit: c.counter.redisHit.Load(),
+		Miss:     c.counter.miss.Load(),
+	}
+}
+
+func (c *Cache[T]) broadcast(ctx context.Context, rdb redis.Cmdable, key string, prefix bool) {
+	msg, _ := json.Marshal(invalidateMsg{Cache: c.name, Key: key, Prefix: prefix})
+	if err := rdb.Publish(ctx, invalidateChannel(), msg).Err(); err != nil {
+		log.Printf("[ERROR] cache(%s) broadcast: %v", c.name, err)
+	}
+}
+
+func (c *Cache[T]) redisKey(key string) string {
+	return config.RedisPrefix + ":cache:" + c.name + ":" + key
+}
+
+// Stats
+// @description 获取所有缓存的命中统计
+func Stats() map[string]Stat {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	stats := make(map[string]Stat, len(registry))
+	for name, c := range registry {
+		stats[name] = c.stat()
+	}
+	return stats
+}
+
+// Subscribe
+// @description 订阅其他实例发出的失效消息, 清除本实例的本地缓存
+func Subscribe(ctx context.Context, rdb redis.UniversalClient) {
+	sub := rdb.Subscribe(ctx, invalidateChannel())
+
+	go func() {
+		defer sub.Close()
+		for msg := range sub.Channel() {
+			var m invalidateMsg
+			if err := json.Unmarshal([]byte(msg.Payload), &m); err != nil {
+				continue
+			}
+
+			registryMu.RLock()
+			c, ok := registry[m.Cache]
+			registryMu.RUnlock()
+			if ok {
+				c.evictLocal(m.Key, m.Prefix)
+			}
+		}
+	}()
+}
+
+func redisTTL() time.Duration {
+	if ttl := config.Cache.RedisTTL; ttl > 0 {
+		return time.Duration(ttl) * time.Second
+	}
+	return 10 * time.Minute
+}
+
+func invalidateChannel() string {
+	return config.RedisPrefix + ":cache:invalidate"
+}
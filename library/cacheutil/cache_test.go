@@ -0,0 +1,208 @@
+package cacheutil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/soxft/openid-go/config"
+)
+
+// setup 使用 miniredis, 本地缓存容量为 localSize
+func setup(t *testing.T, localSize int) (*redis.Client, *miniredis.Miniredis) {
+	t.Helper()
+
+	if err := config.Apply(&config.Config{
+		RedisConfig: config.RedisConfig{Prefix: "openid"},
+		CacheConfig: config.CacheConfig{LocalSize: localSize, LocalTTL: 60, RedisTTL: 120},
+	}); err != nil {
+		t.Fatalf("apply config: %v", err)
+	}
+
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return rdb, mr
+}
+
+// loader 记录 load 的调用次数
+type loader struct {
+	calls int
+	value string
+	err   error
+}
+
+func (l *loader) load() (string, error) {
+	l.calls++
+	return l.value, l.err
+}
+
+func TestLruEviction(t *testing.T) {
+	l := newLru[int](2)
+	l.set("a", 1, time.Minute)
+	l.set("b", 2, time.Minute)
+	// 访问 a 后 b 成为最久未使用的项
+	if _, ok := l.get("a"); !ok {
+		t.Fatal("a missing")
+	}
+	l.set("c", 3, time.Minute)
+
+	if _, ok := l.get("b"); ok {
+		t.Fatal("least recently used entry not evicted")
+	}
+	for key, want := range map[string]int{"a": 1, "c": 3} {
+		if v, ok := l.get(key); !ok || v != want {
+			t.Fatalf("get(%s) = %d, %v", key, v, ok)
+		}
+	}
+
+	// 更新已有的项不会淘汰其他项
+	l.set("a", 10, time.Minute)
+	if v, _ := l.get("a"); v != 10 || l.ll.Len() != 2 {
+		t.Fatalf("update: a = %d, len = %d", v, l.ll.Len())
+	}
+
+	l.set("user:1", 1, time.Minute)
+	l.deletePrefix("user:")
+	if _, ok := l.get("user:1"); ok {
+		t.Fatal("deletePrefix kept matching key")
+	}
+}
+
+func TestLruTTL(t *testing.T) {
+	l := newLru[string](2)
+	l.set("expired", "v", -time.Second)
+	l.set("fresh", "v", time.Minute)
+
+	if _, ok := l.get("expired"); ok {
+		t.Fatal("expired entry returned")
+	}
+	if _, ok := l.items["expired"]; ok {
+		t.Fatal("expired entry not removed on read")
+	}
+	if _, ok := l.get("fresh"); !ok {
+		t.Fatal("fresh entry missing")
+	}
+}
+
+func TestCacheRedisTTL(t *testing.T) {
+	rdb, mr := setup(t, 0)
+	c := New[string]("test_redis_ttl")
+	l := &loader{value: "v1"}
+
+	if v, err := c.Get(context.Background(), rdb, "k", l.load); err != nil || v != "v1" {
+		t.Fatalf("Get = %q, %v", v, err)
+	}
+	if ttl := mr.TTL(c.redisKey("k")); ttl != 120*time.Second {
+		t.Fatalf("redis ttl = %v, want 120s", ttl)
+	}
+
+	// 本地缓存关闭时由 Redis 命中
+	if v, _ := c.Get(context.Background(), rdb, "k", l.load); v != "v1" || l.calls != 1 {
+		t.Fatalf("Get = %q, load calls = %d", v, l.calls)
+	}
+
+	mr.FastForward(121 * time.Second)
+	l.value = "v2"
+	if v, _ := c.Get(context.Background(), rdb, "k", l.load); v != "v2" || l.calls != 2 {
+		t.Fatalf("after expiry Get = %q, load calls = %d", v, l.calls)
+	}
+	if s := c.stat(); s.RedisHit != 1 || s.Miss != 2 || s.LocalHit != 0 {
+		t.Fatalf("stat = %+v", s)
+	}
+}
+
+func TestCacheRedisFallback(t *testing.T) {
+	rdb, mr := setup(t, 16)
+	c := New[string]("test_fallback")
+	l := &loader{value: "v1"}
+
+	// load 的错误不缓存
+	l.err = errors.New("db down")
+	if _, err := c.Get(context.Background(), rdb, "k", l.load); err == nil {
+		t.Fatal("load error not returned")
+	}
+	if mr.Exists(c.redisKey("k")) {
+		t.Fatal("failed load cached in redis")
+	}
+
+	// 其他实例写入的值从 Redis 读取并回填本地缓存
+	raw, _ := json.Marshal("from redis")
+	mr.Set(c.redisKey("k"), string(raw))
+	l.err = nil
+	if v, _ := c.Get(context.Background(), rdb, "k", l.load); v != "from redis" || l.calls != 1 {
+		t.Fatalf("Get = %q, load calls = %d", v, l.calls)
+	}
+	mr.Del(c.redisKey("k"))
+	if v, _ := c.Get(context.Background(), rdb, "k", l.load); v != "from redis" {
+		t.Fatalf("local cache not filled: %q", v)
+	}
+
+	// Redis 不可用时回源加载, 不返回错误
+	c.evictLocal("k", false)
+	mr.Close()
+	if v, err := c.Get(context.Background(), rdb, "k", l.load); err != nil || v != "v1" || l.calls != 2 {
+		t.Fatalf("redis down: Get = %q, %v, load calls = %d", v, err, l.calls)
+	}
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	rdb, mr := setup(t, 16)
+	c := New[string]("test_invalidation")
+	l := &loader{value: "v1"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	Subscribe(ctx, rdb)
+	waitFor(t, func() bool { return mr.PubSubNumSub(invalidateChannel())[invalidateChannel()] == 1 })
+
+	for _, key := range []string{"app:1", "app:2", "other"} {
+		if _, err := c.Get(context.Background(), rdb, key, l.load); err != nil {
+			t.Fatalf("Get(%s): %v", key, err)
+		}
+	}
+
+	// 模拟其他实例删除 key: 只发布失效消息, 不经过本实例的 Delete
+	publish := func(key string, prefix bool) {
+		msg, _ := json.Marshal(invalidateMsg{Cache: c.name, Key: key, Prefix: prefix})
+		mr.Publish(invalidateChannel(), string(msg))
+	}
+	cached := func(key string) bool {
+		_, ok := c.getLocal().get(key)
+		return ok
+	}
+
+	publish("other", false)
+	waitFor(t, func() bool { return !cached("other") })
+	if !cached("app:1") {
+		t.Fatal("unrelated key evicted")
+	}
+
+	publish("app:", true)
+	waitFor(t, func() bool { return !cached("app:1") && !cached("app:2") })
+
+	// Delete 同时清除 Redis 与本地缓存
+	if _, err := c.Get(context.Background(), rdb, "k", l.load); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	c.Delete(context.Background(), rdb, "k")
+	if cached("k") || mr.Exists(c.redisKey("k")) {
+		t.Fatal("Delete left cached value")
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
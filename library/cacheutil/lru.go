@@ -0,0 +1,92 @@
+package cacheutil
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lru 进程内带过期时间的 LRU 缓存
+type lru[T any] struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type lruEntry[T any] struct {
+	key      string
+	value    T
+	expireAt time.Time
+}
+
+func newLru[T any](size int) *lru[T] {
+	return &lru[T]{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (l *lru[T]) get(key string) (T, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var zero T
+	el, ok := l.items[key]
+	if !ok {
+		return zero, false
+	}
+	entry := el.Value.(*lruEntry[T])
+	if time.Now().After(entry.expireAt) {
+		l.removeElement(el)
+		return zero, false
+	}
+	l.ll.MoveToFront(el)
+	return entry.value, true
+}
+
+func (l *lru[T]) set(key string, value T, ttl time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	expireAt := time.Now().Add(ttl)
+	if el, ok := l.items[key]; ok {
+		entry := el.Value.(*lruEntry[T])
+		entry.value = value
+		entry.expireAt = expireAt
+		l.ll.MoveToFront(el)
+		return
+	}
+
+	l.items[key] = l.ll.PushFront(&lruEntry[T]{key: key, value: value, expireAt: expireAt})
+	for l.ll.Len() > l.size {
+		l.removeElement(l.ll.Back())
+	}
+}
+
+func (l *lru[T]) delete(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if el, ok := l.items[key]; ok {
+		l.removeElement(el)
+	}
+}
+
+func (l *lru[T]) deletePrefix(prefix string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, el := range l.items {
+		if strings.HasPrefix(key, prefix) {
+			l.removeElement(el)
+		}
+	}
+}
+
+func (l *lru[T]) removeElement(el *list.Element) {
+	l.ll.Remove(el)
+	delete(l.items, el.Value.(*lruEntry[T]).key)
+}
@@ -0,0 +1,29 @@
+package cacheutil
+
+import "sync/atomic"
+
+// Stat 缓存命中统计
+type Stat struct {
+	LocalHit int64 `json:"local_hit"`
+	RedisHit int64 `json:"redis_hit"`
+	Miss     int64 `json:"miss"`
+}
+
+type counter struct {
+	localHit atomic.Int64
+	redisHit atomic.Int64
+	miss     atomic.Int64
+}
+
+// invalidateMsg 跨实例广播的本地缓存失效消息
+type invalidateMsg struct {
+	Cache  string `json:"cache"`
+	Key    string `json:"key"`
+	Prefix bool   `json:"prefix"`
+}
+
+// localEvicter 由各 Cache 实现, 用于处理失效广播
+type localEvicter interface {
+	evictLocal(key string, prefix bool)
+	stat() Stat
+}
@@ -2,37 +2,31 @@ package codeutil
 
 import (
 	"context"
+	"github.com/redis/go-redis/v9"
 	"github.com/soxft/openid-go/config"
+	"github.com/soxft/openid-go/library/randutil"
 	"github.com/soxft/openid-go/library/toolutil"
-	"github.com/soxft/openid-go/process/redisutil"
-	"math/rand"
-	"strconv"
 	"time"
 )
 
-func New(ctx context.Context) *VerifyCode {
+func New(ctx context.Context, rdb redis.Cmdable) *VerifyCode {
 	return &VerifyCode{
 		ctx: ctx,
+		rdb: rdb,
 	}
 }
 
 // Create
 // @description: create verify code
 func (c VerifyCode) Create(length int) string {
-	rand.Seed(time.Now().UnixNano() + int64(rand.Intn(100)))
-
-	var code string
-	for i := 0; i < length; i++ {
-		code += strconv.Itoa(rand.Intn(10))
-	}
-	return code
+	return randutil.Digits(length)
 }
 
 // Save
 // @description: save verify code 存储验证码
 // timeout: expire time (second)
 func (c VerifyCode) Save(topic string, email string, code string, timeout time.Duration) error {
-	_redis := redisutil.RDB
+	_redis := c.rdb
 
 	redisKey := config.RedisPrefix + ":code:" + topic + ":" + toolutil.Md5(email)
 
@@ -42,7 +36,7 @@ func (c VerifyCode) Save(topic string, email string, code string, timeout time.D
 // Check
 // @description: 判断验证码是否正确
 func (c VerifyCode) Check(topic string, email string, code string) (bool, error) {
-	_redis := redisutil.RDB
+	_redis := c.rdb
 
 	redisKey := config.RedisPrefix + ":code:" + topic + ":" + toolutil.Md5(email)
 	if realCode, err := _redis.Get(c.ctx, redisKey).Result(); err != nil {
@@ -58,7 +52,7 @@ func (c VerifyCode) Check(topic string, email string, code string) (bool, error)
 // Consume
 // @description: 消费(删除)验证码
 func (c VerifyCode) Consume(topic string, email string) {
-	_redis := redisutil.RDB
+	_redis := c.rdb
 
 	redisKey := config.RedisPrefix + ":code:" + topic + ":" + toolutil.Md5(email)
 
@@ -3,6 +3,8 @@ package codeutil
 import (
 	"context"
 	"time"
+
+	"github.com/redis/go-redis/v9"
 )
 
 type Coder interface {
@@ -14,4 +16,5 @@ type Coder interface {
 
 type VerifyCode struct {
 	ctx context.Context
+	rdb redis.Cmdable
 }
@@ -0,0 +1,108 @@
+package limitutil
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/soxft/openid-go/config"
+)
+
+// tokenBucket 原子地补充并消费令牌
+// KEYS[1] 桶 key; ARGV: rate(每秒), burst, now(毫秒)
+// 返回 {allowed, remaining, retryAfterMs, resetMs}
+var tokenBucket = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) * 1000 / rate)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+
+return {allowed, math.floor(tokens), retry, math.ceil((burst - tokens) * 1000 / rate)}
+`)
+
+// Allow
+// @description 从 key 对应的令牌桶中取一个令牌
+func Allow(ctx context.Context, rdb redis.Cmdable, key string, rule Rule) (Result, error) {
+	res, err := tokenBucket.Run(ctx, rdb,
+		[]string{config.RedisPrefix + ":ratelimit:" + key},
+		rule.Rate, rule.Burst, time.Now().UnixMilli(),
+	).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		Allowed:    res[0] == 1,
+		Limit:      rule.Burst,
+		Remaining:  int(res[1]),
+		RetryAfter: time.Duration(res[2]) * time.Millisecond,
+		Reset:      time.Duration(res[3]) * time.Millisecond,
+	}, nil
+}
+
+// RuleFor
+// @description 获取 appId 对应的限流规则, 未单独配置时使用默认规则
+func RuleFor(appId string) Rule {
+	r := config.RateLimit
+	rule := Rule{Rate: r.Rate, Burst: r.Burst}
+
+	if override, ok := r.Apps[appId]; ok && appId != "" {
+		if override.Rate > 0 {
+			rule.Rate = override.Rate
+		}
+		if override.Burst > 0 {
+			rule.Burst = override.Burst
+		}
+	}
+	return rule
+}
+
+// IpRule
+// @description 单个客户端 IP 的总限流规则, 不区分 appid; 未配置时使用默认规则
+func IpRule() Rule {
+	r := config.RateLimit
+	rule := Rule{Rate: r.Rate, Burst: r.Burst}
+
+	if r.Ip.Rate > 0 {
+		rule.Rate = r.Ip.Rate
+	}
+	if r.Ip.Burst > 0 {
+		rule.Burst = r.Ip.Burst
+	}
+	return rule
+}
+
+// AuthRule
+// @description 登录与重新验证身份的限流规则, 未配置时每分钟 6 次, 最多连续 10 次
+func AuthRule() Rule {
+	rule := Rule{Rate: 0.1, Burst: 10}
+
+	if r := config.RateLimit.Auth; r.Rate > 0 {
+		rule.Rate = r.Rate
+	}
+	if r := config.RateLimit.Auth; r.Burst > 0 {
+		rule.Burst = r.Burst
+	}
+	return rule
+}
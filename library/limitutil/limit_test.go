@@ -0,0 +1,124 @@
+package limitutil
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/soxft/openid-go/config"
+)
+
+func setup(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	t.Helper()
+
+	if err := config.Apply(&config.Config{RedisConfig: config.RedisConfig{Prefix: "openid"}}); err != nil {
+		t.Fatalf("apply config: %v", err)
+	}
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return rdb, mr
+}
+
+// drain 连续取令牌, 返回被拒绝前放行的次数
+func drain(t *testing.T, rdb redis.Cmdable, key string, rule Rule) (int, Result) {
+	t.Helper()
+
+	for i := 0; ; i++ {
+		res, err := Allow(context.Background(), rdb, key, rule)
+		if err != nil {
+			t.Fatalf("Allow: %v", err)
+		}
+		if !res.Allowed {
+			return i, res
+		}
+		if i > rule.Burst {
+			t.Fatalf("allowed %d requests with burst %d", i+1, rule.Burst)
+		}
+	}
+}
+
+func TestAllowBurst(t *testing.T) {
+	rdb, _ := setup(t)
+	rule := Rule{Rate: 0.01, Burst: 3}
+
+	res, err := Allow(context.Background(), rdb, "burst", rule)
+	if err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+	if !res.Allowed || res.Limit != 3 || res.Remaining != 2 {
+		t.Fatalf("first request = %+v", res)
+	}
+
+	allowed, denied := drain(t, rdb, "burst", rule)
+	if allowed != 2 {
+		t.Fatalf("allowed %d more requests, want 2", allowed)
+	}
+	if denied.Remaining != 0 || denied.RetryAfter <= 0 || denied.RetryAfter > 100*time.Second {
+		t.Fatalf("denied result = %+v", denied)
+	}
+}
+
+func TestAllowRefill(t *testing.T) {
+	rdb, mr := setup(t)
+	rule := Rule{Rate: 50, Burst: 2}
+
+	if allowed, _ := drain(t, rdb, "refill", rule); allowed != 2 {
+		t.Fatalf("allowed %d, want burst 2", allowed)
+	}
+
+	// 每 20ms 补充一个令牌, 且不会超过桶容量
+	time.Sleep(30 * time.Millisecond)
+	if res, _ := Allow(context.Background(), rdb, "refill", rule); !res.Allowed {
+		t.Fatalf("token not refilled: %+v", res)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if allowed, _ := drain(t, rdb, "refill", rule); allowed != 2 {
+		t.Fatalf("allowed %d after long idle, want capped at burst 2", allowed)
+	}
+
+	// 桶在恢复满额后过期
+	if ttl := mr.TTL("openid:ratelimit:refill"); ttl <= 0 || ttl > 2*time.Second {
+		t.Fatalf("bucket ttl = %v", ttl)
+	}
+}
+
+func TestAllowSeparateKeys(t *testing.T) {
+	rdb, _ := setup(t)
+	rule := Rule{Rate: 0.01, Burst: 1}
+
+	if allowed, _ := drain(t, rdb, "app:1:10.0.0.1", rule); allowed != 1 {
+		t.Fatalf("allowed %d, want 1", allowed)
+	}
+	for _, key := range []string{"app:1:10.0.0.2", "app:2:10.0.0.1"} {
+		if res, _ := Allow(context.Background(), rdb, key, rule); !res.Allowed {
+			t.Fatalf("%s limited by another bucket", key)
+		}
+	}
+}
+
+func TestRules(t *testing.T) {
+	err := config.Apply(&config.Config{RateLimitConfig: config.RateLimitConfig{
+		Rate:  5,
+		Burst: 20,
+		Ip:    config.RateLimitRule{Burst: 60},
+		Apps:  map[string]config.RateLimitRule{"202401010000000001": {Rate: 50}},
+		Auth:  config.RateLimitRule{Burst: 3},
+	}})
+	if err != nil {
+		t.Fatalf("apply config: %v", err)
+	}
+
+	for name, tc := range map[string]struct{ got, want Rule }{
+		"default app":  {RuleFor("202401010000000002"), Rule{Rate: 5, Burst: 20}},
+		"override app": {RuleFor("202401010000000001"), Rule{Rate: 50, Burst: 20}},
+		"ip":           {IpRule(), Rule{Rate: 5, Burst: 60}},
+		"auth":         {AuthRule(), Rule{Rate: 0.1, Burst: 3}},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s rule = %+v, want %+v", name, tc.got, tc.want)
+		}
+	}
+}
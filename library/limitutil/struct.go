@@ -0,0 +1,18 @@
+package limitutil
+
+import "time"
+
+// Rule 令牌桶规则
+type Rule struct {
+	Rate  float64 // 每秒补充的令牌数
+	Burst int     // 桶容量
+}
+
+// Result 单次限流判定结果
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration // 被拒绝时, 距离下一个令牌可用的时间
+	Reset      time.Duration // 令牌桶恢复满额所需时间
+}
@@ -2,16 +2,16 @@ package mailutil
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 	"github.com/soxft/openid-go/config"
 	"github.com/soxft/openid-go/library/toolutil"
-	"github.com/soxft/openid-go/process/redisutil"
 	"time"
 )
 
 // CreateBeacon
 // @description: 创建邮件发送信标
-func CreateBeacon(c *gin.Context, mail string, timeout time.Duration) error {
-	_redis := redisutil.RDB
+func CreateBeacon(c *gin.Context, rdb redis.Cmdable, mail string, timeout time.Duration) error {
+	_redis := rdb
 
 	ipKey, mailKey := getRKeys(c, mail)
 
@@ -22,8 +22,8 @@ func CreateBeacon(c *gin.Context, mail string, timeout time.Duration) error {
 
 // DeleteBeacon
 // @description: 手动删除邮件创建新信标
-func DeleteBeacon(c *gin.Context, mail string) {
-	_redis := redisutil.RDB
+func DeleteBeacon(c *gin.Context, rdb redis.Cmdable, mail string) {
+	_redis := rdb
 
 	ipKey, mailKey := getRKeys(c, mail)
 
@@ -33,8 +33,8 @@ func DeleteBeacon(c *gin.Context, mail string) {
 
 // CheckBeacon
 // @description: 检查邮件发送信标 避免频繁发信
-func CheckBeacon(c *gin.Context, mail string) (bool, error) {
-	_redis := redisutil.RDB
+func CheckBeacon(c *gin.Context, rdb redis.Cmdable, mail string) (bool, error) {
+	_redis := rdb
 
 	ipKey, mailKey := getRKeys(c, mail)
 
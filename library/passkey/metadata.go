@@ -0,0 +1,115 @@
+package passkey
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/soxft/openid-go/config"
+)
+
+// bundledMetadata 内置的 MDS3 快照, 仅保留 aaguid 与名称
+//
+//go:embed aaguid.json
+var bundledMetadata []byte
+
+var (
+	metadataOnce sync.Once
+	metadataName map[string]string
+)
+
+// metadataPayload MDS3 payload 中用到的字段
+type metadataPayload struct {
+	Entries []struct {
+		AAGUID            string `json:"aaguid"`
+		MetadataStatement struct {
+			Description string `json:"description"`
+		} `json:"metadataStatement"`
+	} `json:"entries"`
+}
+
+// AuthenticatorName 根据 AAGUID (uuid 格式) 获取认证器名称, 未知时返回空字符串
+func AuthenticatorName(aaguid string) string {
+	metadataOnce.Do(loadMetadata)
+	return metadataName[strings.ToLower(aaguid)]
+}
+
+// loadMetadata 加载内置快照, 配置了 MetadataPath 时以其覆盖
+func loadMetadata() {
+	metadataName = make(map[string]string)
+	if err := parseMetadata(bundledMetadata, metadataName); err != nil {
+		log.Printf("[ERROR] passkey bundled metadata: %v", err)
+	}
+
+	if config.Passkey.MetadataPath == "" {
+		return
+	}
+	data, err := os.ReadFile(config.Passkey.MetadataPath)
+	if err == nil {
+		err = parseMetadata(data, metadataName)
+	}
+	if err != nil {
+		log.Printf("[ERROR] passkey metadata %s: %v", config.Passkey.MetadataPath, err)
+	}
+}
+
+func parseMetadata(data []byte, names map[string]string) error {
+	var payload metadataPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+	for _, entry := range payload.Entries {
+		if entry.AAGUID != "" && entry.MetadataStatement.Description != "" {
+			names[strings.ToLower(entry.AAGUID)] = entry.MetadataStatement.Description
+		}
+	}
+	return nil
+}
+
+// formatAAGUID 将 16 字节 AAGUID 转为 uuid 格式, 全 0 (未提供) 时返回空字符串
+func formatAAGUID(aaguid []byte) string {
+	if len(aaguid) != 16 {
+		return ""
+	}
+	zero := true
+	for _, b := range aaguid {
+		if b != 0 {
+			zero = false
+			break
+		}
+	}
+	if zero {
+		return ""
+	}
+	return fmt.Sprintf("%x-%x-%x-%x-%x", aaguid[0:4], aaguid[4:6], aaguid[6:8], aaguid[8:10], aaguid[10:16])
+}
+
+// FormatAAGUID 将数据库中保存的 AAGUID 转为 uuid 格式
+func FormatAAGUID(stored string) string {
+	if stored == "" {
+		return ""
+	}
+	data, err := decodeKey(stored)
+	if err != nil {
+		return ""
+	}
+	return formatAAGUID(data)
+}
+
+// aaguidAllowed 检查认证器型号是否在 Passkey.AllowedAAGUIDs 中, 未配置时不限制
+func aaguidAllowed(aaguid []byte) bool {
+	if len(config.Passkey.AllowedAAGUIDs) == 0 {
+		return true
+	}
+	id := formatAAGUID(aaguid)
+	for _, allowed := range config.Passkey.AllowedAAGUIDs {
+		if id != "" && id == allowed {
+			return true
+		}
+	}
+	return false
+}
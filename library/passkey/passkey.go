@@ -1,20 +1,24 @@
 package passkey
 
 import (
-	"bytes"
 	"context"
-	"encoding/base64"
 	"errors"
 	"fmt"
+	"html"
 	"net/http"
 	"net/url"
+	"strconv"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/go-webauthn/webauthn/protocol"
 	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/redis/go-redis/v9"
 	"github.com/soxft/openid-go/app/model"
 	"github.com/soxft/openid-go/config"
+	"github.com/soxft/openid-go/library/auditutil"
+	"gorm.io/gorm"
 )
 
 var (
@@ -26,36 +30,112 @@ var (
 	ErrSessionNotFound = errors.New("passkey session not found")
 	// ErrNoPasskeyRegistered 在用户未绑定任何 passkey 时返回
 	ErrNoPasskeyRegistered = errors.New("no passkey registered")
+	// ErrUserHandleInvalid 表示 userHandle 不是本站签发的用户 ID
+	ErrUserHandleInvalid = errors.New("passkey user handle invalid")
+	// ErrSignCountRegression 表示签名计数未增长, 认证器可能被克隆
+	ErrSignCountRegression = errors.New("passkey sign count regressed")
+	// ErrAuthenticatorNotAllowed 表示认证器型号不在 Passkey.AllowedAAGUIDs 中
+	ErrAuthenticatorNotAllowed = errors.New("passkey authenticator not allowed")
+	// ErrLastPasskey 表示无密码账号不能删除唯一的 passkey
+	ErrLastPasskey = errors.New("cannot remove the last passkey of a passwordless account")
 )
 
-const sessionTTL = 5 * time.Minute
+// defaultTimeout 未配置 Passkey.RegisterTimeout / LoginTimeout 时挑战的有效期
+const defaultTimeout = 5 * time.Minute
 
 // Init 初始化 WebAuthn 配置
 func Init() error {
 	waInitOnce.Do(func() {
+		waInstance, waInitErr = newWebAuthn()
+	})
+
+	return waInitErr
+}
+
+func newWebAuthn() (*webauthn.WebAuthn, error) {
+	rpID, origins := config.Passkey.RPID, config.Passkey.Origins
+	if rpID == "" || len(origins) == 0 {
 		frontURL, err := url.Parse(config.Server.FrontUrl)
 		if err != nil {
-			waInitErr = fmt.Errorf("parse front url: %w", err)
-			return
+			return nil, fmt.Errorf("parse front url: %w", err)
 		}
-
-		rpID := frontURL.Hostname()
 		if rpID == "" {
-			waInitErr = errors.New("front url hostname is empty")
-			return
+			rpID = frontURL.Hostname()
 		}
-
-		origin := fmt.Sprintf("%s://%s", frontURL.Scheme, frontURL.Host)
-		waConfig := &webauthn.Config{
-			RPDisplayName: config.Server.Name,
-			RPID:          rpID,
-			RPOrigins:     []string{origin},
+		if len(origins) == 0 {
+			origins = []string{fmt.Sprintf("%s://%s", frontURL.Scheme, frontURL.Host)}
 		}
+	}
+	if rpID == "" {
+		return nil, errors.New("front url hostname is empty")
+	}
+
+	rpName := config.Passkey.RPName
+	if rpName == "" {
+		rpName = config.Server.Name
+	}
 
-		waInstance, waInitErr = webauthn.New(waConfig)
+	attestation := protocol.PreferNoAttestation
+	if config.Passkey.Attestation != "" {
+		attestation = protocol.ConveyancePreference(config.Passkey.Attestation)
+	}
+
+	return webauthn.New(&webauthn.Config{
+		RPDisplayName:         rpName,
+		RPID:                  rpID,
+		RPOrigins:             origins,
+		AttestationPreference: attestation,
+		// discoverable 登录依赖 resident key, 始终要求
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			AuthenticatorAttachment: authenticatorAttachment(),
+			RequireResidentKey:      boolPtr(true),
+			ResidentKey:             protocol.ResidentKeyRequirementRequired,
+			UserVerification:        userVerification(),
+		},
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        enforcedTimeout(loginTimeout()),
+			Registration: enforcedTimeout(registrationTimeout()),
+		},
 	})
+}
 
-	return waInitErr
+func authenticatorAttachment() protocol.AuthenticatorAttachment {
+	switch config.Passkey.Attachment {
+	case "any":
+		return ""
+	case "cross-platform":
+		return protocol.CrossPlatform
+	default:
+		return protocol.Platform
+	}
+}
+
+func userVerification() protocol.UserVerificationRequirement {
+	if config.Passkey.UserVerification == "" {
+		return protocol.VerificationPreferred
+	}
+	return protocol.UserVerificationRequirement(config.Passkey.UserVerification)
+}
+
+func enforcedTimeout(d time.Duration) webauthn.TimeoutConfig {
+	return webauthn.TimeoutConfig{Enforce: true, Timeout: d, TimeoutUVD: d}
+}
+
+// registrationTimeout 注册挑战有效期, 同时作为 Redis 中会话的过期时间
+func registrationTimeout() time.Duration {
+	return secondsOr(config.Passkey.RegisterTimeout, defaultTimeout)
+}
+
+// loginTimeout 登录挑战有效期, 同时作为 Redis 中会话的过期时间
+func loginTimeout() time.Duration {
+	return secondsOr(config.Passkey.LoginTimeout, defaultTimeout)
+}
+
+func secondsOr(seconds int, def time.Duration) time.Duration {
+	if seconds <= 0 {
+		return def
+	}
+	return time.Duration(seconds) * time.Second
 }
 
 func ensureInit() error {
@@ -69,50 +149,43 @@ func ensureInit() error {
 }
 
 // BeginRegistration 准备创建 passkey
-func BeginRegistration(ctx context.Context, account model.Account) (RegistrationOptions, error) {
+func BeginRegistration(ctx context.Context, db *gorm.DB, rdb redis.Cmdable, account model.Account) (RegistrationOptions, error) {
 	if err := ensureInit(); err != nil {
 		return RegistrationOptions{}, err
 	}
 
-	passkeys, err := loadUserPasskeys(account.ID)
+	passkeys, err := loadUserPasskeys(db, account.ID)
 	if err != nil {
-		return protocol.PublicKeyCredentialCreationOptions{}, err
+		return RegistrationOptions{}, err
 	}
 
 	waUser, err := newWebAuthnUser(account, passkeys)
 	if err != nil {
-		return protocol.PublicKeyCredentialCreationOptions{}, err
-	}
-
-	selection := protocol.AuthenticatorSelection{
-		AuthenticatorAttachment: protocol.Platform,
-		RequireResidentKey:      boolPtr(true),
-		ResidentKey:             protocol.ResidentKeyRequirementRequired,
-		UserVerification:        protocol.VerificationPreferred,
+		return RegistrationOptions{}, err
 	}
 
-	creation, session, err := waInstance.BeginRegistration(waUser,
-		webauthn.WithAuthenticatorSelection(selection),
-		webauthn.WithConveyancePreference(protocol.PreferNoAttestation),
-	)
+	// 认证器选择与 attestation 使用 Init 中由 Passkey 配置生成的默认值
+	creation, session, err := waInstance.BeginRegistration(waUser)
 	if err != nil {
 		return RegistrationOptions{}, err
 	}
 
-	if err := storeRegistrationSession(ctx, account.ID, session, sessionTTL); err != nil {
-		return protocol.PublicKeyCredentialCreationOptions{}, err
+	sessionID, err := saveSession(ctx, rdb, sessionRegister, session, registrationTimeout())
+	if err != nil {
+		return RegistrationOptions{}, err
 	}
 
-	return creation.Response, nil
+	return RegistrationOptions{PublicKeyCredentialCreationOptions: creation.Response, SessionID: sessionID}, nil
 }
 
 // CompleteRegistration 校验并保存 passkey（保留向后兼容）
-func CompleteRegistration(ctx context.Context, account model.Account, parsed *protocol.ParsedCredentialCreationData) (*model.PassKey, error) {
-	return CompleteRegistrationWithRemark(ctx, account, parsed, "")
+func CompleteRegistration(ctx context.Context, db *gorm.DB, rdb redis.Cmdable, account model.Account, sessionID string, parsed *protocol.ParsedCredentialCreationData) (*model.PassKey, error) {
+	return CompleteRegistrationWithRemark(ctx, db, rdb, auditutil.Actor{UserId: account.ID}, account, sessionID, parsed, "")
 }
 
 // CompleteRegistrationWithRemark 校验并保存 passkey（带备注）
-func CompleteRegistrationWithRemark(ctx context.Context, account model.Account, parsed *protocol.ParsedCredentialCreationData, remark string) (*model.PassKey, error) {
+// sessionID 为 BeginRegistration 返回的会话 ID, 会话只能使用一次, 校验失败需重新获取注册参数
+func CompleteRegistrationWithRemark(ctx context.Context, db *gorm.DB, rdb redis.Cmdable, actor auditutil.Actor, account model.Account, sessionID string, parsed *protocol.ParsedCredentialCreationData, remark string) (*model.PassKey, error) {
 	if parsed == nil {
 		return nil, errors.New("empty credential data")
 	}
@@ -120,7 +193,7 @@ func CompleteRegistrationWithRemark(ctx context.Context, account model.Account,
 		return nil, err
 	}
 
-	passkeys, err := loadUserPasskeys(account.ID)
+	passkeys, err := loadUserPasskeys(db, account.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -130,7 +203,7 @@ func CompleteRegistrationWithRemark(ctx context.Context, account model.Account,
 		return nil, err
 	}
 
-	session, err := loadRegistrationSession(ctx, account.ID)
+	session, err := takeSession(ctx, rdb, sessionRegister, sessionID)
 	if err != nil {
 		return nil, err
 	}
@@ -139,30 +212,39 @@ func CompleteRegistrationWithRemark(ctx context.Context, account model.Account,
 	if err != nil {
 		return nil, err
 	}
+	if !aaguidAllowed(credential.Authenticator.AAGUID) {
+		return nil, ErrAuthenticatorNotAllowed
+	}
 
-	passkey, err := saveCredentialWithRemark(account.ID, credential, remark)
+	passkey, err := saveCredentialWithRemark(db, account.ID, credential, remark)
 	if err != nil {
 		return nil, err
 	}
 
-	_ = deleteRegistrationSession(ctx, account.ID)
+	auditutil.Record(db, actor, auditutil.Entry{
+		Action:     auditutil.ActionPasskeyAdd,
+		UserId:     account.ID,
+		TargetType: auditutil.TargetPasskey,
+		TargetId:   strconv.Itoa(passkey.ID),
+		Detail:     remark,
+	})
 	return passkey, nil
 }
 
 // BeginLogin 创建登录挑战（原函数保留向后兼容）
-func BeginLogin(ctx context.Context, account model.Account) (LoginOptions, error) {
-	return BeginLoginForUser(ctx, account)
+func BeginLogin(ctx context.Context, db *gorm.DB, rdb redis.Cmdable, account model.Account) (LoginOptions, error) {
+	return BeginLoginForUser(ctx, db, rdb, account)
 }
 
 // BeginLoginForUser 为特定用户创建登录挑战（条件式 UI）
-func BeginLoginForUser(ctx context.Context, account model.Account) (LoginOptions, error) {
+func BeginLoginForUser(ctx context.Context, db *gorm.DB, rdb redis.Cmdable, account model.Account) (LoginOptions, error) {
 	if err := ensureInit(); err != nil {
 		return LoginOptions{}, err
 	}
 
-	passkeys, err := loadUserPasskeys(account.ID)
+	passkeys, err := loadUserPasskeys(db, account.ID)
 	if err != nil {
-		return protocol.PublicKeyCredentialRequestOptions{}, err
+		return LoginOptions{}, err
 	}
 	if len(passkeys) == 0 {
 		return LoginOptions{}, ErrNoPasskeyRegistered
@@ -178,58 +260,51 @@ func BeginLoginForUser(ctx context.Context, account model.Account) (LoginOptions
 		return LoginOptions{}, err
 	}
 
-	if err := storeLoginSession(ctx, account.ID, session, sessionTTL); err != nil {
-		return protocol.PublicKeyCredentialRequestOptions{}, err
+	sessionID, err := saveSession(ctx, rdb, sessionLogin, session, loginTimeout())
+	if err != nil {
+		return LoginOptions{}, err
 	}
 
-	return assertion.Response, nil
+	return LoginOptions{PublicKeyCredentialRequestOptions: assertion.Response, SessionID: sessionID}, nil
 }
 
 // BeginDiscoverableLogin 创建无用户名登录挑战（无条件 UI）
-// 直接生成一个通用的登录挑战，不依赖特定用户
-func BeginDiscoverableLogin(ctx context.Context) (LoginOptions, error) {
+// 不指定 allowCredentials, 会话由 CompleteDiscoverableLogin 一次性消费
+func BeginDiscoverableLogin(ctx context.Context, rdb redis.Cmdable) (LoginOptions, error) {
 	if err := ensureInit(); err != nil {
 		return LoginOptions{}, err
 	}
-	
-	// 直接创建一个通用的登录选项，不指定特定用户的凭证
-	challenge, err := protocol.CreateChallenge()
+
+	assertion, session, err := waInstance.BeginDiscoverableLogin()
+	if err != nil {
+		return LoginOptions{}, err
+	}
+
+	sessionID, err := saveSession(ctx, rdb, sessionDiscoverable, session, loginTimeout())
 	if err != nil {
-		return LoginOptions{}, fmt.Errorf("failed to create challenge: %w", err)
-	}
-	
-	options := protocol.PublicKeyCredentialRequestOptions{
-		Challenge:          challenge,
-		Timeout:            60000, // 60 秒超时
-		RelyingPartyID:     waInstance.Config.RPID,
-		UserVerification:   protocol.VerificationPreferred,
-		AllowedCredentials: []protocol.CredentialDescriptor{}, // 空数组允许任何已注册的凭证
-	}
-	
-	// 创建会话
-	session := &webauthn.SessionData{
-		Challenge:            base64.RawURLEncoding.EncodeToString(challenge),
-		UserID:               []byte("discoverable"), // 特殊标记
-		UserVerification:     protocol.VerificationPreferred,
-		AllowedCredentialIDs: [][]byte{}, // 不限制特定凭证
-	}
-	
-	// 存储会话，使用 challenge 作为 key
-	sessionKey := fmt.Sprintf("passkey:discoverable:%s", session.Challenge)
-	if err := storeGenericSession(ctx, sessionKey, session, sessionTTL); err != nil {
 		return LoginOptions{}, err
 	}
-	
-	return options, nil
+
+	return LoginOptions{PublicKeyCredentialRequestOptions: assertion.Response, SessionID: sessionID}, nil
 }
 
 // CompleteLogin 校验登录挑战
-func CompleteLogin(ctx context.Context, account model.Account, request *http.Request) (*model.PassKey, error) {
+func CompleteLogin(ctx context.Context, db *gorm.DB, rdb redis.Cmdable, account model.Account, sessionID string, request *http.Request) (*model.PassKey, error) {
+	parsed, err := protocol.ParseCredentialRequestResponse(request)
+	if err != nil {
+		return nil, err
+	}
+	return CompleteLoginWithAssertion(ctx, db, rdb, account, sessionID, parsed)
+}
+
+// CompleteLoginWithAssertion 使用已解析的断言校验 BeginLoginForUser 创建的挑战, 挑战只能使用一次
+// 签名计数异常时返回 ErrSignCountRegression 与已标记的凭证
+func CompleteLoginWithAssertion(ctx context.Context, db *gorm.DB, rdb redis.Cmdable, account model.Account, sessionID string, parsed *protocol.ParsedCredentialAssertionData) (*model.PassKey, error) {
 	if err := ensureInit(); err != nil {
 		return nil, err
 	}
 
-	passkeys, err := loadUserPasskeys(account.ID)
+	passkeys, err := loadUserPasskeys(db, account.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -242,84 +317,114 @@ func CompleteLogin(ctx context.Context, account model.Account, request *http.Req
 		return nil, err
 	}
 
-	session, err := loadLoginSession(ctx, account.ID)
+	session, err := takeSession(ctx, rdb, sessionLogin, sessionID)
 	if err != nil {
 		return nil, err
 	}
 
-	credential, err := waInstance.FinishLogin(waUser, *session, request)
+	credential, err := waInstance.ValidateLogin(waUser, *session, parsed)
 	if err != nil {
 		return nil, err
 	}
 
-	passkey, err := updateCredentialAfterLogin(account.ID, credential)
-	if err != nil {
-		return nil, err
-	}
-
-	_ = deleteLoginSession(ctx, account.ID)
-	return passkey, nil
+	return updateCredentialAfterLogin(db, account.ID, credential)
 }
 
-// CompleteDiscoverableLogin 验证无用户名登录（简化版本）
-func CompleteDiscoverableLogin(ctx context.Context, account model.Account, parsed *protocol.ParsedCredentialAssertionData) (*model.PassKey, error) {
+// CompleteDiscoverableLogin 验证无用户名登录
+// 校验签名, challenge, origin 与签名计数, 用户由 userHandle 确定
+// 用户确定后即使验证失败也会返回对应账号, 便于记录审计日志
+func CompleteDiscoverableLogin(ctx context.Context, db *gorm.DB, rdb redis.Cmdable, sessionID string, parsed *protocol.ParsedCredentialAssertionData) (model.Account, *model.PassKey, error) {
+	var account model.Account
+	if parsed == nil {
+		return account, nil, errors.New("empty credential data")
+	}
 	if err := ensureInit(); err != nil {
-		return nil, err
+		return account, nil, err
 	}
 
-	// 加载用户的 passkeys
-	passkeys, err := loadUserPasskeys(account.ID)
+	// challenge 只能使用一次, 无论验证是否通过
+	session, err := takeSession(ctx, rdb, sessionDiscoverable, sessionID)
 	if err != nil {
-		return nil, err
-	}
-	if len(passkeys) == 0 {
-		return nil, ErrNoPasskeyRegistered
+		return account, nil, err
 	}
 
-	// 找到匹配的凭证
-	var credential *webauthn.Credential
-	for _, pk := range passkeys {
-		decoded, _ := decodeKey(pk.CredentialID)
-		if bytes.Equal(decoded, parsed.RawID) {
-			pkData, _ := decodeKey(pk.PublicKey)
-			credential = &webauthn.Credential{
-				ID:              decoded,
-				PublicKey:       pkData,
-				AttestationType: pk.Attestation,
-				Authenticator: webauthn.Authenticator{
-					SignCount:    pk.SignCount,
-					CloneWarning: pk.CloneWarning,
-				},
-			}
-			break
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		userID, err := strconv.Atoi(string(userHandle))
+		if err != nil || userID <= 0 {
+			return nil, ErrUserHandleInvalid
+		}
+		if account, err = loadAccount(db, userID); err != nil {
+			return nil, err
 		}
-	}
 
-	if credential == nil {
-		return nil, fmt.Errorf("credential not found")
+		passkeys, err := loadUserPasskeys(db, account.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(passkeys) == 0 {
+			return nil, ErrNoPasskeyRegistered
+		}
+		return newWebAuthnUser(account, passkeys)
 	}
 
-	// 更新签名计数（简化验证，实际验证由前端和浏览器完成）
-	// 这里主要是更新最后使用时间和签名计数
-	credential.Authenticator.SignCount++
-	passkey, err := updateCredentialAfterLogin(account.ID, credential)
+	credential, err := waInstance.ValidateDiscoverableLogin(handler, *session, parsed)
 	if err != nil {
-		return nil, err
+		return account, nil, err
 	}
 
-	// 清理会话
-	_ = deleteLoginSession(ctx, account.ID)
-	return passkey, nil
+	// 签名计数异常时返回 ErrSignCountRegression 与已更新的凭证
+	passkey, err := updateCredentialAfterLogin(db, account.ID, credential)
+	return account, passkey, err
 }
 
 // ListUserPasskeys 获取用户绑定的 passkey
-func ListUserPasskeys(userID int) ([]model.PassKey, error) {
-	return loadUserPasskeys(userID)
+func ListUserPasskeys(db *gorm.DB, userID int) ([]model.PassKey, error) {
+	return loadUserPasskeys(db, userID)
+}
+
+// FindCredentialOwner 通过 credential ID (EncodeKey 编码) 获取所属用户
+func FindCredentialOwner(db *gorm.DB, credentialID string) (int, error) {
+	return findCredentialOwner(db, credentialID)
 }
 
 // DeleteUserPasskey 删除 passkey
-func DeleteUserPasskey(userID, passkeyID int) error {
-	return removeCredential(userID, passkeyID)
+func DeleteUserPasskey(db *gorm.DB, actor auditutil.Actor, userID, passkeyID int) error {
+	if err := removeCredential(db, userID, passkeyID); err != nil {
+		return err
+	}
+
+	auditutil.Record(db, actor, auditutil.Entry{
+		Action:     auditutil.ActionPasskeyDelete,
+		UserId:     userID,
+		TargetType: auditutil.TargetPasskey,
+		TargetId:   strconv.Itoa(passkeyID),
+	})
+	return nil
+}
+
+// RenameUserPasskey 修改 passkey 备注
+func RenameUserPasskey(db *gorm.DB, actor auditutil.Actor, userID, passkeyID int, remark string) (*model.PassKey, error) {
+	passkey, err := renameCredential(db, userID, passkeyID, remark)
+	if err != nil {
+		return nil, err
+	}
+
+	auditutil.Record(db, actor, auditutil.Entry{
+		Action:     auditutil.ActionPasskeyRename,
+		UserId:     userID,
+		TargetType: auditutil.TargetPasskey,
+		TargetId:   strconv.Itoa(passkeyID),
+		Detail:     remark,
+	})
+	return passkey, nil
+}
+
+// CheckRemark 检测 passkey 备注合法性, 可以为空
+func CheckRemark(remark string) bool {
+	if html.EscapeString(remark) != remark {
+		return false
+	}
+	return utf8.RuneCountInString(remark) <= 32
 }
 
 func boolPtr(v bool) *bool {
@@ -0,0 +1,615 @@
+package passkey
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/redis/go-redis/v9"
+	"github.com/soxft/openid-go/app/model"
+	"github.com/soxft/openid-go/config"
+	"github.com/soxft/openid-go/library/auditutil"
+	"github.com/soxft/openid-go/library/passkey/passkeytest"
+	"github.com/soxft/openid-go/process/dbutil"
+	"github.com/soxft/openid-go/process/dbutil/migration"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const testOrigin = "https://openid.test"
+
+// env 测试使用的数据库与 redis
+type env struct {
+	db  *gorm.DB
+	rdb *redis.Client
+	mr  *miniredis.Miniredis
+}
+
+// setup 使用内存 SQLite 与 miniredis, 返回测试环境与已创建的账号
+func setup(t *testing.T) (*env, model.Account) {
+	t.Helper()
+
+	err := config.Apply(&config.Config{
+		ServerConfig: config.ServerConfig{Name: "openid test", FrontUrl: testOrigin},
+		RedisConfig:  config.RedisConfig{Prefix: "openid"},
+	})
+	if err != nil {
+		t.Fatalf("apply config: %v", err)
+	}
+
+	db, err := dbutil.Open(dbutil.DriverSqlite, "file:"+t.Name()+"?mode=memory&cache=shared", &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	sqlDb, _ := db.DB()
+	sqlDb.SetMaxOpenConns(1)
+	if _, err := migration.New(db).Up(0); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	t.Cleanup(func() {
+		_ = rdb.Close()
+		_ = sqlDb.Close()
+	})
+
+	account := model.Account{Username: "alice01", Email: "alice@example.com", Role: model.RoleUser}
+	if err := db.Create(&account).Error; err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+	return &env{db: db, rdb: rdb, mr: mr}, account
+}
+
+// register 走完整的注册流程, 返回认证器中的凭证与保存的记录
+func register(t *testing.T, e *env, auth *passkeytest.Authenticator, account model.Account) (*passkeytest.Credential, *model.PassKey) {
+	t.Helper()
+	ctx := context.Background()
+
+	options, err := BeginRegistration(ctx, e.db, e.rdb, account)
+	if err != nil {
+		t.Fatalf("begin registration: %v", err)
+	}
+	cred, body, err := auth.Register(options.PublicKeyCredentialCreationOptions)
+	if err != nil {
+		t.Fatalf("authenticator register: %v", err)
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("parse creation response: %v", err)
+	}
+	record, err := CompleteRegistrationWithRemark(ctx, e.db, e.rdb, auditutil.Actor{UserId: account.ID}, account, options.SessionID, parsed, "laptop")
+	if err != nil {
+		t.Fatalf("complete registration: %v", err)
+	}
+	return cred, record
+}
+
+// login 使用指定用户的登录挑战完成一次登录
+func login(t *testing.T, e *env, auth *passkeytest.Authenticator, account model.Account, cred *passkeytest.Credential) (*model.PassKey, error) {
+	t.Helper()
+	ctx := context.Background()
+
+	options, err := BeginLoginForUser(ctx, e.db, e.rdb, account)
+	if err != nil {
+		t.Fatalf("begin login: %v", err)
+	}
+	body, err := auth.Assert(options.PublicKeyCredentialRequestOptions, cred)
+	if err != nil {
+		t.Fatalf("authenticator assert: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/passkey/login", bytes.NewReader(body))
+	return CompleteLogin(ctx, e.db, e.rdb, account, options.SessionID, req)
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	e, account := setup(t)
+	auth := passkeytest.New(testOrigin)
+
+	cred, record := register(t, e, auth, account)
+	if record.CredentialID != EncodeKey(cred.ID) || record.Remark != "laptop" || record.SignCount != 0 {
+		t.Fatalf("stored passkey = %+v", record)
+	}
+	if owner, err := FindCredentialOwner(e.db, record.CredentialID); err != nil || owner != account.ID {
+		t.Fatalf("owner = %d, %v", owner, err)
+	}
+
+	record, err := login(t, e, auth, account, cred)
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if record.SignCount != 1 || record.LastUsedAt == 0 || record.CloneWarning {
+		t.Fatalf("passkey after login = %+v", record)
+	}
+}
+
+func TestLoginSessionSingleUse(t *testing.T) {
+	e, account := setup(t)
+	auth := passkeytest.New(testOrigin)
+	cred, _ := register(t, e, auth, account)
+	ctx := context.Background()
+
+	// 同一用户的并发登录各自持有独立的会话
+	first, err := BeginLoginForUser(ctx, e.db, e.rdb, account)
+	if err != nil {
+		t.Fatalf("begin login: %v", err)
+	}
+	second, err := BeginLoginForUser(ctx, e.db, e.rdb, account)
+	if err != nil {
+		t.Fatalf("begin login: %v", err)
+	}
+	if first.SessionID == second.SessionID {
+		t.Fatal("login sessions share an id")
+	}
+
+	for _, options := range []LoginOptions{first, second} {
+		parsed := parseAssertion(t, auth, options, cred)
+		if _, err := CompleteLoginWithAssertion(ctx, e.db, e.rdb, account, options.SessionID, parsed); err != nil {
+			t.Fatalf("login: %v", err)
+		}
+		// 会话只能使用一次
+		if _, err := CompleteLoginWithAssertion(ctx, e.db, e.rdb, account, options.SessionID, parsed); !errors.Is(err, ErrSessionNotFound) {
+			t.Fatalf("replayed login err = %v", err)
+		}
+	}
+
+	// 会话不能跨类型使用
+	options, err := BeginDiscoverableLogin(ctx, e.rdb)
+	if err != nil {
+		t.Fatalf("begin discoverable login: %v", err)
+	}
+	if _, err := CompleteLoginWithAssertion(ctx, e.db, e.rdb, account, options.SessionID, parseAssertion(t, auth, options, cred)); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("discoverable session used for login err = %v", err)
+	}
+}
+
+func TestRegistrationChallenge(t *testing.T) {
+	e, account := setup(t)
+	auth := passkeytest.New(testOrigin)
+	ctx := context.Background()
+
+	complete := func(options RegistrationOptions) error {
+		_, body, err := auth.Register(options.PublicKeyCredentialCreationOptions)
+		if err != nil {
+			t.Fatalf("authenticator register: %v", err)
+		}
+		parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("parse creation response: %v", err)
+		}
+		_, err = CompleteRegistrationWithRemark(ctx, e.db, e.rdb, auditutil.Actor{}, account, options.SessionID, parsed, "")
+		return err
+	}
+
+	options, err := BeginRegistration(ctx, e.db, e.rdb, account)
+	if err != nil {
+		t.Fatalf("begin registration: %v", err)
+	}
+	options.Challenge = append([]byte{}, options.Challenge...)
+	options.Challenge[0] ^= 0xff
+	if err := complete(options); err == nil {
+		t.Fatal("registration accepted a response for another challenge")
+	}
+	// 校验失败后会话同样失效
+	options.Challenge[0] ^= 0xff
+	if err := complete(options); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("registration session reused err = %v", err)
+	}
+
+	options, err = BeginRegistration(ctx, e.db, e.rdb, account)
+	if err != nil {
+		t.Fatalf("begin registration: %v", err)
+	}
+	e.mr.FastForward(registrationTimeout())
+	if err := complete(options); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("expired registration err = %v", err)
+	}
+
+	if passkeys, _ := ListUserPasskeys(e.db, account.ID); len(passkeys) != 0 {
+		t.Fatalf("passkeys saved from rejected registrations: %+v", passkeys)
+	}
+}
+
+func TestLoginRejectsUnknownCredential(t *testing.T) {
+	e, account := setup(t)
+	register(t, e, passkeytest.New(testOrigin), account)
+
+	// 另一个认证器中的凭证未绑定到该账号
+	other := passkeytest.New(testOrigin)
+	cred, _, err := other.Register(protocol.PublicKeyCredentialCreationOptions{
+		RelyingParty: protocol.RelyingPartyEntity{ID: "openid.test"},
+		User:         protocol.UserEntity{ID: []byte("2")},
+		Challenge:    []byte("unused"),
+	})
+	if err != nil {
+		t.Fatalf("authenticator register: %v", err)
+	}
+
+	if _, err := login(t, e, other, account, cred); err == nil {
+		t.Fatal("login accepted an unregistered credential")
+	}
+}
+
+func TestLoginChallengeExpired(t *testing.T) {
+	e, account := setup(t)
+	auth := passkeytest.New(testOrigin)
+	cred, _ := register(t, e, auth, account)
+	ctx := context.Background()
+
+	options, err := BeginLoginForUser(ctx, e.db, e.rdb, account)
+	if err != nil {
+		t.Fatalf("begin login: %v", err)
+	}
+	body, _ := auth.Assert(options.PublicKeyCredentialRequestOptions, cred)
+	e.mr.FastForward(loginTimeout())
+
+	req := httptest.NewRequest(http.MethodPost, "/passkey/login", bytes.NewReader(body))
+	if _, err := CompleteLogin(ctx, e.db, e.rdb, account, options.SessionID, req); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("expired login err = %v", err)
+	}
+}
+
+func TestLoginSignCountRegression(t *testing.T) {
+	e, account := setup(t)
+	auth := passkeytest.New(testOrigin)
+	cred, _ := register(t, e, auth, account)
+
+	for i := 0; i < 2; i++ {
+		if _, err := login(t, e, auth, account, cred); err != nil {
+			t.Fatalf("login %d: %v", i, err)
+		}
+	}
+
+	// 克隆的认证器从较小的计数继续签名, 与无用户名登录一样被拒绝
+	cred.SignCount = 0
+	record, err := login(t, e, auth, account, cred)
+	if !errors.Is(err, ErrSignCountRegression) {
+		t.Fatalf("login with regressed counter err = %v", err)
+	}
+	if record == nil || !record.CloneWarning {
+		t.Fatalf("clone warning not set: %+v", record)
+	}
+}
+
+// assertDiscoverable 为无用户名登录挑战生成断言, 返回会话 ID 与断言
+func assertDiscoverable(t *testing.T, e *env, auth *passkeytest.Authenticator, cred *passkeytest.Credential) (string, *protocol.ParsedCredentialAssertionData) {
+	t.Helper()
+
+	options, err := BeginDiscoverableLogin(context.Background(), e.rdb)
+	if err != nil {
+		t.Fatalf("begin discoverable login: %v", err)
+	}
+	if len(options.AllowedCredentials) != 0 {
+		t.Fatalf("discoverable options list credentials: %+v", options.AllowedCredentials)
+	}
+	return options.SessionID, parseAssertion(t, auth, options, cred)
+}
+
+func parseAssertion(t *testing.T, auth *passkeytest.Authenticator, options LoginOptions, cred *passkeytest.Credential) *protocol.ParsedCredentialAssertionData {
+	t.Helper()
+
+	body, err := auth.Assert(options.PublicKeyCredentialRequestOptions, cred)
+	if err != nil {
+		t.Fatalf("authenticator assert: %v", err)
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("parse assertion: %v", err)
+	}
+	return parsed
+}
+
+// completeDiscoverable 使用新的无用户名登录挑战完成一次登录
+func completeDiscoverable(t *testing.T, e *env, auth *passkeytest.Authenticator, cred *passkeytest.Credential) (model.Account, *model.PassKey, error) {
+	t.Helper()
+
+	sessionID, parsed := assertDiscoverable(t, e, auth, cred)
+	return CompleteDiscoverableLogin(context.Background(), e.db, e.rdb, sessionID, parsed)
+}
+
+func TestDiscoverableLogin(t *testing.T) {
+	e, account := setup(t)
+	auth := passkeytest.New(testOrigin)
+	cred, _ := register(t, e, auth, account)
+	ctx := context.Background()
+
+	sessionID, parsed := assertDiscoverable(t, e, auth, cred)
+	got, record, err := CompleteDiscoverableLogin(ctx, e.db, e.rdb, sessionID, parsed)
+	if err != nil {
+		t.Fatalf("discoverable login: %v", err)
+	}
+	if got.ID != account.ID || record.SignCount != 1 || record.CloneWarning {
+		t.Fatalf("login = %+v, %+v", got, record)
+	}
+
+	// 重放同一断言: 会话已被消费
+	if _, _, err := CompleteDiscoverableLogin(ctx, e.db, e.rdb, sessionID, parsed); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("replayed assertion err = %v", err)
+	}
+}
+
+func TestDiscoverableLoginChallenge(t *testing.T) {
+	e, account := setup(t)
+	auth := passkeytest.New(testOrigin)
+	cred, _ := register(t, e, auth, account)
+	ctx := context.Background()
+
+	// 未由服务端签发的 challenge
+	options, err := BeginDiscoverableLogin(ctx, e.rdb)
+	if err != nil {
+		t.Fatalf("begin discoverable login: %v", err)
+	}
+	options.Challenge = append([]byte{}, options.Challenge...)
+	options.Challenge[0] ^= 0xff
+	if _, _, err := CompleteDiscoverableLogin(ctx, e.db, e.rdb, options.SessionID, parseAssertion(t, auth, options, cred)); err == nil {
+		t.Fatal("login accepted a forged challenge")
+	}
+
+	// 未签发的会话 ID
+	_, parsed := assertDiscoverable(t, e, auth, cred)
+	if _, _, err := CompleteDiscoverableLogin(ctx, e.db, e.rdb, "unknown", parsed); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("unknown session err = %v", err)
+	}
+
+	sessionID, parsed := assertDiscoverable(t, e, auth, cred)
+	e.mr.FastForward(loginTimeout())
+	if _, _, err := CompleteDiscoverableLogin(ctx, e.db, e.rdb, sessionID, parsed); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("expired challenge err = %v", err)
+	}
+}
+
+func TestDiscoverableLoginRejectsInvalidAssertion(t *testing.T) {
+	e, account := setup(t)
+	auth := passkeytest.New(testOrigin)
+	cred, _ := register(t, e, auth, account)
+	ctx := context.Background()
+
+	// 签名被篡改
+	sessionID, parsed := assertDiscoverable(t, e, auth, cred)
+	parsed.Response.Signature = append([]byte{}, parsed.Response.Signature...)
+	parsed.Response.Signature[len(parsed.Response.Signature)-1] ^= 0xff
+	if got, _, err := CompleteDiscoverableLogin(ctx, e.db, e.rdb, sessionID, parsed); err == nil || got.ID != account.ID {
+		t.Fatalf("tampered signature = %+v, %v", got, err)
+	}
+
+	// 其他站点的 origin
+	evil := passkeytest.New("https://evil.test")
+	if _, _, err := completeDiscoverable(t, e, evil, cred); err == nil {
+		t.Fatal("login accepted an assertion for another origin")
+	}
+
+	// userHandle 指向其他账号
+	other := *cred
+	other.UserHandle = []byte("999")
+	if _, _, err := completeDiscoverable(t, e, auth, &other); err == nil {
+		t.Fatal("login accepted an unknown user handle")
+	}
+
+	// 未绑定到账号的凭证
+	unknown, _, err := auth.Register(protocol.PublicKeyCredentialCreationOptions{
+		RelyingParty: protocol.RelyingPartyEntity{ID: "openid.test"},
+		User:         protocol.UserEntity{ID: cred.UserHandle},
+		Challenge:    []byte("unused"),
+	})
+	if err != nil {
+		t.Fatalf("authenticator register: %v", err)
+	}
+	if _, _, err := completeDiscoverable(t, e, auth, unknown); err == nil {
+		t.Fatal("login accepted an unregistered credential")
+	}
+
+	passkeys, _ := ListUserPasskeys(e.db, account.ID)
+	if len(passkeys) != 1 || passkeys[0].SignCount != 0 || passkeys[0].LastUsedAt != 0 {
+		t.Fatalf("passkey updated by rejected logins: %+v", passkeys)
+	}
+}
+
+func TestDiscoverableLoginSignCountRegression(t *testing.T) {
+	e, account := setup(t)
+	auth := passkeytest.New(testOrigin)
+	cred, _ := register(t, e, auth, account)
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := completeDiscoverable(t, e, auth, cred); err != nil {
+			t.Fatalf("login %d: %v", i, err)
+		}
+	}
+
+	cred.SignCount = 0
+	got, record, err := completeDiscoverable(t, e, auth, cred)
+	if !errors.Is(err, ErrSignCountRegression) || got.ID != account.ID {
+		t.Fatalf("regressed counter = %+v, %v", got, err)
+	}
+	if record == nil || !record.CloneWarning {
+		t.Fatalf("clone warning not stored: %+v", record)
+	}
+}
+
+func TestRegistrationAllowedAAGUIDs(t *testing.T) {
+	e, account := setup(t)
+	yubikey := [16]byte{0xcb, 0x69, 0x48, 0x1e, 0x8f, 0xf7, 0x40, 0x39, 0x93, 0xec, 0x0a, 0x27, 0x29, 0xa1, 0x54, 0xa8}
+
+	c := *config.C
+	c.PasskeyConfig.AllowedAAGUIDs = []string{"CB69481E-8FF7-4039-93EC-0A2729A154A8"}
+	if err := config.Apply(&c); err != nil {
+		t.Fatalf("apply config: %v", err)
+	}
+	ctx := context.Background()
+
+	for _, aaguid := range [][16]byte{{}, {0x01}} {
+		auth := passkeytest.New(testOrigin)
+		auth.AAGUID = aaguid
+		options, err := BeginRegistration(ctx, e.db, e.rdb, account)
+		if err != nil {
+			t.Fatalf("begin registration: %v", err)
+		}
+		_, body, err := auth.Register(options.PublicKeyCredentialCreationOptions)
+		if err != nil {
+			t.Fatalf("authenticator register: %v", err)
+		}
+		parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("parse creation response: %v", err)
+		}
+		if _, err := CompleteRegistrationWithRemark(ctx, e.db, e.rdb, auditutil.Actor{}, account, options.SessionID, parsed, ""); !errors.Is(err, ErrAuthenticatorNotAllowed) {
+			t.Fatalf("aaguid %x err = %v", aaguid, err)
+		}
+	}
+
+	auth := passkeytest.New(testOrigin)
+	auth.AAGUID = yubikey
+	_, record := register(t, e, auth, account)
+	aaguid := FormatAAGUID(record.AAGUID)
+	if aaguid != "cb69481e-8ff7-4039-93ec-0a2729a154a8" || AuthenticatorName(aaguid) != "YubiKey 5 Series" {
+		t.Fatalf("aaguid = %q, name = %q", aaguid, AuthenticatorName(aaguid))
+	}
+
+	c.PasskeyConfig.AllowedAAGUIDs = []string{"not-an-aaguid"}
+	if err := config.Apply(&c); err == nil {
+		t.Fatal("config accepted an invalid aaguid")
+	}
+}
+
+func TestRenameUserPasskey(t *testing.T) {
+	e, account := setup(t)
+	_, record := register(t, e, passkeytest.New(testOrigin), account)
+
+	if _, err := RenameUserPasskey(e.db, auditutil.Actor{}, account.ID+1, record.ID, "phone"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("rename another user's passkey err = %v", err)
+	}
+
+	renamed, err := RenameUserPasskey(e.db, auditutil.Actor{UserId: account.ID}, account.ID, record.ID, "phone")
+	if err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	passkeys, _ := ListUserPasskeys(e.db, account.ID)
+	if renamed.Remark != "phone" || len(passkeys) != 1 || passkeys[0].Remark != "phone" {
+		t.Fatalf("renamed = %+v, stored = %+v", renamed, passkeys)
+	}
+
+	if !CheckRemark("") || !CheckRemark("工作电脑") || CheckRemark("<b>") || CheckRemark(strings.Repeat("a", 33)) {
+		t.Fatal("CheckRemark")
+	}
+}
+
+// applyPasskeyConfig 使用新的 Passkey 配置重新初始化 WebAuthn, 测试结束后恢复
+func applyPasskeyConfig(t *testing.T, p config.PasskeyConfig) {
+	t.Helper()
+
+	c := *config.C
+	c.PasskeyConfig = p
+	if err := config.Apply(&c); err != nil {
+		t.Fatalf("apply config: %v", err)
+	}
+	waInitOnce, waInstance, waInitErr = sync.Once{}, nil, nil
+	t.Cleanup(func() {
+		waInitOnce, waInstance, waInitErr = sync.Once{}, nil, nil
+	})
+}
+
+func TestRelyingPartyConfig(t *testing.T) {
+	e, account := setup(t)
+	applyPasskeyConfig(t, config.PasskeyConfig{
+		RPID:             "openid.test",
+		RPName:           "OpenID",
+		Origins:          []string{"https://openid.test", "https://accounts.openid.test", "android:apk-key-hash:abc"},
+		Attachment:       "cross-platform",
+		UserVerification: "required",
+		Attestation:      "direct",
+		RegisterTimeout:  60,
+		LoginTimeout:     30,
+	})
+	ctx := context.Background()
+
+	options, err := BeginRegistration(ctx, e.db, e.rdb, account)
+	if err != nil {
+		t.Fatalf("begin registration: %v", err)
+	}
+	selection := options.AuthenticatorSelection
+	if options.RelyingParty.ID != "openid.test" || options.RelyingParty.Name != "OpenID" ||
+		options.Attestation != protocol.PreferDirectAttestation || options.Timeout != 60000 ||
+		selection.AuthenticatorAttachment != protocol.CrossPlatform || selection.UserVerification != protocol.VerificationRequired {
+		t.Fatalf("registration options = %+v", options)
+	}
+
+	// 任一配置的 origin 均可使用
+	cred, _ := register(t, e, passkeytest.New("https://accounts.openid.test"), account)
+	loginOptions, err := BeginDiscoverableLogin(ctx, e.rdb)
+	if err != nil {
+		t.Fatalf("begin discoverable login: %v", err)
+	}
+	if loginOptions.Timeout != 30000 || loginOptions.UserVerification != protocol.VerificationRequired {
+		t.Fatalf("login options = %+v", loginOptions)
+	}
+	if _, _, err := CompleteDiscoverableLogin(ctx, e.db, e.rdb, loginOptions.SessionID, parseAssertion(t, passkeytest.New("android:apk-key-hash:abc"), loginOptions, cred)); err != nil {
+		t.Fatalf("login from native app origin: %v", err)
+	}
+	if _, _, err := completeDiscoverable(t, e, passkeytest.New("https://other.test"), cred); err == nil {
+		t.Fatal("login accepted an origin outside Passkey.Origins")
+	}
+
+	// 会话有效期跟随配置
+	sessionID, parsed := assertDiscoverable(t, e, passkeytest.New(testOrigin), cred)
+	e.mr.FastForward(30 * time.Second)
+	if _, _, err := CompleteDiscoverableLogin(ctx, e.db, e.rdb, sessionID, parsed); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("login after LoginTimeout err = %v", err)
+	}
+}
+
+func TestAnyAttachment(t *testing.T) {
+	e, account := setup(t)
+	applyPasskeyConfig(t, config.PasskeyConfig{Attachment: "any"})
+
+	options, err := BeginRegistration(context.Background(), e.db, e.rdb, account)
+	if err != nil {
+		t.Fatalf("begin registration: %v", err)
+	}
+	if options.AuthenticatorSelection.AuthenticatorAttachment != "" || options.RelyingParty.ID != "openid.test" ||
+		options.AuthenticatorSelection.ResidentKey != protocol.ResidentKeyRequirementRequired {
+		t.Fatalf("registration options = %+v", options)
+	}
+}
+
+func TestMemorySessionStore(t *testing.T) {
+	e, account := setup(t)
+	applyPasskeyConfig(t, config.PasskeyConfig{SessionStore: "memory"})
+	auth := passkeytest.New(testOrigin)
+
+	cred, _ := register(t, e, auth, account)
+	if _, _, err := completeDiscoverable(t, e, auth, cred); err != nil {
+		t.Fatalf("discoverable login: %v", err)
+	}
+	if keys := e.mr.Keys(); len(keys) != 0 {
+		t.Fatalf("sessions written to redis: %v", keys)
+	}
+}
+
+func TestPasskeyConfigValidation(t *testing.T) {
+	setup(t)
+
+	for _, p := range []config.PasskeyConfig{
+		{Attachment: "usb"},
+		{UserVerification: "always"},
+		{Attestation: "self"},
+		{LoginTimeout: -1},
+		{Origins: []string{""}},
+		{SessionStore: "file"},
+	} {
+		c := *config.C
+		c.PasskeyConfig = p
+		if err := config.Apply(&c); err == nil {
+			t.Errorf("config accepted %+v", p)
+		}
+	}
+}
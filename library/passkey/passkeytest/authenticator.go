@@ -0,0 +1,178 @@
+// Package passkeytest 提供软件实现的 WebAuthn 认证器, 用于在测试中生成注册与登录响应
+//
+// 认证器使用内存中的 ES256 密钥, attestation 格式为 none, 不设置 backup 标志.
+package passkeytest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+)
+
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+// Authenticator 软件认证器
+type Authenticator struct {
+	Origin string   // 写入 clientDataJSON 的 origin
+	AAGUID [16]byte // 注册时写入 attestedCredentialData
+}
+
+// Credential 认证器中保存的凭证
+type Credential struct {
+	ID         []byte
+	UserHandle []byte
+	RPID       string
+	SignCount  uint32 // 每次 Assert 前加一, 测试中可改小以模拟克隆的认证器
+
+	key *ecdsa.PrivateKey
+}
+
+func New(origin string) *Authenticator {
+	return &Authenticator{Origin: origin}
+}
+
+// Register
+// @description 按注册选项创建凭证, 返回凭证与 navigator.credentials.create() 结果的 JSON
+func (a *Authenticator) Register(options protocol.PublicKeyCredentialCreationOptions) (*Credential, []byte, error) {
+	userHandle, err := userHandleOf(options.User.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	id := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return nil, nil, err
+	}
+	cred := &Credential{ID: id, UserHandle: userHandle, RPID: options.RelyingParty.ID, key: key}
+
+	coseKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  1, // P-256
+		XCoord: key.X.FillBytes(make([]byte, 32)),
+		YCoord: key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// attestedCredentialData: aaguid | credentialIdLength | credentialId | credentialPublicKey
+	attested := append([]byte{}, a.AAGUID[:]...)
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(id)))
+	attested = append(attested, id...)
+	attested = append(attested, coseKey...)
+
+	authData := append(authenticatorData(cred.RPID, flagUserPresent|flagUserVerified|flagAttested, 0), attested...)
+	attestationObject, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": authData,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"id":    encode(id),
+		"rawId": encode(id),
+		"type":  "public-key",
+		"response": map[string]any{
+			"attestationObject": encode(attestationObject),
+			"clientDataJSON":    encode(a.clientData(protocol.CreateCeremony, options.Challenge)),
+			"transports":        []string{"internal"},
+		},
+		"authenticatorAttachment": "platform",
+	})
+	return cred, body, err
+}
+
+// Assert
+// @description 使用凭证签名登录挑战, 返回 navigator.credentials.get() 结果的 JSON
+func (a *Authenticator) Assert(options protocol.PublicKeyCredentialRequestOptions, cred *Credential) ([]byte, error) {
+	if cred == nil || cred.key == nil {
+		return nil, errors.New("passkeytest: credential was not created by Register")
+	}
+
+	rpID := options.RelyingPartyID
+	if rpID == "" {
+		rpID = cred.RPID
+	}
+
+	cred.SignCount++
+	authData := authenticatorData(rpID, flagUserPresent|flagUserVerified, cred.SignCount)
+	clientData := a.clientData(protocol.AssertCeremony, options.Challenge)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, cred.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]any{
+		"id":    encode(cred.ID),
+		"rawId": encode(cred.ID),
+		"type":  "public-key",
+		"response": map[string]any{
+			"authenticatorData": encode(authData),
+			"clientDataJSON":    encode(clientData),
+			"signature":         encode(signature),
+			"userHandle":        encode(cred.UserHandle),
+		},
+		"authenticatorAttachment": "platform",
+	})
+}
+
+func (a *Authenticator) clientData(ceremony protocol.CeremonyType, challenge []byte) []byte {
+	data, _ := json.Marshal(protocol.CollectedClientData{
+		Type:      ceremony,
+		Challenge: encode(challenge),
+		Origin:    a.Origin,
+	})
+	return data
+}
+
+// authenticatorData rpIdHash | flags | signCount
+func authenticatorData(rpID string, flags byte, signCount uint32) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, signCount)
+}
+
+// userHandleOf 注册选项中的 user.id, 解析 JSON 后为 base64url 字符串
+func userHandleOf(id any) ([]byte, error) {
+	switch v := id.(type) {
+	case []byte:
+		return v, nil
+	case protocol.URLEncodedBase64:
+		return v, nil
+	case string:
+		return base64.RawURLEncoding.DecodeString(v)
+	default:
+		return nil, fmt.Errorf("passkeytest: unsupported user id type %T", id)
+	}
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
@@ -2,92 +2,82 @@ package passkey
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
-	"fmt"
+	"sync"
 	"time"
 
 	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/redis/go-redis/v9"
 	"github.com/soxft/openid-go/config"
-	"github.com/soxft/openid-go/process/redisutil"
+	"github.com/soxft/openid-go/library/randutil"
 )
 
-func registrationSessionKey(userID int) string {
-	return fmt.Sprintf("%s:passkey:register:%d", config.RedisPrefix, userID)
-}
-
-func loginSessionKey(userID int) string {
-	return fmt.Sprintf("%s:passkey:login:%d", config.RedisPrefix, userID)
-}
-
-func storeRegistrationSession(ctx context.Context, userID int, data *webauthn.SessionData, ttl time.Duration) error {
-	return storeSession(ctx, registrationSessionKey(userID), data, ttl)
-}
+// 会话类型, 不同类型的会话 ID 不能混用
+const (
+	sessionRegister     = "register"
+	sessionLogin        = "login"
+	sessionDiscoverable = "discoverable"
+)
 
-func loadRegistrationSession(ctx context.Context, userID int) (*webauthn.SessionData, error) {
-	return loadSession(ctx, registrationSessionKey(userID))
-}
+var (
+	customStore SessionStore
 
-func deleteRegistrationSession(ctx context.Context, userID int) error {
-	return deleteSession(ctx, registrationSessionKey(userID))
-}
+	memoryStoreOnce sync.Once
+	memoryStore     *MemoryStore
+)
 
-func storeLoginSession(ctx context.Context, userID int, data *webauthn.SessionData, ttl time.Duration) error {
-	return storeSession(ctx, loginSessionKey(userID), data, ttl)
+// SetSessionStore 使用自定义会话存储替代 Passkey.SessionStore 配置, 传入 nil 恢复
+func SetSessionStore(s SessionStore) {
+	customStore = s
 }
 
-func loadLoginSession(ctx context.Context, userID int) (*webauthn.SessionData, error) {
-	return loadSession(ctx, loginSessionKey(userID))
-}
+func sessionStore(rdb redis.Cmdable) (SessionStore, error) {
+	if customStore != nil {
+		return customStore, nil
+	}
+	if config.Passkey.SessionStore == "memory" {
+		memoryStoreOnce.Do(func() {
+			memoryStore = NewMemoryStore()
+		})
+		return memoryStore, nil
+	}
 
-func deleteLoginSession(ctx context.Context, userID int) error {
-	return deleteSession(ctx, loginSessionKey(userID))
+	if rdb == nil {
+		return nil, errors.New("redis not initialized")
+	}
+	return NewRedisStore(rdb, config.RedisPrefix+":passkey:"), nil
 }
 
-func storeSession(ctx context.Context, key string, data *webauthn.SessionData, ttl time.Duration) error {
-	if redisutil.RDB == nil {
-		return fmt.Errorf("redis not initialized")
-	}
-	payload, err := json.Marshal(data)
+// saveSession 保存会话, 返回交给客户端的随机会话 ID
+func saveSession(ctx context.Context, rdb redis.Cmdable, kind string, data *webauthn.SessionData, ttl time.Duration) (string, error) {
+	store, err := sessionStore(rdb)
 	if err != nil {
-		return err
+		return "", err
+	}
+
+	id := randutil.Base62(32)
+	if err := store.Save(ctx, kind+":"+id, data, ttl); err != nil {
+		return "", err
 	}
-	return redisutil.RDB.Set(ctx, key, payload, ttl).Err()
+	return id, nil
 }
 
-func loadSession(ctx context.Context, key string) (*webauthn.SessionData, error) {
-	if redisutil.RDB == nil {
-		return nil, fmt.Errorf("redis not initialized")
+// takeSession 取出并删除会话, 无论后续校验是否通过, 会话都只能使用一次
+func takeSession(ctx context.Context, rdb redis.Cmdable, kind, id string) (*webauthn.SessionData, error) {
+	if id == "" {
+		return nil, ErrSessionNotFound
 	}
-	raw, err := redisutil.RDB.Get(ctx, key).Bytes()
+	store, err := sessionStore(rdb)
 	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			return nil, ErrSessionNotFound
-		}
 		return nil, err
 	}
-	var session webauthn.SessionData
-	if err := json.Unmarshal(raw, &session); err != nil {
+
+	session, err := store.Take(ctx, kind+":"+id)
+	if err != nil {
 		return nil, err
 	}
-	return &session, nil
-}
-
-func deleteSession(ctx context.Context, key string) error {
-	if redisutil.RDB == nil {
-		return fmt.Errorf("redis not initialized")
+	if !session.Expires.IsZero() && session.Expires.Before(time.Now()) {
+		return nil, ErrSessionNotFound
 	}
-	return redisutil.RDB.Del(ctx, key).Err()
-}
-
-// 通用会话管理函数
-func storeGenericSession(ctx context.Context, key string, data *webauthn.SessionData, ttl time.Duration) error {
-	fullKey := fmt.Sprintf("%s:%s", config.RedisPrefix, key)
-	return storeSession(ctx, fullKey, data, ttl)
-}
-
-func loadGenericSession(ctx context.Context, key string) (*webauthn.SessionData, error) {
-	fullKey := fmt.Sprintf("%s:%s", config.RedisPrefix, key)
-	return loadSession(ctx, fullKey)
+	return session, nil
 }
@@ -6,23 +6,36 @@ import (
 
 	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/soxft/openid-go/app/model"
-	"github.com/soxft/openid-go/process/dbutil"
 	"gorm.io/gorm"
 )
 
-func loadUserPasskeys(userID int) ([]model.PassKey, error) {
+func loadUserPasskeys(db *gorm.DB, userID int) ([]model.PassKey, error) {
 	var passkeys []model.PassKey
-	if err := dbutil.D.Where("user_id = ?", userID).Find(&passkeys).Error; err != nil {
+	if err := db.Where("user_id = ?", userID).Find(&passkeys).Error; err != nil {
 		return nil, err
 	}
 	return passkeys, nil
 }
 
-func saveCredential(userID int, credential *webauthn.Credential) (*model.PassKey, error) {
-	return saveCredentialWithRemark(userID, credential, "")
+func loadAccount(db *gorm.DB, userID int) (model.Account, error) {
+	var account model.Account
+	err := db.Where("id = ?", userID).Take(&account).Error
+	return account, err
 }
 
-func saveCredentialWithRemark(userID int, credential *webauthn.Credential, remark string) (*model.PassKey, error) {
+func findCredentialOwner(db *gorm.DB, credentialID string) (int, error) {
+	var record model.PassKey
+	if err := db.Select("user_id").Where("credential_id = ?", credentialID).Take(&record).Error; err != nil {
+		return 0, err
+	}
+	return record.UserID, nil
+}
+
+func saveCredential(db *gorm.DB, userID int, credential *webauthn.Credential) (*model.PassKey, error) {
+	return saveCredentialWithRemark(db, userID, credential, "")
+}
+
+func saveCredentialWithRemark(db *gorm.DB, userID int, credential *webauthn.Credential, remark string) (*model.PassKey, error) {
 	if credential == nil {
 		return nil, errors.New("credential is nil")
 	}
@@ -52,10 +65,10 @@ func saveCredentialWithRemark(userID int, credential *webauthn.Credential, remar
 	}
 
 	var existing model.PassKey
-	err := dbutil.D.Where("user_id = ? AND credential_id = ?", userID, encodedID).Take(&existing).Error
+	err := db.Where("user_id = ? AND credential_id = ?", userID, encodedID).Take(&existing).Error
 	switch {
 	case errors.Is(err, gorm.ErrRecordNotFound):
-		if err := dbutil.D.Create(&passkey).Error; err != nil {
+		if err := db.Create(&passkey).Error; err != nil {
 			return nil, err
 		}
 		return &passkey, nil
@@ -71,17 +84,17 @@ func saveCredentialWithRemark(userID int, credential *webauthn.Credential, remar
 			"clone_warning": credential.Authenticator.CloneWarning,
 			"updated_at":    time.Now().Unix(),
 		}
-		if err := dbutil.D.Model(&existing).Updates(updates).Error; err != nil {
+		if err := db.Model(&existing).Updates(updates).Error; err != nil {
 			return nil, err
 		}
-		if err := dbutil.D.Where("id = ?", existing.ID).Take(&existing).Error; err != nil {
+		if err := db.Where("id = ?", existing.ID).Take(&existing).Error; err != nil {
 			return nil, err
 		}
 		return &existing, nil
 	}
 }
 
-func updateCredentialAfterLogin(userID int, credential *webauthn.Credential) (*model.PassKey, error) {
+func updateCredentialAfterLogin(db *gorm.DB, userID int, credential *webauthn.Credential) (*model.PassKey, error) {
 	encodedID := encodeKey(credential.ID)
 	if encodedID == "" {
 		return nil, errors.New("credential id is empty")
@@ -96,26 +109,65 @@ func updateCredentialAfterLogin(userID int, credential *webauthn.Credential) (*m
 		"updated_at":    now,
 	}
 
-	if err := dbutil.D.Model(&model.PassKey{}).
+	if err := db.Model(&model.PassKey{}).
 		Where("user_id = ? AND credential_id = ?", userID, encodedID).
 		Updates(updates).Error; err != nil {
 		return nil, err
 	}
 
 	var result model.PassKey
-	if err := dbutil.D.Where("user_id = ? AND credential_id = ?", userID, encodedID).Take(&result).Error; err != nil {
+	if err := db.Where("user_id = ? AND credential_id = ?", userID, encodedID).Take(&result).Error; err != nil {
 		return nil, err
 	}
+	// 签名计数未增长, 认证器可能被克隆; 凭证保留 CloneWarning 标记, 由用户确认后删除
+	if credential.Authenticator.CloneWarning {
+		return &result, ErrSignCountRegression
+	}
 	return &result, nil
 }
 
-func removeCredential(userID, passkeyID int) error {
-	res := dbutil.D.Where("user_id = ? AND id = ?", userID, passkeyID).Delete(&model.PassKey{})
-	if res.Error != nil {
-		return res.Error
+func renameCredential(db *gorm.DB, userID, passkeyID int, remark string) (*model.PassKey, error) {
+	var record model.PassKey
+	if err := db.Where("user_id = ? AND id = ?", userID, passkeyID).Take(&record).Error; err != nil {
+		return nil, err
 	}
-	if res.RowsAffected == 0 {
-		return gorm.ErrRecordNotFound
+
+	now := time.Now().Unix()
+	if err := db.Model(&record).Updates(map[string]interface{}{
+		"remark":     remark,
+		"updated_at": now,
+	}).Error; err != nil {
+		return nil, err
 	}
-	return nil
+	record.Remark, record.UpdatedAt = remark, now
+	return &record, nil
+}
+
+func removeCredential(db *gorm.DB, userID, passkeyID int) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("user_id = ? AND id = ?", userID, passkeyID).Delete(&model.PassKey{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		// 无密码账号至少保留一个 passkey
+		var account model.Account
+		if err := tx.Select("id, password").Where("id = ?", userID).Take(&account).Error; err != nil {
+			return err
+		}
+		if account.Password != "" {
+			return nil
+		}
+		var remaining int64
+		if err := tx.Model(&model.PassKey{}).Where("user_id = ?", userID).Count(&remaining).Error; err != nil {
+			return err
+		}
+		if remaining == 0 {
+			return ErrLastPasskey
+		}
+		return nil
+	})
 }
@@ -0,0 +1,106 @@
+package passkey
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/redis/go-redis/v9"
+)
+
+// SessionStore 保存 WebAuthn 挑战会话
+// Take 取出并删除会话, 并发调用时只有一个能取到; 不存在或已过期时返回 ErrSessionNotFound
+type SessionStore interface {
+	Save(ctx context.Context, key string, data *webauthn.SessionData, ttl time.Duration) error
+	Take(ctx context.Context, key string) (*webauthn.SessionData, error)
+}
+
+// RedisStore 基于 Redis 的会话存储, 多实例部署时使用
+type RedisStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewRedisStore 创建 Redis 会话存储, key 前加 prefix
+func NewRedisStore(client redis.Cmdable, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+func (s *RedisStore) Save(ctx context.Context, key string, data *webauthn.SessionData, ttl time.Duration) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, s.prefix+key, payload, ttl).Err()
+}
+
+// Take 使用 GETDEL 保证会话只能被取出一次
+func (s *RedisStore) Take(ctx context.Context, key string) (*webauthn.SessionData, error) {
+	raw, err := s.client.GetDel(ctx, s.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrSessionNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal(raw, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// MemoryStore 进程内会话存储, 仅适用于单实例部署
+type MemoryStore struct {
+	mu        sync.Mutex
+	sessions  map[string]memorySession
+	lastSweep time.Time
+}
+
+type memorySession struct {
+	data     webauthn.SessionData
+	expireAt time.Time
+}
+
+// memorySweepInterval 清理过期会话的最小间隔
+const memorySweepInterval = time.Minute
+
+// NewMemoryStore 创建进程内会话存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: map[string]memorySession{}}
+}
+
+func (s *MemoryStore) Save(_ context.Context, key string, data *webauthn.SessionData, ttl time.Duration) error {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 过期会话未被取出时不会自动删除, 写入时顺带清理
+	if now.Sub(s.lastSweep) >= memorySweepInterval {
+		for k, v := range s.sessions {
+			if !now.Before(v.expireAt) {
+				delete(s.sessions, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	s.sessions[key] = memorySession{data: *data, expireAt: now.Add(ttl)}
+	return nil
+}
+
+func (s *MemoryStore) Take(_ context.Context, key string) (*webauthn.SessionData, error) {
+	s.mu.Lock()
+	session, ok := s.sessions[key]
+	delete(s.sessions, key)
+	s.mu.Unlock()
+
+	if !ok || !time.Now().Before(session.expireAt) {
+		return nil, ErrSessionNotFound
+	}
+	return &session.data, nil
+}
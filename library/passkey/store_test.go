@@ -0,0 +1,93 @@
+package passkey
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/redis/go-redis/v9"
+)
+
+func testStores(t *testing.T) map[string]SessionStore {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+
+	return map[string]SessionStore{
+		"redis":  NewRedisStore(rdb, "test:"),
+		"memory": NewMemoryStore(),
+	}
+}
+
+func TestSessionStoreSingleUse(t *testing.T) {
+	ctx := context.Background()
+
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			data := &webauthn.SessionData{Challenge: "challenge", UserID: []byte("1")}
+			if err := store.Save(ctx, "login:a", data, time.Minute); err != nil {
+				t.Fatalf("save: %v", err)
+			}
+			if _, err := store.Take(ctx, "login:b"); !errors.Is(err, ErrSessionNotFound) {
+				t.Fatalf("take unknown key err = %v", err)
+			}
+
+			got, err := store.Take(ctx, "login:a")
+			if err != nil || got.Challenge != "challenge" || string(got.UserID) != "1" {
+				t.Fatalf("take = %+v, %v", got, err)
+			}
+			if _, err := store.Take(ctx, "login:a"); !errors.Is(err, ErrSessionNotFound) {
+				t.Fatalf("second take err = %v", err)
+			}
+		})
+	}
+}
+
+func TestSessionStoreConcurrentTake(t *testing.T) {
+	ctx := context.Background()
+
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := store.Save(ctx, "login:a", &webauthn.SessionData{Challenge: "challenge"}, time.Minute); err != nil {
+				t.Fatalf("save: %v", err)
+			}
+
+			var wins atomic.Int32
+			var wg sync.WaitGroup
+			for i := 0; i < 16; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := store.Take(ctx, "login:a"); err == nil {
+						wins.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if wins.Load() != 1 {
+				t.Fatalf("%d concurrent takes succeeded, want 1", wins.Load())
+			}
+		})
+	}
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	if err := store.Save(ctx, "login:a", &webauthn.SessionData{}, 10*time.Millisecond); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, err := store.Take(ctx, "login:a"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("expired take err = %v", err)
+	}
+}
@@ -4,16 +4,25 @@ import (
 	"github.com/go-webauthn/webauthn/protocol"
 )
 
-// RegistrationOptions 兼容旧代码的类型别名
-type RegistrationOptions = protocol.PublicKeyCredentialCreationOptions
+// RegistrationOptions 注册参数, 序列化后与 WebAuthn 参数字段相同并附带 sessionId
+// 浏览器会忽略 sessionId, 完成注册时需将其原样提交
+type RegistrationOptions struct {
+	protocol.PublicKeyCredentialCreationOptions
+	SessionID string `json:"sessionId"`
+}
 
-// LoginOptions 兼容旧代码的类型别名
-type LoginOptions = protocol.PublicKeyCredentialRequestOptions
+// LoginOptions 登录参数, 序列化后与 WebAuthn 参数字段相同并附带 sessionId
+type LoginOptions struct {
+	protocol.PublicKeyCredentialRequestOptions
+	SessionID string `json:"sessionId"`
+}
 
 // Summary 用于对外输出的 Passkey 信息
 type Summary struct {
 	ID           int      `json:"id"`
-	Remark       string   `json:"remark"`       // 备注
+	Remark       string   `json:"remark"` // 备注
+	AAGUID       string   `json:"aaguid"` // 认证器型号, uuid 格式, 未知时为空
+	Name         string   `json:"name"`   // 认证器名称, 由 AAGUID 查询 FIDO MDS 得到, 未知时为空
 	CreatedAt    int64    `json:"createdAt"`
 	LastUsedAt   int64    `json:"lastUsedAt"`
 	CloneWarning bool     `json:"cloneWarning"`
@@ -0,0 +1,136 @@
+package passwordutil
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/soxft/openid-go/config"
+	"github.com/soxft/openid-go/library/randutil"
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+
+	// 校验已有哈希时允许的范围, 超出范围的哈希视为格式错误, 避免导入的哈希在登录时耗尽内存
+	argon2MinSaltLen   = 8
+	argon2MaxSaltLen   = 64
+	argon2MinKeyLen    = 16
+	argon2MaxKeyLen    = 64
+	argon2MaxMemoryKiB = 4 * 1024 * 1024 // 4 GiB
+)
+
+var errArgon2Format = errors.New("invalid argon2id hash")
+
+// argon2idHasher 以 PHC 字符串格式保存: $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+type argon2idHasher struct {
+	memory      uint32 // KiB
+	iterations  uint32
+	parallelism uint8
+	maxMemory   uint32 // 校验时允许的最大内存 (KiB)
+}
+
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func newArgon2idHasher(c config.Argon2Config) *argon2idHasher {
+	h := &argon2idHasher{memory: 64 * 1024, iterations: 3, parallelism: 2, maxMemory: argon2MaxMemoryKiB}
+	if c.MaxMemory > 0 && c.MaxMemory < argon2MaxMemoryKiB {
+		h.maxMemory = uint32(c.MaxMemory)
+	}
+	if c.Memory > 0 {
+		h.memory = uint32(c.Memory)
+	}
+	if c.Iterations > 0 {
+		h.iterations = uint32(c.Iterations)
+	}
+	if c.Parallelism > 0 && c.Parallelism <= 255 {
+		h.parallelism = uint8(c.Parallelism)
+	}
+	return h
+}
+
+func (h *argon2idHasher) Name() string {
+	return "argon2id"
+}
+
+func (h *argon2idHasher) Hash(password string) (string, error) {
+	salt := randutil.Bytes(argon2SaltLen)
+	key := argon2.IDKey([]byte(password), salt, h.iterations, h.memory, h.parallelism, argon2KeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.memory, h.iterations, h.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *argon2idHasher) Match(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (h *argon2idHasher) Validate(encoded string) error {
+	_, err := h.decode(encoded)
+	return err
+}
+
+func (h *argon2idHasher) Verify(password, encoded string) (bool, error) {
+	p, err := h.decode(encoded)
+	if err != nil {
+		return false, err
+	}
+	key := argon2.IDKey([]byte(password), p.salt, p.iterations, p.memory, p.parallelism, uint32(len(p.key)))
+	return subtle.ConstantTimeCompare(key, p.key) == 1, nil
+}
+
+func (h *argon2idHasher) Outdated(encoded string) bool {
+	p, err := h.decode(encoded)
+	if err != nil {
+		return true
+	}
+	return p.memory < h.memory || p.iterations < h.iterations || p.parallelism < h.parallelism
+}
+
+// decode 解析哈希并检查参数范围: t >= 1, p >= 1, 8*p <= m <= maxMemory, 盐与哈希长度在合理范围内
+func (h *argon2idHasher) decode(encoded string) (argon2Params, error) {
+	var p argon2Params
+
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, errArgon2Format
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, errArgon2Format
+	}
+	// 重新格式化后比较, 拒绝多余字符或前导零
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism); err != nil ||
+		fmt.Sprintf("m=%d,t=%d,p=%d", p.memory, p.iterations, p.parallelism) != parts[3] {
+		return p, errArgon2Format
+	}
+	if p.iterations < 1 || p.parallelism < 1 || p.memory < 8*uint32(p.parallelism) || p.memory > h.maxMemory {
+		return p, errArgon2Format
+	}
+
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil ||
+		len(p.salt) < argon2MinSaltLen || len(p.salt) > argon2MaxSaltLen {
+		return p, errArgon2Format
+	}
+	if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil ||
+		len(p.key) < argon2MinKeyLen || len(p.key) > argon2MaxKeyLen {
+		return p, errArgon2Format
+	}
+	return p, nil
+}
@@ -0,0 +1,56 @@
+package passwordutil
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcryptHashLen $2a$10$ + 22 位盐 + 31 位哈希
+const bcryptHashLen = 60
+
+type bcryptHasher struct {
+	cost int
+}
+
+func newBcryptHasher(cost int) *bcryptHasher {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		cost = bcrypt.DefaultCost
+	}
+	return &bcryptHasher{cost: cost}
+}
+
+func (h *bcryptHasher) Name() string {
+	return "bcrypt"
+}
+
+func (h *bcryptHasher) Hash(password string) (string, error) {
+	str, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	return string(str), err
+}
+
+func (h *bcryptHasher) Match(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (h *bcryptHasher) Validate(encoded string) error {
+	if len(encoded) != bcryptHashLen {
+		return bcrypt.ErrHashTooShort
+	}
+	_, err := bcrypt.Cost([]byte(encoded))
+	return err
+}
+
+func (h *bcryptHasher) Verify(password, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (h *bcryptHasher) Outdated(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost < h.cost
+}
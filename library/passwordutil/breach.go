@@ -0,0 +1,66 @@
+package passwordutil
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/soxft/openid-go/config"
+)
+
+// IsBreached
+// @description 检查密码是否出现在本地泄露密码库中
+// 密码库按 SHA-1 前 5 位分片 (k-anonymity), 与 Have I Been Pwned range 接口返回格式一致:
+// 文件名为前缀 (可带 .txt 后缀), 每行为 "剩余 35 位:出现次数"
+func IsBreached(password string) (bool, error) {
+	dir := config.Password.BreachedDir
+	if dir == "" {
+		return false, nil
+	}
+
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	file, err := openRange(dir, prefix)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	minCount := config.Password.BreachedMinCount
+	if minCount <= 0 {
+		minCount = 1
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		s, c, _ := strings.Cut(line, ":")
+		if !strings.EqualFold(s, suffix) {
+			continue
+		}
+		// 没有次数的行视为出现过 1 次
+		count, err := strconv.Atoi(c)
+		if err != nil {
+			count = 1
+		}
+		return count >= minCount, nil
+	}
+	return false, scanner.Err()
+}
+
+func openRange(dir, prefix string) (*os.File, error) {
+	file, err := os.Open(filepath.Join(dir, prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		return os.Open(filepath.Join(dir, prefix+".txt"))
+	}
+	return file, err
+}
@@ -0,0 +1,57 @@
+package passwordutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/soxft/openid-go/config"
+)
+
+func TestIsBreached(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		dir      string
+		minCount int
+		password string
+		want     bool
+	}{
+		{name: "disabled", password: "P@ssw0rd"},
+		{name: "suffix in range file", dir: testBreachedDir, password: "P@ssw0rd", want: true},
+		{name: "txt file, lowercase, no count", dir: testBreachedDir, password: "Summer2024!", want: true},
+		{name: "suffix not in range file", dir: testBreachedDir, password: "Tr0ub4dor&3"},
+		{name: "no range file for prefix", dir: testBreachedDir, password: "Winter2024!"},
+		{name: "below min count", dir: testBreachedDir, minCount: 4, password: "P@ssw0rd"},
+		{name: "at min count", dir: testBreachedDir, minCount: 3, password: "P@ssw0rd", want: true},
+		{name: "missing dir", dir: "testdata/missing", password: "P@ssw0rd"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setPasswordConfig(t, config.PasswordConfig{BreachedDir: tc.dir, BreachedMinCount: tc.minCount})
+
+			got, err := IsBreached(tc.password)
+			if err != nil {
+				t.Fatalf("IsBreached(%q): %v", tc.password, err)
+			}
+			if got != tc.want {
+				t.Fatalf("IsBreached(%q) = %v, want %v", tc.password, got, tc.want)
+			}
+		})
+	}
+}
+
+// 只有对应前缀的分片会被读取, 读取失败时返回错误
+func TestIsBreachedReadsOnlyPrefixFile(t *testing.T) {
+	dir := t.TempDir()
+	setPasswordConfig(t, config.PasswordConfig{BreachedDir: dir})
+
+	// P@ssw0rd 的前缀为 21BD1, 以目录代替文件使读取失败
+	if err := os.Mkdir(filepath.Join(dir, "21BD1"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := IsBreached("Summer2024!"); err != nil {
+		t.Fatalf("other prefix: %v", err)
+	}
+	if _, err := IsBreached("P@ssw0rd"); err == nil {
+		t.Fatal("unreadable range file not reported")
+	}
+}
@@ -0,0 +1,87 @@
+package passwordutil
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/soxft/openid-go/config"
+)
+
+// Hasher 密码哈希算法, 算法与参数均编码在哈希字符串中
+type Hasher interface {
+	// Name 算法名称, 与配置中的 Password.Hasher 对应
+	Name() string
+	// Hash 使用当前参数计算哈希
+	Hash(password string) (string, error)
+	// Match 是否为该算法生成的哈希 (只检查前缀)
+	Match(encoded string) bool
+	// Validate 完整解析哈希, 格式或参数不合法时返回错误
+	Validate(encoded string) error
+	// Verify 校验密码
+	Verify(password, encoded string) (bool, error)
+	// Outdated 哈希使用的参数是否低于当前配置
+	Outdated(encoded string) bool
+}
+
+var (
+	ErrUnknownHash = errors.New("unknown password hash scheme")
+	ErrMismatch    = errors.New("password mismatch")
+)
+
+// hashers 可识别的全部算法, 按配置重新构造以读取最新参数
+func hashers() []Hasher {
+	return []Hasher{
+		newBcryptHasher(config.Password.BcryptCost),
+		newArgon2idHasher(config.Password.Argon2),
+		legacyHasher{},
+	}
+}
+
+// current 当前配置的算法, 默认 bcrypt
+func current() Hasher {
+	switch strings.ToLower(config.Password.Hasher) {
+	case "argon2id":
+		return newArgon2idHasher(config.Password.Argon2)
+	default:
+		return newBcryptHasher(config.Password.BcryptCost)
+	}
+}
+
+// Hash
+// @description 使用当前配置的算法计算密码哈希
+func Hash(password string) (string, error) {
+	return current().Hash(password)
+}
+
+// Recognized
+// @description 是否为可识别且能完整解析的哈希, 用于导入已有哈希前的检查
+func Recognized(encoded string) bool {
+	for _, h := range hashers() {
+		if h.Match(encoded) {
+			return h.Validate(encoded) == nil
+		}
+	}
+	return false
+}
+
+// Verify
+// @description 按哈希中编码的算法校验密码, 密码错误时返回 ErrMismatch
+// rehash 为 true 表示校验通过但哈希算法或参数已过时, 调用方应使用 Hash 重新计算并保存
+func Verify(password, encoded string) (rehash bool, err error) {
+	for _, h := range hashers() {
+		if !h.Match(encoded) {
+			continue
+		}
+
+		ok, err := h.Verify(password, encoded)
+		if err != nil {
+			return false, err
+		} else if !ok {
+			return false, ErrMismatch
+		}
+
+		cur := current()
+		return cur.Name() != h.Name() || cur.Outdated(encoded), nil
+	}
+	return false, ErrUnknownHash
+}
@@ -0,0 +1,208 @@
+package passwordutil
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/soxft/openid-go/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 测试使用较小的参数, 避免拖慢测试
+var testArgon2 = config.Argon2Config{Memory: 64, Iterations: 1, Parallelism: 1}
+
+func setPasswordConfig(t *testing.T, c config.PasswordConfig) {
+	t.Helper()
+
+	old := config.Password
+	config.Password = c
+	t.Cleanup(func() { config.Password = old })
+}
+
+// argon2Encoded 拼接 argon2id 哈希, 盐与哈希内容无关紧要
+func argon2Encoded(params string, saltLen, keyLen int) string {
+	return fmt.Sprintf("$argon2id$v=19$%s$%s$%s", params,
+		base64.RawStdEncoding.EncodeToString(make([]byte, saltLen)),
+		base64.RawStdEncoding.EncodeToString(make([]byte, keyLen)),
+	)
+}
+
+func TestArgon2RoundTrip(t *testing.T) {
+	setPasswordConfig(t, config.PasswordConfig{Hasher: "argon2id", Argon2: testArgon2})
+
+	encoded, err := Hash("correct horse")
+	if err != nil {
+		t.Fatalf("hash: %v", err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$") || !Recognized(encoded) {
+		t.Fatalf("encoded = %s", encoded)
+	}
+
+	if rehash, err := Verify("correct horse", encoded); err != nil || rehash {
+		t.Fatalf("verify = %v, %v", rehash, err)
+	}
+	if _, err := Verify("wrong horse", encoded); !errors.Is(err, ErrMismatch) {
+		t.Fatalf("verify wrong password = %v, want ErrMismatch", err)
+	}
+}
+
+func TestArgon2Outdated(t *testing.T) {
+	h := newArgon2idHasher(config.Argon2Config{Memory: 128, Iterations: 2, Parallelism: 2})
+
+	cases := []struct {
+		params   config.Argon2Config
+		outdated bool
+	}{
+		{config.Argon2Config{Memory: 128, Iterations: 2, Parallelism: 2}, false},
+		{config.Argon2Config{Memory: 256, Iterations: 3, Parallelism: 4}, false},
+		{config.Argon2Config{Memory: 64, Iterations: 2, Parallelism: 2}, true},
+		{config.Argon2Config{Memory: 128, Iterations: 1, Parallelism: 2}, true},
+		{config.Argon2Config{Memory: 128, Iterations: 2, Parallelism: 1}, true},
+	}
+	for _, tc := range cases {
+		encoded, _ := newArgon2idHasher(tc.params).Hash("secret")
+		if got := h.Outdated(encoded); got != tc.outdated {
+			t.Errorf("Outdated(%+v) = %v, want %v", tc.params, got, tc.outdated)
+		}
+	}
+
+	// 通过 Verify 检查当前配置
+	setPasswordConfig(t, config.PasswordConfig{Hasher: "argon2id", Argon2: config.Argon2Config{Memory: 128, Iterations: 1, Parallelism: 1}})
+	encoded, _ := newArgon2idHasher(testArgon2).Hash("secret")
+	if rehash, err := Verify("secret", encoded); err != nil || !rehash {
+		t.Fatalf("verify with lower memory = %v, %v, want rehash", rehash, err)
+	}
+}
+
+func TestBcryptCostUpgrade(t *testing.T) {
+	encoded, _ := newBcryptHasher(bcrypt.MinCost).Hash("secret")
+
+	cases := []struct {
+		cost   int
+		rehash bool
+	}{
+		{bcrypt.MinCost, false},
+		{bcrypt.MinCost + 1, true},
+	}
+	for _, tc := range cases {
+		setPasswordConfig(t, config.PasswordConfig{BcryptCost: tc.cost})
+		if rehash, err := Verify("secret", encoded); err != nil || rehash != tc.rehash {
+			t.Errorf("cost %d: verify = %v, %v, want rehash %v", tc.cost, rehash, err, tc.rehash)
+		}
+	}
+}
+
+func TestLegacy(t *testing.T) {
+	setPasswordConfig(t, config.PasswordConfig{BcryptCost: bcrypt.MinCost})
+
+	digests := map[string][]byte{
+		"md5":    func() []byte { s := md5.Sum([]byte("s1" + "secret")); return s[:] }(),
+		"sha1":   func() []byte { s := sha1.Sum([]byte("s1" + "secret")); return s[:] }(),
+		"sha256": func() []byte { s := sha256.Sum256([]byte("s1" + "secret")); return s[:] }(),
+		"sha512": func() []byte { s := sha512.Sum512([]byte("s1" + "secret")); return s[:] }(),
+	}
+	for algo, digest := range digests {
+		encoded, err := EncodeLegacy(strings.ToUpper(algo), "s1", strings.ToUpper(hex.EncodeToString(digest)))
+		if err != nil {
+			t.Fatalf("%s: encode: %v", algo, err)
+		}
+		if !Recognized(encoded) {
+			t.Errorf("%s: %s not recognized", algo, encoded)
+		}
+		// 校验成功后总是需要重新计算
+		if rehash, err := Verify("secret", encoded); err != nil || !rehash {
+			t.Errorf("%s: verify = %v, %v", algo, rehash, err)
+		}
+		if _, err := Verify("wrong", encoded); !errors.Is(err, ErrMismatch) {
+			t.Errorf("%s: verify wrong password = %v", algo, err)
+		}
+	}
+
+	md5Hex := hex.EncodeToString(digests["md5"])
+	invalid := []struct {
+		algo, salt, digest string
+	}{
+		{"crc32", "", md5Hex},
+		{"md5", "a$b", md5Hex},
+		{"md5", "", "not-hex"},
+		{"md5", "", md5Hex[:30]},
+		{"sha256", "", md5Hex},
+	}
+	for _, tc := range invalid {
+		if encoded, err := EncodeLegacy(tc.algo, tc.salt, tc.digest); err == nil {
+			t.Errorf("EncodeLegacy(%q, %q, %q) = %s, want error", tc.algo, tc.salt, tc.digest, encoded)
+		}
+	}
+}
+
+func TestRehashOnHasherChange(t *testing.T) {
+	bcryptHash, _ := newBcryptHasher(bcrypt.MinCost).Hash("secret")
+	argon2Hash, _ := newArgon2idHasher(testArgon2).Hash("secret")
+
+	cases := []struct {
+		hasher, encoded string
+		rehash          bool
+	}{
+		{"bcrypt", bcryptHash, false},
+		{"argon2id", bcryptHash, true},
+		{"argon2id", argon2Hash, false},
+		{"bcrypt", argon2Hash, true},
+	}
+	for _, tc := range cases {
+		setPasswordConfig(t, config.PasswordConfig{Hasher: tc.hasher, BcryptCost: bcrypt.MinCost, Argon2: testArgon2})
+		if rehash, err := Verify("secret", tc.encoded); err != nil || rehash != tc.rehash {
+			t.Errorf("hasher %s, %.12s: verify = %v, %v, want rehash %v", tc.hasher, tc.encoded, rehash, err, tc.rehash)
+		}
+	}
+}
+
+func TestMalformedHash(t *testing.T) {
+	setPasswordConfig(t, config.PasswordConfig{Argon2: config.Argon2Config{MaxMemory: 1024}})
+
+	bcryptHash, _ := newBcryptHasher(bcrypt.MinCost).Hash("secret")
+	cases := []struct {
+		name, encoded string
+	}{
+		{"argon2 t=0", argon2Encoded("m=64,t=0,p=1", 16, 32)},
+		{"argon2 p=0", argon2Encoded("m=64,t=1,p=0", 16, 32)},
+		{"argon2 m<8p", argon2Encoded("m=15,t=1,p=2", 16, 32)},
+		{"argon2 m>max", argon2Encoded("m=2048,t=1,p=1", 16, 32)},
+		{"argon2 m overflow", argon2Encoded("m=4294967296,t=1,p=1", 16, 32)},
+		{"argon2 p overflow", argon2Encoded("m=4096,t=1,p=256", 16, 32)},
+		{"argon2 trailing params", argon2Encoded("m=64,t=1,p=1,x=1", 16, 32)},
+		{"argon2 leading zero", argon2Encoded("m=064,t=1,p=1", 16, 32)},
+		{"argon2 short salt", argon2Encoded("m=64,t=1,p=1", 4, 32)},
+		{"argon2 long salt", argon2Encoded("m=64,t=1,p=1", 128, 32)},
+		{"argon2 short key", argon2Encoded("m=64,t=1,p=1", 16, 8)},
+		{"argon2 long key", argon2Encoded("m=64,t=1,p=1", 16, 128)},
+		{"argon2 bad base64", "$argon2id$v=19$m=64,t=1,p=1$!!!!$" + base64.RawStdEncoding.EncodeToString(make([]byte, 32))},
+		{"argon2 version", strings.Replace(argon2Encoded("m=64,t=1,p=1", 16, 32), "v=19", "v=16", 1)},
+		{"argon2 missing part", "$argon2id$v=19$m=64,t=1,p=1$" + base64.RawStdEncoding.EncodeToString(make([]byte, 16))},
+		{"bcrypt truncated", bcryptHash[:40]},
+		{"bcrypt cost", strings.Replace(bcryptHash, "$04$", "$99$", 1)},
+		{"legacy digest length", "$legacy$md5$$00"},
+		{"legacy algo", "$legacy$crc32$$" + strings.Repeat("0", 8)},
+		{"unknown", "$scrypt$ln=15,r=8,p=1$c2FsdA$aGFzaA"},
+	}
+	for _, tc := range cases {
+		if Recognized(tc.encoded) {
+			t.Errorf("%s: %s recognized", tc.name, tc.encoded)
+		}
+		if _, err := Verify("secret", tc.encoded); err == nil || errors.Is(err, ErrMismatch) {
+			t.Errorf("%s: verify = %v, want format error", tc.name, err)
+		}
+	}
+
+	// 范围内的参数可以识别
+	if encoded := argon2Encoded("m=1024,t=1,p=1", 8, 16); !Recognized(encoded) {
+		t.Errorf("%s not recognized", encoded)
+	}
+}
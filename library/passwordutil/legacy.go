@@ -0,0 +1,92 @@
+package passwordutil
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"strings"
+)
+
+// legacyHasher 从其他系统导入的摘要型哈希, 格式为 $legacy$<algo>$<salt>$<hex(algo(salt + password))>
+// 仅用于校验, 不会用于生成新哈希; 校验成功后总是视为过时, 登录时会被重新计算
+type legacyHasher struct{}
+
+var legacyDigests = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// EncodeLegacy
+// @description 将其他系统的摘要型哈希编码为可识别的格式, salt 可为空
+func EncodeLegacy(algo, salt, digest string) (string, error) {
+	algo = strings.ToLower(algo)
+	if _, ok := legacyDigests[algo]; !ok {
+		return "", ErrUnknownHash
+	}
+	if strings.Contains(salt, "$") {
+		return "", errors.New("salt must not contain '$'")
+	}
+	if raw, err := hex.DecodeString(digest); err != nil {
+		return "", errors.New("digest must be hex encoded")
+	} else if len(raw) != legacyDigests[algo]().Size() {
+		return "", errors.New("digest length does not match " + algo)
+	}
+	return "$legacy$" + algo + "$" + salt + "$" + strings.ToLower(digest), nil
+}
+
+func (legacyHasher) Name() string {
+	return "legacy"
+}
+
+func (legacyHasher) Hash(string) (string, error) {
+	return "", errors.New("legacy hasher can not generate new hashes")
+}
+
+func (legacyHasher) Match(encoded string) bool {
+	return strings.HasPrefix(encoded, "$legacy$")
+}
+
+func (legacyHasher) Validate(encoded string) error {
+	_, _, _, err := decodeLegacy(encoded)
+	return err
+}
+
+func (legacyHasher) Verify(password, encoded string) (bool, error) {
+	newHash, salt, want, err := decodeLegacy(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	h := newHash()
+	h.Write([]byte(salt + password))
+	return subtle.ConstantTimeCompare(h.Sum(nil), want) == 1, nil
+}
+
+// decodeLegacy 解析哈希, 摘要长度必须与算法一致
+func decodeLegacy(encoded string) (func() hash.Hash, string, []byte, error) {
+	// "", "legacy", algo, salt, digest
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 || parts[1] != "legacy" {
+		return nil, "", nil, ErrUnknownHash
+	}
+	newHash, ok := legacyDigests[parts[2]]
+	if !ok {
+		return nil, "", nil, ErrUnknownHash
+	}
+	digest, err := hex.DecodeString(parts[4])
+	if err != nil || len(digest) != newHash().Size() {
+		return nil, "", nil, ErrUnknownHash
+	}
+	return newHash, parts[3], digest, nil
+}
+
+func (legacyHasher) Outdated(string) bool {
+	return true
+}
@@ -0,0 +1,88 @@
+package passwordutil
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/soxft/openid-go/config"
+)
+
+// Check
+// @description 按配置的密码策略检查密码, 不符合时返回 *PolicyError
+// 历史密码检查依赖用户数据, 由调用方完成
+func Check(password string, subject Subject) *PolicyError {
+	policy := config.Password
+	result := &PolicyError{}
+
+	minLength, maxLength := policy.MinLength, policy.MaxLength
+	if minLength <= 0 {
+		minLength = 8
+	}
+	if maxLength <= 0 {
+		maxLength = 64
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < minLength {
+		result.Add(ReasonTooShort, "密码长度至少为 "+strconv.Itoa(minLength)+" 位")
+	} else if length > maxLength {
+		result.Add(ReasonTooLong, "密码长度不能超过 "+strconv.Itoa(maxLength)+" 位")
+	}
+
+	if policy.MinClasses > 1 && countClasses(password) < policy.MinClasses {
+		result.Add(ReasonTooFewClasses, "密码应至少包含小写字母、大写字母、数字、符号中的 "+strconv.Itoa(policy.MinClasses)+" 种")
+	}
+
+	if policy.DisallowPersonal {
+		lower := strings.ToLower(password)
+		if containsPart(lower, subject.Username) {
+			result.Add(ReasonContainsUsername, "密码不能包含用户名")
+		}
+		if local, _, ok := strings.Cut(subject.Email, "@"); ok && containsPart(lower, local) {
+			result.Add(ReasonContainsEmail, "密码不能包含邮箱地址")
+		}
+	}
+
+	// 泄露检查失败时不阻止用户设置密码
+	if breached, err := IsBreached(password); err != nil {
+		log.Printf("[ERROR] passwordutil breached check: %v", err)
+	} else if breached {
+		result.Add(ReasonBreached, "该密码已出现在公开泄露的密码库中, 请更换")
+	}
+
+	return result
+}
+
+// countClasses 统计密码包含的字符种类数
+func countClasses(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	count := 0
+	for _, ok := range []bool{lower, upper, digit, symbol} {
+		if ok {
+			count++
+		}
+	}
+	return count
+}
+
+// containsPart 过短的个人信息 (少于 3 位) 不参与比较, 避免误判
+func containsPart(lowerPassword, part string) bool {
+	part = strings.ToLower(part)
+	return len(part) >= 3 && strings.Contains(lowerPassword, part)
+}
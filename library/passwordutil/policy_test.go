@@ -0,0 +1,67 @@
+package passwordutil
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/soxft/openid-go/config"
+)
+
+// testBreachedDir 按 SHA-1 前缀分片的泄露密码库样例:
+// 21BD1 含 P@ssw0rd (出现 3 次), 7E8B0.txt 含 Summer2024! (小写, 无次数), 87457 不含 Tr0ub4dor&3
+const testBreachedDir = "testdata/breached"
+
+// codes 取出全部原因码, 没有原因时为 nil
+func codes(err *PolicyError) []string {
+	var list []string
+	for _, v := range err.Violations {
+		list = append(list, v.Code)
+	}
+	return list
+}
+
+func TestCheck(t *testing.T) {
+	base := config.PasswordConfig{MinLength: 8, MaxLength: 16, MinClasses: 3, DisallowPersonal: true}
+	subject := Subject{Username: "alice01", Email: "bob.smith@example.com"}
+
+	for _, tc := range []struct {
+		name     string
+		config   func(c *config.PasswordConfig)
+		password string
+		subject  Subject
+		want     []string
+	}{
+		{name: "ok", password: "Correct-Horse1", subject: subject},
+		{name: "too short", password: "Ab1-x", subject: subject, want: []string{ReasonTooShort}},
+		{name: "min length counts runes", password: "密码Ab1-中文字", subject: subject},
+		{name: "too long", password: "Correct-Horse1-Battery", subject: subject, want: []string{ReasonTooLong}},
+		{name: "default length", config: func(c *config.PasswordConfig) { c.MinLength, c.MaxLength = 0, 0 }, password: "Ab1-xyz", subject: subject, want: []string{ReasonTooShort}},
+		{name: "too few classes", password: "correcthorse1", subject: subject, want: []string{ReasonTooFewClasses}},
+		{name: "symbols count as a class", password: "correct horse!", subject: subject, want: []string{ReasonTooFewClasses}},
+		{name: "classes disabled", config: func(c *config.PasswordConfig) { c.MinClasses = 0 }, password: "correcthorse", subject: subject},
+		{name: "contains username", password: "xALICE01-Pass", subject: subject, want: []string{ReasonContainsUsername}},
+		{name: "contains email local part", password: "Bob.Smith#2024", subject: subject, want: []string{ReasonContainsEmail}},
+		{name: "email domain ignored", password: "Example-com1", subject: subject},
+		{name: "short username ignored", password: "ab-Correct-1", subject: Subject{Username: "ab", Email: "ab@example.com"}},
+		{name: "personal allowed", config: func(c *config.PasswordConfig) { c.DisallowPersonal = false }, password: "alice01-Pass", subject: subject},
+		{name: "breached", config: func(c *config.PasswordConfig) { c.BreachedDir = testBreachedDir }, password: "P@ssw0rd", subject: subject, want: []string{ReasonBreached}},
+		{name: "all reasons", config: func(c *config.PasswordConfig) { c.BreachedDir = testBreachedDir }, password: "alice01", subject: Subject{Username: "alice01", Email: "alice01@example.com"},
+			want: []string{ReasonTooShort, ReasonTooFewClasses, ReasonContainsUsername, ReasonContainsEmail}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := base
+			if tc.config != nil {
+				tc.config(&c)
+			}
+			setPasswordConfig(t, c)
+
+			result := Check(tc.password, tc.subject)
+			if got := codes(result); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("Check(%q) = %v, want %v", tc.password, got, tc.want)
+			}
+			if err := result.OrNil(); (err == nil) != (len(tc.want) == 0) {
+				t.Fatalf("OrNil() = %v", err)
+			}
+		})
+	}
+}
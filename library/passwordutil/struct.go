@@ -0,0 +1,52 @@
+package passwordutil
+
+import "strings"
+
+// 不符合策略的原因
+const (
+	ReasonTooShort         = "too_short"
+	ReasonTooLong          = "too_long"
+	ReasonTooFewClasses    = "too_few_classes"
+	ReasonContainsUsername = "contains_username"
+	ReasonContainsEmail    = "contains_email"
+	ReasonReused           = "reused"
+	ReasonBreached         = "breached"
+)
+
+// Subject 密码所属用户, 用于检测密码中是否包含个人信息
+type Subject struct {
+	Username string
+	Email    string
+}
+
+// Violation 一条不符合策略的原因
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PolicyError 密码不符合策略, 包含全部原因
+type PolicyError struct {
+	Violations []Violation
+}
+
+func (e *PolicyError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		messages = append(messages, v.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Add 追加一条原因
+func (e *PolicyError) Add(code, message string) {
+	e.Violations = append(e.Violations, Violation{Code: code, Message: message})
+}
+
+// OrNil 没有任何原因时返回 nil
+func (e *PolicyError) OrNil() error {
+	if len(e.Violations) == 0 {
+		return nil
+	}
+	return e
+}
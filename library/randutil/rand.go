@@ -0,0 +1,89 @@
+package randutil
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/binary"
+	"math/big"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	Base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	Base32Alphabet = "abcdefghijklmnopqrstuvwxyz234567"
+	DigitAlphabet  = "0123456789"
+	LetterAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+)
+
+var (
+	base32Encoding = base32.NewEncoding(Base32Alphabet).WithPadding(base32.NoPadding)
+
+	idCounter atomic.Uint32
+)
+
+// Bytes
+// @description 生成 n 字节的密码学安全随机数
+func Bytes(n int) []byte {
+	b := make([]byte, n)
+	// crypto/rand.Read 不会返回错误, 系统随机源不可用时会直接终止程序
+	_, _ = rand.Read(b)
+	return b
+}
+
+// String
+// @description 从 alphabet 中均匀地选取 n 个字符
+func String(n int, alphabet string) string {
+	max := big.NewInt(int64(len(alphabet)))
+	result := make([]byte, n)
+	for i := range result {
+		idx, _ := rand.Int(rand.Reader, max)
+		result[i] = alphabet[idx.Int64()]
+	}
+	return string(result)
+}
+
+// Base62 生成 n 位 [0-9A-Za-z] 随机字符串
+func Base62(n int) string {
+	return String(n, Base62Alphabet)
+}
+
+// Base32 生成 n 位 [a-z2-7] 随机字符串
+func Base32(n int) string {
+	return String(n, Base32Alphabet)
+}
+
+// Digits 生成 n 位数字字符串 (可能以 0 开头)
+func Digits(n int) string {
+	return String(n, DigitAlphabet)
+}
+
+// EncodeBase32 以 [a-z2-7] 字母表编码 b (无填充)
+func EncodeBase32(b []byte) string {
+	return base32Encoding.EncodeToString(b)
+}
+
+// Int
+// @description 返回 [0, max) 内的均匀随机整数
+func Int(max int) int {
+	if max <= 0 {
+		return 0
+	}
+	n, _ := rand.Int(rand.Reader, big.NewInt(int64(max)))
+	return int(n.Int64())
+}
+
+// ID
+// @description 生成全局唯一 ID (26 位 base32)
+// 由 48 位毫秒时间戳, 32 位进程内自增计数器与 48 位随机数组成:
+// 同一进程内由时间戳 + 计数器保证不重复, 不同实例间依赖随机部分
+func ID() string {
+	var b [16]byte
+	ms := uint64(time.Now().UnixMilli())
+	b[0] = byte(ms >> 40)
+	b[1] = byte(ms >> 32)
+	binary.BigEndian.PutUint32(b[2:6], uint32(ms))
+	binary.BigEndian.PutUint32(b[6:10], idCounter.Add(1))
+	copy(b[10:], Bytes(6))
+	return EncodeBase32(b[:])
+}
@@ -0,0 +1,114 @@
+package randutil
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestIDUniqueConcurrent(t *testing.T) {
+	const workers, perWorker = 32, 2000
+
+	var mu sync.Mutex
+	seen := make(map[string]struct{}, workers*perWorker)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ids := make([]string, 0, perWorker)
+			for j := 0; j < perWorker; j++ {
+				ids = append(ids, ID())
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			for _, id := range ids {
+				if _, ok := seen[id]; ok {
+					t.Errorf("duplicate id %s", id)
+				}
+				seen[id] = struct{}{}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(seen) != workers*perWorker {
+		t.Fatalf("got %d unique ids, want %d", len(seen), workers*perWorker)
+	}
+}
+
+func TestIDFormat(t *testing.T) {
+	id := ID()
+	if len(id) != 26 {
+		t.Fatalf("len(ID()) = %d, want 26", len(id))
+	}
+	for _, r := range id {
+		if !strings.ContainsRune(Base32Alphabet, r) {
+			t.Fatalf("ID() = %q contains %q", id, r)
+		}
+	}
+}
+
+func TestBase62UniqueConcurrent(t *testing.T) {
+	const workers, perWorker = 16, 1000
+
+	results := make(chan string, workers*perWorker)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perWorker; j++ {
+				results <- Base62(32)
+			}
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	seen := make(map[string]struct{}, workers*perWorker)
+	for s := range results {
+		if _, ok := seen[s]; ok {
+			t.Fatalf("duplicate secret %s", s)
+		}
+		seen[s] = struct{}{}
+	}
+}
+
+func TestStringAlphabet(t *testing.T) {
+	tests := []struct {
+		name     string
+		gen      func(int) string
+		alphabet string
+	}{
+		{"Base62", Base62, Base62Alphabet},
+		{"Base32", Base32, Base32Alphabet},
+		{"Digits", Digits, DigitAlphabet},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.gen(512)
+			if len(s) != 512 {
+				t.Fatalf("len = %d, want 512", len(s))
+			}
+			for _, r := range s {
+				if !strings.ContainsRune(tt.alphabet, r) {
+					t.Fatalf("%q contains %q outside alphabet", s, r)
+				}
+			}
+		})
+	}
+}
+
+func TestIntRange(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		if n := Int(10); n < 0 || n >= 10 {
+			t.Fatalf("Int(10) = %d", n)
+		}
+	}
+	if n := Int(0); n != 0 {
+		t.Fatalf("Int(0) = %d, want 0", n)
+	}
+}
@@ -1,45 +1,24 @@
 package toolutil
 
 import (
-	"math/rand"
-	"time"
-)
+	"strconv"
 
-const strList string = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	"github.com/soxft/openid-go/library/randutil"
+)
 
 func RandStr(length int) string {
-	var result []byte
-
-	r := rand.New(rand.NewSource(time.Now().Unix()))
-
-	for i := 0; i < length; i++ {
-		result = append(result, strList[r.Int63()%int64(len(strList))])
-	}
-	return string(result)
+	return randutil.String(length, randutil.LetterAlphabet)
 }
 
+// RandInt 生成 length 位的随机整数
 func RandInt(length int) int {
-	r := rand.New(rand.NewSource(time.Now().Unix()))
-
-	var code int
-	for i := 0; i < length; i++ {
-		code += r.Intn(10)
+	if length <= 0 {
+		return 0
 	}
-	return code
+	n, _ := strconv.Atoi(strconv.Itoa(randutil.Int(9)+1) + randutil.Digits(length-1))
+	return n
 }
 
 func RandStrInt(length int) string {
-	var result []byte
-
-	r := rand.New(rand.NewSource(time.Now().Unix()))
-
-	for i := 0; i < length; i++ {
-		j := r.Intn(4)
-		if j%2 == 0 {
-			result = append(result, strList[r.Int63()%int64(len(strList))])
-		} else {
-			result = append(result, byte(r.Intn(10)+'0'))
-		}
-	}
-	return string(result)
+	return randutil.String(length, randutil.LetterAlphabet+randutil.DigitAlphabet)
 }
@@ -0,0 +1,177 @@
+package userutil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/soxft/openid-go/app/model"
+	"github.com/soxft/openid-go/library/mailutil"
+	"github.com/soxft/openid-go/library/mq"
+	"github.com/soxft/openid-go/library/randutil"
+	"github.com/soxft/openid-go/library/toolutil"
+	"gorm.io/gorm"
+)
+
+// IsAdmin
+// @description 判断用户是否为管理员 (实时查库, 角色变更立即生效)
+func IsAdmin(db *gorm.DB, userId int) (bool, error) {
+	var role string
+	err := db.Model(&model.Account{}).Select("role").Where(model.Account{ID: userId}).Take(&role).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	} else if err != nil {
+		log.Printf("[ERROR] IsAdmin: %v", err)
+		return false, ErrDatabase
+	}
+	return role == model.RoleAdmin, nil
+}
+
+// SearchUsers
+// @description 按 用户名 / 邮箱 / ID 搜索用户
+func SearchUsers(db *gorm.DB, keyword string, limit, offset int) ([]AdminUser, int64, error) {
+	query := db.Model(&model.Account{})
+	if keyword != "" {
+		like := "%" + keyword + "%"
+		if id, err := strconv.Atoi(keyword); err == nil {
+			query = query.Where("username LIKE ? OR email LIKE ? OR id = ?", like, like, id)
+		} else {
+			query = query.Where("username LIKE ? OR email LIKE ?", like, like)
+		}
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		log.Printf("[ERROR] SearchUsers: %v", err)
+		return nil, 0, ErrDatabase
+	}
+
+	users := []AdminUser{}
+	if err := query.Order("id desc").Limit(limit).Offset(offset).Scan(&users).Error; err != nil {
+		log.Printf("[ERROR] SearchUsers: %v", err)
+		return nil, 0, ErrDatabase
+	}
+	return users, total, nil
+}
+
+// GetAdminUser
+// @description 获取用户详情
+func GetAdminUser(db *gorm.DB, userId int) (AdminUser, error) {
+	var user AdminUser
+	err := db.Model(&model.Account{}).Where(model.Account{ID: userId}).Take(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, ErrUserNotFound
+	} else if err != nil {
+		log.Printf("[ERROR] GetAdminUser: %v", err)
+		return user, ErrDatabase
+	}
+	return user, nil
+}
+
+// ForcePasswordReset
+// @description 强制重置密码: 将密码替换为无人知晓的随机值并吊销全部会话, 用户需通过找回密码设置新密码
+func ForcePasswordReset(ctx context.Context, db *gorm.DB, rdb redis.Cmdable, q mq.MessageQueue, userId int) error {
+	var account model.Account
+	err := db.Select("id, email").Where(model.Account{ID: userId}).Take(&account).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrUserNotFound
+	} else if err != nil {
+		log.Printf("[ERROR] ForcePasswordReset: %v", err)
+		return ErrDatabase
+	}
+
+	pwd, err := GeneratePwd(randutil.Base62(32))
+	if err != nil {
+		return err
+	}
+	if err := db.Model(&model.Account{}).Where(model.Account{ID: userId}).Update("password", pwd).Error; err != nil {
+		log.Printf("[ERROR] ForcePasswordReset: %v", err)
+		return ErrDatabase
+	}
+
+	if err := RevokeAllSessions(ctx, rdb, userId); err != nil {
+		return err
+	}
+
+	_msg, _ := json.Marshal(mailutil.Mail{
+		ToAddress: account.Email,
+		Subject:   "您的密码已被重置",
+		Content:   "出于安全原因, 您的密码已于" + time.Now().Format("2006-01-02 15:04:05") + "被重置, 所有设备均已退出登录. 请通过 \"忘记密码\" 设置新密码",
+		Typ:       "passwordForceReset",
+	})
+	_ = q.Publish("mail", string(_msg), 0)
+	return nil
+}
+
+// FindUserId
+// @description 按 ID / 用户名 / 邮箱 查找用户
+func FindUserId(db *gorm.DB, key string) (int, error) {
+	var where model.Account
+	if id, err := strconv.Atoi(key); err == nil {
+		where.ID = id
+	} else if toolutil.IsEmail(key) {
+		where.Email = key
+	} else {
+		where.Username = key
+	}
+
+	var userId int
+	err := db.Model(&model.Account{}).Select("id").Where(where).Take(&userId).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, ErrUserNotFound
+	} else if err != nil {
+		log.Printf("[ERROR] FindUserId: %v", err)
+		return 0, ErrDatabase
+	}
+	return userId, nil
+}
+
+// CreateUser
+// @description 直接创建账号 (命令行工具使用), 密码需符合密码策略
+func CreateUser(db *gorm.DB, username, email, password, role string) (int, error) {
+	if !toolutil.IsUserName(username) {
+		return 0, ErrUsernameInvalid
+	}
+	if !toolutil.IsEmail(email) {
+		return 0, ErrEmailInvalid
+	}
+	if role != model.RoleUser && role != model.RoleAdmin {
+		return 0, ErrRoleInvalid
+	}
+	if err := RegisterCheck(db, username, email); err != nil {
+		return 0, err
+	}
+	if err := ValidatePassword(db, 0, username, email, password); err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+	return Register(db, model.Account{
+		Username: username,
+		Email:    email,
+		RegTime:  timestamp,
+		LastTime: timestamp,
+		Role:     role,
+	}, password)
+}
+
+// SetRole
+// @description 修改用户角色
+func SetRole(db *gorm.DB, userId int, role string) error {
+	if role != model.RoleUser && role != model.RoleAdmin {
+		return ErrRoleInvalid
+	}
+
+	result := db.Model(&model.Account{}).Where(model.Account{ID: userId}).Update("role", role)
+	if result.Error != nil {
+		log.Printf("[ERROR] SetRole: %v", result.Error)
+		return ErrDatabase
+	} else if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+package userutil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/soxft/openid-go/app/model"
+	"github.com/soxft/openid-go/config"
+	"github.com/soxft/openid-go/library/apputil"
+	"github.com/soxft/openid-go/library/auditutil"
+	"github.com/soxft/openid-go/library/mailutil"
+	"github.com/soxft/openid-go/library/mq"
+	"github.com/soxft/openid-go/library/randutil"
+	"github.com/soxft/openid-go/library/toolutil"
+	"gorm.io/gorm"
+)
+
+// ScheduleDeletion
+// @description 申请注销账号, 冷静期结束后由 DeletionSweeper 执行删除
+// 返回计划删除时间
+func ScheduleDeletion(ctx context.Context, db *gorm.DB, rdb redis.Cmdable, q mq.MessageQueue, userId int) (time.Time, error) {
+	var account model.Account
+	if err := db.Select("id, username, email, delete_at").Where(model.Account{ID: userId}).Take(&account).Error; err != nil {
+		return time.Time{}, err
+	}
+	if account.DeleteAt > 0 {
+		return time.Unix(account.DeleteAt, 0), ErrDeletionScheduled
+	}
+
+	grace := deleteGracePeriod()
+	deleteAt := time.Now().Add(grace)
+
+	// 同时记录用户对应的撤销 key, 账号删除时一并清理
+	token := randutil.Base62(32)
+	cancelKey := getDeleteCancelKey(token)
+	pipe := rdb.TxPipeline()
+	pipe.SetEx(ctx, cancelKey, userId, grace)
+	pipe.SetEx(ctx, getDeleteCancelUserKey(userId), cancelKey, grace)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("[ERROR] ScheduleDeletion: %v", err)
+		return time.Time{}, ErrDatabase
+	}
+
+	if err := db.Model(&model.Account{}).Where(model.Account{ID: userId}).Update("delete_at", deleteAt.Unix()).Error; err != nil {
+		log.Printf("[ERROR] ScheduleDeletion: %v", err)
+		rdb.Del(ctx, cancelKey, getDeleteCancelUserKey(userId))
+		return time.Time{}, ErrDatabase
+	}
+
+	cancelUrl := strings.TrimRight(config.Server.FrontUrl, "/") + "/account/delete/cancel?token=" + token
+	_msg, _ := json.Marshal(mailutil.Mail{
+		ToAddress: account.Email,
+		Subject:   "您的账号将被注销",
+		Content: "您已申请注销账号 " + account.Username + ", 账号及相关数据将于 " + deleteAt.Format("2006-01-02 15:04:05") + " 被永久删除. " +
+			"如果不是您本人操作或您想保留账号, 请在此之前访问以下链接撤销: <a href=\"" + cancelUrl + "\">" + cancelUrl + "</a>",
+		Typ: "accountDeleteScheduled",
+	})
+	_ = q.Publish("mail", string(_msg), 0)
+
+	return deleteAt, nil
+}
+
+// CancelDeletion
+// @description 通过邮件中的 token 撤销注销申请, 返回对应的用户 ID
+// 账号已被删除或已撤销时返回 ErrDeletionTokenInvalid
+func CancelDeletion(ctx context.Context, db *gorm.DB, rdb redis.Cmdable, token string) (int, error) {
+	userId, err := rdb.GetDel(ctx, getDeleteCancelKey(token)).Int()
+	if errors.Is(err, redis.Nil) {
+		return 0, ErrDeletionTokenInvalid
+	} else if err != nil {
+		log.Printf("[ERROR] CancelDeletion: %v", err)
+		return 0, ErrDatabase
+	}
+
+	rdb.Del(ctx, getDeleteCancelUserKey(userId))
+
+	result := db.Model(&model.Account{}).Where("id = ? AND delete_at > 0", userId).Update("delete_at", 0)
+	if result.Error != nil {
+		log.Printf("[ERROR] CancelDeletion: %v", result.Error)
+		return userId, ErrDatabase
+	} else if result.RowsAffected == 0 {
+		return 0, ErrDeletionTokenInvalid
+	}
+	return userId, nil
+}
+
+// DeleteAccount
+// @description 在一个事务中删除用户及其所有关联数据, 并通知用户授权过的应用开发者
+func DeleteAccount(db *gorm.DB, rdb redis.Cmdable, q mq.MessageQueue, userId int) error {
+	var (
+		account   model.Account
+		notices   []AppDeleteNotice
+		ownAppIds []string
+	)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(model.Account{ID: userId}).Take(&account).Error; err != nil {
+			return err
+		}
+
+		// 删除前收集需要通知的开发者, 与删除在同一事务内, 避免遗漏期间新增的授权
+		var err error
+		if notices, err = collectAuthorizedApps(tx, userId); err != nil {
+			return err
+		}
+		if err := tx.Model(&model.App{}).Where(model.App{UserId: userId}).Pluck("app_id", &ownAppIds).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", userId).Delete(&model.OpenId{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? OR dev_user_id = ?", userId, userId).Delete(&model.UniqueId{}).Error; err != nil {
+			return err
+		}
+		if len(ownAppIds) > 0 {
+			if err := tx.Where("app_id IN ?", ownAppIds).Delete(&model.OpenId{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("user_id = ?", userId).Delete(&model.App{}).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("user_id = ?", userId).Delete(&model.PassKey{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userId).Delete(&model.LoginHistory{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userId).Delete(&model.PasswordHistory{}).Error; err != nil {
+			return err
+		}
+		// 审计日志需保留操作记录, 仅抹去其中的个人信息
+		if err := tx.Model(&model.AuditLog{}).Where("user_id = ? OR actor_id = ?", userId, userId).
+			Updates(map[string]any{"ip": "", "user_agent": ""}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.AuditLog{}).Where("user_id = ?", userId).Update("detail", "").Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", userId).Delete(&model.Account{}).Error
+	})
+	if err != nil {
+		log.Printf("[ERROR] DeleteAccount(%d): %v", userId, err)
+		return err
+	}
+
+	// 清理缓存与未使用的撤销链接
+	ctx := context.Background()
+	if cancelKey, err := rdb.GetDel(ctx, getDeleteCancelUserKey(userId)).Result(); err == nil {
+		rdb.Del(ctx, cancelKey)
+	}
+	for _, appId := range ownAppIds {
+		apputil.PurgeAppCache(rdb, appId)
+		apputil.PurgeOpenIdCache(rdb, appId)
+	}
+	for _, n := range notices {
+		apputil.OpenIdCache.Delete(ctx, rdb, n.AppId+":"+strconv.Itoa(userId))
+	}
+	apputil.UniqueIdCache.DeletePrefix(ctx, rdb, strconv.Itoa(userId)+":")
+	suspensionCache.Delete(ctx, rdb, strconv.Itoa(userId))
+
+	notifyAppsAccountDeleted(q, notices)
+
+	auditutil.Record(db, auditutil.Actor{}, auditutil.Entry{
+		Action:     auditutil.ActionAccountDelete,
+		UserId:     userId,
+		TargetType: auditutil.TargetUser,
+		TargetId:   strconv.Itoa(userId),
+	})
+
+	_msg, _ := json.Marshal(mailutil.Mail{
+		ToAddress: account.Email,
+		Subject:   "您的账号已注销",
+		Content:   "您的账号 " + account.Username + " 及相关数据已于 " + time.Now().Format("2006-01-02 15:04:05") + " 被永久删除.",
+		Typ:       "accountDeleted",
+	})
+	_ = q.Publish("mail", string(_msg), 0)
+
+	log.Printf("[INFO] account %d deleted", userId)
+	return nil
+}
+
+// DeletionSweeper
+// @description 定期删除冷静期已结束的账号, 多实例部署时通过 redis 锁保证只有一个实例执行
+func DeletionSweeper(ctx context.Context, db *gorm.DB, rdb redis.Cmdable, q mq.MessageQueue, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			sweepDeletions(ctx, db, rdb, q, interval)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// releaseLock 仅当锁仍由 ARGV[1] 持有时删除
+var releaseLock = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+func sweepDeletions(ctx context.Context, db *gorm.DB, rdb redis.Cmdable, q mq.MessageQueue, lockTTL time.Duration) {
+	// 锁的值为本次执行的随机 token, 释放时校验, 避免执行超时后误删其他实例的锁
+	lockKey := getDeleteLockKey()
+	owner := randutil.Base62(16)
+	if ok, err := rdb.SetNX(ctx, lockKey, owner, lockTTL).Result(); err != nil || !ok {
+		return
+	}
+	defer releaseLock.Run(context.Background(), rdb, []string{lockKey}, owner)
+
+	var userIds []int
+	err := db.Model(&model.Account{}).
+		Where("delete_at > 0 AND delete_at <= ?", time.Now().Unix()).
+		Pluck("id", &userIds).Error
+	if err != nil {
+		log.Printf("[ERROR] sweepDeletions: %v", err)
+		return
+	}
+
+	for _, userId := range userIds {
+		_ = DeleteAccount(db, rdb, q, userId)
+	}
+}
+
+// collectAuthorizedApps 获取用户授权过的 (不属于该用户的) 应用及对应 openId
+// pairwise 模式下未入库的授权关系无法追溯
+func collectAuthorizedApps(db *gorm.DB, userId int) ([]AppDeleteNotice, error) {
+	var notices []AppDeleteNotice
+	err := db.Table("open_id").
+		Select("apps.app_id, apps.app_name, open_id.open_id, accounts.email AS dev_email").
+		Joins("JOIN apps ON apps.app_id = open_id.app_id").
+		Joins("JOIN accounts ON accounts.id = apps.user_id").
+		Where("open_id.user_id = ? AND apps.user_id <> ?", userId, userId).
+		Scan(&notices).Error
+	if err != nil {
+		log.Printf("[ERROR] collectAuthorizedApps: %v", err)
+		return nil, ErrDatabase
+	}
+	return notices, nil
+}
+
+// notifyAppsAccountDeleted 按开发者聚合, 告知其应用下的哪些 openId 已被注销
+func notifyAppsAccountDeleted(q mq.MessageQueue, notices []AppDeleteNotice) {
+	byDev := make(map[string][]AppDeleteNotice)
+	for _, n := range notices {
+		byDev[n.DevEmail] = append(byDev[n.DevEmail], n)
+	}
+
+	for email, items := range byDev {
+		var lines []string
+		for _, n := range items {
+			lines = append(lines, fmt.Sprintf("应用 %s (%s): openId %s", html.EscapeString(n.AppName), n.AppId, n.OpenId))
+		}
+		_msg, _ := json.Marshal(mailutil.Mail{
+			ToAddress: email,
+			Subject:   "用户注销通知",
+			Content:   "以下授权过您应用的用户已注销账号, 请及时删除相关数据:<br>" + strings.Join(lines, "<br>"),
+			Typ:       "appUserDeleted",
+		})
+		_ = q.Publish("mail", string(_msg), 0)
+	}
+}
+
+func deleteGracePeriod() time.Duration {
+	days := config.Account.DeleteGraceDays
+	if days <= 0 {
+		days = 7
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func getDeleteCancelKey(token string) string {
+	return config.RedisPrefix + ":account:delete:cancel:" + toolutil.Md5(token)
+}
+
+// getDeleteCancelUserKey 用户 ID -> 撤销 key
+func getDeleteCancelUserKey(userId int) string {
+	return config.RedisPrefix + ":account:delete:cancel_user:" + strconv.Itoa(userId)
+}
+
+func getDeleteLockKey() string {
+	return config.RedisPrefix + ":lock:account_delete"
+}
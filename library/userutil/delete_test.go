@@ -0,0 +1,298 @@
+package userutil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/soxft/openid-go/app/model"
+	"github.com/soxft/openid-go/config"
+	"github.com/soxft/openid-go/library/mailutil"
+	"github.com/soxft/openid-go/process/dbutil"
+	"github.com/soxft/openid-go/process/dbutil/migration"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// env 测试使用的数据库, redis 与邮件队列
+type env struct {
+	db    *gorm.DB
+	rdb   *redis.Client
+	mr    *miniredis.Miniredis
+	mails *mailSink
+}
+
+// setup 使用内存 SQLite 与 miniredis
+func setup(t *testing.T) *env {
+	t.Helper()
+
+	err := config.Apply(&config.Config{
+		ServerConfig:  config.ServerConfig{Name: "openid test", FrontUrl: "https://openid.test"},
+		RedisConfig:   config.RedisConfig{Prefix: "openid"},
+		AccountConfig: config.AccountConfig{DeleteGraceDays: 7},
+	})
+	if err != nil {
+		t.Fatalf("apply config: %v", err)
+	}
+
+	db, err := dbutil.Open(dbutil.DriverSqlite, "file:"+t.Name()+"?mode=memory&cache=shared", &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	sqlDb, _ := db.DB()
+	sqlDb.SetMaxOpenConns(1)
+	if _, err := migration.New(db).Up(0); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	t.Cleanup(func() {
+		_ = rdb.Close()
+		_ = sqlDb.Close()
+	})
+	return &env{db: db, rdb: rdb, mr: mr, mails: &mailSink{}}
+}
+
+// createAccount 创建一个普通用户
+func (e *env) createAccount(t *testing.T, username string) model.Account {
+	t.Helper()
+
+	account := model.Account{Username: username, Email: username + "@example.com", Role: model.RoleUser}
+	if err := e.db.Create(&account).Error; err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+	return account
+}
+
+// mailSink 实现 mq.MessageQueue, 记录投递到 mail 队列的邮件
+type mailSink struct {
+	mu    sync.Mutex
+	mails []mailutil.Mail
+}
+
+func (s *mailSink) Publish(topic string, msg string, _ int64) error {
+	if topic != "mail" {
+		return nil
+	}
+
+	var mail mailutil.Mail
+	if err := json.Unmarshal([]byte(msg), &mail); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.mails = append(s.mails, mail)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *mailSink) Subscribe(string, int, func(msg string)) {}
+
+// last 最近一封指定类型, 发往 to 的邮件
+func (s *mailSink) last(to, typ string) (mailutil.Mail, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := len(s.mails) - 1; i >= 0; i-- {
+		if m := s.mails[i]; m.ToAddress == to && m.Typ == typ {
+			return m, true
+		}
+	}
+	return mailutil.Mail{}, false
+}
+
+var cancelTokenRe = regexp.MustCompile(`token=(\w+)`)
+
+// scheduleDeletion 申请注销并返回邮件中的撤销 token
+func (e *env) scheduleDeletion(t *testing.T, account model.Account) (time.Time, string) {
+	t.Helper()
+
+	deleteAt, err := ScheduleDeletion(context.Background(), e.db, e.rdb, e.mails, account.ID)
+	if err != nil {
+		t.Fatalf("schedule deletion: %v", err)
+	}
+	mail, ok := e.mails.last(account.Email, "accountDeleteScheduled")
+	if !ok {
+		t.Fatal("schedule mail not sent")
+	}
+	m := cancelTokenRe.FindStringSubmatch(mail.Content)
+	if m == nil {
+		t.Fatalf("cancel token not found in %q", mail.Content)
+	}
+	return deleteAt, m[1]
+}
+
+func (e *env) deleteAt(t *testing.T, userId int) int64 {
+	t.Helper()
+
+	var account model.Account
+	if err := e.db.Select("delete_at").Where(model.Account{ID: userId}).Take(&account).Error; err != nil {
+		t.Fatalf("load account: %v", err)
+	}
+	return account.DeleteAt
+}
+
+func TestScheduleDeletionGracePeriod(t *testing.T) {
+	e := setup(t)
+	account := e.createAccount(t, "alice01")
+
+	before := time.Now()
+	deleteAt, _ := e.scheduleDeletion(t, account)
+
+	want := before.Add(7 * 24 * time.Hour)
+	if d := deleteAt.Sub(want); d < -time.Second || d > 5*time.Second {
+		t.Fatalf("deleteAt = %v, want about %v", deleteAt, want)
+	}
+	if got := e.deleteAt(t, account.ID); got != deleteAt.Unix() {
+		t.Fatalf("stored delete_at = %d, want %d", got, deleteAt.Unix())
+	}
+
+	// 冷静期内重复申请不会推迟删除时间
+	again, err := ScheduleDeletion(context.Background(), e.db, e.rdb, e.mails, account.ID)
+	if !errors.Is(err, ErrDeletionScheduled) {
+		t.Fatalf("second schedule err = %v, want ErrDeletionScheduled", err)
+	}
+	if again.Unix() != deleteAt.Unix() {
+		t.Fatalf("second schedule deleteAt = %v, want %v", again, deleteAt)
+	}
+
+	// 冷静期未结束, 清理任务不会删除账号
+	sweepDeletions(context.Background(), e.db, e.rdb, e.mails, time.Minute)
+	if got := e.deleteAt(t, account.ID); got != deleteAt.Unix() {
+		t.Fatalf("account swept before grace period ended")
+	}
+}
+
+func TestCancelDeletion(t *testing.T) {
+	e := setup(t)
+	account := e.createAccount(t, "alice01")
+	_, token := e.scheduleDeletion(t, account)
+
+	userId, err := CancelDeletion(context.Background(), e.db, e.rdb, token)
+	if err != nil {
+		t.Fatalf("cancel deletion: %v", err)
+	}
+	if userId != account.ID {
+		t.Fatalf("cancel userId = %d, want %d", userId, account.ID)
+	}
+	if got := e.deleteAt(t, account.ID); got != 0 {
+		t.Fatalf("delete_at = %d after cancel, want 0", got)
+	}
+	if e.mr.Exists(getDeleteCancelUserKey(account.ID)) {
+		t.Fatal("cancel user key not cleared")
+	}
+
+	// token 只能使用一次
+	if _, err := CancelDeletion(context.Background(), e.db, e.rdb, token); !errors.Is(err, ErrDeletionTokenInvalid) {
+		t.Fatalf("reuse token err = %v, want ErrDeletionTokenInvalid", err)
+	}
+	if _, err := CancelDeletion(context.Background(), e.db, e.rdb, "unknown"); !errors.Is(err, ErrDeletionTokenInvalid) {
+		t.Fatalf("unknown token err = %v, want ErrDeletionTokenInvalid", err)
+	}
+
+	// 撤销后可以重新申请
+	e.scheduleDeletion(t, account)
+}
+
+func TestSweepDeletions(t *testing.T) {
+	e := setup(t)
+	alice := e.createAccount(t, "alice01")
+	bob := e.createAccount(t, "bob01")
+	carol := e.createAccount(t, "carol01")
+
+	// alice 授权过 bob 的应用, 自己也拥有一个应用
+	bobApp := model.App{UserId: bob.ID, AppId: "202401010000000001", AppName: "bob app", AppSecret: "bob-secret"}
+	aliceApp := model.App{UserId: alice.ID, AppId: "202401010000000002", AppName: "alice app", AppSecret: "alice-secret"}
+	for _, app := range []*model.App{&bobApp, &aliceApp} {
+		if err := e.db.Create(app).Error; err != nil {
+			t.Fatalf("create app: %v", err)
+		}
+	}
+	openIds := []model.OpenId{
+		{UserId: alice.ID, AppId: bobApp.AppId, OpenId: "alice-bob"},
+		{UserId: carol.ID, AppId: aliceApp.AppId, OpenId: "carol-alice"},
+	}
+	if err := e.db.Create(&openIds).Error; err != nil {
+		t.Fatalf("create open ids: %v", err)
+	}
+	logs := []model.AuditLog{
+		{Action: "login", ActorId: alice.ID, UserId: alice.ID, Ip: "1.2.3.4", UserAgent: "ua", Detail: "remark", CreatedAt: 1},
+		{Action: "admin", ActorId: alice.ID, UserId: bob.ID, Ip: "1.2.3.4", UserAgent: "ua", Detail: "bob", CreatedAt: 1},
+	}
+	if err := e.db.Create(&logs).Error; err != nil {
+		t.Fatalf("create audit logs: %v", err)
+	}
+
+	_, _ = e.scheduleDeletion(t, alice)
+	_, _ = e.scheduleDeletion(t, carol)
+	past := time.Now().Add(-time.Minute).Unix()
+	if err := e.db.Model(&model.Account{}).Where("id = ?", alice.ID).Update("delete_at", past).Error; err != nil {
+		t.Fatalf("expire grace period: %v", err)
+	}
+
+	// 其他实例持有锁时不执行
+	e.mr.Set(getDeleteLockKey(), "other")
+	sweepDeletions(context.Background(), e.db, e.rdb, e.mails, time.Minute)
+	if got := e.deleteAt(t, alice.ID); got != past {
+		t.Fatal("account swept while lock held by another instance")
+	}
+	if v, _ := e.mr.Get(getDeleteLockKey()); v != "other" {
+		t.Fatalf("lock owned by another instance was released: %q", v)
+	}
+	e.mr.Del(getDeleteLockKey())
+
+	sweepDeletions(context.Background(), e.db, e.rdb, e.mails, time.Minute)
+
+	var count int64
+	e.db.Model(&model.Account{}).Where("id = ?", alice.ID).Count(&count)
+	if count != 0 {
+		t.Fatal("due account not deleted")
+	}
+	if got := e.deleteAt(t, carol.ID); got == 0 {
+		t.Fatal("account still in grace period was touched")
+	}
+	e.db.Model(&model.App{}).Where("user_id = ?", alice.ID).Count(&count)
+	if count != 0 {
+		t.Fatal("owned apps not deleted")
+	}
+	e.db.Model(&model.OpenId{}).Where("open_id IN ?", []string{"alice-bob", "carol-alice"}).Count(&count)
+	if count != 0 {
+		t.Fatalf("%d open ids left", count)
+	}
+
+	var stored []model.AuditLog
+	e.db.Where("actor_id = ? OR user_id = ?", alice.ID, alice.ID).Order("id").Find(&stored)
+	if len(stored) < 2 {
+		t.Fatalf("audit logs = %d, want kept", len(stored))
+	}
+	for _, l := range stored {
+		if l.Ip != "" || l.UserAgent != "" {
+			t.Fatalf("audit log %d not anonymized: %+v", l.ID, l)
+		}
+		if l.UserId == alice.ID && l.Detail != "" {
+			t.Fatalf("audit log %d detail not cleared: %q", l.ID, l.Detail)
+		}
+	}
+	if stored[1].Detail != "bob" {
+		t.Fatalf("detail of other user's log changed: %q", stored[1].Detail)
+	}
+
+	if _, ok := e.mails.last(bob.Email, "appUserDeleted"); !ok {
+		t.Fatal("developer not notified")
+	}
+	if _, ok := e.mails.last(alice.Email, "accountDeleted"); !ok {
+		t.Fatal("deleted mail not sent")
+	}
+	if e.mr.Exists(getDeleteLockKey()) {
+		t.Fatal("lock not released")
+	}
+}
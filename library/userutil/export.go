@@ -0,0 +1,70 @@
+package userutil
+
+import (
+	"github.com/soxft/openid-go/app/model"
+	"gorm.io/gorm"
+)
+
+// ExportUserData
+// @description 导出系统中与该用户相关的全部数据
+func ExportUserData(db *gorm.DB, userId int) (UserExport, error) {
+	var export UserExport
+
+	var account model.Account
+	if err := db.Where(model.Account{ID: userId}).Take(&account).Error; err != nil {
+		return export, err
+	}
+	export.Account = ExportAccount{
+		ID:       account.ID,
+		Username: account.Username,
+		Email:    account.Email,
+		RegTime:  account.RegTime,
+		RegIp:    account.RegIp,
+		LastTime: account.LastTime,
+		LastIp:   account.LastIp,
+		DeleteAt: account.DeleteAt,
+	}
+
+	export.Apps = []ExportApp{}
+	if err := db.Model(&model.App{}).
+		Select("app_id, app_name, app_gateway, create_at").
+		Where(model.App{UserId: userId}).
+		Scan(&export.Apps).Error; err != nil {
+		return export, err
+	}
+
+	export.Authorizations = []ExportAuthorization{}
+	if err := db.Table("open_id").
+		Select("open_id.app_id, apps.app_name, open_id.open_id, open_id.create_at").
+		Joins("LEFT JOIN apps ON apps.app_id = open_id.app_id").
+		Where("open_id.user_id = ?", userId).
+		Scan(&export.Authorizations).Error; err != nil {
+		return export, err
+	}
+
+	export.UniqueIds = []ExportUniqueId{}
+	if err := db.Model(&model.UniqueId{}).
+		Select("dev_user_id, unique_id, create_at").
+		Where(model.UniqueId{UserId: userId}).
+		Scan(&export.UniqueIds).Error; err != nil {
+		return export, err
+	}
+
+	export.Passkeys = []ExportPasskey{}
+	if err := db.Model(&model.PassKey{}).
+		Select("id, remark, aaguid, transport, created_at, last_used_at").
+		Where("user_id = ?", userId).
+		Scan(&export.Passkeys).Error; err != nil {
+		return export, err
+	}
+
+	export.LoginHistory = []LoginRecord{}
+	if err := db.Model(&model.LoginHistory{}).
+		Where("user_id = ?", userId).
+		Order("id desc").
+		Scan(&export.LoginHistory).Error; err != nil {
+		return export, err
+	}
+
+	return export, nil
+}
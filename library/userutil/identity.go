@@ -1,14 +1,15 @@
 package userutil
 
-import "golang.org/x/crypto/bcrypt"
+import "github.com/soxft/openid-go/library/passwordutil"
 
 // GeneratePwd hash password
+// 使用 Password.Hasher 配置的算法, 算法与参数编码在结果中
 func GeneratePwd(password string) (string, error) {
-	str, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(str), err
+	return passwordutil.Hash(password)
 }
 
 // CheckPwd check if password is correct
 func CheckPwd(password, hash string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	_, err := passwordutil.Verify(password, hash)
+	return err
 }
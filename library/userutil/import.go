@@ -0,0 +1,149 @@
+package userutil
+
+import (
+	"strings"
+
+	"github.com/soxft/openid-go/app/model"
+	"github.com/soxft/openid-go/library/passwordutil"
+	"github.com/soxft/openid-go/library/toolutil"
+	"gorm.io/gorm"
+)
+
+// 导入冲突原因
+const (
+	ConflictInvalidUsername = "invalid_username"
+	ConflictInvalidEmail    = "invalid_email"
+	ConflictInvalidPassword = "invalid_password"
+	ConflictInvalidRegTime  = "invalid_reg_time"
+	ConflictUsernameExists  = "username_exists"
+	ConflictEmailExists     = "email_exists"
+)
+
+// ImportBatch
+// @description 在一个事务中导入一批账号, 校验失败或与已有账号冲突的记录会被跳过并返回
+// 返回成功导入的数量; 发生数据库错误时整批回滚
+func ImportBatch(db *gorm.DB, records []ImportRecord) (int, []ImportConflict, error) {
+	var conflicts []ImportConflict
+	var valid []ImportRecord
+
+	// 同一批次内的重复也视为冲突
+	seenUsername := make(map[string]bool)
+	seenEmail := make(map[string]bool)
+	for _, r := range records {
+		reason := validateImportRecord(r)
+		if reason == "" && seenUsername[strings.ToLower(r.Username)] {
+			reason = ConflictUsernameExists
+		}
+		if reason == "" && seenEmail[strings.ToLower(r.Email)] {
+			reason = ConflictEmailExists
+		}
+		if reason != "" {
+			conflicts = append(conflicts, ImportConflict{Record: r, Reason: reason})
+			continue
+		}
+		seenUsername[strings.ToLower(r.Username)] = true
+		seenEmail[strings.ToLower(r.Email)] = true
+		valid = append(valid, r)
+	}
+	if len(valid) == 0 {
+		return 0, conflicts, nil
+	}
+
+	imported := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		existUsername, existEmail, err := existingIdentities(tx, valid)
+		if err != nil {
+			return err
+		}
+
+		var accounts []model.Account
+		for _, r := range valid {
+			if existUsername[strings.ToLower(r.Username)] {
+				conflicts = append(conflicts, ImportConflict{Record: r, Reason: ConflictUsernameExists})
+				continue
+			}
+			if existEmail[strings.ToLower(r.Email)] {
+				conflicts = append(conflicts, ImportConflict{Record: r, Reason: ConflictEmailExists})
+				continue
+			}
+
+			password := r.PasswordHash
+			if password == "" {
+				if password, err = GeneratePwd(r.Password); err != nil {
+					return err
+				}
+			}
+			accounts = append(accounts, model.Account{
+				Username: r.Username,
+				Password: password,
+				Email:    r.Email,
+				RegTime:  r.RegTime,
+				RegIp:    r.RegIp,
+				LastTime: r.RegTime,
+				LastIp:   r.RegIp,
+				Role:     model.RoleUser,
+			})
+		}
+		if len(accounts) == 0 {
+			return nil
+		}
+
+		if err := tx.CreateInBatches(&accounts, 100).Error; err != nil {
+			return err
+		}
+		for _, account := range accounts {
+			if err := RecordPasswordHistory(tx, account.ID, account.Password); err != nil {
+				return err
+			}
+		}
+		imported = len(accounts)
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return imported, conflicts, nil
+}
+
+// validateImportRecord 返回不符合要求的原因, 合法时返回空字符串
+func validateImportRecord(r ImportRecord) string {
+	if !toolutil.IsUserName(r.Username) {
+		return ConflictInvalidUsername
+	}
+	if !toolutil.IsEmail(r.Email) {
+		return ConflictInvalidEmail
+	}
+	// 已有哈希必须可识别; 明文密码不检查密码策略, 以免无法迁移旧账号
+	if r.PasswordHash != "" && !passwordutil.Recognized(r.PasswordHash) {
+		return ConflictInvalidPassword
+	}
+	if r.PasswordHash == "" && r.Password == "" {
+		return ConflictInvalidPassword
+	}
+	return ""
+}
+
+// existingIdentities 查询已存在的用户名和邮箱 (小写), 不区分大小写比较, 与数据库的排序规则无关
+func existingIdentities(tx *gorm.DB, records []ImportRecord) (map[string]bool, map[string]bool, error) {
+	usernames := make([]string, 0, len(records))
+	emails := make([]string, 0, len(records))
+	for _, r := range records {
+		usernames = append(usernames, strings.ToLower(r.Username))
+		emails = append(emails, strings.ToLower(r.Email))
+	}
+
+	var exists []model.Account
+	if err := tx.Model(&model.Account{}).Select("username, email").
+		Where("LOWER(username) IN ? OR LOWER(email) IN ?", usernames, emails).
+		Find(&exists).Error; err != nil {
+		return nil, nil, err
+	}
+
+	existUsername := make(map[string]bool, len(exists))
+	existEmail := make(map[string]bool, len(exists))
+	for _, a := range exists {
+		existUsername[strings.ToLower(a.Username)] = true
+		existEmail[strings.ToLower(a.Email)] = true
+	}
+	return existUsername, existEmail, nil
+}
@@ -0,0 +1,45 @@
+package userutil
+
+import (
+	"testing"
+
+	"github.com/soxft/openid-go/app/model"
+)
+
+func TestImportBatchConflicts(t *testing.T) {
+	e := setup(t)
+	e.createAccount(t, "alice01")
+	// 早期注册的账号可能保存了大写的邮箱
+	if err := e.db.Create(&model.Account{Username: "dave01", Email: "Dave@Example.com", Role: model.RoleUser}).Error; err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+
+	records := []ImportRecord{
+		{Line: 2, Username: "ALICE01", Email: "new@example.com", Password: "Imported-pass-1"},
+		{Line: 3, Username: "bob01", Email: "dave@example.com", Password: "Imported-pass-1"},
+		{Line: 4, Username: "carol01", Email: "carol@example.com", Password: "Imported-pass-1"},
+		{Line: 5, Username: "Carol01", Email: "carol2@example.com", Password: "Imported-pass-1"},
+	}
+	imported, conflicts, err := ImportBatch(e.db, records)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if imported != 1 {
+		t.Fatalf("imported = %d, want 1", imported)
+	}
+
+	// 与已有账号比较时不区分大小写
+	reasons := map[int]string{}
+	for _, c := range conflicts {
+		reasons[c.Record.Line] = c.Reason
+	}
+	want := map[int]string{2: ConflictUsernameExists, 3: ConflictEmailExists, 5: ConflictUsernameExists}
+	for line, reason := range want {
+		if reasons[line] != reason {
+			t.Errorf("line %d reason = %q, want %q", line, reasons[line], reason)
+		}
+	}
+	if len(reasons) != len(want) {
+		t.Errorf("conflicts = %v", reasons)
+	}
+}
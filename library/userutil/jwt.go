@@ -2,17 +2,17 @@ package userutil
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/redis/go-redis/v9"
 	"github.com/soxft/openid-go/app/model"
 	"github.com/soxft/openid-go/config"
-	"github.com/soxft/openid-go/library/toolutil"
-	"github.com/soxft/openid-go/process/dbutil"
-	"github.com/soxft/openid-go/process/redisutil"
+	"github.com/soxft/openid-go/library/mq"
+	"github.com/soxft/openid-go/library/randutil"
 	"gorm.io/gorm"
 	"log"
 	"regexp"
+	"strconv"
 	"time"
 )
 
@@ -27,10 +27,10 @@ func GetJwtFromAuth(Authorization string) string {
 }
 
 // GenerateJwt
-// @description generate JWT token for user
-func GenerateJwt(userId int, clientIp string) (string, error) {
+// @description generate JWT token for user, 同时记录登录历史
+func GenerateJwt(db *gorm.DB, rdb redis.Cmdable, q mq.MessageQueue, userId int, meta LoginMeta) (string, error) {
 	var userInfo model.Account
-	err := dbutil.D.Model(model.Account{}).Select("id, username, email, last_time, last_ip").Where(model.Account{ID: userId}).Take(&userInfo).Error
+	err := db.Model(model.Account{}).Select("id, username, email, last_time, last_ip").Where(model.Account{ID: userId}).Take(&userInfo).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return "", nil
 	} else if err != nil {
@@ -39,35 +39,44 @@ func GenerateJwt(userId int, clientIp string) (string, error) {
 
 	timeNow := time.Now().Unix()
 
-	uInfo := UserInfo{
-		UserId:   userId,
-		Username: userInfo.Username,
-		Email:    userInfo.Email,
-		LastTime: timeNow,
-	}
 	// update last login info
-	setUserLastLogin(userInfo.ID, timeNow, clientIp)
+	setUserLastLogin(db, userInfo.ID, timeNow, meta.Ip)
+	recordLogin(context.Background(), db, rdb, q, userInfo, meta, timeNow)
 
-	return jwt.NewWithClaims(jwt.SigningMethodHS512, JwtClaims{
-		ID:       generateJti(uInfo),
-		ExpireAt: time.Now().Add(24 * 30 * time.Hour).Unix(),
-		IssuedAt: time.Now().Unix(),
+	claims := JwtClaims{
+		ID:       generateJti(),
+		ExpireAt: time.Now().Add(jwtTTL).Unix(),
+		IssuedAt: timeNow,
 		Issuer:   config.Server.Title,
 		Username: userInfo.Username,
 		UserId:   userId,
 		Email:    userInfo.Email,
 		LastTime: timeNow,
-	}).SignedString([]byte(config.Jwt.Secret))
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString([]byte(config.Jwt.Secret))
+	if err != nil {
+		return "", err
+	}
+
+	recordSession(context.Background(), rdb, userId, Session{
+		Jti:       claims.ID,
+		Ip:        meta.Ip,
+		UserAgent: meta.UserAgent,
+		Method:    meta.Method,
+		IssuedAt:  claims.IssuedAt,
+		ExpireAt:  claims.ExpireAt,
+	})
+	return token, nil
 }
 
 // CheckPermission
 // @description check user permission
-func CheckPermission(ctx context.Context, _jwt string) (UserInfo, error) {
+func CheckPermission(ctx context.Context, rdb redis.Cmdable, _jwt string) (UserInfo, error) {
 	JwtClaims, err := JwtDecode(_jwt)
 	if err != nil {
 		return UserInfo{}, err
 	}
-	if checkJti(ctx, JwtClaims.ID) != nil {
+	if checkJti(ctx, rdb, JwtClaims) != nil {
 		return UserInfo{}, ErrJwtExpired
 	}
 	return UserInfo{
@@ -75,6 +84,7 @@ func CheckPermission(ctx context.Context, _jwt string) (UserInfo, error) {
 		Username: JwtClaims.Username,
 		Email:    JwtClaims.Email,
 		LastTime: JwtClaims.LastTime,
+		Jti:      JwtClaims.ID,
 	}, nil
 }
 
@@ -97,13 +107,26 @@ func JwtDecode(_jwt string) (JwtClaims, error) {
 
 // SetJwtExpire
 // @description 标记JWT过期
-func SetJwtExpire(c context.Context, _jwt string) error {
+func SetJwtExpire(c context.Context, rdb redis.Cmdable, _jwt string) error {
 	JwtClaims, _ := JwtDecode(_jwt)
-	_redis := redisutil.RDB
 
-	ttl := JwtClaims.ExpireAt - time.Now().Unix()
+	if err := expireJti(c, rdb, JwtClaims.ID, JwtClaims.ExpireAt); err != nil {
+		return err
+	}
+	forgetSession(c, rdb, JwtClaims.UserId, JwtClaims.ID)
+	return nil
+}
+
+// expireJti 标记 jti 过期, 标记保留至 token 自然过期
+func expireJti(c context.Context, rdb redis.Cmdable, jti string, expireAt int64) error {
+	_redis := rdb
+
+	ttl := expireAt - time.Now().Unix()
+	if ttl <= 0 {
+		return nil
+	}
 
-	err := _redis.SetEx(c, getJwtExpiredKey(JwtClaims.ID), "1", time.Duration(ttl)).Err()
+	err := _redis.SetEx(c, getJwtExpiredKey(jti), "1", time.Duration(ttl)*time.Second).Err()
 	if err != nil {
 		log.Printf("[ERROR] SetJwtExpire: %s", err.Error())
 		return errors.New("set jwt expire error")
@@ -113,37 +136,42 @@ func SetJwtExpire(c context.Context, _jwt string) error {
 }
 
 // checkJti
-func checkJti(ctx context.Context, jti string) error {
-	_redis := redisutil.RDB
+// jti 被单独标记过期, 或签发时间早于全局吊销时间时返回 ErrJwtExpired
+func checkJti(ctx context.Context, rdb redis.Cmdable, claims JwtClaims) error {
+	_redis := rdb
 
-	expired, err := _redis.Exists(ctx, getJwtExpiredKey(jti)).Result()
+	values, err := _redis.MGet(ctx, getJwtExpiredKey(claims.ID), getJwtNotBeforeKey()).Result()
 	if err != nil {
 		log.Printf("[ERROR] checkJti: %s", err.Error())
 		return errors.New("check jti error")
 	}
-	if expired == 1 {
+	if values[0] != nil {
 		return ErrJwtExpired
 	}
+	if notBefore, ok := values[1].(string); ok {
+		if ts, _ := strconv.ParseInt(notBefore, 10, 64); claims.IssuedAt < ts {
+			return ErrJwtExpired
+		}
+	}
 
 	return nil
 }
 
 // generateJti 创建 Jti
-func generateJti(user UserInfo) string {
-	JtiJson, _ := json.Marshal(map[string]string{
-		"username": user.Username,
-		"randStr":  toolutil.RandStr(32),
-		"time":     time.Now().Format("150405"),
-	})
-	_jti := toolutil.Md5(string(JtiJson))
-	return _jti
+func generateJti() string {
+	return randutil.ID()
 }
 
-func setUserLastLogin(userId int, lastTime int64, lastIp string) {
-	dbutil.D.Model(&model.Account{}).Where(model.Account{ID: userId}).Updates(&model.Account{LastTime: lastTime, LastIp: lastIp})
+func setUserLastLogin(db *gorm.DB, userId int, lastTime int64, lastIp string) {
+	db.Model(&model.Account{}).Where(model.Account{ID: userId}).Updates(&model.Account{LastTime: lastTime, LastIp: lastIp})
 }
 
 // getJwtExpiredKey
 func getJwtExpiredKey(jti string) string {
 	return config.RedisPrefix + ":jti:expired:" + jti
 }
+
+// getJwtNotBeforeKey 全局吊销时间, 早于该时间签发的 JWT 全部失效
+func getJwtNotBeforeKey() string {
+	return config.RedisPrefix + ":jwt:not_before"
+}
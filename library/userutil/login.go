@@ -0,0 +1,163 @@
+package userutil
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"html"
+	"log"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/soxft/openid-go/app/model"
+	"github.com/soxft/openid-go/config"
+	"github.com/soxft/openid-go/library/mailutil"
+	"github.com/soxft/openid-go/library/mq"
+	"github.com/soxft/openid-go/library/randutil"
+	"github.com/soxft/openid-go/library/toolutil"
+	"gorm.io/gorm"
+)
+
+const loginDenyTTL = 7 * 24 * time.Hour
+
+var uaVersionReg = regexp.MustCompile(`[\d._]+`)
+
+// recordLogin
+// 记录登录历史, 若为新设备或新网络则发送提醒邮件
+func recordLogin(ctx context.Context, db *gorm.DB, rdb redis.Cmdable, q mq.MessageQueue, account model.Account, meta LoginMeta, now int64) {
+	history := model.LoginHistory{
+		UserId:     account.ID,
+		Ip:         meta.Ip,
+		Network:    networkOf(meta.Ip),
+		UserAgent:  meta.UserAgent,
+		DeviceHash: deviceHash(meta.UserAgent),
+		Method:     meta.Method,
+		CreatedAt:  now,
+	}
+	if len([]rune(history.UserAgent)) > 255 {
+		history.UserAgent = string([]rune(history.UserAgent)[:255])
+	}
+
+	newDevice, newNetwork, err := detectNewLogin(db, history)
+	if err != nil {
+		log.Printf("[ERROR] recordLogin: %v", err)
+	}
+
+	if err := db.Create(&history).Error; err != nil {
+		log.Printf("[ERROR] recordLogin: %v", err)
+	}
+
+	if newDevice || newNetwork {
+		sendLoginAlert(ctx, rdb, q, account, history, newDevice, newNetwork)
+	}
+}
+
+// detectNewLogin 与历史记录比对; 首次登录 (无历史) 不视为异常
+func detectNewLogin(db *gorm.DB, h model.LoginHistory) (newDevice, newNetwork bool, err error) {
+	var total int64
+	if err = db.Model(&model.LoginHistory{}).Where("user_id = ?", h.UserId).Count(&total).Error; err != nil || total == 0 {
+		return false, false, err
+	}
+
+	var count int64
+	if err = db.Model(&model.LoginHistory{}).Where("user_id = ? AND device_hash = ?", h.UserId, h.DeviceHash).Count(&count).Error; err != nil {
+		return false, false, err
+	}
+	newDevice = count == 0
+
+	if err = db.Model(&model.LoginHistory{}).Where("user_id = ? AND network = ?", h.UserId, h.Network).Count(&count).Error; err != nil {
+		return false, false, err
+	}
+	newNetwork = count == 0
+
+	return newDevice, newNetwork, nil
+}
+
+// sendLoginAlert 发送登录提醒, 附带 "不是我本人" 链接
+func sendLoginAlert(ctx context.Context, rdb redis.Cmdable, q mq.MessageQueue, account model.Account, h model.LoginHistory, newDevice, newNetwork bool) {
+	token := randutil.Base62(32)
+	if err := rdb.SetEx(ctx, getLoginDenyKey(token), account.ID, loginDenyTTL).Err(); err != nil {
+		log.Printf("[ERROR] sendLoginAlert: %v", err)
+		return
+	}
+
+	var reasons []string
+	if newDevice {
+		reasons = append(reasons, "新设备")
+	}
+	if newNetwork {
+		reasons = append(reasons, "新网络")
+	}
+
+	denyUrl := strings.TrimRight(config.Server.FrontUrl, "/") + "/login/deny?token=" + token
+	_msg, _ := json.Marshal(mailutil.Mail{
+		ToAddress: account.Email,
+		Subject:   "新的登录提醒",
+		Content: "您的账号 " + account.Username + " 于 " + time.Unix(h.CreatedAt, 0).Format("2006-01-02 15:04:05") + " 在" + strings.Join(reasons, "、") + "上登录.<br>" +
+			"IP: " + html.EscapeString(h.Ip) + "<br>设备: " + html.EscapeString(h.UserAgent) + "<br><br>" +
+			"如果不是您本人操作, 请访问以下链接, 我们将退出所有设备并重置您的密码: <a href=\"" + denyUrl + "\">" + denyUrl + "</a>",
+		Typ: "loginAlert",
+	})
+	_ = q.Publish("mail", string(_msg), 0)
+}
+
+// DenyLogin
+// @description 用户通过提醒邮件确认 "不是我本人": 吊销全部会话并强制重置密码, 返回用户 ID
+func DenyLogin(ctx context.Context, db *gorm.DB, rdb redis.Cmdable, q mq.MessageQueue, token string) (int, error) {
+	userId, err := rdb.GetDel(ctx, getLoginDenyKey(token)).Int()
+	if errors.Is(err, redis.Nil) {
+		return 0, ErrLoginDenyTokenInvalid
+	} else if err != nil {
+		log.Printf("[ERROR] DenyLogin: %v", err)
+		return 0, ErrDatabase
+	}
+
+	return userId, ForcePasswordReset(ctx, db, rdb, q, userId)
+}
+
+// ListLoginHistory
+// @description 分页获取登录历史, 按时间倒序
+func ListLoginHistory(db *gorm.DB, userId, limit, offset int) ([]LoginRecord, int64, error) {
+	query := db.Model(&model.LoginHistory{}).Where("user_id = ?", userId)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		log.Printf("[ERROR] ListLoginHistory: %v", err)
+		return nil, 0, ErrDatabase
+	}
+
+	records := []LoginRecord{}
+	if err := query.Order("id desc").Limit(limit).Offset(offset).Scan(&records).Error; err != nil {
+		log.Printf("[ERROR] ListLoginHistory: %v", err)
+		return nil, 0, ErrDatabase
+	}
+	return records, total, nil
+}
+
+// networkOf 将 IP 归并到所在网段, IPv4 取 /24, IPv6 取 /48
+func networkOf(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String() + "/24"
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String() + "/48"
+}
+
+// deviceHash 设备指纹, 去掉 UA 中的版本号, 避免浏览器升级后被识别为新设备
+func deviceHash(userAgent string) string {
+	normalized := uaVersionReg.ReplaceAllString(strings.ToLower(userAgent), "")
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:16])
+}
+
+func getLoginDenyKey(token string) string {
+	return config.RedisPrefix + ":login:deny:" + toolutil.Md5(token)
+}
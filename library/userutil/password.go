@@ -0,0 +1,108 @@
+package userutil
+
+import (
+	"log"
+	"time"
+
+	"github.com/soxft/openid-go/app/model"
+	"github.com/soxft/openid-go/config"
+	"github.com/soxft/openid-go/library/passwordutil"
+	"gorm.io/gorm"
+)
+
+// ValidatePassword
+// @description 按密码策略检查新密码, 不符合时返回 *passwordutil.PolicyError
+// userId 为 0 时 (注册) 不检查历史密码
+func ValidatePassword(db *gorm.DB, userId int, username, email, password string) error {
+	result := passwordutil.Check(password, passwordutil.Subject{Username: username, Email: email})
+
+	if userId > 0 && config.Password.History > 0 {
+		reused, err := isRecentPassword(db, userId, password)
+		if err != nil {
+			return err
+		}
+		if reused {
+			result.Add(passwordutil.ReasonReused, "不能使用最近用过的密码")
+		}
+	}
+
+	return result.OrNil()
+}
+
+// SetPassword
+// @description 修改用户密码并记录到历史密码
+func SetPassword(db *gorm.DB, userId int, password string) error {
+	hash, err := GeneratePwd(password)
+	if err != nil {
+		log.Printf("[ERROR] SetPassword: %v", err)
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.Account{}).Where(model.Account{ID: userId}).Update("password", hash)
+		if result.Error != nil {
+			log.Printf("[ERROR] SetPassword: %v", result.Error)
+			return ErrDatabase
+		} else if result.RowsAffected == 0 {
+			return ErrUserNotFound
+		}
+		return RecordPasswordHistory(tx, userId, hash)
+	})
+}
+
+// RecordPasswordHistory
+// @description 记录历史密码, 只保留最近 Password.History 条
+func RecordPasswordHistory(tx *gorm.DB, userId int, hash string) error {
+	keep := config.Password.History
+	if keep <= 0 {
+		return nil
+	}
+
+	if err := tx.Create(&model.PasswordHistory{
+		UserId:    userId,
+		Password:  hash,
+		CreatedAt: time.Now().Unix(),
+	}).Error; err != nil {
+		log.Printf("[ERROR] RecordPasswordHistory: %v", err)
+		return ErrDatabase
+	}
+
+	var expired []int64
+	if err := tx.Model(&model.PasswordHistory{}).Where("user_id = ?", userId).
+		Order("id desc").Offset(keep).Limit(100).Pluck("id", &expired).Error; err != nil {
+		log.Printf("[ERROR] RecordPasswordHistory: %v", err)
+		return ErrDatabase
+	}
+	if len(expired) > 0 {
+		if err := tx.Where("id IN ?", expired).Delete(&model.PasswordHistory{}).Error; err != nil {
+			log.Printf("[ERROR] RecordPasswordHistory: %v", err)
+			return ErrDatabase
+		}
+	}
+	return nil
+}
+
+// isRecentPassword 是否与当前密码或最近 Password.History 次使用过的密码相同
+func isRecentPassword(db *gorm.DB, userId int, password string) (bool, error) {
+	var hashes []string
+	if err := db.Model(&model.PasswordHistory{}).Where("user_id = ?", userId).
+		Order("id desc").Limit(config.Password.History).Pluck("password", &hashes).Error; err != nil {
+		log.Printf("[ERROR] isRecentPassword: %v", err)
+		return false, ErrDatabase
+	}
+
+	// 启用历史记录前设置的密码不在历史表中
+	var current string
+	if err := db.Model(&model.Account{}).Select("password").Where(model.Account{ID: userId}).Take(&current).Error; err != nil {
+		log.Printf("[ERROR] isRecentPassword: %v", err)
+		return false, ErrDatabase
+	}
+	hashes = append(hashes, current)
+
+	for _, hash := range hashes {
+		if CheckPwd(password, hash) == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,93 @@
+package userutil
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/soxft/openid-go/app/model"
+	"github.com/soxft/openid-go/config"
+	"github.com/soxft/openid-go/library/passwordutil"
+)
+
+func setPasswordConfig(t *testing.T, c config.PasswordConfig) {
+	t.Helper()
+
+	old := config.Password
+	config.Password = c
+	t.Cleanup(func() { config.Password = old })
+}
+
+// reasons ValidatePassword 返回的原因码, 通过时为 nil
+func reasons(t *testing.T, err error) []string {
+	t.Helper()
+
+	if err == nil {
+		return nil
+	}
+	var policy *passwordutil.PolicyError
+	if !errors.As(err, &policy) {
+		t.Fatalf("err = %v, want *PolicyError", err)
+	}
+	var list []string
+	for _, v := range policy.Violations {
+		list = append(list, v.Code)
+	}
+	return list
+}
+
+func TestValidatePassword(t *testing.T) {
+	e := setup(t)
+	setPasswordConfig(t, config.PasswordConfig{
+		MinLength:        8,
+		MaxLength:        64,
+		MinClasses:       2,
+		DisallowPersonal: true,
+		History:          2,
+		BreachedDir:      "../passwordutil/testdata/breached",
+		BcryptCost:       4,
+	})
+
+	userId, err := Register(e.db, model.Account{Username: "alice01", Email: "liddell@example.com"}, "First-pass-1")
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	// 当前密码为 Third-pass-3, 历史只保留最近 2 次: Third-pass-3, Second-pass-2
+	for _, password := range []string{"Second-pass-2", "Third-pass-3"} {
+		if err := SetPassword(e.db, userId, password); err != nil {
+			t.Fatalf("set password: %v", err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		userId   int
+		password string
+		want     []string
+	}{
+		{name: "ok", userId: userId, password: "Fourth-pass-4"},
+		{name: "too short", userId: userId, password: "Ab-1", want: []string{passwordutil.ReasonTooShort}},
+		{name: "too few classes", userId: userId, password: "lowercaseonly", want: []string{passwordutil.ReasonTooFewClasses}},
+		{name: "contains username", userId: userId, password: "Alice01-pass", want: []string{passwordutil.ReasonContainsUsername}},
+		{name: "contains email", userId: userId, password: "My-liddell-pass", want: []string{passwordutil.ReasonContainsEmail}},
+		{name: "breached", userId: userId, password: "P@ssw0rd", want: []string{passwordutil.ReasonBreached}},
+		{name: "current password", userId: userId, password: "Third-pass-3", want: []string{passwordutil.ReasonReused}},
+		{name: "within history depth", userId: userId, password: "Second-pass-2", want: []string{passwordutil.ReasonReused}},
+		{name: "beyond history depth", userId: userId, password: "First-pass-1"},
+		{name: "no history for new account", password: "Third-pass-3"},
+		{name: "reasons combined", userId: userId, password: "alice01", want: []string{passwordutil.ReasonTooShort, passwordutil.ReasonContainsUsername}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidatePassword(e.db, tc.userId, "alice01", "liddell@example.com", tc.password)
+			if got := reasons(t, err); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("ValidatePassword(%q) = %v, want %v", tc.password, got, tc.want)
+			}
+		})
+	}
+
+	// 关闭历史检查后可以重复使用
+	config.Password.History = 0
+	if err := ValidatePassword(e.db, userId, "alice01", "liddell@example.com", "Third-pass-3"); err != nil {
+		t.Fatalf("history disabled: %v", err)
+	}
+}
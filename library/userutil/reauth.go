@@ -0,0 +1,56 @@
+package userutil
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/soxft/openid-go/config"
+)
+
+// reauthTTL 二次验证后可执行敏感操作的时长
+const reauthTTL = 5 * time.Minute
+
+// 二次验证方式
+const (
+	ReauthMethodPassword = "password"
+	ReauthMethodPasskey  = "passkey"
+)
+
+// MarkReauthenticated
+// @description 记录会话 (jti) 刚完成二次验证, 返回过期时间
+func MarkReauthenticated(ctx context.Context, rdb redis.Cmdable, jti, method string) (time.Time, error) {
+	if jti == "" {
+		return time.Time{}, ErrSessionNotFound
+	}
+
+	expireAt := time.Now().Add(reauthTTL)
+	if err := rdb.Set(ctx, getReauthKey(jti), method, reauthTTL).Err(); err != nil {
+		log.Printf("[ERROR] MarkReauthenticated: %s", err.Error())
+		return time.Time{}, ErrDatabase
+	}
+	return expireAt, nil
+}
+
+// IsReauthenticated
+// @description 会话是否在 reauthTTL 内完成过二次验证
+func IsReauthenticated(ctx context.Context, rdb redis.Cmdable, jti string) (bool, error) {
+	if jti == "" {
+		return false, nil
+	}
+
+	err := rdb.Get(ctx, getReauthKey(jti)).Err()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	} else if err != nil {
+		log.Printf("[ERROR] IsReauthenticated: %s", err.Error())
+		return false, ErrDatabase
+	}
+	return true, nil
+}
+
+func getReauthKey(jti string) string {
+	return config.RedisPrefix + ":reauth:" + jti
+}
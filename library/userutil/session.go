@@ -0,0 +1,114 @@
+package userutil
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/soxft/openid-go/config"
+)
+
+// recordSession
+// 记录已签发的 JWT, 用于会话查看与批量吊销
+func recordSession(ctx context.Context, rdb redis.Cmdable, userId int, session Session) {
+	payload, _ := json.Marshal(session)
+
+	key := getSessionsKey(userId)
+	pipe := rdb.TxPipeline()
+	pipe.HSet(ctx, key, session.Jti, payload)
+	pipe.Expire(ctx, key, jwtTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("[ERROR] recordSession: %s", err.Error())
+	}
+}
+
+// forgetSession
+// 从会话列表中移除
+func forgetSession(ctx context.Context, rdb redis.Cmdable, userId int, jti string) {
+	rdb.HDel(ctx, getSessionsKey(userId), jti)
+}
+
+// ListSessions
+// @description 获取用户当前有效的会话, 按签发时间倒序
+func ListSessions(ctx context.Context, rdb redis.Cmdable, userId int) ([]Session, error) {
+	raw, err := rdb.HGetAll(ctx, getSessionsKey(userId)).Result()
+	if err != nil {
+		log.Printf("[ERROR] ListSessions: %s", err.Error())
+		return nil, ErrDatabase
+	}
+
+	notBefore, _ := rdb.Get(ctx, getJwtNotBeforeKey()).Int64()
+
+	now := time.Now().Unix()
+	sessions := make([]Session, 0, len(raw))
+	for jti, payload := range raw {
+		var session Session
+		if err := json.Unmarshal([]byte(payload), &session); err != nil || session.ExpireAt <= now || session.IssuedAt < notBefore {
+			forgetSession(ctx, rdb, userId, jti)
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].IssuedAt > sessions[j].IssuedAt
+	})
+	return sessions, nil
+}
+
+// RevokeSession
+// @description 吊销用户的指定会话
+func RevokeSession(ctx context.Context, rdb redis.Cmdable, userId int, jti string) error {
+	raw, err := rdb.HGet(ctx, getSessionsKey(userId), jti).Result()
+	if err != nil {
+		return ErrSessionNotFound
+	}
+
+	var session Session
+	if err := json.Unmarshal([]byte(raw), &session); err != nil {
+		forgetSession(ctx, rdb, userId, jti)
+		return ErrSessionNotFound
+	}
+
+	if err := expireJti(ctx, rdb, jti, session.ExpireAt); err != nil {
+		return err
+	}
+	forgetSession(ctx, rdb, userId, jti)
+	return nil
+}
+
+// RevokeAllSessions
+// @description 吊销用户的全部会话 (修改密码, 禁用账号等场景)
+func RevokeAllSessions(ctx context.Context, rdb redis.Cmdable, userId int) error {
+	sessions, err := ListSessions(ctx, rdb, userId)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if err := expireJti(ctx, rdb, session.Jti, session.ExpireAt); err != nil {
+			return err
+		}
+	}
+	rdb.Del(ctx, getSessionsKey(userId))
+	return nil
+}
+
+// RevokeEverySession
+// @description 吊销所有用户在此之前签发的会话 (如 JWT 密钥泄露), 标记保留至这些会话自然过期
+func RevokeEverySession(ctx context.Context, rdb redis.Cmdable) (int64, error) {
+	now := time.Now().Unix()
+	if err := rdb.Set(ctx, getJwtNotBeforeKey(), now, jwtTTL).Err(); err != nil {
+		log.Printf("[ERROR] RevokeEverySession: %s", err.Error())
+		return 0, ErrDatabase
+	}
+	return now, nil
+}
+
+func getSessionsKey(userId int) string {
+	return config.RedisPrefix + ":sessions:" + strconv.Itoa(userId)
+}
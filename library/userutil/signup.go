@@ -0,0 +1,139 @@
+package userutil
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/soxft/openid-go/app/model"
+	"github.com/soxft/openid-go/config"
+	"github.com/soxft/openid-go/library/randutil"
+	"github.com/soxft/openid-go/library/toolutil"
+	"gorm.io/gorm"
+)
+
+// RegisterPasswordless
+// @description 无密码注册: 创建未设置密码的账号, 随后需绑定 passkey 作为唯一凭证
+// 同一邮箱已有尚未绑定 passkey 的账号且用户名一致时复用该账号, 便于中断后重试
+// 调用前需校验邮箱验证码
+func RegisterPasswordless(db *gorm.DB, account model.Account) (int, error) {
+	existing, err := GetAccountByEmail(db, account.Email)
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		return 0, err
+	}
+	if err == nil && existing.Username == account.Username && existing.PendingSignup {
+		if pending, err := hasNoPasskey(db, existing.ID); err != nil {
+			return 0, err
+		} else if pending {
+			// 重新计时, 避免绑定过程中被当作超时注册释放
+			if err := db.Model(&model.Account{}).Where(model.Account{ID: existing.ID}).Update("reg_time", account.RegTime).Error; err != nil {
+				log.Printf("[ERROR] RegisterPasswordless: %v", err)
+				return 0, ErrDatabase
+			}
+			return existing.ID, nil
+		}
+	}
+
+	if err := RegisterCheck(db, account.Username, account.Email); err != nil {
+		return 0, err
+	}
+	account.PendingSignup = true
+	return Register(db, account, "")
+}
+
+// CreateSignupToken
+// @description 无密码注册完成前, 用于在绑定 passkey 时识别账号
+func CreateSignupToken(ctx context.Context, rdb redis.Cmdable, userId int) (string, error) {
+	token := randutil.Base62(32)
+	if err := rdb.SetEx(ctx, getSignupKey(token), userId, pendingSignupTTL()).Err(); err != nil {
+		log.Printf("[ERROR] CreateSignupToken: %v", err)
+		return "", ErrDatabase
+	}
+	return token, nil
+}
+
+// GetSignupToken
+// @description 获取注册凭据对应的用户 ID, 绑定失败时可继续使用
+func GetSignupToken(ctx context.Context, rdb redis.Cmdable, token string) (int, error) {
+	if token == "" {
+		return 0, ErrSignupTokenInvalid
+	}
+
+	userId, err := rdb.Get(ctx, getSignupKey(token)).Int()
+	if errors.Is(err, redis.Nil) {
+		return 0, ErrSignupTokenInvalid
+	} else if err != nil {
+		log.Printf("[ERROR] GetSignupToken: %v", err)
+		return 0, ErrDatabase
+	}
+	return userId, nil
+}
+
+// CompleteSignup
+// @description passkey 绑定成功后取消待完成标记并删除注册凭据
+// 标记未能清除时账号已有 passkey, 不会被 SignupSweeper 删除, 仅记录日志
+func CompleteSignup(ctx context.Context, db *gorm.DB, rdb redis.Cmdable, userId int, token string) {
+	if err := db.Model(&model.Account{}).Where(model.Account{ID: userId}).Update("pending_signup", false).Error; err != nil {
+		log.Printf("[ERROR] CompleteSignup: %v", err)
+	}
+	if err := rdb.Del(ctx, getSignupKey(token)).Err(); err != nil {
+		log.Printf("[ERROR] CompleteSignup: %v", err)
+	}
+}
+
+// SignupSweeper
+// @description 定期删除超时未完成的无密码注册, 释放其用户名与邮箱
+// 删除条件幂等, 多实例同时执行无副作用
+func SignupSweeper(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			sweepSignups(db)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// sweepSignups 只删除带有待完成标记且没有 passkey 的账号, 返回删除数量
+func sweepSignups(db *gorm.DB) int64 {
+	res := db.Where("pending_signup = ? AND reg_time <= ?", true, time.Now().Add(-pendingSignupTTL()).Unix()).
+		Where("NOT EXISTS (SELECT 1 FROM pass_keys WHERE pass_keys.user_id = accounts.id)").
+		Delete(&model.Account{})
+	if res.Error != nil {
+		log.Printf("[ERROR] sweepSignups: %v", res.Error)
+		return 0
+	}
+	if res.RowsAffected > 0 {
+		log.Printf("[INFO] released %d stale passwordless signups", res.RowsAffected)
+	}
+	return res.RowsAffected
+}
+
+// pendingSignupTTL 无密码注册需在此时间内完成 passkey 绑定, 超时后由 SignupSweeper 释放用户名与邮箱
+// 不短于 passkey 注册挑战的有效期
+func pendingSignupTTL() time.Duration {
+	return max(30*time.Minute, time.Duration(config.Passkey.RegisterTimeout)*time.Second)
+}
+
+// hasNoPasskey 账号是否尚未绑定 passkey
+func hasNoPasskey(db *gorm.DB, userId int) (bool, error) {
+	var count int64
+	if err := db.Model(&model.PassKey{}).Where("user_id = ?", userId).Count(&count).Error; err != nil {
+		log.Printf("[ERROR] hasNoPasskey: %v", err)
+		return false, ErrDatabase
+	}
+	return count == 0, nil
+}
+
+func getSignupKey(token string) string {
+	return config.RedisPrefix + ":signup:passkey:" + toolutil.Md5(token)
+}
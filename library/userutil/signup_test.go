@@ -0,0 +1,105 @@
+package userutil
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/soxft/openid-go/app/model"
+)
+
+// createPendingSignup 模拟一次无密码注册, age 为注册距今的时间
+func (e *env) createPendingSignup(t *testing.T, username string, age time.Duration) model.Account {
+	t.Helper()
+
+	userId, err := RegisterPasswordless(e.db, model.Account{
+		Username: username,
+		Email:    username + "@example.com",
+		RegTime:  time.Now().Add(-age).Unix(),
+	})
+	if err != nil {
+		t.Fatalf("register passwordless: %v", err)
+	}
+	account, err := GetAccount(e.db, userId)
+	if err != nil {
+		t.Fatalf("load account: %v", err)
+	}
+	if !account.PendingSignup {
+		t.Fatal("passwordless signup not marked pending")
+	}
+	return account
+}
+
+func (e *env) exists(t *testing.T, userId int) bool {
+	t.Helper()
+
+	var count int64
+	if err := e.db.Model(&model.Account{}).Where("id = ?", userId).Count(&count).Error; err != nil {
+		t.Fatalf("count account: %v", err)
+	}
+	return count > 0
+}
+
+func TestPendingSignupOccupiesUntilSwept(t *testing.T) {
+	e := setup(t)
+	stale := e.createPendingSignup(t, "gina001", time.Hour)
+
+	// 检查用户名 / 邮箱只读, 超时的待完成注册在清理前仍然占用
+	if exists, err := CheckUserNameExists(e.db, stale.Username); err != nil || !exists {
+		t.Fatalf("username exists = %v, %v", exists, err)
+	}
+	if err := RegisterCheck(e.db, "other01", stale.Email); !errors.Is(err, ErrEmailExists) {
+		t.Fatalf("register check err = %v, want ErrEmailExists", err)
+	}
+	if !e.exists(t, stale.ID) {
+		t.Fatal("pending account deleted by existence check")
+	}
+
+	if n := sweepSignups(e.db); n != 1 {
+		t.Fatalf("swept %d accounts, want 1", n)
+	}
+	if e.exists(t, stale.ID) {
+		t.Fatal("stale pending account not swept")
+	}
+	if err := RegisterCheck(e.db, stale.Username, stale.Email); err != nil {
+		t.Fatalf("register check after sweep: %v", err)
+	}
+}
+
+func TestSweepSignupsKeepsOtherAccounts(t *testing.T) {
+	e := setup(t)
+
+	fresh := e.createPendingSignup(t, "fresh01", time.Minute)
+	bound := e.createPendingSignup(t, "bound01", time.Hour)
+	completed := e.createPendingSignup(t, "done001", time.Hour)
+
+	// 标记未能清除但已绑定 passkey 的账号
+	if err := e.db.Create(&model.PassKey{UserID: bound.ID, CredentialID: "bound", PublicKey: "key", CreatedAt: 1, UpdatedAt: 1}).Error; err != nil {
+		t.Fatalf("create passkey: %v", err)
+	}
+	CompleteSignup(t.Context(), e.db, e.rdb, completed.ID, "token")
+
+	// 导入或历史遗留的无密码账号没有待完成标记
+	legacy := model.Account{Username: "legacy1", Email: "legacy@example.com", RegTime: time.Now().Add(-24 * time.Hour).Unix()}
+	if err := e.db.Create(&legacy).Error; err != nil {
+		t.Fatalf("create legacy account: %v", err)
+	}
+
+	if n := sweepSignups(e.db); n != 0 {
+		t.Fatalf("swept %d accounts, want 0", n)
+	}
+	for _, id := range []int{fresh.ID, bound.ID, completed.ID, legacy.ID} {
+		if !e.exists(t, id) {
+			t.Fatalf("account %d swept", id)
+		}
+	}
+
+	// 中断后重试复用待完成的账号并重新计时
+	userId, err := RegisterPasswordless(e.db, model.Account{Username: fresh.Username, Email: fresh.Email, RegTime: time.Now().Unix()})
+	if err != nil || userId != fresh.ID {
+		t.Fatalf("retry signup = %d, %v, want %d", userId, err, fresh.ID)
+	}
+	if _, err := RegisterPasswordless(e.db, model.Account{Username: completed.Username, Email: completed.Email}); !errors.Is(err, ErrUsernameExists) {
+		t.Fatalf("signup over completed account err = %v, want ErrUsernameExists", err)
+	}
+}
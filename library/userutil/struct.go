@@ -3,6 +3,15 @@ package userutil
 import (
 	"errors"
 	"github.com/golang-jwt/jwt/v4"
+	"time"
+)
+
+const jwtTTL = 30 * 24 * time.Hour
+
+// 登录方式
+const (
+	LoginMethodPassword = "password"
+	LoginMethodPasskey  = "passkey"
 )
 
 //type User struct {
@@ -32,17 +41,154 @@ type JwtClaims struct {
 	jwt.RegisteredClaims
 }
 
+// AdminUser 管理后台用户信息
+type AdminUser struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Role     string `json:"role"`
+	RegTime  int64  `json:"reg_time"`
+	RegIp    string `json:"reg_ip"`
+	LastTime int64  `json:"last_time"`
+	LastIp   string `json:"last_ip"`
+	DeleteAt int64  `json:"delete_at"`
+
+	SuspendedAt   int64  `json:"suspended_at"`
+	SuspendUntil  int64  `json:"suspend_until"`
+	SuspendReason string `json:"suspend_reason"`
+}
+
+// Suspension 账号封禁状态
+type Suspension struct {
+	SuspendedAt int64  `json:"suspended_at"`
+	Until       int64  `json:"until"` // 0 为永久
+	Reason      string `json:"reason"`
+}
+
+// LoginMeta 登录请求信息
+type LoginMeta struct {
+	Ip        string
+	UserAgent string
+	Method    string
+}
+
+// LoginRecord 登录历史
+type LoginRecord struct {
+	Ip        string `json:"ip"`
+	Network   string `json:"network"`
+	UserAgent string `json:"user_agent"`
+	Method    string `json:"method"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// Session 已签发的登录会话
+type Session struct {
+	Jti       string `json:"jti"`
+	Ip        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	Method    string `json:"method"`
+	IssuedAt  int64  `json:"issued_at"`
+	ExpireAt  int64  `json:"expire_at"`
+}
+
 type UserInfo struct {
 	Username string `json:"username"`
 	UserId   int    `json:"userId"`
 	Email    string `json:"email"`
 	LastTime int64  `json:"lastTime"`
+	Jti      string `json:"-"`
+}
+
+// ImportRecord 待导入的账号
+type ImportRecord struct {
+	Line         int // 在源文件中的位置, 用于冲突报告
+	Username     string
+	Email        string
+	Password     string // 明文密码, 与 PasswordHash 二选一
+	PasswordHash string // 已有哈希, 需为 passwordutil 可识别的格式
+	RegTime      int64
+	RegIp        string
+}
+
+// ImportConflict 未能导入的账号及原因
+type ImportConflict struct {
+	Record ImportRecord
+	Reason string
+}
+
+// AppDeleteNotice 用户注销时需要通知的应用
+type AppDeleteNotice struct {
+	AppId    string
+	AppName  string
+	OpenId   string
+	DevEmail string
 }
 
 var (
-	ErrEmailExists    = errors.New("mailExists")
-	ErrUsernameExists = errors.New("usernameExists")
-	ErrPasswd         = errors.New("password not correct")
-	ErrDatabase       = errors.New("database error")
-	ErrJwtExpired     = errors.New("jwt is expired")
+	ErrEmailExists          = errors.New("mailExists")
+	ErrUsernameExists       = errors.New("usernameExists")
+	ErrPasswd               = errors.New("password not correct")
+	ErrDatabase             = errors.New("database error")
+	ErrJwtExpired           = errors.New("jwt is expired")
+	ErrDeletionScheduled    = errors.New("account deletion already scheduled")
+	ErrDeletionTokenInvalid = errors.New("deletion cancel token invalid")
+	ErrSessionNotFound      = errors.New("session not found")
+	ErrAccountSuspended     = errors.New("account suspended")
+	ErrUserNotFound         = errors.New("user not found")
+	ErrUsernameInvalid      = errors.New("invalid username")
+	ErrEmailInvalid         = errors.New("invalid email")
+	ErrRoleInvalid          = errors.New("invalid role")
+	ErrSignupTokenInvalid   = errors.New("signup token invalid")
+
+	ErrLoginDenyTokenInvalid = errors.New("login deny token invalid")
 )
+
+// UserExport 用户数据导出
+type UserExport struct {
+	Account        ExportAccount         `json:"account"`
+	Apps           []ExportApp           `json:"apps"`
+	Authorizations []ExportAuthorization `json:"authorizations"`
+	UniqueIds      []ExportUniqueId      `json:"unique_ids"`
+	Passkeys       []ExportPasskey       `json:"passkeys"`
+	LoginHistory   []LoginRecord         `json:"login_history"`
+}
+
+type ExportAccount struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	RegTime  int64  `json:"reg_time"`
+	RegIp    string `json:"reg_ip"`
+	LastTime int64  `json:"last_time"`
+	LastIp   string `json:"last_ip"`
+	DeleteAt int64  `json:"delete_at"`
+}
+
+type ExportApp struct {
+	AppId      string `json:"app_id"`
+	AppName    string `json:"app_name"`
+	AppGateway string `json:"app_gateway"`
+	CreateAt   int64  `json:"create_time"`
+}
+
+type ExportAuthorization struct {
+	AppId    string `json:"app_id"`
+	AppName  string `json:"app_name"`
+	OpenId   string `json:"open_id"`
+	CreateAt int64  `json:"create_time"`
+}
+
+type ExportUniqueId struct {
+	DevUserId int    `json:"dev_user_id"`
+	UniqueId  string `json:"unique_id"`
+	CreateAt  int64  `json:"create_time"`
+}
+
+type ExportPasskey struct {
+	ID         int    `json:"id"`
+	Remark     string `json:"remark"`
+	AAGUID     string `json:"aaguid" gorm:"column:aaguid"`
+	Transport  string `json:"transport"`
+	CreatedAt  int64  `json:"created_at"`
+	LastUsedAt int64  `json:"last_used_at"`
+}
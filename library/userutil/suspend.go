@@ -0,0 +1,101 @@
+package userutil
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/soxft/openid-go/app/model"
+	"github.com/soxft/openid-go/library/cacheutil"
+	"gorm.io/gorm"
+)
+
+// suspensionCache userId => Suspension, 未封禁的用户同样缓存, 避免每个请求都查库
+var suspensionCache = cacheutil.New[Suspension]("suspension")
+
+// Active
+// @description 封禁是否仍然有效
+func (s Suspension) Active(now time.Time) bool {
+	if s.SuspendedAt == 0 {
+		return false
+	}
+	return s.Until == 0 || s.Until > now.Unix()
+}
+
+// Suspend
+// @description 封禁账号, until 为 0 表示永久封禁; 同时吊销全部会话
+func Suspend(ctx context.Context, db *gorm.DB, rdb redis.Cmdable, userId int, reason string, until int64) error {
+	result := db.Model(&model.Account{}).Where(model.Account{ID: userId}).Updates(map[string]interface{}{
+		"suspended_at":   time.Now().Unix(),
+		"suspend_until":  until,
+		"suspend_reason": reason,
+	})
+	if result.Error != nil {
+		log.Printf("[ERROR] Suspend: %v", result.Error)
+		return ErrDatabase
+	} else if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	suspensionCache.Delete(ctx, rdb, strconv.Itoa(userId))
+	return RevokeAllSessions(ctx, rdb, userId)
+}
+
+// Unsuspend
+// @description 解除封禁
+func Unsuspend(ctx context.Context, db *gorm.DB, rdb redis.Cmdable, userId int) error {
+	result := db.Model(&model.Account{}).Where(model.Account{ID: userId}).Updates(map[string]interface{}{
+		"suspended_at":   0,
+		"suspend_until":  0,
+		"suspend_reason": "",
+	})
+	if result.Error != nil {
+		log.Printf("[ERROR] Unsuspend: %v", result.Error)
+		return ErrDatabase
+	} else if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	suspensionCache.Delete(ctx, rdb, strconv.Itoa(userId))
+	return nil
+}
+
+// GetSuspension
+// @description 获取账号封禁状态 (带缓存)
+func GetSuspension(ctx context.Context, db *gorm.DB, rdb redis.Cmdable, userId int) (Suspension, error) {
+	return suspensionCache.Get(ctx, rdb, strconv.Itoa(userId), func() (Suspension, error) {
+		var account model.Account
+		err := db.Select("suspended_at, suspend_until, suspend_reason").Where(model.Account{ID: userId}).Take(&account).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return Suspension{}, ErrUserNotFound
+		} else if err != nil {
+			log.Printf("[ERROR] GetSuspension: %v", err)
+			return Suspension{}, ErrDatabase
+		}
+		return suspensionOf(account), nil
+	})
+}
+
+// CheckSuspended
+// @description 账号处于封禁状态时返回 ErrAccountSuspended
+func CheckSuspended(ctx context.Context, db *gorm.DB, rdb redis.Cmdable, userId int) error {
+	suspension, err := GetSuspension(ctx, db, rdb, userId)
+	if err != nil {
+		return err
+	}
+	if suspension.Active(time.Now()) {
+		return ErrAccountSuspended
+	}
+	return nil
+}
+
+func suspensionOf(account model.Account) Suspension {
+	return Suspension{
+		SuspendedAt: account.SuspendedAt,
+		Until:       account.SuspendUntil,
+		Reason:      account.SuspendReason,
+	}
+}
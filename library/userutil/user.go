@@ -5,9 +5,9 @@ import (
 	"errors"
 	"github.com/soxft/openid-go/app/model"
 	"github.com/soxft/openid-go/library/mailutil"
+	"github.com/soxft/openid-go/library/mq"
+	"github.com/soxft/openid-go/library/passwordutil"
 	"github.com/soxft/openid-go/library/toolutil"
-	"github.com/soxft/openid-go/process/dbutil"
-	"github.com/soxft/openid-go/process/queueutil"
 	"gorm.io/gorm"
 	"log"
 	"time"
@@ -23,14 +23,14 @@ import (
 
 // RegisterCheck
 // @description Check users email or user if already exists
-func RegisterCheck(username, email string) error {
-	if exists, err := CheckUserNameExists(username); err != nil {
+func RegisterCheck(db *gorm.DB, username, email string) error {
+	if exists, err := CheckUserNameExists(db, username); err != nil {
 		return err
 	} else if exists {
 		return ErrUsernameExists
 	}
 
-	if exists, err := CheckEmailExists(email); err != nil {
+	if exists, err := CheckEmailExists(db, email); err != nil {
 		return err
 	} else if exists {
 		return ErrEmailExists
@@ -39,11 +39,85 @@ func RegisterCheck(username, email string) error {
 	return nil
 }
 
+// Register
+// @description 创建账号并记录历史密码, 调用前需完成合法性与重复检测
+// password 为空时创建无密码账号, 仅能通过 passkey 登录
+func Register(db *gorm.DB, account model.Account, password string) (int, error) {
+	var pwd string
+	if password != "" {
+		var err error
+		if pwd, err = GeneratePwd(password); err != nil {
+			log.Printf("[ERROR] Register: %v", err)
+			return 0, err
+		}
+	}
+	account.Password = pwd
+	if account.Role == "" {
+		account.Role = model.RoleUser
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&account).Error; err != nil {
+			return err
+		}
+		if pwd == "" {
+			return nil
+		}
+		return RecordPasswordHistory(tx, account.ID, pwd)
+	})
+	if err != nil {
+		log.Printf("[ERROR] Register: %v", err)
+		return 0, ErrDatabase
+	}
+	return account.ID, nil
+}
+
+// GetAccount
+// @description 获取账号
+func GetAccount(db *gorm.DB, userId int) (model.Account, error) {
+	var account model.Account
+	err := db.Where(model.Account{ID: userId}).Take(&account).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return account, ErrUserNotFound
+	} else if err != nil {
+		log.Printf("[ERROR] GetAccount: %v", err)
+		return account, ErrDatabase
+	}
+	return account, nil
+}
+
+// GetAccountByEmail
+// @description 通过邮箱获取账号
+func GetAccountByEmail(db *gorm.DB, email string) (model.Account, error) {
+	var account model.Account
+	err := db.Where(model.Account{Email: email}).Take(&account).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return account, ErrUserNotFound
+	} else if err != nil {
+		log.Printf("[ERROR] GetAccountByEmail: %v", err)
+		return account, ErrDatabase
+	}
+	return account, nil
+}
+
+// UpdateEmail
+// @description 修改邮箱
+func UpdateEmail(db *gorm.DB, userId int, email string) error {
+	result := db.Model(&model.Account{}).Where(model.Account{ID: userId}).Update("email", email)
+	if result.Error != nil {
+		log.Printf("[ERROR] UpdateEmail: %v", result.Error)
+		return ErrDatabase
+	} else if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
 // CheckUserNameExists
 // @description Check username if exists in database
-func CheckUserNameExists(username string) (bool, error) {
-	var ID int64
-	err := dbutil.D.Model(&model.Account{}).Select("id").Where(model.Account{Username: username}).First(&ID).Error
+func CheckUserNameExists(db *gorm.DB, username string) (bool, error) {
+	var account model.Account
+	err := db.Select("id").Where(model.Account{Username: username}).Take(&account).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return false, nil
 	} else if err != nil {
@@ -55,13 +129,13 @@ func CheckUserNameExists(username string) (bool, error) {
 
 // CheckEmailExists
 // @description Check email if exists in database
-func CheckEmailExists(email string) (bool, error) {
-	var ID string
-	err := dbutil.D.Model(&model.Account{}).Select("id").Where(&model.Account{Email: email}).Take(&ID).Error
+func CheckEmailExists(db *gorm.DB, email string) (bool, error) {
+	var account model.Account
+	err := db.Select("id").Where(&model.Account{Email: email}).Take(&account).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return false, nil
 	} else if err != nil {
-		log.Printf("[ERROR] CheckUserNameExists: %s", err.Error())
+		log.Printf("[ERROR] CheckEmailExists: %s", err.Error())
 		return false, errors.New("system error")
 	}
 	return true, nil
@@ -69,30 +143,70 @@ func CheckEmailExists(email string) (bool, error) {
 
 // CheckPassword
 // @description 验证用户登录
-// if return < 0  error, pwd error or server error
+// if return = 0  error, pwd error or server error
 // if return > 0  success, return user id
-func CheckPassword(username, password string) (int, error) {
-	var err error
+// 失败时不返回 user id, 审计日志需要的目标账号通过 FindLoginUserId 获取
+func CheckPassword(db *gorm.DB, username, password string) (int, error) {
 	var account model.Account
 
-	if toolutil.IsEmail(username) {
-		err = dbutil.D.Select("id, password").Where(model.Account{Email: username}).Take(&account).Error
-	} else {
-		err = dbutil.D.Select("id, password").Where(model.Account{Username: username}).Take(&account).Error
-	}
-
+	err := db.Select("id, password, suspended_at, suspend_until").Where(loginWhere(username)).Take(&account).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return 0, ErrPasswd
 	} else if err != nil {
 		log.Printf("[ERROR] CheckPassword: %v", err)
 		return 0, ErrDatabase
 	}
-	if CheckPwd(password, account.Password) != nil {
+	// 无密码账号只能使用 passkey 登录
+	if account.Password == "" {
 		return 0, ErrPasswd
 	}
+	rehash, err := passwordutil.Verify(password, account.Password)
+	if err != nil {
+		return 0, ErrPasswd
+	}
+	if rehash {
+		upgradePasswordHash(db, account.ID, password)
+	}
+	if suspensionOf(account).Active(time.Now()) {
+		return 0, ErrAccountSuspended
+	}
 	return account.ID, nil
 }
 
+// FindLoginUserId
+// @description 按登录名 (用户名或邮箱) 查找用户 ID, 用于登录失败时记录目标账号
+func FindLoginUserId(db *gorm.DB, username string) (int, error) {
+	var userId int
+	err := db.Model(&model.Account{}).Select("id").Where(loginWhere(username)).Take(&userId).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, ErrUserNotFound
+	} else if err != nil {
+		log.Printf("[ERROR] FindLoginUserId: %v", err)
+		return 0, ErrDatabase
+	}
+	return userId, nil
+}
+
+// loginWhere 登录名为邮箱时按邮箱查找, 否则按用户名
+func loginWhere(username string) model.Account {
+	if toolutil.IsEmail(username) {
+		return model.Account{Email: username}
+	}
+	return model.Account{Username: username}
+}
+
+// upgradePasswordHash 哈希算法或参数过时, 登录成功后重新计算; 失败不影响登录
+func upgradePasswordHash(db *gorm.DB, userId int, password string) {
+	hash, err := GeneratePwd(password)
+	if err != nil {
+		log.Printf("[ERROR] upgradePasswordHash: %v", err)
+		return
+	}
+	if err := db.Model(&model.Account{}).Where(model.Account{ID: userId}).Update("password", hash).Error; err != nil {
+		log.Printf("[ERROR] upgradePasswordHash: %v", err)
+	}
+}
+
 // CheckPasswordByUserId
 // @description 通过userid验证用户password
 //func CheckPasswordByUserId(userId int, password string) (bool, error) {
@@ -111,22 +225,22 @@ func CheckPassword(username, password string) (int, error) {
 //	return true, nil
 //}
 
-func PasswordChangeNotify(email string, timestamp time.Time) {
+func PasswordChangeNotify(q mq.MessageQueue, email string, timestamp time.Time) {
 	_msg, _ := json.Marshal(mailutil.Mail{
 		ToAddress: email,
 		Subject:   "您的密码已修改",
 		Content:   "您的密码已于" + timestamp.Format("2006-01-02 15:04:05") + "修改, 如果不是您本人操作, 请及时联系管理员",
 		Typ:       "passwordChangeNotify",
 	})
-	_ = queueutil.Q.Publish("mail", string(_msg), 5)
+	_ = q.Publish("mail", string(_msg), 5)
 }
 
-func EmailChangeNotify(email string, timestamp time.Time) {
+func EmailChangeNotify(q mq.MessageQueue, email string, timestamp time.Time) {
 	_msg, _ := json.Marshal(mailutil.Mail{
 		ToAddress: email,
 		Subject:   "您的邮箱已修改",
 		Content:   "您的邮箱已于" + timestamp.Format("2006-01-02 15:04:05") + "修改, 如果不是您本人操作, 请及时联系管理员",
 		Typ:       "emailChangeNotify",
 	})
-	_ = queueutil.Q.Publish("mail", string(_msg), 5)
+	_ = q.Publish("mail", string(_msg), 5)
 }
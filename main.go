@@ -1,7 +1,11 @@
 package main
 
-import "github.com/soxft/openid-go/core"
+import (
+	"os"
+
+	"github.com/soxft/openid-go/core"
+)
 
 func main() {
-	core.Init()
+	core.Run(os.Args[1:])
 }
@@ -2,23 +2,30 @@ package dbutil
 
 import (
 	"fmt"
-	"github.com/soxft/openid-go/app/model"
+	"github.com/glebarez/sqlite"
 	"github.com/soxft/openid-go/config"
+	"github.com/soxft/openid-go/process/dbutil/migration"
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 	"log"
 	"os"
+	"strings"
 	"time"
 )
 
+const (
+	DriverMysql    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSqlite   = "sqlite"
+)
+
 var D *gorm.DB
 
 func Init() {
-	m := config.Mysql
-	log.Printf("[INFO] Mysql trying connect to tcp://%s:%s/%s", m.User, m.Addr, m.Db)
-
-	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=%s", m.User, m.Pwd, m.Addr, m.Db, m.Charset)
+	driver, dsn := dsnFromConfig()
+	log.Printf("[INFO] Database trying connect to %s", driver)
 
 	var logMode = logger.Warn
 	if config.Server.Debug {
@@ -36,28 +43,92 @@ func Init() {
 	)
 
 	var err error
-	D, err = gorm.Open(mysql.Open(dsn), &gorm.Config{
+	D, err = Open(driver, dsn, &gorm.Config{
 		Logger: sqlLogger,
 	})
 	if err != nil {
-		log.Fatalf("mysql error: %v", err)
+		log.Fatalf("database error: %v", err)
 	}
 
 	sqlDb, err := D.DB()
 	if err != nil {
-		log.Fatalf("mysql get db error: %v", err)
+		log.Fatalf("database get db error: %v", err)
 	}
 
-	sqlDb.SetMaxOpenConns(m.MaxOpen)
-	sqlDb.SetMaxIdleConns(m.MaxIdle)
-	sqlDb.SetConnMaxLifetime(time.Duration(m.MaxLifetime) * time.Second)
+	d, m := config.Database, config.Mysql
+	sqlDb.SetMaxOpenConns(orDefault(d.MaxOpen, m.MaxOpen))
+	sqlDb.SetMaxIdleConns(orDefault(d.MaxIdle, m.MaxIdle))
+	sqlDb.SetConnMaxLifetime(time.Duration(orDefault(d.MaxLifetime, m.MaxLifetime)) * time.Second)
 	if err := sqlDb.Ping(); err != nil {
-		log.Fatalf("mysql connect error: %v", err)
+		log.Fatalf("database connect error: %v", err)
+	}
+
+	log.Printf("[INFO] Database connect success")
+}
+
+// Open 按驱动打开数据库
+func Open(driver, dsn string, cfg *gorm.Config) (*gorm.DB, error) {
+	switch driver {
+	case DriverMysql:
+		return gorm.Open(mysql.Open(dsn), cfg)
+	case DriverPostgres:
+		return gorm.Open(postgres.Open(dsn), cfg)
+	case DriverSqlite:
+		return gorm.Open(sqlite.Open(sqliteDsn(dsn)), cfg)
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
+	}
+}
+
+// dsnFromConfig 未配置 Database.Dsn 时, 兼容旧版本的 Mysql 配置
+func dsnFromConfig() (string, string) {
+	driver := strings.ToLower(config.Database.Driver)
+	if driver == "" {
+		driver = DriverMysql
+	}
+
+	dsn := config.Database.Dsn
+	if dsn == "" && driver == DriverMysql {
+		m := config.Mysql
+		dsn = fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=%s", m.User, m.Pwd, m.Addr, m.Db, m.Charset)
 	}
+	return driver, dsn
+}
+
+// sqliteDsn 未指定时开启 WAL 与 busy_timeout, 减少并发写入时的 database is locked
+func sqliteDsn(dsn string) string {
+	if strings.Contains(dsn, "_pragma=") {
+		return dsn
+	}
+
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+}
 
-	if err := D.AutoMigrate(model.Account{}, model.App{}, model.OpenId{}, model.UniqueId{}, model.PassKey{}); err != nil {
-		log.Fatalf("mysql migrate error: %v", err)
+func orDefault(v, def int) int {
+	if v > 0 {
+		return v
 	}
+	return def
+}
+
+// Migrator 表结构迁移, 见 process/dbutil/migration
+func Migrator(db *gorm.DB) *migration.Migrator {
+	return migration.New(db)
+}
 
-	log.Printf("[INFO] Mysql connect success")
+// CheckSchema 存在未执行的迁移时返回错误, 服务启动前调用
+func CheckSchema(db *gorm.DB) error {
+	m := Migrator(db)
+	pending, err := m.Pending()
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("database schema is behind: %d pending migrations (latest %d), run `openid-go migrate` first", len(pending), m.Latest())
+	}
+	return nil
 }
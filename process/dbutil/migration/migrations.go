@@ -0,0 +1,7 @@
+package migration
+
+// migrations 全部迁移, 新增迁移时追加到末尾, 已发布的迁移不可修改
+var migrations = []Migration{
+	v1Baseline,
+	v2PendingSignup,
+}
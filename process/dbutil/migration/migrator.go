@@ -0,0 +1,285 @@
+package migration
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/soxft/openid-go/library/randutil"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	lockPoll    = time.Second
+	lockStale   = 10 * time.Minute // 持锁进程异常退出后, 超过该时间的锁视为失效
+	lockRefresh = time.Minute      // 持锁期间刷新 locked_at 的间隔, 需远小于 lockStale
+)
+
+type Migrator struct {
+	db          *gorm.DB
+	migrations  []Migration
+	lockTimeout time.Duration
+	lockRefresh time.Duration
+}
+
+// New
+// @description 使用已注册的全部迁移创建 Migrator
+func New(db *gorm.DB) *Migrator {
+	return NewWith(db, migrations)
+}
+
+// NewWith
+// @description 使用指定的迁移列表创建 Migrator, 版本号必须唯一
+func NewWith(db *gorm.DB, list []Migration) *Migrator {
+	sorted := append([]Migration(nil), list...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Version == sorted[i-1].Version {
+			panic(fmt.Sprintf("duplicate migration version %d", sorted[i].Version))
+		}
+	}
+
+	return &Migrator{db: db, migrations: sorted, lockTimeout: time.Minute, lockRefresh: lockRefresh}
+}
+
+// Latest
+// @description 最新的迁移版本
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Status
+// @description 所有迁移的执行状态, 包括数据库中存在但当前程序未知的版本
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Status, 0, len(m.migrations))
+	known := make(map[int]bool, len(m.migrations))
+	for _, mg := range m.migrations {
+		known[mg.Version] = true
+		s := Status{Version: mg.Version, Name: mg.Name}
+		if row, ok := applied[mg.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = row.AppliedAt
+		}
+		result = append(result, s)
+	}
+	for version, row := range applied {
+		if !known[version] {
+			result = append(result, Status{Version: version, Name: row.Name, Applied: true, AppliedAt: row.AppliedAt})
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+	return result, nil
+}
+
+// Pending
+// @description 尚未执行的迁移
+func (m *Migrator) Pending() ([]Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	return m.pending(applied), nil
+}
+
+// Up
+// @description 依次执行未执行的迁移直到 target (包含), target 为 0 时执行全部
+func (m *Migrator) Up(target int) ([]Migration, error) {
+	if target != 0 && !m.known(target) {
+		return nil, ErrUnknownTarget
+	}
+
+	var done []Migration
+	err := m.withLock(func() error {
+		applied, err := m.applied()
+		if err != nil {
+			return err
+		}
+
+		for _, mg := range m.pending(applied) {
+			if target != 0 && mg.Version > target {
+				break
+			}
+
+			log.Printf("[INFO] migrating up %d %s", mg.Version, mg.Name)
+			err := m.db.Transaction(func(tx *gorm.DB) error {
+				if err := mg.Up(tx); err != nil {
+					return err
+				}
+				return tx.Create(&schemaMigration{Version: mg.Version, Name: mg.Name, AppliedAt: time.Now().Unix()}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d %s: %w", mg.Version, mg.Name, err)
+			}
+			done = append(done, mg)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down
+// @description 按版本倒序回滚最近执行的 steps 个迁移
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(func() error {
+		applied, err := m.applied()
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			mg := m.migrations[i]
+			if _, ok := applied[mg.Version]; !ok {
+				continue
+			}
+			if mg.Down == nil {
+				return fmt.Errorf("migration %d %s: %w", mg.Version, mg.Name, ErrIrreversible)
+			}
+
+			log.Printf("[INFO] migrating down %d %s", mg.Version, mg.Name)
+			err := m.db.Transaction(func(tx *gorm.DB) error {
+				if err := mg.Down(tx); err != nil {
+					return err
+				}
+				return tx.Delete(&schemaMigration{Version: mg.Version}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d %s: %w", mg.Version, mg.Name, err)
+			}
+			done = append(done, mg)
+		}
+		return nil
+	})
+	return done, err
+}
+
+func (m *Migrator) known(version int) bool {
+	for _, mg := range m.migrations {
+		if mg.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Migrator) pending(applied map[int]schemaMigration) []Migration {
+	var pending []Migration
+	for _, mg := range m.migrations {
+		if _, ok := applied[mg.Version]; !ok {
+			pending = append(pending, mg)
+		}
+	}
+	return pending
+}
+
+// applied 已执行的迁移, 版本表不存在时视为空
+func (m *Migrator) applied() (map[int]schemaMigration, error) {
+	result := make(map[int]schemaMigration)
+	if !m.db.Migrator().HasTable(&schemaMigration{}) {
+		return result, nil
+	}
+
+	var rows []schemaMigration
+	if err := m.db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		result[row.Version] = row
+	}
+	return result, nil
+}
+
+// withLock 获取迁移锁后执行 fn, 多个实例同时迁移时只有一个会执行, 其余等待后发现已无待执行的迁移
+// 执行期间定期刷新 locked_at, 耗时超过 lockStale 的迁移不会被其他实例视为失效而抢占
+func (m *Migrator) withLock(fn func() error) error {
+	// 多个实例同时首次启动时可能并发建表, 失败的一方再执行一次, 此时表已存在
+	if err := m.db.AutoMigrate(&schemaMigration{}, &schemaLock{}); err != nil {
+		if err := m.db.AutoMigrate(&schemaMigration{}, &schemaLock{}); err != nil {
+			return err
+		}
+	}
+	if err := m.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&schemaLock{ID: 1}).Error; err != nil {
+		return err
+	}
+
+	owner := lockOwner()
+	deadline := time.Now().Add(m.lockTimeout)
+	for {
+		now := time.Now().Unix()
+		result := m.db.Model(&schemaLock{}).
+			Where("id = ? AND (locked_at = 0 OR locked_at < ?)", 1, now-int64(lockStale/time.Second)).
+			Updates(map[string]interface{}{"owner": owner, "locked_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			return ErrLockTimeout
+		}
+		time.Sleep(lockPoll)
+	}
+
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		m.refreshLock(owner, stop)
+	}()
+
+	defer func() {
+		close(stop)
+		<-stopped
+
+		err := m.db.Model(&schemaLock{}).Where("id = ? AND owner = ?", 1, owner).
+			Updates(map[string]interface{}{"owner": "", "locked_at": 0}).Error
+		if err != nil {
+			log.Printf("[ERROR] release migration lock: %v", err)
+		}
+	}()
+	return fn()
+}
+
+// refreshLock 持锁期间定期刷新 locked_at, 直到 stop 关闭
+func (m *Migrator) refreshLock(owner string, stop <-chan struct{}) {
+	ticker := time.NewTicker(m.lockRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		result := m.db.Model(&schemaLock{}).Where("id = ? AND owner = ?", 1, owner).Update("locked_at", time.Now().Unix())
+		if result.Error != nil {
+			log.Printf("[ERROR] refresh migration lock: %v", result.Error)
+		} else if result.RowsAffected == 0 {
+			log.Printf("[ERROR] migration lock owned by %s was taken over by another instance", owner)
+		}
+	}
+}
+
+// lockOwner 持锁者标识, 便于排查残留的锁
+func lockOwner() string {
+	host, _ := os.Hostname()
+	return host + ":" + strconv.Itoa(os.Getpid()) + ":" + randutil.Base62(6)
+}
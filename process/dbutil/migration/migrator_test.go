@@ -0,0 +1,231 @@
+package migration
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	sqlDb, _ := db.DB()
+	sqlDb.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDb.Close() })
+	return db
+}
+
+type widgetV1 struct {
+	ID   int    `gorm:"autoIncrement;primaryKey"`
+	Name string `gorm:"type:varchar(32)"`
+}
+
+func (widgetV1) TableName() string { return "widgets" }
+
+type widget struct {
+	ID    int    `gorm:"autoIncrement;primaryKey"`
+	Name  string `gorm:"type:varchar(32)"`
+	Color string `gorm:"type:varchar(16)"`
+}
+
+func widgetMigrations() []Migration {
+	return []Migration{
+		{
+			Version: 1,
+			Name:    "create_widgets",
+			Up: func(tx *gorm.DB) error {
+				return tx.Migrator().CreateTable(&widgetV1{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable("widgets")
+			},
+		},
+		{
+			Version: 2,
+			Name:    "add_widget_color",
+			Up: func(tx *gorm.DB) error {
+				return tx.Migrator().AddColumn(&widget{}, "Color")
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropColumn(&widget{}, "Color")
+			},
+		},
+	}
+}
+
+func TestRegisteredMigrationsOnSqlite(t *testing.T) {
+	db := openTestDB(t)
+	m := New(db)
+
+	done, err := m.Up(0)
+	if err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if len(done) != len(migrations) {
+		t.Fatalf("applied %d migrations, want %d", len(done), len(migrations))
+	}
+
+	for _, table := range []string{"accounts", "apps", "open_id", "unique_id", "pass_keys", "audit_logs", "login_histories", "password_histories"} {
+		if !db.Migrator().HasTable(table) {
+			t.Errorf("table %s missing after migrate", table)
+		}
+	}
+
+	pending, err := m.Pending()
+	if err != nil || len(pending) != 0 {
+		t.Fatalf("pending after up = %v, %v", pending, err)
+	}
+	if done, err := m.Up(0); err != nil || len(done) != 0 {
+		t.Fatalf("second up applied %v, %v", done, err)
+	}
+}
+
+func TestUpToTargetAndDown(t *testing.T) {
+	db := openTestDB(t)
+	m := NewWith(db, widgetMigrations())
+
+	if done, err := m.Up(1); err != nil || len(done) != 1 {
+		t.Fatalf("up to 1 = %v, %v", done, err)
+	}
+	if db.Migrator().HasColumn(&widget{}, "Color") {
+		t.Fatal("migration 2 applied before target")
+	}
+
+	status, err := m.Status()
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if len(status) != 2 || !status[0].Applied || status[1].Applied {
+		t.Fatalf("status = %+v", status)
+	}
+
+	if _, err := m.Up(0); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if !db.Migrator().HasColumn(&widget{}, "Color") {
+		t.Fatal("color column missing after up")
+	}
+
+	if done, err := m.Down(1); err != nil || len(done) != 1 || done[0].Version != 2 {
+		t.Fatalf("down 1 = %v, %v", done, err)
+	}
+	if db.Migrator().HasColumn(&widget{}, "Color") {
+		t.Fatal("color column still present after down")
+	}
+	pending, _ := m.Pending()
+	if len(pending) != 1 || pending[0].Version != 2 {
+		t.Fatalf("pending after down = %v", pending)
+	}
+
+	if _, err := m.Up(3); !errors.Is(err, ErrUnknownTarget) {
+		t.Fatalf("up to unknown version err = %v", err)
+	}
+}
+
+func TestFailedMigrationIsNotRecorded(t *testing.T) {
+	db := openTestDB(t)
+	boom := errors.New("boom")
+	m := NewWith(db, []Migration{{
+		Version: 1,
+		Name:    "broken",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Exec("CREATE TABLE broken (id integer)").Error; err != nil {
+				return err
+			}
+			return boom
+		},
+	}})
+
+	if _, err := m.Up(0); !errors.Is(err, boom) {
+		t.Fatalf("up err = %v, want boom", err)
+	}
+	pending, err := m.Pending()
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("pending = %v, %v", pending, err)
+	}
+	if db.Migrator().HasTable("broken") {
+		t.Fatal("failed migration was not rolled back")
+	}
+}
+
+func TestIrreversibleMigrationStopsDown(t *testing.T) {
+	db := openTestDB(t)
+	m := NewWith(db, []Migration{{
+		Version: 1,
+		Name:    "noop",
+		Up:      func(tx *gorm.DB) error { return nil },
+	}})
+
+	if _, err := m.Up(0); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if _, err := m.Down(1); !errors.Is(err, ErrIrreversible) {
+		t.Fatalf("down err = %v, want ErrIrreversible", err)
+	}
+}
+
+func TestLockHeldByOtherInstance(t *testing.T) {
+	db := openTestDB(t)
+	m := NewWith(db, widgetMigrations())
+	m.lockTimeout = 0
+
+	if err := db.AutoMigrate(&schemaMigration{}, &schemaLock{}); err != nil {
+		t.Fatalf("migrate bookkeeping tables: %v", err)
+	}
+	db.Create(&schemaLock{ID: 1, Owner: "other", LockedAt: time.Now().Unix()})
+
+	if _, err := m.Up(0); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("up with held lock err = %v, want ErrLockTimeout", err)
+	}
+
+	// 持锁者异常退出, 锁过期后可以继续
+	db.Model(&schemaLock{}).Where("id = 1").Update("locked_at", time.Now().Add(-2*lockStale).Unix())
+	if _, err := m.Up(1); err != nil {
+		t.Fatalf("up with stale lock: %v", err)
+	}
+
+	var lock schemaLock
+	db.Take(&lock, 1)
+	if lock.LockedAt != 0 || lock.Owner != "" {
+		t.Fatalf("lock not released: %+v", lock)
+	}
+}
+
+func TestLockRefreshedWhileHeld(t *testing.T) {
+	db := openTestDB(t)
+	m := NewWith(db, widgetMigrations())
+	m.lockRefresh = 100 * time.Millisecond
+
+	var before, after schemaLock
+	err := m.withLock(func() error {
+		db.Take(&before, 1)
+		time.Sleep(1500 * time.Millisecond)
+		db.Take(&after, 1)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("with lock: %v", err)
+	}
+	if after.Owner != before.Owner || after.LockedAt <= before.LockedAt {
+		t.Fatalf("lock not refreshed: before %+v, after %+v", before, after)
+	}
+}
+
+func TestDuplicateVersionPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("NewWith accepted duplicate versions")
+		}
+	}()
+	NewWith(nil, []Migration{{Version: 1}, {Version: 1}})
+}
@@ -0,0 +1,52 @@
+package migration
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// Migration 一次表结构变更
+// Up / Down 在事务中执行; 注意 MySQL 的 DDL 会隐式提交, 一次迁移中应只包含一类变更
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error // 为 nil 时不可回滚
+}
+
+// Status 迁移执行状态
+type Status struct {
+	Version   int    `json:"version"`
+	Name      string `json:"name"`
+	Applied   bool   `json:"applied"`
+	AppliedAt int64  `json:"applied_at,omitempty"`
+}
+
+// schemaMigration 已执行的迁移
+type schemaMigration struct {
+	Version   int    `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"type:varchar(128);not null"`
+	AppliedAt int64  `gorm:"type:bigint;not null"`
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// schemaLock 迁移锁, 只有一行 (id = 1), LockedAt 为 0 表示未加锁
+type schemaLock struct {
+	ID       int    `gorm:"primaryKey;autoIncrement:false"`
+	Owner    string `gorm:"type:varchar(128);not null;default:''"`
+	LockedAt int64  `gorm:"type:bigint;not null;default:0"`
+}
+
+func (schemaLock) TableName() string {
+	return "schema_migrations_lock"
+}
+
+var (
+	ErrLockTimeout   = errors.New("timed out waiting for migration lock")
+	ErrIrreversible  = errors.New("migration is irreversible")
+	ErrUnknownTarget = errors.New("unknown target version")
+)
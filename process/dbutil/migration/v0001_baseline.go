@@ -0,0 +1,123 @@
+package migration
+
+import "gorm.io/gorm"
+
+// v1Baseline 引入版本化迁移前由 AutoMigrate 维护的表结构
+// 使用表结构快照而不是 app/model, 以免模型变更后影响历史迁移; 对已有的库执行时只会补齐缺失的列和索引
+// 列类型只使用 MySQL / PostgreSQL / SQLite 通用的写法
+var v1Baseline = Migration{
+	Version: 1,
+	Name:    "baseline",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&v1Account{}, &v1App{}, &v1OpenId{}, &v1UniqueId{}, &v1PassKey{}, &v1AuditLog{}, &v1LoginHistory{}, &v1PasswordHistory{})
+	},
+	// 回滚即删除全部数据, 不提供
+	Down: nil,
+}
+
+type v1Account struct {
+	ID       int    `gorm:"autoIncrement;primaryKey"`
+	Username string `gorm:"type:varchar(20);uniqueIndex;not null"`
+	Password string `gorm:"type:varchar(128);not null"`
+	Email    string `gorm:"type:varchar(128);uniqueIndex"`
+	RegTime  int64  `gorm:"type:bigint"`
+	RegIp    string `gorm:"type:varchar(128)"`
+	LastTime int64  `gorm:"type:bigint"`
+	LastIp   string `gorm:"type:varchar(128)"`
+	DeleteAt int64  `gorm:"type:bigint;default:0;index"`
+	Role     string `gorm:"type:varchar(16);default:'user'"`
+
+	SuspendedAt   int64  `gorm:"type:bigint;default:0"`
+	SuspendUntil  int64  `gorm:"type:bigint;default:0"`
+	SuspendReason string `gorm:"type:varchar(255)"`
+}
+
+func (v1Account) TableName() string { return "accounts" }
+
+type v1App struct {
+	ID         int    `gorm:"autoIncrement;primaryKey"`
+	UserId     int    `gorm:"index"`
+	AppId      string `gorm:"type:varchar(20);uniqueIndex"`
+	AppName    string `gorm:"type:varchar(128)"`
+	AppSecret  string `gorm:"type:varchar(100);uniqueIndex"`
+	AppGateway string `gorm:"type:varchar(200)"`
+	CreateAt   int64  `gorm:"autoCreateTime"`
+}
+
+func (v1App) TableName() string { return "apps" }
+
+type v1OpenId struct {
+	ID       int    `gorm:"autoIncrement;primaryKey"`
+	UserId   int    `gorm:"index"`
+	AppId    string `gorm:"type:varchar(20);index"`
+	OpenId   string `gorm:"type:varchar(128);uniqueIndex"`
+	CreateAt int64  `gorm:"autoCreateTime"`
+}
+
+func (v1OpenId) TableName() string { return "open_id" }
+
+type v1UniqueId struct {
+	ID        int    `gorm:"autoIncrement;primaryKey"`
+	UserId    int    `gorm:"index"`
+	DevUserId int    `gorm:"index"`
+	UniqueId  string `gorm:"type:varchar(128);uniqueIndex"`
+	CreateAt  int64  `gorm:"autoCreateTime"`
+}
+
+func (v1UniqueId) TableName() string { return "unique_id" }
+
+type v1PassKey struct {
+	ID           int    `gorm:"autoIncrement;primaryKey"`
+	UserID       int    `gorm:"index;not null"`
+	CredentialID string `gorm:"type:varchar(255);uniqueIndex;not null"`
+	PublicKey    string `gorm:"type:text;not null"`
+	Attestation  string `gorm:"type:varchar(32)"`
+	AAGUID       string `gorm:"type:varchar(64)"`
+	SignCount    uint32 `gorm:"default:0"`
+	Transport    string `gorm:"type:varchar(255)"`
+	CloneWarning bool   `gorm:"default:false"`
+	Remark       string `gorm:"type:varchar(255);default:''"`
+	CreatedAt    int64  `gorm:"type:bigint;not null"`
+	UpdatedAt    int64  `gorm:"type:bigint;not null"`
+	LastUsedAt   int64  `gorm:"type:bigint;default:0"`
+}
+
+func (v1PassKey) TableName() string { return "pass_keys" }
+
+type v1AuditLog struct {
+	ID         int64  `gorm:"autoIncrement;primaryKey"`
+	Action     string `gorm:"type:varchar(64);index;not null"`
+	ActorId    int    `gorm:"index"`
+	UserId     int    `gorm:"index"`
+	TargetType string `gorm:"type:varchar(32)"`
+	TargetId   string `gorm:"type:varchar(64);index"`
+	Ip         string `gorm:"type:varchar(128)"`
+	UserAgent  string `gorm:"type:varchar(255)"`
+	Result     string `gorm:"type:varchar(16)"`
+	Detail     string `gorm:"type:varchar(255)"`
+	CreatedAt  int64  `gorm:"type:bigint;index;not null"`
+}
+
+func (v1AuditLog) TableName() string { return "audit_logs" }
+
+type v1LoginHistory struct {
+	ID         int64  `gorm:"autoIncrement;primaryKey"`
+	UserId     int    `gorm:"index;not null"`
+	Ip         string `gorm:"type:varchar(128)"`
+	Network    string `gorm:"type:varchar(64)"`
+	UserAgent  string `gorm:"type:varchar(255)"`
+	DeviceHash string `gorm:"type:varchar(64)"`
+	Method     string `gorm:"type:varchar(16)"`
+	CreatedAt  int64  `gorm:"type:bigint;index;not null"`
+}
+
+func (v1LoginHistory) TableName() string { return "login_histories" }
+
+type v1PasswordHistory struct {
+	ID        int64  `gorm:"autoIncrement;primaryKey"`
+	UserId    int    `gorm:"index;not null"`
+	Password  string `gorm:"type:varchar(128);not null"`
+	CreatedAt int64  `gorm:"type:bigint;not null"`
+}
+
+func (v1PasswordHistory) TableName() string { return "password_histories" }
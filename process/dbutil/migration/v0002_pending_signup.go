@@ -0,0 +1,28 @@
+package migration
+
+import "gorm.io/gorm"
+
+// v2PendingSignup 标记尚未绑定 passkey 的无密码注册, 超时清理只针对带有该标记的账号
+// 引入前创建的无密码账号无法与导入的无密码账号区分, 不做回填
+var v2PendingSignup = Migration{
+	Version: 2,
+	Name:    "account_pending_signup",
+	Up: func(tx *gorm.DB) error {
+		if err := tx.Migrator().AddColumn(&v2Account{}, "PendingSignup"); err != nil {
+			return err
+		}
+		return tx.Migrator().CreateIndex(&v2Account{}, "PendingSignup")
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropIndex(&v2Account{}, "PendingSignup"); err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&v2Account{}, "PendingSignup")
+	},
+}
+
+type v2Account struct {
+	PendingSignup bool `gorm:"not null;default:false;index"`
+}
+
+func (v2Account) TableName() string { return "accounts" }
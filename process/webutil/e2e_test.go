@@ -0,0 +1,518 @@
+package webutil
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/soxft/openid-go/app/model"
+	"github.com/soxft/openid-go/config"
+	"github.com/soxft/openid-go/library/userutil"
+)
+
+const testPassword = "Secret-pass-1"
+
+// signUp 通过注册接口创建账号并登录, 返回 token
+func (h *harness) signUp(username, email string) string {
+	h.t.Helper()
+
+	h.mustDo(http.MethodPost, "/register/code", "", map[string]string{"email": email})
+	h.mustDo(http.MethodPost, "/register", "", map[string]string{
+		"email":    email,
+		"code":     h.code(email, "register"),
+		"username": username,
+		"password": testPassword,
+	})
+	return h.login(username, testPassword)
+}
+
+func (h *harness) login(username, password string) string {
+	h.t.Helper()
+
+	var data struct {
+		Token string `json:"token"`
+	}
+	h.mustDo(http.MethodPost, "/login", "", map[string]string{
+		"username": username,
+		"password": password,
+	}).decode(h.t, &data)
+	if data.Token == "" {
+		h.t.Fatal("login returned empty token")
+	}
+	return data.Token
+}
+
+// reauth 使用密码重新验证当前会话
+func (h *harness) reauth(token string) {
+	h.t.Helper()
+	h.mustDo(http.MethodPost, "/user/reauth", token, map[string]string{"password": testPassword})
+}
+
+func TestRegisterLoginAuthorizeFlow(t *testing.T) {
+	h := newHarness(t)
+	token := h.signUp("alice01", "alice@example.com")
+
+	var info struct {
+		UserId   int    `json:"userId"`
+		Username string `json:"username"`
+		Email    string `json:"email"`
+	}
+	h.mustDo(http.MethodGet, "/user/info", token, nil).decode(t, &info)
+	if info.Username != "alice01" || info.Email != "alice@example.com" {
+		t.Fatalf("user info = %+v", info)
+	}
+
+	// 注册的邮箱不能重复获取验证码
+	if resp := h.do(http.MethodPost, "/register/code", "", map[string]string{"email": "alice@example.com"}); resp.Success {
+		t.Fatal("register code sent for existing email")
+	}
+
+	// 创建应用并配置网关
+	h.mustDo(http.MethodPost, "/app/create", token, map[string]string{"app_name": "demo"})
+	var list struct {
+		Total int `json:"total"`
+		List  []struct {
+			AppId string `json:"app_id"`
+		} `json:"list"`
+	}
+	h.mustDo(http.MethodGet, "/app/list", token, nil).decode(t, &list)
+	if list.Total != 1 || len(list.List) != 1 {
+		t.Fatalf("app list = %+v", list)
+	}
+	appId := list.List[0].AppId
+
+	h.mustDo(http.MethodPut, "/app/id/"+appId, token, map[string]string{
+		"app_name":    "demo",
+		"app_gateway": "client.example.com",
+	})
+	var app struct {
+		AppSecret string `json:"app_secret"`
+	}
+	h.mustDo(http.MethodGet, "/app/id/"+appId, token, nil).decode(t, &app)
+
+	// 网关不匹配
+	if resp := h.do(http.MethodPost, "/v1/code", token, map[string]string{
+		"appid":        appId,
+		"redirect_uri": "https://evil.example.net/cb",
+	}); resp.Success {
+		t.Fatal("code issued for redirect_uri outside gateway")
+	}
+
+	authorize := func() (string, string) {
+		var code struct {
+			Token string `json:"token"`
+		}
+		h.mustDo(http.MethodPost, "/v1/code", token, map[string]string{
+			"appid":        appId,
+			"redirect_uri": "https://client.example.com/cb",
+		}).decode(t, &code)
+
+		// 错误的 secret
+		if resp := h.do(http.MethodPost, "/v1/info", "", map[string]string{
+			"token":      code.Token,
+			"appid":      appId,
+			"app_secret": "wrong",
+		}); resp.Success {
+			t.Fatal("info returned with wrong app secret")
+		}
+
+		var ids struct {
+			OpenId   string `json:"openId"`
+			UniqueId string `json:"uniqueId"`
+		}
+		h.mustDo(http.MethodPost, "/v1/info", "", map[string]string{
+			"token":      code.Token,
+			"appid":      appId,
+			"app_secret": app.AppSecret,
+		}).decode(t, &ids)
+		if ids.OpenId == "" || ids.UniqueId == "" {
+			t.Fatalf("ids = %+v", ids)
+		}
+
+		// token 只能使用一次
+		if resp := h.do(http.MethodPost, "/v1/info", "", map[string]string{
+			"token":      code.Token,
+			"appid":      appId,
+			"app_secret": app.AppSecret,
+		}); resp.Success {
+			t.Fatal("code token accepted twice")
+		}
+		return ids.OpenId, ids.UniqueId
+	}
+
+	openId, uniqueId := authorize()
+	if o, u := authorize(); o != openId || u != uniqueId {
+		t.Fatalf("ids changed between authorizations: %s/%s -> %s/%s", openId, uniqueId, o, u)
+	}
+
+	h.mustDo(http.MethodPost, "/user/logout", token, nil)
+	if resp := h.do(http.MethodGet, "/user/status", token, nil); resp.Status != http.StatusUnauthorized {
+		t.Fatalf("status after logout = %d", resp.Status)
+	}
+}
+
+func TestForgetPasswordFlow(t *testing.T) {
+	h := newHarness(t)
+	h.signUp("bob0001", "bob@example.com")
+
+	// 注册验证码的发送间隔为 2 分钟
+	h.redis.FastForward(time.Minute)
+	if resp := h.do(http.MethodPost, "/forget/password/code", "", map[string]string{"email": "bob@example.com"}); resp.Success {
+		t.Fatal("code sent while beacon is active")
+	}
+	h.redis.FastForward(time.Minute + time.Second)
+
+	if resp := h.do(http.MethodPost, "/forget/password/code", "", map[string]string{"email": "nobody@example.com"}); resp.Success {
+		t.Fatal("code sent to unknown email")
+	}
+	h.mustDo(http.MethodPost, "/forget/password/code", "", map[string]string{"email": "bob@example.com"})
+	code := h.code("bob@example.com", "forgetPwd")
+
+	if resp := h.do(http.MethodPatch, "/forget/password/update", "", map[string]string{
+		"email":    "bob@example.com",
+		"code":     "000000",
+		"password": "New-pass-123",
+	}); resp.Success {
+		t.Fatal("password reset with wrong code")
+	}
+	// 不能重复使用近期用过的密码
+	if resp := h.do(http.MethodPatch, "/forget/password/update", "", map[string]string{
+		"email":    "bob@example.com",
+		"code":     code,
+		"password": testPassword,
+	}); resp.Success {
+		t.Fatal("password reset to a recently used password")
+	}
+
+	h.mustDo(http.MethodPatch, "/forget/password/update", "", map[string]string{
+		"email":    "bob@example.com",
+		"code":     code,
+		"password": "New-pass-123",
+	})
+	if _, ok := h.mails.last("bob@example.com", "passwordChangeNotify"); !ok {
+		t.Fatal("no password change notification")
+	}
+
+	// 验证码已消费
+	if resp := h.do(http.MethodPatch, "/forget/password/update", "", map[string]string{
+		"email":    "bob@example.com",
+		"code":     code,
+		"password": "Other-pass-123",
+	}); resp.Success {
+		t.Fatal("code reused")
+	}
+
+	if resp := h.do(http.MethodPost, "/login", "", map[string]string{"username": "bob0001", "password": testPassword}); resp.Success {
+		t.Fatal("login with old password")
+	}
+	h.login("bob@example.com", "New-pass-123")
+}
+
+func TestEmailChangeFlow(t *testing.T) {
+	h := newHarness(t)
+	token := h.signUp("carol01", "carol@example.com")
+	h.signUp("dave001", "dave@example.com")
+
+	// 未重新验证身份
+	if resp := h.do(http.MethodPost, "/user/email/update/code", token, map[string]string{
+		"new_email": "carol.new@example.com",
+	}); resp.Status != http.StatusForbidden {
+		t.Fatalf("code request without reauth = %d, want 403", resp.Status)
+	}
+	if resp := h.do(http.MethodPost, "/user/reauth", token, map[string]string{"password": "wrong-password"}); resp.Success {
+		t.Fatal("reauth accepted a wrong password")
+	}
+	h.reauth(token)
+
+	if resp := h.do(http.MethodPost, "/user/email/update/code", token, map[string]string{
+		"new_email": "dave@example.com",
+	}); resp.Success {
+		t.Fatal("code sent for email owned by another account")
+	}
+
+	h.mustDo(http.MethodPost, "/user/email/update/code", token, map[string]string{
+		"new_email": "carol.new@example.com",
+	})
+	h.mustDo(http.MethodPatch, "/user/email/update", token, map[string]string{
+		"email": "carol.new@example.com",
+		"code":  h.code("carol.new@example.com", "emailChange"),
+	})
+
+	if _, ok := h.mails.last("carol@example.com", "emailChangeNotify"); !ok {
+		t.Fatal("no notification sent to the old email")
+	}
+	if resp := h.do(http.MethodGet, "/user/status", token, nil); resp.Status != http.StatusUnauthorized {
+		t.Fatalf("old token status = %d, want 401", resp.Status)
+	}
+	if resp := h.do(http.MethodPost, "/login", "", map[string]string{"username": "carol@example.com", "password": testPassword}); resp.Success {
+		t.Fatal("login with old email")
+	}
+
+	var info struct {
+		Email string `json:"email"`
+	}
+	h.mustDo(http.MethodGet, "/user/info", h.login("carol.new@example.com", testPassword), nil).decode(t, &info)
+	if info.Email != "carol.new@example.com" {
+		t.Fatalf("email = %s", info.Email)
+	}
+}
+
+func TestReauthRequired(t *testing.T) {
+	h := newHarness(t)
+	token := h.signUp("frank01", "frank@example.com")
+	other := h.login("frank01", testPassword)
+
+	h.mustDo(http.MethodPost, "/app/create", token, map[string]string{"app_name": "demo"})
+	var list struct {
+		List []struct {
+			AppId string `json:"app_id"`
+		} `json:"list"`
+	}
+	h.mustDo(http.MethodGet, "/app/list", token, nil).decode(t, &list)
+	secretPath := "/app/id/" + list.List[0].AppId + "/secret"
+
+	update := map[string]string{"new_password": "New-pass-123"}
+	for _, tc := range []struct {
+		method, path string
+		body         interface{}
+	}{
+		{http.MethodPut, secretPath, nil},
+		{http.MethodPatch, "/user/password/update", update},
+		{http.MethodPost, "/user/delete", nil},
+	} {
+		if resp := h.do(tc.method, tc.path, token, tc.body); resp.Status != http.StatusForbidden {
+			t.Fatalf("%s %s without reauth = %d, want 403", tc.method, tc.path, resp.Status)
+		}
+	}
+
+	h.reauth(token)
+	h.mustDo(http.MethodPut, secretPath, token, nil)
+
+	// 验证状态只属于完成验证的会话
+	if resp := h.do(http.MethodPatch, "/user/password/update", other, update); resp.Status != http.StatusForbidden {
+		t.Fatalf("password update from another session = %d, want 403", resp.Status)
+	}
+
+	// 验证状态过期
+	h.redis.FastForward(5 * time.Minute)
+	if resp := h.do(http.MethodPatch, "/user/password/update", token, update); resp.Status != http.StatusForbidden {
+		t.Fatalf("password update after reauth expired = %d, want 403", resp.Status)
+	}
+
+	h.reauth(token)
+	h.mustDo(http.MethodPatch, "/user/password/update", token, update)
+	h.login("frank01", "New-pass-123")
+}
+
+// 弃用期内旧版客户端仍可在请求体中直接提交当前密码
+func TestReauthLegacyPassword(t *testing.T) {
+	h := newHarness(t)
+	token := h.signUp("irene01", "irene@example.com")
+
+	resp := h.do(http.MethodPatch, "/user/password/update", token, map[string]string{"old_password": "wrong-password", "new_password": "New-pass-123"})
+	if resp.Success || resp.Code != "password_incorrect" {
+		t.Fatalf("legacy password update with wrong password = %d %s", resp.Status, resp.Code)
+	}
+	h.mustDo(http.MethodPost, "/user/email/update/code", token, map[string]string{"password": testPassword, "new_email": "irene.new@example.com"})
+	h.mustDo(http.MethodPatch, "/user/password/update", token, map[string]string{"old_password": testPassword, "new_password": "New-pass-123"})
+	h.login("irene01", "New-pass-123")
+
+	// 内联密码只对本次请求生效, 不提升会话
+	other := h.login("irene01", "New-pass-123")
+	h.mustDo(http.MethodPost, "/user/email/update/code", other, map[string]string{"password": "New-pass-123", "new_email": "irene.other@example.com"})
+	if resp := h.do(http.MethodPost, "/user/delete", other, nil); resp.Status != http.StatusForbidden {
+		t.Fatalf("delete after legacy inline password = %d, want 403", resp.Status)
+	}
+}
+
+func TestReauthThrottled(t *testing.T) {
+	h := newHarness(t)
+	token := h.signUp("jack001", "jack@example.com")
+
+	config.RateLimit.Auth = config.RateLimitRule{Rate: 0.001, Burst: 2}
+	t.Cleanup(func() { config.RateLimit = config.RateLimitConfig{} })
+
+	for i := 0; i < 2; i++ {
+		if resp := h.do(http.MethodPost, "/user/reauth", token, map[string]string{"password": "wrong-password"}); resp.Code != "password_incorrect" {
+			t.Fatalf("reauth attempt %d = %d %s", i, resp.Status, resp.Code)
+		}
+	}
+	if resp := h.do(http.MethodPost, "/user/reauth", token, map[string]string{"password": testPassword}); resp.Status != http.StatusTooManyRequests {
+		t.Fatalf("reauth after bucket drained = %d, want 429", resp.Status)
+	}
+	// 旧版客户端的内联密码与 /user/reauth 共用限制
+	resp := h.do(http.MethodPatch, "/user/password/update", token, map[string]string{"old_password": testPassword, "new_password": "New-pass-123"})
+	if resp.Status != http.StatusTooManyRequests {
+		t.Fatalf("legacy inline password after bucket drained = %d, want 429", resp.Status)
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	h := newHarness(t)
+	h.signUp("grace01", "grace@example.com")
+
+	cases := []struct {
+		method, path string
+		body         interface{}
+		status       int
+		code         string
+	}{
+		{http.MethodPost, "/forget/password/code", map[string]string{"email": "nobody@example.com"}, http.StatusNotFound, "email_not_found"},
+		{http.MethodPost, "/register/code", map[string]string{}, http.StatusBadRequest, "invalid_params"},
+		{http.MethodPost, "/login", map[string]string{"username": "grace01", "password": "wrong-password"}, http.StatusBadRequest, "password_incorrect"},
+		{http.MethodGet, "/user/info", nil, http.StatusUnauthorized, "unauthorized"},
+		{http.MethodGet, "/no/such/route", nil, http.StatusNotFound, "route_not_found"},
+	}
+	for _, tc := range cases {
+		resp := h.do(tc.method, tc.path, "", tc.body)
+		if resp.Success || resp.Status != tc.status || resp.Code != tc.code {
+			t.Errorf("%s %s = %d %s, want %d %s", tc.method, tc.path, resp.Status, resp.Code, tc.status, tc.code)
+		}
+	}
+
+	// 兼容模式: 状态码与 message 保持旧版
+	config.Server.LegacyErrors = true
+	t.Cleanup(func() { config.Server.LegacyErrors = false })
+
+	resp := h.do(http.MethodPost, "/forget/password/code", "", map[string]string{"email": "nobody@example.com"})
+	if resp.Status != http.StatusOK || resp.Code != "email_not_found" || resp.Message != "邮箱不存在" {
+		t.Fatalf("legacy response = %d %s %q", resp.Status, resp.Code, resp.Message)
+	}
+	if resp := h.do(http.MethodGet, "/user/info", "", nil); resp.Status != http.StatusUnauthorized {
+		t.Fatalf("legacy unauthorized status = %d", resp.Status)
+	}
+}
+
+var deleteCancelRe = regexp.MustCompile(`token=(\w+)`)
+
+// scheduleDeletion 申请注销, 返回用户 ID 与邮件中的撤销 token
+func (h *harness) scheduleDeletion(username, email string) (int, string) {
+	h.t.Helper()
+
+	token := h.signUp(username, email)
+	var info struct {
+		UserId int `json:"userId"`
+	}
+	h.mustDo(http.MethodGet, "/user/info", token, nil).decode(h.t, &info)
+	h.reauth(token)
+	h.mustDo(http.MethodPost, "/user/delete", token, nil)
+
+	mail, ok := h.mails.last(email, "accountDeleteScheduled")
+	if !ok {
+		h.t.Fatalf("no deletion mail sent to %s", email)
+	}
+	m := deleteCancelRe.FindStringSubmatch(mail.Content)
+	if m == nil {
+		h.t.Fatalf("no cancel token in deletion mail: %q", mail.Content)
+	}
+	return info.UserId, m[1]
+}
+
+func TestAccountDeletionCancel(t *testing.T) {
+	h := newHarness(t)
+
+	_, cancel := h.scheduleDeletion("ivy01", "ivy@example.com")
+	h.mustDo(http.MethodPost, "/user/delete/cancel", "", map[string]string{"token": cancel})
+	if resp := h.do(http.MethodPost, "/user/delete/cancel", "", map[string]string{"token": cancel}); resp.Code != "link_invalid" {
+		t.Fatalf("reused cancel token = %d %s", resp.Status, resp.Code)
+	}
+
+	// 删除账号时清理撤销链接
+	userId, cancel := h.scheduleDeletion("jack01", "jack@example.com")
+	if err := userutil.DeleteAccount(h.db, h.rdb, h.mails, userId); err != nil {
+		t.Fatalf("delete account: %v", err)
+	}
+	for _, key := range h.redis.Keys() {
+		if strings.Contains(key, ":account:delete:cancel") {
+			t.Fatalf("cancel key %s left after account deleted", key)
+		}
+	}
+	if resp := h.do(http.MethodPost, "/user/delete/cancel", "", map[string]string{"token": cancel}); resp.Code != "link_invalid" {
+		t.Fatalf("cancel after account deleted = %d %s", resp.Status, resp.Code)
+	}
+
+	// 撤销 key 仍在但账号已不存在
+	userId, cancel = h.scheduleDeletion("kate01", "kate@example.com")
+	if err := h.db.Delete(&model.Account{}, userId).Error; err != nil {
+		t.Fatalf("delete account row: %v", err)
+	}
+	if resp := h.do(http.MethodPost, "/user/delete/cancel", "", map[string]string{"token": cancel}); resp.Code != "link_invalid" {
+		t.Fatalf("cancel for missing account = %d %s", resp.Status, resp.Code)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	h := newHarness(t)
+	token := h.signUp("henry01", "henry@example.com")
+	h.mustDo(http.MethodPost, "/app/create", token, map[string]string{"app_name": "demo"})
+	var list struct {
+		List []struct {
+			AppId string `json:"app_id"`
+		} `json:"list"`
+	}
+	h.mustDo(http.MethodGet, "/app/list", token, nil).decode(t, &list)
+	appId := list.List[0].AppId
+
+	config.RateLimit = config.RateLimitConfig{
+		Enable: true,
+		Rate:   0.001,
+		Burst:  1,
+		Ip:     config.RateLimitRule{Burst: 4},
+		Apps:   map[string]config.RateLimitRule{appId: {Burst: 2}},
+	}
+	t.Cleanup(func() { config.RateLimit = config.RateLimitConfig{} })
+
+	// 存在的应用使用单独配置的规则
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if resp := h.do(http.MethodGet, "/v1/app/info/"+appId, "", nil); resp.Status != want {
+			t.Fatalf("request %d for existing app = %d, want %d", i, resp.Status, want)
+		}
+	}
+
+	// 每次更换伪造的 appid 也不能绕过 IP 的总限制
+	if resp := h.do(http.MethodGet, "/v1/app/info/20000101000000001", "", nil); resp.Status != http.StatusNotFound {
+		t.Fatalf("unknown app = %d, want 404", resp.Status)
+	}
+	resp := h.do(http.MethodGet, "/v1/app/info/20000101000000002", "", nil)
+	if resp.Status != http.StatusTooManyRequests || resp.Code != "rate_limited" {
+		t.Fatalf("unknown app after ip bucket drained = %d %s", resp.Status, resp.Code)
+	}
+}
+
+func TestRateLimitUnknownApp(t *testing.T) {
+	h := newHarness(t)
+	config.RateLimit = config.RateLimitConfig{
+		Enable: true,
+		Rate:   0.001,
+		Burst:  1,
+		Ip:     config.RateLimitRule{Burst: 10},
+	}
+	t.Cleanup(func() { config.RateLimit = config.RateLimitConfig{} })
+
+	// 不存在的 appid 同样消耗 appid + IP 的桶, 不会只受 IP 总桶限制
+	if resp := h.do(http.MethodGet, "/v1/app/info/20000101000000001", "", nil); resp.Status != http.StatusNotFound {
+		t.Fatalf("unknown app = %d, want 404", resp.Status)
+	}
+	if resp := h.do(http.MethodGet, "/v1/app/info/20000101000000001", "", nil); resp.Status != http.StatusTooManyRequests {
+		t.Fatalf("repeated unknown app = %d, want 429", resp.Status)
+	}
+}
+
+func TestRateLimitRedisDown(t *testing.T) {
+	h := newHarness(t)
+	config.RateLimit = config.RateLimitConfig{Enable: true, Rate: 1, Burst: 1}
+	t.Cleanup(func() { config.RateLimit = config.RateLimitConfig{} })
+	h.redis.Close()
+
+	// 默认 fail-open, 限流失效但请求继续处理
+	if resp := h.do(http.MethodGet, "/v1/app/info/20000101000000001", "", nil); resp.Status != http.StatusNotFound {
+		t.Fatalf("fail-open = %d %s, want 404", resp.Status, resp.Code)
+	}
+
+	config.RateLimit.FailClosed = true
+	if resp := h.do(http.MethodGet, "/v1/app/info/20000101000000001", "", nil); resp.Status != http.StatusInternalServerError || resp.Code != "internal_error" {
+		t.Fatalf("fail-closed = %d %s, want 500 internal_error", resp.Status, resp.Code)
+	}
+}
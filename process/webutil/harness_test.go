@@ -0,0 +1,193 @@
+package webutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/soxft/openid-go/app/service"
+	"github.com/soxft/openid-go/config"
+	"github.com/soxft/openid-go/library/mailutil"
+	"github.com/soxft/openid-go/process/dbutil"
+	"github.com/soxft/openid-go/process/dbutil/migration"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// harness 在内存中启动完整的路由: SQLite + miniredis, 邮件写入 mailSink 而不发送
+type harness struct {
+	t      *testing.T
+	engine *gin.Engine
+	db     *gorm.DB
+	rdb    *redis.Client
+	redis  *miniredis.Miniredis
+	mails  *mailSink
+}
+
+func testConfig() *config.Config {
+	return &config.Config{
+		ServerConfig:    config.ServerConfig{Title: "openid test", Name: "openid test", FrontUrl: "http://openid.test"},
+		RedisConfig:     config.RedisConfig{Prefix: "openid"},
+		JwtConfig:       config.JwtConfig{Secret: "test-secret"},
+		DeveloperConfig: config.DeveloperConfig{AppLimit: 10},
+		OpenIdConfig:    config.OpenIdConfig{Mode: "random"},
+		AccountConfig:   config.AccountConfig{DeleteGraceDays: 7},
+		PasswordConfig: config.PasswordConfig{
+			MinLength:  8,
+			MaxLength:  64,
+			MinClasses: 2,
+			History:    5,
+			BcryptCost: 4,
+		},
+	}
+}
+
+// newHarness 每个测试使用独立的数据库, redis 与邮件队列, 通过 service.New 注入
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+
+	if err := config.Apply(testConfig()); err != nil {
+		t.Fatalf("apply config: %v", err)
+	}
+
+	db, err := dbutil.Open(dbutil.DriverSqlite, "file:"+t.Name()+"?mode=memory&cache=shared", &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	sqlDb, _ := db.DB()
+	sqlDb.SetMaxOpenConns(1)
+	if _, err := migration.New(db).Up(0); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	mails := &mailSink{}
+
+	t.Cleanup(func() {
+		_ = rdb.Close()
+		_ = sqlDb.Close()
+	})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	initRoute(r, service.New(db, rdb, mails))
+
+	return &harness{t: t, engine: r, db: db, rdb: rdb, redis: mr, mails: mails}
+}
+
+// response 接口统一的返回格式
+type response struct {
+	Status  int             `json:"-"`
+	Success bool            `json:"success"`
+	Code    string          `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// decode 将 data 解析到 v
+func (r response) decode(t *testing.T, v any) {
+	t.Helper()
+	if err := json.Unmarshal(r.Data, v); err != nil {
+		t.Fatalf("decode data %s: %v", r.Data, err)
+	}
+}
+
+// do 发送 JSON 请求, token 不为空时携带 Authorization
+func (h *harness) do(method, path, token string, body any) response {
+	h.t.Helper()
+
+	var buf bytes.Buffer
+	if body != nil {
+		_ = json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	h.engine.ServeHTTP(w, req)
+
+	resp := response{Status: w.Code}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		h.t.Fatalf("%s %s: decode response %q: %v", method, path, w.Body.String(), err)
+	}
+	return resp
+}
+
+// mustDo 与 do 相同, 但要求请求成功
+func (h *harness) mustDo(method, path, token string, body any) response {
+	h.t.Helper()
+
+	resp := h.do(method, path, token, body)
+	if resp.Status != http.StatusOK || !resp.Success {
+		h.t.Fatalf("%s %s = %d %q %s", method, path, resp.Status, resp.Message, resp.Data)
+	}
+	return resp
+}
+
+// mailSink 实现 mq.MessageQueue, 记录投递到 mail 队列的邮件
+type mailSink struct {
+	mu    sync.Mutex
+	mails []mailutil.Mail
+}
+
+func (s *mailSink) Publish(topic string, msg string, _ int64) error {
+	if topic != "mail" {
+		return nil
+	}
+
+	var mail mailutil.Mail
+	if err := json.Unmarshal([]byte(msg), &mail); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.mails = append(s.mails, mail)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *mailSink) Subscribe(string, int, func(msg string)) {}
+
+// last 最近一封指定类型, 发往 to 的邮件
+func (s *mailSink) last(to, typ string) (mailutil.Mail, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := len(s.mails) - 1; i >= 0; i-- {
+		if m := s.mails[i]; m.ToAddress == to && m.Typ == typ {
+			return m, true
+		}
+	}
+	return mailutil.Mail{}, false
+}
+
+var verifyCodeRe = regexp.MustCompile(`验证码为: (\w+)`)
+
+// code 从最近一封验证码邮件中取出验证码
+func (h *harness) code(to, typ string) string {
+	h.t.Helper()
+
+	mail, ok := h.mails.last(to, typ)
+	if !ok {
+		h.t.Fatalf("no %s mail sent to %s", typ, to)
+	}
+	m := verifyCodeRe.FindStringSubmatch(mail.Content)
+	if m == nil {
+		h.t.Fatalf("no code in %s mail: %q", typ, mail.Content)
+	}
+	return m[1]
+}
@@ -0,0 +1,248 @@
+package webutil
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/soxft/openid-go/app/model"
+	"github.com/soxft/openid-go/library/passkey"
+	"github.com/soxft/openid-go/library/passkey/passkeytest"
+)
+
+func TestPasskeyRegisterAndLogin(t *testing.T) {
+	h := newHarness(t)
+	token := h.signUp("erin001", "erin@example.com")
+	auth := passkeytest.New(testConfig().FrontUrl)
+
+	var creation passkey.RegistrationOptions
+	h.mustDo(http.MethodGet, "/passkey/register/options", token, nil).decode(t, &creation)
+	cred, body, err := auth.Register(creation.PublicKeyCredentialCreationOptions)
+	if err != nil {
+		t.Fatalf("authenticator register: %v", err)
+	}
+	// 备注, sessionId 与 WebAuthn 响应在同一请求体中
+	registration := withFields(t, body, map[string]interface{}{"remark": "laptop"})
+	if resp := h.do(http.MethodPost, "/passkey/register", token, registration); resp.Success {
+		t.Fatal("registration completed without a session id")
+	}
+	registration["sessionId"] = creation.SessionID
+	h.mustDo(http.MethodPost, "/passkey/register", token, registration)
+
+	var passkeys []struct {
+		ID        int    `json:"id"`
+		Remark    string `json:"remark"`
+		SignCount int    `json:"signCount"`
+	}
+	h.mustDo(http.MethodGet, "/passkey", token, nil).decode(t, &passkeys)
+	if len(passkeys) != 1 || passkeys[0].Remark != "laptop" {
+		t.Fatalf("passkeys = %+v", passkeys)
+	}
+
+	passkeyPath := "/passkey/" + strconv.Itoa(passkeys[0].ID)
+	if resp := h.do(http.MethodPatch, passkeyPath, token, map[string]string{"remark": "<script>"}); resp.Success {
+		t.Fatal("rename accepted an invalid remark")
+	}
+	var renamed struct {
+		Remark string `json:"remark"`
+	}
+	h.mustDo(http.MethodPatch, passkeyPath, token, map[string]string{"remark": " phone "}).decode(t, &renamed)
+	if renamed.Remark != "phone" {
+		t.Fatalf("renamed = %+v", renamed)
+	}
+	if resp := h.do(http.MethodPatch, passkeyPath, h.signUp("grace01", "grace@example.com"), map[string]string{"remark": "mine"}); resp.Success {
+		t.Fatal("renamed another user's passkey")
+	}
+
+	sign := func(cred *passkeytest.Credential, a *passkeytest.Authenticator) map[string]interface{} {
+		var options passkey.LoginOptions
+		h.mustDo(http.MethodGet, "/passkey/login/options", "", nil).decode(t, &options)
+		body, err := a.Assert(options.PublicKeyCredentialRequestOptions, cred)
+		if err != nil {
+			t.Fatalf("authenticator assert: %v", err)
+		}
+		return withFields(t, body, map[string]interface{}{"sessionId": options.SessionID})
+	}
+	assert := func(cred *passkeytest.Credential, a *passkeytest.Authenticator) response {
+		return h.do(http.MethodPost, "/passkey/login", "", sign(cred, a))
+	}
+
+	var login struct {
+		Token     string `json:"token"`
+		PasskeyId int    `json:"passkeyId"`
+		Username  string `json:"username"`
+	}
+	signed := sign(cred, auth)
+	resp := h.do(http.MethodPost, "/passkey/login", "", signed)
+	if !resp.Success {
+		t.Fatalf("passkey login failed: %s", resp.Message)
+	}
+	resp.decode(t, &login)
+	if login.Username != "erin001" || login.PasskeyId != passkeys[0].ID {
+		t.Fatalf("login = %+v", login)
+	}
+	h.mustDo(http.MethodGet, "/user/status", login.Token, nil)
+
+	// 同一断言不能重放
+	if resp := h.do(http.MethodPost, "/passkey/login", "", signed); resp.Success || resp.Code != "passkey_challenge_expired" {
+		t.Fatalf("replayed assertion = %d %s", resp.Status, resp.Code)
+	}
+
+	// 删除 passkey 需先重新验证身份, 使用 passkey 完成验证
+	if resp := h.do(http.MethodDelete, passkeyPath, login.Token, nil); resp.Status != http.StatusForbidden {
+		t.Fatalf("passkey delete without reauth = %d, want 403", resp.Status)
+	}
+	var reauthOptions passkey.LoginOptions
+	h.mustDo(http.MethodGet, "/user/reauth/options", login.Token, nil).decode(t, &reauthOptions)
+	if len(reauthOptions.AllowedCredentials) != 1 {
+		t.Fatalf("reauth options = %+v", reauthOptions)
+	}
+	reauth, err := auth.Assert(reauthOptions.PublicKeyCredentialRequestOptions, cred)
+	if err != nil {
+		t.Fatalf("authenticator assert: %v", err)
+	}
+	reauthBody := map[string]interface{}{"credential": json.RawMessage(reauth), "sessionId": reauthOptions.SessionID}
+	h.mustDo(http.MethodPost, "/user/reauth", login.Token, reauthBody)
+	// 同一断言不能重复使用
+	if resp := h.do(http.MethodPost, "/user/reauth", token, reauthBody); resp.Success {
+		t.Fatal("reauth accepted a replayed assertion")
+	}
+	h.mustDo(http.MethodDelete, passkeyPath, login.Token, nil)
+
+	// 未注册的凭证
+	other := passkeytest.New(testConfig().FrontUrl)
+	unknown, _, err := other.Register(creation.PublicKeyCredentialCreationOptions)
+	if err != nil {
+		t.Fatalf("authenticator register: %v", err)
+	}
+	if resp := assert(unknown, other); resp.Success {
+		t.Fatal("login accepted an unregistered credential")
+	}
+}
+
+func TestPasswordlessSignup(t *testing.T) {
+	h := newHarness(t)
+	auth := passkeytest.New(testConfig().FrontUrl)
+	const email = "frank@example.com"
+
+	h.mustDo(http.MethodPost, "/register/code", "", map[string]string{"email": email})
+	signup := map[string]string{"email": email, "code": h.code(email, "register"), "username": "frank01"}
+
+	var begin struct {
+		SignupToken string                      `json:"signupToken"`
+		Options     passkey.RegistrationOptions `json:"options"`
+	}
+	h.mustDo(http.MethodPost, "/register/passkey/options", "", signup).decode(t, &begin)
+	// 中断后使用同一验证码重试, 复用已创建的账号
+	h.mustDo(http.MethodPost, "/register/passkey/options", "", signup).decode(t, &begin)
+	if resp := h.do(http.MethodPost, "/register/passkey/options", "", map[string]string{
+		"email": email, "code": signup["code"], "username": "frank02",
+	}); resp.Success {
+		t.Fatal("signup reused a pending account under another username")
+	}
+
+	cred, body, err := auth.Register(begin.Options.PublicKeyCredentialCreationOptions)
+	if err != nil {
+		t.Fatalf("authenticator register: %v", err)
+	}
+	registration := withFields(t, body, map[string]interface{}{"sessionId": begin.Options.SessionID})
+	if resp := h.do(http.MethodPost, "/register/passkey", "", registration); resp.Success {
+		t.Fatal("signup completed without a signup token")
+	}
+	registration["signupToken"] = begin.SignupToken
+	var done struct {
+		Token    string `json:"token"`
+		Username string `json:"username"`
+	}
+	h.mustDo(http.MethodPost, "/register/passkey", "", registration).decode(t, &done)
+	if done.Token == "" || done.Username != "frank01" {
+		t.Fatalf("signup = %+v", done)
+	}
+	token := done.Token
+
+	// 验证码与注册凭据均已消费
+	if resp := h.do(http.MethodPost, "/register/passkey/options", "", signup); resp.Success {
+		t.Fatal("signup code reused after completion")
+	}
+	if resp := h.do(http.MethodPost, "/register/passkey", "", registration); resp.Success {
+		t.Fatal("signup token reused after completion")
+	}
+
+	var info struct {
+		HasPassword bool `json:"hasPassword"`
+	}
+	h.mustDo(http.MethodGet, "/user/info", token, nil).decode(t, &info)
+	if info.HasPassword {
+		t.Fatal("passwordless account reports a password")
+	}
+	for _, password := range []string{"", testPassword} {
+		if resp := h.do(http.MethodPost, "/login", "", map[string]string{"username": "frank01", "password": password}); resp.Success {
+			t.Fatalf("password login with %q succeeded for passwordless account", password)
+		}
+	}
+	if resp := h.do(http.MethodPost, "/user/reauth", token, map[string]string{"password": testPassword}); resp.Success {
+		t.Fatal("password reauth succeeded for passwordless account")
+	}
+
+	// 使用 passkey 重新验证身份后可设置密码, 但不能删除唯一的 passkey
+	var reauthOptions passkey.LoginOptions
+	h.mustDo(http.MethodGet, "/user/reauth/options", token, nil).decode(t, &reauthOptions)
+	reauth, err := auth.Assert(reauthOptions.PublicKeyCredentialRequestOptions, cred)
+	if err != nil {
+		t.Fatalf("authenticator assert: %v", err)
+	}
+	h.mustDo(http.MethodPost, "/user/reauth", token, map[string]interface{}{"credential": json.RawMessage(reauth), "sessionId": reauthOptions.SessionID})
+
+	var passkeys []struct {
+		ID int `json:"id"`
+	}
+	h.mustDo(http.MethodGet, "/passkey", token, nil).decode(t, &passkeys)
+	if len(passkeys) != 1 {
+		t.Fatalf("passkeys = %+v", passkeys)
+	}
+	if resp := h.do(http.MethodDelete, "/passkey/"+strconv.Itoa(passkeys[0].ID), token, nil); resp.Status != http.StatusConflict || resp.Code != "passkey_last" {
+		t.Fatalf("deleting the only passkey of a passwordless account = %d %s", resp.Status, resp.Code)
+	}
+
+	h.mustDo(http.MethodPatch, "/user/password/update", token, map[string]string{"new_password": testPassword})
+	h.login("frank01", testPassword)
+}
+
+func TestPasswordlessSignupPendingAccount(t *testing.T) {
+	h := newHarness(t)
+	const email = "gina@example.com"
+
+	h.mustDo(http.MethodPost, "/register/code", "", map[string]string{"email": email})
+	h.mustDo(http.MethodPost, "/register/passkey/options", "", map[string]string{
+		"email": email, "code": h.code(email, "register"), "username": "gina001",
+	})
+
+	// 未完成 passkey 绑定的账号在被清理前占用邮箱与用户名, 检查本身不会删除账号
+	stale := time.Now().Add(-time.Hour).Unix()
+	if err := h.db.Model(&model.Account{}).Where("email = ?", email).Update("reg_time", stale).Error; err != nil {
+		t.Fatalf("age account: %v", err)
+	}
+	if resp := h.do(http.MethodPost, "/register/code", "", map[string]string{"email": email}); resp.Success {
+		t.Fatal("register code sent while the signup is pending")
+	}
+	var account model.Account
+	if err := h.db.Where("email = ?", email).Take(&account).Error; err != nil || !account.PendingSignup {
+		t.Fatalf("pending account = %+v, %v", account, err)
+	}
+}
+
+// withFields 在 WebAuthn 响应 JSON 的顶层附加字段
+func withFields(t *testing.T, body []byte, fields map[string]interface{}) map[string]interface{} {
+	t.Helper()
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(body, &m); err != nil {
+		t.Fatalf("decode credential: %v", err)
+	}
+	for k, v := range fields {
+		m[k] = v
+	}
+	return m
+}
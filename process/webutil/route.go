@@ -5,28 +5,39 @@ import (
 	"github.com/soxft/openid-go/api/version_one"
 	"github.com/soxft/openid-go/app/controller"
 	"github.com/soxft/openid-go/app/middleware"
+	"github.com/soxft/openid-go/app/service"
 	"github.com/soxft/openid-go/config"
 	"github.com/soxft/openid-go/library/apiutil"
 )
 
-func initRoute(r *gin.Engine) {
+func initRoute(r *gin.Engine, s *service.Services) {
 	r.Use(gin.Recovery())
 	if config.Server.Log {
 		r.Use(gin.Logger())
 	}
 	r.Use(middleware.Cors())
+	r.Use(service.Inject(s))
 	{
 		{
 			// ping
 			r.HEAD("/ping", controller.Ping)
 			r.GET("/ping", controller.Ping)
+			if config.Server.Debug {
+				r.GET("/debug/cache", controller.CacheStats)
+			}
 
 			// register
 			r.POST("/register/code", controller.RegisterCode)
 			r.POST("/register", controller.RegisterSubmit)
+			r.POST("/register/passkey/options", controller.RegisterPasskeyOptions)
+			r.POST("/register/passkey", controller.RegisterPasskey)
 
 			// login
-			r.POST("/login", controller.Login)
+			r.POST("/login", middleware.AuthRateLimit(), controller.Login)
+			r.POST("/login/deny", controller.LoginDeny)
+
+			// 撤销注销 (邮件链接, 无需登录)
+			r.POST("/user/delete/cancel", controller.UserDeleteCancel)
 		}
 
 		user := r.Group("/user")
@@ -35,9 +46,15 @@ func initRoute(r *gin.Engine) {
 			user.GET("/status", controller.UserStatus)
 			user.GET("/info", controller.UserInfo)
 			user.POST("/logout", controller.UserLogout)
-			user.PATCH("/password/update", controller.UserPasswordUpdate)
-			user.POST("/email/update/code", controller.UserEmailUpdateCode)
+			user.GET("/reauth/options", controller.UserReauthOptions)
+			user.POST("/reauth", middleware.AuthRateLimit(), controller.UserReauth)
+			user.PATCH("/password/update", middleware.RequireReauthOrPassword("old_password"), controller.UserPasswordUpdate)
+			user.POST("/email/update/code", middleware.RequireReauthOrPassword("password"), controller.UserEmailUpdateCode)
 			user.PATCH("/email/update", controller.UserEmailUpdate)
+			user.POST("/delete", middleware.RequireReauth(), controller.UserDelete)
+			user.GET("/export", controller.UserExport)
+			user.GET("/security-log", controller.UserSecurityLog)
+			user.GET("/login-history", controller.UserLoginHistory)
 		}
 
 		pass := r.Group("/passkey")
@@ -53,7 +70,8 @@ func initRoute(r *gin.Engine) {
 
 			// Management endpoints (auth required)
 			pass.GET("", controller.PasskeyList)
-			pass.DELETE(":id", controller.PasskeyDelete)
+			pass.PATCH(":id", controller.PasskeyRename)
+			pass.DELETE(":id", middleware.RequireReauth(), controller.PasskeyDelete)
 		}
 
 		app := r.Group("/app")
@@ -68,7 +86,29 @@ func initRoute(r *gin.Engine) {
 			app.DELETE("/id/:appid", controller.AppDel)
 			app.GET("/id/:appid", controller.AppInfo)
 
-			app.PUT("/id/:appid/secret", controller.AppReGenerateSecret)
+			app.PUT("/id/:appid/secret", middleware.RequireReauth(), controller.AppReGenerateSecret)
+		}
+
+		admin := r.Group("/admin")
+		{
+			admin.Use(middleware.AuthPermission(), middleware.AdminPermission())
+			admin.GET("/users", controller.AdminUserList)
+			admin.GET("/users/:id", controller.AdminUserInfo)
+			admin.GET("/users/:id/sessions", controller.AdminUserSessions)
+			admin.DELETE("/users/:id/sessions", controller.AdminUserSessionsRevoke)
+			admin.GET("/users/:id/passkeys", controller.AdminUserPasskeys)
+			admin.GET("/users/:id/apps", controller.AdminUserApps)
+			admin.PUT("/users/:id/suspend", controller.AdminUserSuspend)
+			admin.DELETE("/users/:id/suspend", controller.AdminUserUnsuspend)
+			admin.POST("/users/:id/password/reset", controller.AdminUserPasswordReset)
+
+			admin.GET("/apps", controller.AdminAppList)
+			admin.DELETE("/apps/:appid", controller.AdminAppDel)
+
+			admin.GET("/audit", controller.AdminAuditList)
+			admin.GET("/audit/export", controller.AdminAuditExport)
+
+			admin.GET("/cache", controller.CacheStats)
 		}
 
 		forget := r.Group("/forget")
@@ -79,6 +119,7 @@ func initRoute(r *gin.Engine) {
 
 		v1 := r.Group("/v1")
 		{
+			v1.Use(middleware.RateLimit())
 			v1.GET("/login", version_one.Login)
 			v1.POST("/code", middleware.AuthPermission(), version_one.Code)
 			v1.POST("/info", version_one.Info)
@@ -92,5 +133,5 @@ func initRoute(r *gin.Engine) {
 func noRoute(c *gin.Context) {
 	api := apiutil.New(c)
 
-	api.FailWithHttpCode(404, "Route not exists")
+	api.Abort(apiutil.CodeRouteNotFound, "Route not exists", "route.not_exists")
 }
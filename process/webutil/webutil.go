@@ -5,10 +5,11 @@ import (
 	"os"
 
 	"github.com/gin-gonic/gin"
+	"github.com/soxft/openid-go/app/service"
 	"github.com/soxft/openid-go/config"
 )
 
-func Init() {
+func Init(s *service.Services) {
 	log.Printf("[INFO] Web initailizing...")
 
 	log.SetOutput(os.Stdout)
@@ -19,8 +20,7 @@ func Init() {
 	}
 
 	// init gin
-	r := gin.New()
-	initRoute(r)
+	r := Engine(s)
 
 	log.Printf("[INFO] Web initailizing success, running at %s ", config.Server.Addr)
 	if err := r.Run(config.Server.Addr); err != nil {
@@ -31,3 +31,11 @@ func Init() {
 	// 	log.Panic(err)
 	// }
 }
+
+// Engine
+// @description 构造注册好全部路由的 gin.Engine, 不监听端口
+func Engine(s *service.Services) *gin.Engine {
+	r := gin.New()
+	initRoute(r, s)
+	return r
+}